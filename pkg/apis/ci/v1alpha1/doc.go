@@ -0,0 +1,5 @@
+// Package v1alpha1 contains the API types for configuring Tekton CI.
+//
+// +k8s:deepcopy-gen=package
+// +groupName=tekton-ci.gitops-tools.dev
+package v1alpha1
@@ -0,0 +1,103 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// Repository declares a repository that hooks are processed for, and the
+// configuration for the PipelineRuns that are created.
+//
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type Repository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RepositorySpec   `json:"spec"`
+	Status RepositoryStatus `json:"status,omitempty"`
+}
+
+// RepositorySpec is the desired configuration for a Repository.
+type RepositorySpec struct {
+	// URL is the URL of the repository e.g.
+	// https://github.com/my-org/my-repo.git
+	URL string `json:"url"`
+	// Driver is the go-scm driver for the Git hosting service e.g. github,
+	// gitlab, defaults to github.
+	Driver string `json:"driver,omitempty"`
+	// ServerURL is the server URL for the go-scm driver, if the repository is
+	// not hosted on the public service e.g.
+	// https://github.example.com
+	ServerURL string `json:"serverURL,omitempty"`
+	// WebhookSecretRef references the key in a Secret with the shared secret
+	// for validating hooks.
+	WebhookSecretRef *SecretKeyReference `json:"webhookSecretRef,omitempty"`
+	// TokenRef references the key in a Secret with the API token for
+	// accessing the repository.
+	TokenRef *SecretKeyReference `json:"tokenRef,omitempty"`
+	// CloneSecret is the name of a basic-auth or ssh-auth Secret with the
+	// credentials for cloning the repository, ssh-auth Secrets must have a
+	// "known_hosts" key.
+	CloneSecret string `json:"cloneSecret,omitempty"`
+	// Pipelines lists the paths to the pipeline definitions that are
+	// processed, if this is empty, all definitions are processed.
+	Pipelines []string `json:"pipelines,omitempty"`
+	// Defaults overrides the configuration for the created PipelineRuns.
+	Defaults RepositoryDefaults `json:"defaults,omitempty"`
+}
+
+// SecretKeyReference references a key in a Secret in the same namespace as
+// the Repository.
+type SecretKeyReference struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// RepositoryDefaults overrides the configuration for the PipelineRuns created
+// for a Repository.
+type RepositoryDefaults struct {
+	ArchiverImage      string             `json:"archiverImage,omitempty"`
+	ArchiveURL         string             `json:"archiveURL,omitempty"`
+	PipelineRunPrefix  string             `json:"pipelineRunPrefix,omitempty"`
+	ServiceAccountName string             `json:"serviceAccountName,omitempty"`
+	VolumeSize         *resource.Quantity `json:"volumeSize,omitempty"`
+}
+
+// RepositoryStatus is the observed state of a Repository.
+type RepositoryStatus struct {
+	duckv1.Status `json:",inline"`
+
+	// FullName is the org/repo parsed from the URL, this is what hooks are
+	// matched against.
+	FullName string `json:"fullName,omitempty"`
+}
+
+var repositoryCondSet = apis.NewLivingConditionSet()
+
+// MarkReady sets the Ready condition to True.
+func (s *RepositoryStatus) MarkReady() {
+	repositoryCondSet.Manage(s).MarkTrue(apis.ConditionReady)
+}
+
+// MarkNotReady sets the Ready condition to False.
+func (s *RepositoryStatus) MarkNotReady(reason, messageFormat string, messageA ...interface{}) {
+	repositoryCondSet.Manage(s).MarkFalse(apis.ConditionReady, reason, messageFormat, messageA...)
+}
+
+// IsReady returns true if the Ready condition is True.
+func (s *RepositoryStatus) IsReady() bool {
+	return repositoryCondSet.Manage(s).IsHappy()
+}
+
+// RepositoryList is a list of Repositories.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type RepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Repository `json:"items"`
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// TokenKey is the key in the Secret with the token that requests are
+// authenticated with.
+const TokenKey = "token"
+
+// tokenTTL is how long the token is cached for before the Secret is read
+// again.
+const tokenTTL = time.Minute
+
+// TokenHandler implements the http.Handler interface, it serves requests with
+// a bearer token that matches the token in a Secret, and rejects other
+// requests.
+//
+// The token is cached for the tokenTTL, so that the token can be rotated
+// without restarting, without reading the Secret for each request. If the
+// Secret can't be read because of an error from the API, the cached token is
+// used until it can be, if the Secret is deleted, or has no token, all
+// requests are rejected.
+type TokenHandler struct {
+	coreClient kubernetes.Interface
+	namespace  string
+	name       string
+	next       http.Handler
+	log        logger.Logger
+	now        func() time.Time
+
+	mu sync.Mutex
+	// The token from the Secret, this is nil if there is no valid token.
+	token   []byte
+	fetched time.Time
+}
+
+// New creates and returns a new TokenHandler that authenticates requests with
+// the token in the named Secret in the namespace, before serving them with the
+// handler.
+func New(c kubernetes.Interface, namespace, name string, h http.Handler, l logger.Logger) *TokenHandler {
+	return &TokenHandler{coreClient: c, namespace: namespace, name: name, next: h, log: l, now: time.Now}
+}
+
+// ServeHTTP implements the http.Handler interface.
+//
+// Requests without a bearer token are rejected before the token is read.
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if got == "" || got == r.Header.Get("Authorization") {
+		unauthorized(w)
+		return
+	}
+	want, err := h.currentToken(r.Context())
+	if err != nil {
+		h.log.Errorf("error fetching the token: %s", err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if want == nil || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+		unauthorized(w)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// currentToken returns the cached token, or reads the token from the Secret
+// if the cached token has expired, the token is nil if there is no valid
+// token.
+//
+// The lock isn't held while the Secret is read, so that requests with a
+// cached token aren't blocked by a slow read.
+func (h *TokenHandler) currentToken(ctx context.Context) ([]byte, error) {
+	h.mu.Lock()
+	cached, fetched := h.token, h.fetched
+	h.mu.Unlock()
+	if !fetched.IsZero() && h.now().Sub(fetched) < tokenTTL {
+		return cached, nil
+	}
+	token, err := h.readToken(ctx)
+	if err != nil {
+		if !fetched.IsZero() {
+			h.log.Errorf("error fetching the token, using the cached token: %s", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	h.mu.Lock()
+	h.token, h.fetched = token, h.now()
+	h.mu.Unlock()
+	return token, nil
+}
+
+// readToken reads the token from the Secret, if the Secret doesn't exist, or
+// has no token, the token is nil, and no error is returned, so that deleting
+// the token revokes it.
+func (h *TokenHandler) readToken(ctx context.Context) ([]byte, error) {
+	secret, err := h.coreClient.CoreV1().Secrets(h.namespace).Get(ctx, h.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		h.log.Errorf("the token Secret %s/%s was not found", h.namespace, h.name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the token Secret %s/%s: %w", h.namespace, h.name, err)
+	}
+	token := secret.Data[TokenKey]
+	if len(token) == 0 {
+		h.log.Errorf("no %s in the token Secret %s/%s", TokenKey, h.namespace, h.name)
+		return nil, nil
+	}
+	return token, nil
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNS = "testing"
+
+func TestTokenHandler(t *testing.T) {
+	authTests := []struct {
+		name     string
+		secret   *corev1.Secret
+		header   string
+		wantCode int
+	}{
+		{"valid token", makeSecret("secret-token"), "Bearer secret-token", http.StatusOK},
+		{"invalid token", makeSecret("secret-token"), "Bearer other-token", http.StatusUnauthorized},
+		{"token without bearer", makeSecret("secret-token"), "other-token", http.StatusUnauthorized},
+		{"no token", makeSecret("secret-token"), "", http.StatusUnauthorized},
+		{"empty bearer token", makeSecret("secret-token"), "Bearer ", http.StatusUnauthorized},
+		{"empty token in secret", makeSecret(""), "Bearer secret-token", http.StatusUnauthorized},
+		{"missing secret", nil, "Bearer secret-token", http.StatusUnauthorized},
+		{"missing secret with no token", nil, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range authTests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tt.secret != nil {
+				client = fake.NewSimpleClientset(tt.secret)
+			}
+			h := makeHandler(t, client)
+
+			if code := serve(h, tt.header); code != tt.wantCode {
+				t.Fatalf("got %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTokenHandlerCachesToken(t *testing.T) {
+	client := fake.NewSimpleClientset(makeSecret("secret-token"))
+	h := makeHandler(t, client)
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if code := serve(h, "Bearer secret-token"); code != http.StatusOK {
+			t.Fatalf("got %d, want %d", code, http.StatusOK)
+		}
+	}
+	if l := len(client.Actions()); l != 1 {
+		t.Fatalf("got %d reads of the Secret, want 1", l)
+	}
+
+	// The token is rotated, and then the Secret can't be read.
+	if _, err := client.CoreV1().Secrets(testNS).Update(context.TODO(), makeSecret("new-token"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(tokenTTL)
+	if code := serve(h, "Bearer new-token"); code != http.StatusOK {
+		t.Fatalf("got %d, want %d", code, http.StatusOK)
+	}
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("unavailable")
+	})
+	now = now.Add(tokenTTL)
+	if code := serve(h, "Bearer new-token"); code != http.StatusOK {
+		t.Fatalf("got %d with the cached token, want %d", code, http.StatusOK)
+	}
+	if code := serve(h, "Bearer secret-token"); code != http.StatusUnauthorized {
+		t.Fatalf("got %d with the old token, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestTokenHandlerWithUnreadableSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(makeSecret("secret-token"))
+	client.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("unavailable")
+	})
+	h := makeHandler(t, client)
+
+	if code := serve(h, "Bearer secret-token"); code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestTokenHandlerRevokesDeletedTokens(t *testing.T) {
+	revokeTests := []struct {
+		name   string
+		revoke func(*fake.Clientset) error
+	}{
+		{"deleted secret", func(c *fake.Clientset) error {
+			return c.CoreV1().Secrets(testNS).Delete(context.TODO(), "tekton-ci-admin", metav1.DeleteOptions{})
+		}},
+		{"empty token", func(c *fake.Clientset) error {
+			_, err := c.CoreV1().Secrets(testNS).Update(context.TODO(), makeSecret(""), metav1.UpdateOptions{})
+			return err
+		}},
+	}
+
+	for _, tt := range revokeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(makeSecret("secret-token"))
+			h := makeHandler(t, client)
+			now := time.Now()
+			h.now = func() time.Time { return now }
+			if code := serve(h, "Bearer secret-token"); code != http.StatusOK {
+				t.Fatalf("got %d, want %d", code, http.StatusOK)
+			}
+
+			if err := tt.revoke(client); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(tokenTTL)
+
+			if code := serve(h, "Bearer secret-token"); code != http.StatusUnauthorized {
+				t.Fatalf("got %d with the revoked token, want %d", code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func makeHandler(t *testing.T, client *fake.Clientset) *TokenHandler {
+	return New(client, testNS, "tekton-ci-admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel)).Sugar())
+}
+
+func serve(h http.Handler, header string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/trigger", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func makeSecret(token string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tekton-ci-admin", Namespace: testNS},
+		Data:       map[string][]byte{TokenKey: []byte(token)},
+	}
+}
@@ -3,6 +3,7 @@ package cel
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/google/cel-go/cel"
@@ -12,6 +13,41 @@ import (
 	"github.com/jenkins-x/go-scm/scm"
 )
 
+// The values of the CI_PIPELINE_SOURCE variable, these match the values used
+// by GitLab CI.
+const (
+	PushSource         = "push"
+	MergeRequestSource = "merge_request_event"
+	ScheduleSource     = "schedule"
+	APISource          = "api"
+)
+
+// Option configures the variables that expressions are evaluated with.
+type Option func(vars map[string]string)
+
+// WithPipelineSource sets the CI_PIPELINE_SOURCE variable, for pipelines that
+// are not triggered by the hook e.g. scheduled pipelines.
+func WithPipelineSource(s string) Option {
+	return func(vars map[string]string) {
+		vars["CI_PIPELINE_SOURCE"] = s
+	}
+}
+
+// WithPipelineID sets the CI_PIPELINE_ID variable, this is the ID of the hook
+// that the pipeline is run for, which defaults to the GUID of the hook.
+func WithPipelineID(id string) Option {
+	return func(vars map[string]string) {
+		vars["CI_PIPELINE_ID"] = id
+	}
+}
+
+// WithJobName sets the CI_JOB_NAME variable, for the expressions in a job.
+func WithJobName(name string) Option {
+	return func(vars map[string]string) {
+		vars["CI_JOB_NAME"] = name
+	}
+}
+
 // Context makes it easy to execute CEL expressions on a hook body.
 type Context struct {
 	env  *cel.Env
@@ -19,12 +55,12 @@ type Context struct {
 }
 
 // New creates and returns a Context for evaluating expressions.
-func New(hook interface{}) (*Context, error) {
+func New(hook interface{}, opts ...Option) (*Context, error) {
 	env, err := makeCelEnv()
 	if err != nil {
 		return nil, err
 	}
-	ctx, err := makeEvalContext(hook)
+	ctx, err := makeEvalContext(hook, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +70,30 @@ func New(hook interface{}) (*Context, error) {
 	}, nil
 }
 
+// With returns a copy of the Context with the options applied to the
+// variables.
+func (c *Context) With(opts ...Option) *Context {
+	vars := c.Vars()
+	for _, o := range opts {
+		o(vars)
+	}
+	data := map[string]interface{}{}
+	for k, v := range c.Data {
+		data[k] = v
+	}
+	data["vars"] = vars
+	return &Context{env: c.env, Data: data}
+}
+
+// Vars returns a copy of the variables that expressions are evaluated with.
+func (c *Context) Vars() map[string]string {
+	vars := map[string]string{}
+	for k, v := range c.Data["vars"].(map[string]string) {
+		vars[k] = v
+	}
+	return vars
+}
+
 // Evaluate evaluates the provided expression and returns the result.
 func (c *Context) Evaluate(expr string) (ref.Val, error) {
 	return evaluate(expr, c.env, c.Data)
@@ -76,12 +136,15 @@ func makeCelEnv() (*cel.Env, error) {
 			decls.NewIdent("vars", decls.Dyn, nil)))
 }
 
-func makeEvalContext(hook interface{}) (map[string]interface{}, error) {
+func makeEvalContext(hook interface{}, opts ...Option) (map[string]interface{}, error) {
 	m, err := hookToMap(hook)
 	if err != nil {
 		return nil, err
 	}
 	vars := varsFromHook(hook)
+	for _, o := range opts {
+		o(vars)
+	}
 	return map[string]interface{}{"hook": m, "vars": vars}, nil
 }
 
@@ -106,25 +169,107 @@ func valToString(v ref.Val) (string, error) {
 	return "", fmt.Errorf("unknown result type %T, expression must be a string", v)
 }
 
+// varsFromHook returns the GitLab CI compatible predefined variables for the
+// hook.
+//
+// Variables that don't apply to the hook are empty, e.g. CI_COMMIT_TAG for
+// pushes to a branch, or the CI_MERGE_REQUEST_ variables for pushes, so that
+// expressions can check for them.
 func varsFromHook(h interface{}) map[string]string {
 	switch v := h.(type) {
 	case *scm.PullRequestHook:
-		return map[string]string{
+		vars := map[string]string{
 			"CI_COMMIT_SHA":       v.PullRequest.Sha,
-			"CI_COMMIT_SHORT_SHA": v.PullRequest.Sha[0:7],
+			"CI_COMMIT_SHORT_SHA": shortSHA(v.PullRequest.Sha),
 			"CI_COMMIT_BRANCH":    v.PullRequest.Source,
+			"CI_COMMIT_REF_NAME":  v.PullRequest.Source,
+			"CI_COMMIT_TAG":       "",
+			"CI_COMMIT_MESSAGE":   "",
+			"CI_COMMIT_AUTHOR":    "",
+			"CI_PIPELINE_ID":      v.GUID,
+			"CI_PIPELINE_SOURCE":  MergeRequestSource,
 		}
+		addRepoVars(vars, v.Repo)
+		addMergeRequestVars(vars, &v.PullRequest, v.Repo)
+		return vars
 	case *scm.PushHook:
-		return map[string]string{
+		vars := map[string]string{
 			"CI_COMMIT_SHA":       v.Commit.Sha,
-			"CI_COMMIT_SHORT_SHA": v.Commit.Sha[0:7],
-			"CI_COMMIT_BRANCH":    branchFromRef(v.Ref),
+			"CI_COMMIT_SHORT_SHA": shortSHA(v.Commit.Sha),
+			"CI_COMMIT_BRANCH":    "",
+			"CI_COMMIT_REF_NAME":  scm.TrimRef(v.Ref),
+			"CI_COMMIT_TAG":       "",
+			"CI_COMMIT_MESSAGE":   v.Commit.Message,
+			"CI_COMMIT_AUTHOR":    author(v.Commit.Author),
+			"CI_PIPELINE_ID":      v.GUID,
+			"CI_PIPELINE_SOURCE":  PushSource,
+		}
+		if scm.IsTag(v.Ref) {
+			vars["CI_COMMIT_TAG"] = scm.TrimRef(v.Ref)
+		} else {
+			vars["CI_COMMIT_BRANCH"] = scm.TrimRef(v.Ref)
 		}
+		addRepoVars(vars, v.Repo)
+		addMergeRequestVars(vars, &scm.PullRequest{}, scm.Repository{})
+		return vars
+	}
+	return map[string]string{}
+}
+
+func addRepoVars(vars map[string]string, r scm.Repository) {
+	vars["CI_PROJECT_NAME"] = r.Name
+	vars["CI_PROJECT_NAMESPACE"] = r.Namespace
+	vars["CI_PROJECT_PATH"] = projectPath(r)
+	vars["CI_PROJECT_URL"] = r.Link
+	vars["CI_DEFAULT_BRANCH"] = r.Branch
+}
+
+// addMergeRequestVars adds the CI_MERGE_REQUEST_ variables for the pull
+// request to the repository.
+func addMergeRequestVars(vars map[string]string, pr *scm.PullRequest, r scm.Repository) {
+	iid := ""
+	if pr.Number != 0 {
+		iid = strconv.Itoa(pr.Number)
+	}
+	labels := []string{}
+	for _, l := range pr.Labels {
+		labels = append(labels, l.Name)
 	}
-	return nil
+	vars["CI_MERGE_REQUEST_IID"] = iid
+	vars["CI_MERGE_REQUEST_TITLE"] = pr.Title
+	vars["CI_MERGE_REQUEST_DESCRIPTION"] = pr.Body
+	vars["CI_MERGE_REQUEST_LABELS"] = strings.Join(labels, ",")
+	vars["CI_MERGE_REQUEST_PROJECT_PATH"] = projectPath(r)
+	vars["CI_MERGE_REQUEST_PROJECT_URL"] = r.Link
+	vars["CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"] = pr.Source
+	vars["CI_MERGE_REQUEST_SOURCE_BRANCH_SHA"] = pr.Sha
+	vars["CI_MERGE_REQUEST_SOURCE_PROJECT_PATH"] = projectPath(pr.Head.Repo)
+	vars["CI_MERGE_REQUEST_SOURCE_PROJECT_URL"] = pr.Head.Repo.Link
+	vars["CI_MERGE_REQUEST_TARGET_BRANCH_NAME"] = pr.Target
+	vars["CI_MERGE_REQUEST_TARGET_BRANCH_SHA"] = pr.Base.Sha
 }
 
-func branchFromRef(s string) string {
-	parts := strings.Split(s, "/")
-	return parts[len(parts)-1]
+func projectPath(r scm.Repository) string {
+	if r.FullName != "" {
+		return r.FullName
+	}
+	if r.Name == "" {
+		return ""
+	}
+	return r.Namespace + "/" + r.Name
+}
+
+// author returns the author in the same form as GitLab, "name <email>".
+func author(s scm.Signature) string {
+	if s.Email == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+func shortSHA(s string) string {
+	if len(s) < 7 {
+		return s
+	}
+	return s[0:7]
 }
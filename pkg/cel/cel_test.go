@@ -7,6 +7,7 @@ import (
 	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jenkins-x/go-scm/scm"
 
 	"github.com/gitops-tools/tekton-ci/test/hook"
 )
@@ -142,14 +143,60 @@ func TestEvalContextVars(t *testing.T) {
 		want      map[string]string
 	}{
 		{"../testdata/github_pull_request.json", "pull_request", map[string]string{
-			"CI_COMMIT_SHA":       "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
-			"CI_COMMIT_SHORT_SHA": "ec26c3e",
-			"CI_COMMIT_BRANCH":    "changes",
+			"CI_COMMIT_SHA":                        "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+			"CI_COMMIT_SHORT_SHA":                  "ec26c3e",
+			"CI_COMMIT_BRANCH":                     "changes",
+			"CI_COMMIT_REF_NAME":                   "changes",
+			"CI_COMMIT_TAG":                        "",
+			"CI_COMMIT_MESSAGE":                    "",
+			"CI_COMMIT_AUTHOR":                     "",
+			"CI_PIPELINE_ID":                       "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			"CI_PIPELINE_SOURCE":                   "merge_request_event",
+			"CI_PROJECT_NAME":                      "Hello-World",
+			"CI_PROJECT_NAMESPACE":                 "Codertocat",
+			"CI_PROJECT_PATH":                      "Codertocat/Hello-World",
+			"CI_PROJECT_URL":                       "https://github.com/Codertocat/Hello-World",
+			"CI_DEFAULT_BRANCH":                    "master",
+			"CI_MERGE_REQUEST_IID":                 "2",
+			"CI_MERGE_REQUEST_TITLE":               "Update the README with new information.",
+			"CI_MERGE_REQUEST_DESCRIPTION":         "This is a pretty simple change that we need to pull into master.",
+			"CI_MERGE_REQUEST_LABELS":              "",
+			"CI_MERGE_REQUEST_PROJECT_PATH":        "Codertocat/Hello-World",
+			"CI_MERGE_REQUEST_PROJECT_URL":         "https://github.com/Codertocat/Hello-World",
+			"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME":  "changes",
+			"CI_MERGE_REQUEST_SOURCE_BRANCH_SHA":   "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+			"CI_MERGE_REQUEST_SOURCE_PROJECT_PATH": "Codertocat/Hello-World",
+			"CI_MERGE_REQUEST_SOURCE_PROJECT_URL":  "https://github.com/Codertocat/Hello-World",
+			"CI_MERGE_REQUEST_TARGET_BRANCH_NAME":  "master",
+			"CI_MERGE_REQUEST_TARGET_BRANCH_SHA":   "f95f852bd8fca8fcc58a9a2d6c842781e32a215e",
 		}},
 		{"../testdata/github_push.json", "push", map[string]string{
-			"CI_COMMIT_SHA":       "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
-			"CI_COMMIT_SHORT_SHA": "6113728",
-			"CI_COMMIT_BRANCH":    "simple-tag",
+			"CI_COMMIT_SHA":                        "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+			"CI_COMMIT_SHORT_SHA":                  "6113728",
+			"CI_COMMIT_BRANCH":                     "",
+			"CI_COMMIT_REF_NAME":                   "simple-tag",
+			"CI_COMMIT_TAG":                        "simple-tag",
+			"CI_COMMIT_MESSAGE":                    "",
+			"CI_COMMIT_AUTHOR":                     "",
+			"CI_PIPELINE_ID":                       "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			"CI_PIPELINE_SOURCE":                   "push",
+			"CI_PROJECT_NAME":                      "Hello-World",
+			"CI_PROJECT_NAMESPACE":                 "Codertocat",
+			"CI_PROJECT_PATH":                      "Codertocat/Hello-World",
+			"CI_PROJECT_URL":                       "https://github.com/Codertocat/Hello-World",
+			"CI_DEFAULT_BRANCH":                    "master",
+			"CI_MERGE_REQUEST_IID":                 "",
+			"CI_MERGE_REQUEST_TITLE":               "",
+			"CI_MERGE_REQUEST_DESCRIPTION":         "",
+			"CI_MERGE_REQUEST_LABELS":              "",
+			"CI_MERGE_REQUEST_PROJECT_PATH":        "",
+			"CI_MERGE_REQUEST_PROJECT_URL":         "",
+			"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME":  "",
+			"CI_MERGE_REQUEST_SOURCE_BRANCH_SHA":   "",
+			"CI_MERGE_REQUEST_SOURCE_PROJECT_PATH": "",
+			"CI_MERGE_REQUEST_SOURCE_PROJECT_URL":  "",
+			"CI_MERGE_REQUEST_TARGET_BRANCH_NAME":  "",
+			"CI_MERGE_REQUEST_TARGET_BRANCH_SHA":   "",
 		}},
 	}
 
@@ -167,6 +214,94 @@ func TestEvalContextVars(t *testing.T) {
 	}
 }
 
+func TestContextWithPipelineSource(t *testing.T) {
+	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
+	ctx, err := New(hook, WithPipelineSource(ScheduleSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ctx.Evaluate("vars.CI_PIPELINE_SOURCE == 'schedule'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != types.True {
+		t.Fatalf("got %#v, want %#v\n", result, types.True)
+	}
+}
+
+func TestEvalContextVarsForBranchPush(t *testing.T) {
+	ctx, err := makeEvalContext(&scm.PushHook{
+		Ref: "refs/heads/feature/testing",
+		Commit: scm.Commit{
+			Sha:     "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+			Message: "Fix all the bugs",
+			Author:  scm.Signature{Name: "Monalisa Octocat", Email: "support@github.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := ctx["vars"].(map[string]string)
+	want := map[string]string{
+		"CI_COMMIT_BRANCH":   "feature/testing",
+		"CI_COMMIT_REF_NAME": "feature/testing",
+		"CI_COMMIT_TAG":      "",
+		"CI_COMMIT_MESSAGE":  "Fix all the bugs",
+		"CI_COMMIT_AUTHOR":   "Monalisa Octocat <support@github.com>",
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("got %s = %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+// CI_COMMIT_BRANCH was the last part of the ref for tags, it's empty for tags
+// in GitLab, and tags are in CI_COMMIT_TAG.
+func TestEvalContextVarsForTagPush(t *testing.T) {
+	ctx, err := makeEvalContext(&scm.PushHook{
+		Ref:    "refs/tags/v1.0.0",
+		Commit: scm.Commit{Sha: "6113728f27ae82c7b1a177c8d03f9e96e0adf246"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := ctx["vars"].(map[string]string)
+	want := map[string]string{
+		"CI_COMMIT_BRANCH":   "",
+		"CI_COMMIT_REF_NAME": "v1.0.0",
+		"CI_COMMIT_TAG":      "v1.0.0",
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("got %s = %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+func TestContextWith(t *testing.T) {
+	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
+	ctx, err := New(hook, WithPipelineID("test-id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := ctx.With(WithJobName("test"))
+
+	result, err := job.Evaluate("vars.CI_JOB_NAME == 'test' && vars.CI_PIPELINE_ID == 'test-id'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != types.True {
+		t.Fatalf("got %#v, want %#v\n", result, types.True)
+	}
+	if _, ok := ctx.Vars()["CI_JOB_NAME"]; ok {
+		t.Fatal("With() modified the original context")
+	}
+}
+
 // TODO move this and share via a specific test package.
 func matchError(t *testing.T, s string, e error) bool {
 	t.Helper()
@@ -37,25 +37,33 @@ func Parse(in io.Reader) (*Pipeline, error) {
 func parseRaw(raw map[string]interface{}) (*Pipeline, error) {
 	cfg := &Pipeline{}
 	for k, v := range raw {
+		var err error
 		switch k {
 		case "image":
-			cfg.Image = v.(string)
+			cfg.Image, err = stringValue("image", v)
 		case "variables":
-			cfg.Variables = stringMap(v)
+			cfg.Variables, err = stringMap("variables", v)
 		case "before_script":
-			cfg.BeforeScript = stringSlice(v)
+			cfg.BeforeScript, err = stringSlice("before_script", v)
 		case "after_script":
-			cfg.AfterScript = stringSlice(v)
+			cfg.AfterScript, err = stringSlice("after_script", v)
 		case "stages":
-			cfg.Stages = stringSlice(v)
+			cfg.Stages, err = stringSlice("stages", v)
 		case "tekton":
-			cfg.TektonConfig = parseTektonConfig(v)
+			cfg.TektonConfig, err = parseTektonConfig(v)
+		case "git":
+			cfg.Git, err = parseGitConfig(v)
+		case "schedules":
+			cfg.Schedules, err = parseSchedules(v)
 		default:
-			task, err := parseTask(k, v)
-			if err != nil {
-				return nil, err
+			var task *Task
+			task, err = parseTask(k, v)
+			if err == nil {
+				cfg.Tasks = append(cfg.Tasks, task)
 			}
-			cfg.Tasks = append(cfg.Tasks, task)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 	applyDefaultsToPipeline(cfg)
@@ -68,50 +76,187 @@ func applyDefaultsToPipeline(p *Pipeline) {
 	}
 }
 
-func stringMap(vars interface{}) map[string]string {
+// The values are checked before they're used, so that invalid pipeline
+// definitions are reported as errors, rather than panicking.
+
+func stringValue(name string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s: %v is not a string", name, v)
+	}
+	return s, nil
+}
+
+func boolValue(name string, v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid %s: %v is not a boolean", name, v)
+	}
+	return b, nil
+}
+
+func mapValue(name string, v interface{}) (map[string]interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: %v is not a map", name, v)
+	}
+	return m, nil
+}
+
+func listValue(name string, v interface{}) ([]interface{}, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: %v is not a list", name, v)
+	}
+	return l, nil
+}
+
+func stringMap(name string, vars interface{}) (map[string]string, error) {
+	m, err := mapValue(name, vars)
+	if err != nil {
+		return nil, err
+	}
 	newVars := map[string]string{}
-	for k, v := range vars.(map[string]interface{}) {
-		newVars[k] = v.(string)
+	for k, v := range m {
+		s, err := stringValue(name+" "+k, v)
+		if err != nil {
+			return nil, err
+		}
+		newVars[k] = s
 	}
-	return newVars
+	return newVars, nil
 }
 
-func stringSlice(vars interface{}) []string {
+func stringSlice(name string, vars interface{}) ([]string, error) {
+	l, err := listValue(name, vars)
+	if err != nil {
+		return nil, err
+	}
 	strings := []string{}
-	for _, v := range vars.([]interface{}) {
-		strings = append(strings, v.(string))
+	for _, v := range l {
+		s, err := stringValue(name, v)
+		if err != nil {
+			return nil, err
+		}
+		strings = append(strings, s)
+	}
+	return strings, nil
+}
+
+// parseStrings sets the strings to the values of the fields with the same
+// keys, it returns an error if any of the values is not a string.
+func parseStrings(name string, fields map[string]interface{}, strings map[string]*string) error {
+	for k, v := range fields {
+		p, ok := strings[k]
+		if !ok {
+			continue
+		}
+		s, err := stringValue(name+" "+k, v)
+		if err != nil {
+			return err
+		}
+		*p = s
 	}
-	return strings
+	return nil
 }
 
-func parseTektonConfig(v interface{}) *TektonConfig {
+func parseTektonConfig(v interface{}) (*TektonConfig, error) {
+	fields, err := mapValue("tekton", v)
+	if err != nil {
+		return nil, err
+	}
 	t := &TektonConfig{}
-	for k, v := range v.(map[string]interface{}) {
-		if k == "serviceAccountName" {
-			t.ServiceAccountName = v.(string)
+	if err := parseStrings("tekton", fields, map[string]*string{"serviceAccountName": &t.ServiceAccountName}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseGitConfig(v interface{}) (*GitConfig, error) {
+	fields, err := mapValue("git", v)
+	if err != nil {
+		return nil, err
+	}
+	g := &GitConfig{}
+	for k, v := range fields {
+		var err error
+		switch k {
+		case "depth":
+			depth, ok := v.(float64)
+			if !ok || depth < 0 || depth != float64(int(depth)) {
+				return nil, fmt.Errorf("invalid git depth: %v", v)
+			}
+			d := int(depth)
+			g.Depth = &d
+		case "submodules":
+			submodules := fmt.Sprint(v)
+			if submodules != "true" && submodules != "recursive" && submodules != "false" {
+				return nil, fmt.Errorf("invalid git submodules: %v", v)
+			}
+			g.Submodules = submodules
+		case "sparse_checkout":
+			g.SparseCheckout, err = stringSlice("git sparse_checkout", v)
+		case "lfs":
+			g.LFS, err = boolValue("git lfs", v)
+		case "fetch_tags":
+			g.FetchTags, err = boolValue("git fetch_tags", v)
+		case "merge_base":
+			g.MergeBase, err = boolValue("git merge_base", v)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
-	return t
+	return g, nil
+}
+
+func parseSchedules(v interface{}) ([]Schedule, error) {
+	items, err := listValue("schedules", v)
+	if err != nil {
+		return nil, err
+	}
+	schedules := []Schedule{}
+	for _, raw := range items {
+		fields, err := mapValue("schedule", raw)
+		if err != nil {
+			return nil, err
+		}
+		s := Schedule{}
+		if err := parseStrings("schedule", fields, map[string]*string{"name": &s.Name, "cron": &s.Cron, "branch": &s.Branch}); err != nil {
+			return nil, err
+		}
+		if s.Name == "" || s.Cron == "" {
+			return nil, fmt.Errorf("invalid schedule %#v: missing name or cron", s.Name)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
 }
 
 func parseTask(name string, v interface{}) (*Task, error) {
+	fields, err := mapValue(fmt.Sprintf("task %#v", name), v)
+	if err != nil {
+		return nil, err
+	}
 	t := &Task{Name: name}
-	for k, v := range v.(map[string]interface{}) {
+	for k, v := range fields {
+		var err error
 		switch k {
 		case "stage":
-			t.Stage = v.(string)
+			t.Stage, err = stringValue("stage", v)
 		case "script":
-			t.Script = stringSlice(v)
+			t.Script, err = stringSlice("script", v)
 		case "tekton":
-			tekton, err := parseTektonTask(v)
-			if err != nil {
-				return nil, err
-			}
-			t.Tekton = tekton
+			t.Tekton, err = parseTektonTask(v)
 		case "rules":
-			t.Rules = parseRules(v)
+			t.Rules, err = parseRules(v)
 		case "artifacts":
-			t.Artifacts = parseArtifacts(v)
+			t.Artifacts, err = parseArtifacts(v)
+		case "when":
+			t.When, err = stringValue("when", v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid task %#v: %w", name, err)
 		}
 	}
 	if len(t.Script) == 0 && t.Tekton == nil {
@@ -126,56 +271,89 @@ func parseTask(name string, v interface{}) (*Task, error) {
 	return t, nil
 }
 
-func parseArtifacts(v interface{}) Artifacts {
+func parseArtifacts(v interface{}) (Artifacts, error) {
 	a := Artifacts{Paths: []string{}}
-	for k, v := range v.(map[string]interface{}) {
-		if k == "paths" {
-			a.Paths = stringSlice(v)
+	fields, err := mapValue("artifacts", v)
+	if err != nil {
+		return a, err
+	}
+	for k, v := range fields {
+		var err error
+		switch k {
+		case "paths":
+			a.Paths, err = stringSlice("artifacts paths", v)
+		case "reports":
+			a.Reports, err = parseReports(v)
+		}
+		if err != nil {
+			return a, err
 		}
 	}
-	return a
+	return a, nil
+}
+
+// The JUnit reports can be a single path, or a list of paths.
+func parseReports(v interface{}) (Reports, error) {
+	r := Reports{}
+	fields, err := mapValue("artifacts reports", v)
+	if err != nil {
+		return r, err
+	}
+	for k, v := range fields {
+		if k == "junit" {
+			if s, ok := v.(string); ok {
+				r.JUnit = []string{s}
+			} else if r.JUnit, err = stringSlice("junit reports", v); err != nil {
+				return r, err
+			}
+		}
+	}
+	return r, nil
 }
 
 func parseTektonTask(v interface{}) (*TektonTask, error) {
+	fields, err := mapValue("tekton", v)
+	if err != nil {
+		return nil, err
+	}
 	t := &TektonTask{}
-	for k, v := range v.(map[string]interface{}) {
+	for k, v := range fields {
+		var err error
 		switch k {
 		case "jobs":
-			jobs, err := parseTektonTaskJobs(v)
-			if err != nil {
-				return nil, err
-			}
-			t.Jobs = jobs
+			t.Jobs, err = parseTektonTaskJobs(v)
 		case "taskRef":
-			t.TaskRef = v.(string)
+			t.TaskRef, err = stringValue("tekton taskRef", v)
 		case "image":
-			t.Image = v.(string)
+			t.Image, err = stringValue("tekton image", v)
 		case "params":
-			params, err := parseTektonTaskParams(v)
-			if err != nil {
-				return nil, err
-			}
-			t.Params = params
+			t.Params, err = parseTektonTaskParams(v)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 	return t, nil
 }
 
-func parseRules(v interface{}) []Rule {
+func parseRules(v interface{}) ([]Rule, error) {
+	items, err := listValue("rules", v)
+	if err != nil {
+		return nil, err
+	}
 	rules := []Rule{}
-	for _, rule := range v.([]interface{}) {
+	for _, rule := range items {
+		fields, err := mapValue("rule", rule)
+		if err != nil {
+			return nil, err
+		}
 		currentRule := Rule{}
-		for k, v := range rule.(map[string]interface{}) {
-			switch k {
-			case "if":
-				currentRule.If = v.(string)
-			case "when":
-				currentRule.When = v.(string)
-			}
+		if err := parseStrings("rule", fields, map[string]*string{"if": &currentRule.If, "when": &currentRule.When}); err != nil {
+			return nil, err
 		}
 		rules = append(rules, currentRule)
 	}
-	return rules
+	return rules, nil
 }
 
 func findStages(tasks []*Task) []string {
@@ -195,19 +373,22 @@ func findStages(tasks []*Task) []string {
 
 // TODO: this should validate params.
 func parseTektonTaskParams(v interface{}) ([]TektonTaskParam, error) {
+	items, err := listValue("tekton params", v)
+	if err != nil {
+		return nil, err
+	}
 	params := []TektonTaskParam{}
-	for _, p := range v.([]interface{}) {
+	for _, p := range items {
+		fields, err := mapValue("Tekton task parameter", p)
+		if err != nil {
+			return nil, err
+		}
 		param := TektonTaskParam{}
-		for k, v := range p.(map[string]interface{}) {
-			switch k {
-			case "name":
-				param.Name = v.(string)
-			case "expr":
-				param.Expression = v.(string)
-			}
+		if err := parseStrings("Tekton task parameter", fields, map[string]*string{"name": &param.Name, "expr": &param.Expression}); err != nil {
+			return nil, err
 		}
 		if param.Expression == "" || param.Name == "" {
-			return nil, fmt.Errorf("bad Tekton task parameter: %#v", v)
+			return nil, fmt.Errorf("bad Tekton task parameter: %#v", p)
 		}
 		params = append(params, param)
 	}
@@ -215,12 +396,15 @@ func parseTektonTaskParams(v interface{}) ([]TektonTaskParam, error) {
 }
 
 func parseTektonTaskJobs(v interface{}) ([]map[string]string, error) {
+	items, err := stringSlice("tekton jobs", v)
+	if err != nil {
+		return nil, err
+	}
 	jobs := []map[string]string{}
-	for _, j := range v.([]interface{}) {
-		// TODO: these should be using , ok syntax and better errors.
-		parts := strings.Split(j.(string), "=")
+	for _, j := range items {
+		parts := strings.Split(j, "=")
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("could not parse %s as an environment variable", j.(string))
+			return nil, fmt.Errorf("could not parse %s as an environment variable", j)
 		}
 		jobs = append(jobs, map[string]string{parts[0]: parts[1]})
 	}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestParse(t *testing.T) {
@@ -93,6 +95,17 @@ func TestParse(t *testing.T) {
 				},
 			},
 		}},
+		{"testdata/manual-task.yaml", &Pipeline{
+			Image:  "golang:latest",
+			Stages: []string{DefaultStage},
+			Tasks: []*Task{
+				{Name: "deploy",
+					Stage:  DefaultStage,
+					Script: []string{`echo "deploying"`},
+					When:   "manual",
+				},
+			},
+		}},
 		{"testdata/simple-with-tekton-image.yaml", &Pipeline{
 			Image:  "alpine",
 			Stages: []string{DefaultStage},
@@ -106,6 +119,60 @@ func TestParse(t *testing.T) {
 				},
 			},
 		}},
+		{"testdata/git-config.yaml", &Pipeline{
+			Image:  "golang:latest",
+			Stages: []string{DefaultStage},
+			Git: &GitConfig{
+				Depth:          intPtr(50),
+				Submodules:     "false",
+				SparseCheckout: []string{"cmd", "pkg"},
+				LFS:            true,
+				FetchTags:      true,
+				MergeBase:      true,
+			},
+			Tasks: []*Task{
+				{Name: "format",
+					Stage:  DefaultStage,
+					Script: []string{`echo "testing"`},
+				},
+			},
+		}},
+		{"testdata/junit-reports.yaml", &Pipeline{
+			Image:  "golang:latest",
+			Stages: []string{DefaultStage},
+			Tasks: []*Task{
+				{Name: "format",
+					Stage:  DefaultStage,
+					Script: []string{`go test ./... 2>&1 | go-junit-report > report.xml`},
+					Artifacts: Artifacts{
+						Paths:   []string{},
+						Reports: Reports{JUnit: []string{"report.xml"}},
+					},
+				},
+				{Name: "integration",
+					Stage:  DefaultStage,
+					Script: []string{`./integration.sh`},
+					Artifacts: Artifacts{
+						Paths:   []string{"logs"},
+						Reports: Reports{JUnit: []string{"reports/*.xml", "more-reports/*.xml"}},
+					},
+				},
+			},
+		}},
+		{"testdata/schedules.yaml", &Pipeline{
+			Image:  "golang:latest",
+			Stages: []string{DefaultStage},
+			Schedules: []Schedule{
+				{Name: "nightly", Cron: "0 2 * * *"},
+				{Name: "weekly-release", Cron: "@weekly", Branch: "release"},
+			},
+			Tasks: []*Task{
+				{Name: "format",
+					Stage:  DefaultStage,
+					Script: []string{`echo "testing"`},
+				},
+			},
+		}},
 	}
 
 	for _, tt := range parseTests {
@@ -121,7 +188,8 @@ func TestParse(t *testing.T) {
 				rt.Errorf("failed to parse %v: %s", tt.filename, err)
 				return
 			}
-			if diff := cmp.Diff(tt.want, got); diff != "" {
+			// Tasks are parsed from a map, so they're in no particular order.
+			if diff := cmp.Diff(tt.want, got, cmpopts.SortSlices(func(a, b *Task) bool { return a.Name < b.Name })); diff != "" {
 				rt.Errorf("Parse(%s) failed diff\n%s", tt.filename, diff)
 			}
 		})
@@ -137,6 +205,12 @@ func TestParseBadFiles(t *testing.T) {
 		{"testdata/bad-tekton-task.yaml", `invalid task "format": provided Tekton taskRef and script`},
 		{"testdata/bad-tekton-task-params.yaml", `bad Tekton task parameter`},
 		{"testdata/bad-tekton-jobs.yaml", `could not parse CI_NODE_INDEX==0 as an environment variable`},
+		{"testdata/bad-git-depth.yaml", `invalid git depth: -1`},
+		{"testdata/bad-git-submodules.yaml", `invalid git submodules: sometimes`},
+		{"testdata/bad-schedule.yaml", `invalid schedule "nightly": missing name or cron`},
+		{"testdata/bad-schedule-cron.yaml", `invalid schedule cron: \[0 2 \* \* \*\] is not a string`},
+		{"testdata/bad-schedules.yaml", `invalid schedules: .* is not a list`},
+		{"testdata/bad-rules.yaml", `invalid task "format": invalid rule when: \[never\] is not a string`},
 	}
 
 	for _, tt := range parseTests {
@@ -155,6 +229,36 @@ func TestParseBadFiles(t *testing.T) {
 	}
 }
 
+func TestParseInvalidValues(t *testing.T) {
+	parseTests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{"string image", "image: [golang]", `invalid image: \[golang\] is not a string`},
+		{"string variables", "variables: [TEST]", `invalid variables: \[TEST\] is not a map`},
+		{"list of stages", "stages: test", `invalid stages: test is not a list`},
+		{"task map", "format: go fmt", `invalid task "format": go fmt is not a map`},
+		{"string script", "format:\n  script: go fmt", `invalid task "format": invalid script: go fmt is not a list`},
+		{"rules list", "format:\n  script: [go fmt]\n  rules: never", `invalid task "format": invalid rules: never is not a list`},
+		{"rule map", "format:\n  script: [go fmt]\n  rules: [never]", `invalid task "format": invalid rule: never is not a map`},
+		{"tekton jobs", "format:\n  tekton:\n    jobs: [1]", `invalid task "format": invalid tekton jobs: 1 is not a string`},
+		{"artifact paths", "format:\n  script: [go fmt]\n  artifacts:\n    paths: bin", `invalid task "format": invalid artifacts paths: bin is not a list`},
+		{"git lfs", "git:\n  lfs: yes please", `invalid git lfs: yes please is not a boolean`},
+		{"schedule map", "schedules: [nightly]", `invalid schedule: nightly is not a map`},
+		{"string when", "deploy:\n  script: [./deploy.sh]\n  when: [manual]", `invalid task "deploy": invalid when: \[manual\] is not a string`},
+	}
+
+	for _, tt := range parseTests {
+		t.Run(tt.name, func(rt *testing.T) {
+			_, err := Parse(strings.NewReader(tt.yaml))
+			if !matchError(rt, tt.errMsg, err) {
+				rt.Errorf("error match failed, got %s, want %s", err, tt.errMsg)
+			}
+		})
+	}
+}
+
 func matchError(t *testing.T, s string, e error) bool {
 	t.Helper()
 	if s == "" && e == nil {
@@ -169,3 +273,7 @@ func matchError(t *testing.T, s string, e error) bool {
 	}
 	return match
 }
+
+func intPtr(i int) *int {
+	return &i
+}
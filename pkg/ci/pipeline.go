@@ -9,6 +9,8 @@ type Pipeline struct {
 	Stages       []string          `json:"stages,omitempty"`
 	Tasks        []*Task           `json:"tasks,omitempty"`
 	TektonConfig *TektonConfig     `json:"tekton,omitempty"`
+	Git          *GitConfig        `json:"git,omitempty"`
+	Schedules    []Schedule        `json:"schedules,omitempty"`
 }
 
 // Task represents the parsed Task from the Pipeline.
@@ -19,12 +21,20 @@ type Task struct {
 	Script    []string    `json:"script,omitempty"`
 	Artifacts Artifacts   `json:"artifacts,omitempty"`
 	Rules     []Rule      `json:"rules,omitempty"`
+	When      string      `json:"when,omitempty"`
 }
 
 // Artifacts represents a set of paths that should be treated as artifacts and
 // archived in some way.
 type Artifacts struct {
-	Paths []string `json:"paths,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Reports Reports  `json:"reports,omitempty"`
+}
+
+// Reports are the paths of reports that are generated by a task, they can
+// include globs e.g. "reports/*.xml".
+type Reports struct {
+	JUnit []string `json:"junit,omitempty"`
 }
 
 // Rule represents a rule that determines when a PipelineRun is triggered.
@@ -48,12 +58,43 @@ type TektonTaskParam struct {
 	Expression string `json:"expression"`
 }
 
+// Schedule runs the pipeline for a branch on a cron expression.
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is a standard cron expression e.g. "0 2 * * *", or a descriptor
+	// e.g. "@daily", evaluated in UTC.
+	Cron string `json:"cron"`
+	// Branch is the branch to run the pipeline for, if this is empty, the
+	// default branch of the repository is used.
+	Branch string `json:"branch,omitempty"`
+}
+
 // TektonConfig provides global configuration for the DSL script specifically
 // for Tekton.
 type TektonConfig struct {
 	ServiceAccountName string `json:"serviceAccountName"`
 }
 
+// GitConfig configures how the repository is cloned.
+type GitConfig struct {
+	// Depth is the number of commits to fetch, 0 fetches the full history,
+	// if this is nil, the git-init default is used.
+	Depth *int `json:"depth,omitempty"`
+	// Submodules is "true", "recursive" or "false", if this is empty, the
+	// submodules are updated recursively.
+	Submodules string `json:"submodules,omitempty"`
+	// SparseCheckout lists the directories to checkout, if this is empty,
+	// the full tree is checked out.
+	SparseCheckout []string `json:"sparse_checkout,omitempty"`
+	// LFS fetches the Git LFS objects for the checkout.
+	LFS bool `json:"lfs,omitempty"`
+	// FetchTags fetches all the tags from the repository after the clone.
+	FetchTags bool `json:"fetch_tags,omitempty"`
+	// MergeBase checks out pull requests merged into their target branch,
+	// rather than the head of the pull request.
+	MergeBase bool `json:"merge_base,omitempty"`
+}
+
 // TasksForStage returns the named jobs for a specific stage.
 func (c Pipeline) TasksForStage(n string) []string {
 	s := []string{}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+)
+
+// tokenEnvVar is the environment variable with the default token that the
+// commands authenticate to the http command with.
+const tokenEnvVar = "TEKTON_CI_TOKEN"
+
+// doRequest makes a request to the http command, if the token is not empty,
+// it's sent as a bearer token.
+func doRequest(method, u, token string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// defaultToken returns the token from the environment, for the default value
+// of the token flags.
+func defaultToken() string {
+	return os.Getenv(tokenEnvVar)
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm/factory"
+	"github.com/spf13/viper"
+	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/repository"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+	"github.com/gitops-tools/tekton-ci/pkg/schedule"
+	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+	"github.com/gitops-tools/tekton-ci/pkg/spec"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
+	"github.com/gitops-tools/tekton-ci/pkg/volumes"
+	"github.com/gitops-tools/tekton-ci/pkg/watcher"
+)
+
+// driverConfig is the configuration for a go-scm driver that hooks are
+// accepted from.
+type driverConfig struct {
+	name         string
+	serverURL    string
+	token        string
+	tokensSecret string
+}
+
+// parseDrivers returns the configuration for the default driver, followed by
+// the additional drivers, which are of the form "gitlab" or
+// "gitlab=https://gitlab.example.com".
+//
+// The default driver uses the token in $GITHUB_TOKEN, and the tokens in the
+// default tokens Secret, additional drivers use $<DRIVER>_TOKEN e.g.
+// $GITLAB_TOKEN and the default Secret name suffixed with the driver name.
+func parseDrivers(def, serverURL string, additional []string) ([]driverConfig, error) {
+	drivers := []driverConfig{
+		{name: def, serverURL: serverURL, token: os.Getenv("GITHUB_TOKEN"), tokensSecret: credentials.DefaultName},
+	}
+	seen := map[string]bool{def: true}
+	for _, v := range additional {
+		parts := strings.SplitN(v, "=", 2)
+		d := driverConfig{
+			name:         parts[0],
+			token:        os.Getenv(strings.ToUpper(parts[0]) + "_TOKEN"),
+			tokensSecret: credentials.DefaultName + "-" + parts[0],
+		}
+		if len(parts) == 2 {
+			d.serverURL = parts[1]
+		}
+		if seen[d.name] {
+			return nil, fmt.Errorf("driver %s is configured more than once", d.name)
+		}
+		seen[d.name] = true
+		drivers = append(drivers, d)
+	}
+	for _, d := range drivers {
+		if _, err := factory.NewWebHookService(d.name); err != nil {
+			return nil, fmt.Errorf("failed to create a git driver: %s", err)
+		}
+		if _, err := git.DriverHost(d.name, d.serverURL); err != nil {
+			return nil, err
+		}
+	}
+	return drivers, nil
+}
+
+// driverHandlers are the hook handlers for a driver, and the runner for the
+// driver's schedules.
+type driverHandlers struct {
+	dsl      http.Handler
+	spec     http.Handler
+	admin    http.Handler
+	schedule schedule.Runner
+}
+
+// handlersConfig is the configuration that is shared by the handlers for all
+// the drivers.
+type handlersConfig struct {
+	// multiple is true if more than one driver is configured.
+	multiple bool
+	// namespace is the namespace that the http command is running in.
+	namespace string
+	// watchNamespace is the namespace that PipelineRuns are watched in.
+	watchNamespace string
+	coreClient     kubernetes.Interface
+	tektonClient   pipelineclientset.Interface
+	router         routing.Router
+	metrics        metrics.Interface
+	history        runs.Store
+	logArchive     *logs.Archive
+	queue          *queue.Queue
+	log            logger.Logger
+}
+
+// newDriverHandlers creates the git.SCM client for the driver, and the hook
+// handlers that use it.
+//
+// A watcher is started to record metrics, and the results and logs of
+// PipelineRuns for the driver, and to report them if commit-statuses or pull
+// request comments are enabled, when multiple drivers are configured, each
+// watcher only reports PipelineRuns for the driver's host, and only
+// Repositories for the driver are routed to.
+func newDriverHandlers(d driverConfig, cfg *handlersConfig, stop <-chan struct{}) (*driverHandlers, error) {
+	httpClient, err := newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := newFallbackCredentials(context.Background(), cfg.coreClient, cfg.namespace, d, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	router := cfg.router
+	if r, ok := router.(*repository.Router); ok && cfg.multiple {
+		router = r.ForDriver(d.name)
+	}
+	tokens := credentials.NewKubeProvider(router, d.tokensSecret, cfg.coreClient, fallback, tokenRefreshPeriod)
+	gitClient := git.NewPerRepository(d.name, d.serverURL, router, tokens, secrets.New(router, secrets.DefaultName, cfg.coreClient), cfg.metrics,
+		git.WithTransport(httpClient.Transport))
+	watcherConfig := newWatcherConfig(cfg.history, cfg.logArchive, cfg.coreClient)
+	if cfg.multiple {
+		// The host was validated when the drivers were parsed.
+		watcherConfig.Host, _ = git.DriverHost(d.name, d.serverURL)
+	}
+	w := watcher.New(gitClient, cfg.tektonClient, cfg.watchNamespace, watcherConfig, cfg.metrics, cfg.log)
+	go w.WatchPipelineRuns(stop)
+
+	policy := trust.New(gitClient, viper.GetStringSlice("trusted-users"))
+	converter := dsl.NewDSLConverter(gitClient,
+		cfg.tektonClient, volumes.New(cfg.coreClient), newCloneSecrets(tokens, cfg.coreClient), policy,
+		cfg.metrics, newDSLConfig(), router, cfg.log)
+	return &driverHandlers{
+		dsl:      dsl.New(gitClient, cfg.log, cfg.metrics, converter, cfg.queue),
+		spec:     spec.New(gitClient, cfg.tektonClient, policy, router, cfg.log, cfg.metrics, cfg.queue),
+		admin:    dsl.NewAdminHandler(converter, cfg.watchNamespace, cfg.log),
+		schedule: converter,
+	}, nil
+}
+
+// driverParamMux dispatches requests to the handler for the driver in the
+// driver query parameter, or to the handler for the default driver.
+type driverParamMux struct {
+	def      string
+	handlers map[string]http.Handler
+}
+
+func (d driverParamMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("driver")
+	if name == "" {
+		name = d.def
+	}
+	h, ok := d.handlers[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown driver %q", name), http.StatusBadRequest)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// newFallbackCredentials returns the provider for tokens for repositories that
+// have no token configured.
+//
+// If a GitHub App is configured, installation tokens are used for the github
+// driver, otherwise the token from the environment is used.
+func newFallbackCredentials(ctx context.Context, coreClient kubernetes.Interface, namespace string, d driverConfig, httpClient *http.Client) (credentials.Provider, error) {
+	name := viper.GetString("github-app-secret")
+	if name == "" || d.name != "github" {
+		return credentials.NewStatic(d.token), nil
+	}
+	app, err := credentials.NewGitHubAppFromSecret(ctx, coreClient, namespace, name, git.GitHubAPIURL(d.serverURL), httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the GitHub App: %w", err)
+	}
+	return app, nil
+}
+
+// newHTTPClient returns the client for requests to the Git hosting services,
+// if a CA bundle is configured, the certificates in it are trusted.
+func newHTTPClient() (*http.Client, error) {
+	bundle := viper.GetString("scm-ca-bundle")
+	if bundle == "" {
+		return &http.Client{Transport: http.DefaultTransport}, nil
+	}
+	b, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+	}
+	t, err := git.NewTransport(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA bundle %s: %w", bundle, err)
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// newCloneSecrets returns a creator for Secrets with clone credentials, if
+// cloning with tokens is not enabled, no Secrets are created.
+func newCloneSecrets(tokens credentials.Provider, coreClient kubernetes.Interface) credentials.CloneSecretCreator {
+	if !viper.GetBool("clone-with-token") {
+		tokens = credentials.NewStatic("")
+	}
+	return credentials.NewCloneSecrets(tokens, coreClient)
+}
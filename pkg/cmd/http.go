@@ -1,35 +1,72 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
-	"github.com/jenkins-x/go-scm/scm/factory"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	"knative.dev/pkg/signals"
 
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/auth"
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+	"github.com/gitops-tools/tekton-ci/pkg/deliveries"
 	"github.com/gitops-tools/tekton-ci/pkg/dsl"
 	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
-	"github.com/gitops-tools/tekton-ci/pkg/secrets"
-	"github.com/gitops-tools/tekton-ci/pkg/spec"
-	"github.com/gitops-tools/tekton-ci/pkg/volumes"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/repository"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+	"github.com/gitops-tools/tekton-ci/pkg/schedule"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/ui"
 	"github.com/gitops-tools/tekton-ci/pkg/watcher"
 )
 
 const (
 	defaultPipelineRunPrefix = "test-pipelinerun-"
 	defaultVolumeSize        = "1G"
+	defaultGitImage          = "alpine/git"
+
+	// Repositories are revalidated periodically, as the Secrets that they
+	// reference are not watched.
+	repositoryResyncPeriod = 10 * time.Minute
+
+	// API tokens are read from Secrets again after this period.
+	tokenRefreshPeriod = 5 * time.Minute
+
+	// Failed hooks are retried at least this often.
+	maxHookRetryBackoff = time.Minute
+
+	// Hook deliveries and runs that are older than their retention are
+	// deleted this often.
+	prunePeriod = time.Hour
 )
 
 func makeHTTPCmd() *cobra.Command {
@@ -37,9 +74,9 @@ func makeHTTPCmd() *cobra.Command {
 		Use:   "http",
 		Short: "execute PipelineRuns in response to hooks",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			scmClient, err := factory.NewClient(viper.GetString("driver"), "", githubToken())
+			drivers, err := parseDrivers(viper.GetString("driver"), viper.GetString("scm-server-url"), viper.GetStringSlice("drivers"))
 			if err != nil {
-				return fmt.Errorf("failed to create a git driver: %s", err)
+				return err
 			}
 
 			clusterConfig, err := rest.InClusterConfig()
@@ -66,30 +103,272 @@ func makeHTTPCmd() *cobra.Command {
 			}()
 			sugar := logger.Sugar()
 
-			met := metrics.New("dsl", nil)
+			var metricsOpts []metrics.Option
+			if viper.GetBool("metrics-repo-label") {
+				metricsOpts = append(metricsOpts, metrics.WithRepoLabels())
+			}
+			met := metrics.New("dsl", nil, metricsOpts...)
+			shutdownTracing, err := setupTracing(context.Background())
+			if err != nil {
+				return err
+			}
+			defer shutdownTracing()
 			namespace := viper.GetString("namespace")
-			gitClient := git.New(scmClient, secrets.New(namespace, secrets.DefaultName, coreClient), met)
-			if viper.GetBool("commit-statuses") {
-				go watcher.WatchPipelineRuns(signals.SetupSignalHandler(), scmClient, tektonClient, namespace, sugar)
-			}
-
-			converter := dsl.NewDSLConverter(gitClient,
-				tektonClient, volumes.New(coreClient),
-				met, newDSLConfig(), namespace, sugar)
-			dslHandler := dsl.New(gitClient, sugar, met, converter)
-			specHandler := spec.New(
-				gitClient,
-				tektonClient,
-				namespace,
-				sugar)
-			http.Handle("/pipeline", dslHandler)
-			http.Handle("/pipelinerun", specHandler)
+			stop := signals.SetupSignalHandler()
+			router, watchNamespace, err := newRouter(namespace, clusterConfig, coreClient, sugar, stop)
+			if err != nil {
+				return err
+			}
+			store, err := newDeliveryStore(coreClient, namespace)
+			if err != nil {
+				return err
+			}
+			var recorder *deliveries.Recorder
+			var done func(string, error)
+			if store != nil {
+				recorder = deliveries.NewRecorder(store, sugar)
+				done = recorder.Completed
+				go prune("hook deliveries", store.Prune, viper.GetDuration("hook-retention"), sugar, stop)
+			}
+			runStore, err := newRunStore()
+			if err != nil {
+				return err
+			}
+			var history runs.Store
+			var runsAPI http.Handler
+			if runStore != nil {
+				defer runStore.Close()
+				go prune("runs", runStore.Prune, viper.GetDuration("run-retention"), sugar, stop)
+				history = runStore
+				// The results include the failure messages and hook IDs, so
+				// they're only served to authenticated requests.
+				if name := viper.GetString("admin-token-secret"); name != "" {
+					runsAPI = auth.New(coreClient, namespace, name, runs.NewAPIHandler(runStore, sugar), sugar)
+					http.Handle(runs.APIPath, runsAPI)
+					http.Handle(runs.StatsPath, auth.New(coreClient, namespace, name, runs.NewStatsHandler(runStore, sugar), sugar))
+				} else {
+					sugar.Warnw("the runs API is only served with an admin-token-secret")
+				}
+				prometheus.MustRegister(runs.NewCollector("dsl", runStore, viper.GetDuration("stats-window"), sugar))
+			}
+			archive, err := newLogArchive(context.Background())
+			if err != nil {
+				return err
+			}
+			if archive != nil {
+				defer archive.Close()
+			}
+			servers := []*http.Server{{Addr: fmt.Sprintf(":%d", viper.GetInt("port"))}}
+			streamer := logs.NewKubeStreamer(coreClient)
+			if viper.GetBool("ui") {
+				servers = append(servers, newUIServer(ui.New(tektonClient, streamer, archive, watchNamespace, sugar)))
+			}
+			if viper.GetBool("logs-api") {
+				name := viper.GetString("admin-token-secret")
+				if name == "" {
+					return fmt.Errorf("the logs API can only be served with an admin-token-secret")
+				}
+				http.Handle(logs.APIPath+"/", auth.New(coreClient, namespace, name, logs.NewAPIHandler(tektonClient, streamer, archive, watchNamespace, sugar), sugar))
+			}
+			q := newQueue(met, done, sugar)
+			dslHandlers := map[string]http.Handler{}
+			specHandlers := map[string]http.Handler{}
+			adminHandlers := map[string]http.Handler{}
+			runners := map[string]schedule.Runner{}
+			cfg := &handlersConfig{
+				multiple:       len(drivers) > 1,
+				namespace:      namespace,
+				watchNamespace: watchNamespace,
+				coreClient:     coreClient,
+				tektonClient:   tektonClient,
+				router:         router,
+				metrics:        met,
+				history:        history,
+				logArchive:     archive,
+				queue:          q,
+				log:            sugar,
+			}
+			for _, d := range drivers {
+				h, err := newDriverHandlers(d, cfg, stop)
+				if err != nil {
+					return err
+				}
+				dslHandlers[d.name] = h.dsl
+				specHandlers[d.name] = h.spec
+				adminHandlers[d.name] = h.admin
+				runners[d.name] = h.schedule
+				http.Handle("/"+d.name+"/pipeline", recordDeliveries(recorder, h.dsl))
+				http.Handle("/"+d.name+"/pipelinerun", recordDeliveries(recorder, h.spec))
+			}
+			http.Handle("/pipeline", recordDeliveries(recorder, git.NewDriverMux(drivers[0].name, dslHandlers)))
+			http.Handle("/pipelinerun", recordDeliveries(recorder, git.NewDriverMux(drivers[0].name, specHandlers)))
+			if name := viper.GetString("schedules-configmap"); name != "" {
+				scheduler := schedule.New(schedule.NewConfigMapSource(namespace, name, coreClient),
+					drivers[0].name, runners, viper.GetDuration("schedule-refresh"), sugar)
+				go scheduler.Run(stop)
+			}
+			var admin http.Handler
+			if name := viper.GetString("admin-token-secret"); name != "" {
+				admin = auth.New(coreClient, namespace, name, driverParamMux{def: drivers[0].name, handlers: adminHandlers}, sugar)
+				http.Handle(dsl.TriggerPath, admin)
+			}
+			// The runs API and the endpoints to rerun and cancel PipelineRuns
+			// share a path.
+			if runsAPI != nil || admin != nil {
+				http.Handle(runs.APIPath+"/", runsHandler{api: runsAPI, admin: admin})
+			}
 			http.Handle("/metrics", promhttp.Handler())
-			listen := fmt.Sprintf(":%d", viper.GetInt("port"))
-			return http.ListenAndServe(listen, nil)
+			if store != nil {
+				adminServer, err := newAdminServer(store, coreClient, namespace, sugar)
+				if err != nil {
+					return err
+				}
+				servers = append(servers, adminServer)
+			}
+			return serve(servers, q, sugar, stop)
 		},
 	}
 
+	cmd.Flags().Int(
+		"hook-workers",
+		4,
+		"number of hooks to process concurrently, if this is 0, hooks are processed before responding",
+	)
+	logIfError(viper.BindPFlag("hook-workers", cmd.Flags().Lookup("hook-workers")))
+
+	cmd.Flags().Int(
+		"hook-queue-size",
+		100,
+		"number of hooks that can be waiting to be processed, hooks are rejected when the queue is full",
+	)
+	logIfError(viper.BindPFlag("hook-queue-size", cmd.Flags().Lookup("hook-queue-size")))
+
+	cmd.Flags().Int(
+		"hook-retries",
+		3,
+		"number of times to retry hooks that fail to be processed",
+	)
+	logIfError(viper.BindPFlag("hook-retries", cmd.Flags().Lookup("hook-retries")))
+
+	cmd.Flags().Duration(
+		"hook-retry-backoff",
+		time.Second,
+		"delay before retrying a failed hook, this doubles for each retry",
+	)
+	logIfError(viper.BindPFlag("hook-retry-backoff", cmd.Flags().Lookup("hook-retry-backoff")))
+
+	cmd.Flags().Duration(
+		"shutdown-timeout",
+		30*time.Second,
+		"time to wait for queued hooks to be processed when shutting down",
+	)
+	logIfError(viper.BindPFlag("shutdown-timeout", cmd.Flags().Lookup("shutdown-timeout")))
+
+	cmd.Flags().String(
+		"hook-store",
+		"configmap",
+		"where hook deliveries are recorded so that they can be replayed, one of configmap, file or none",
+	)
+	logIfError(viper.BindPFlag("hook-store", cmd.Flags().Lookup("hook-store")))
+
+	cmd.Flags().String(
+		"hook-store-dir",
+		"/var/lib/tekton-ci/hooks",
+		"directory to record hook deliveries in when the hook-store is file e.g. on a PersistentVolume",
+	)
+	logIfError(viper.BindPFlag("hook-store-dir", cmd.Flags().Lookup("hook-store-dir")))
+
+	cmd.Flags().Duration(
+		"hook-retention",
+		7*24*time.Hour,
+		"time to keep recorded hook deliveries for",
+	)
+	logIfError(viper.BindPFlag("hook-retention", cmd.Flags().Lookup("hook-retention")))
+
+	cmd.Flags().String(
+		"run-store-path",
+		"",
+		"path of a database file to record the results of completed PipelineRuns in e.g. /var/lib/tekton-ci/runs.db, if empty, results are not recorded",
+	)
+	logIfError(viper.BindPFlag("run-store-path", cmd.Flags().Lookup("run-store-path")))
+
+	cmd.Flags().Duration(
+		"run-retention",
+		30*24*time.Hour,
+		"time to keep the results of completed PipelineRuns for",
+	)
+	logIfError(viper.BindPFlag("run-retention", cmd.Flags().Lookup("run-retention")))
+
+	cmd.Flags().Duration(
+		"stats-window",
+		runs.DefaultWindow,
+		"period over which the job and test metrics are calculated from the recorded results",
+	)
+	logIfError(viper.BindPFlag("stats-window", cmd.Flags().Lookup("stats-window")))
+
+	cmd.Flags().String(
+		"schedules-configmap",
+		"",
+		fmt.Sprintf("name of a ConfigMap in the namespace with a %s that configures scheduled pipelines, if empty, pipelines are not scheduled", schedule.ConfigKey),
+	)
+	logIfError(viper.BindPFlag("schedules-configmap", cmd.Flags().Lookup("schedules-configmap")))
+
+	cmd.Flags().Duration(
+		"schedule-refresh",
+		5*time.Minute,
+		"how often the schedules are read again from the ConfigMap and the pipeline definitions",
+	)
+	logIfError(viper.BindPFlag("schedule-refresh", cmd.Flags().Lookup("schedule-refresh")))
+
+	cmd.Flags().String(
+		"admin-token-secret",
+		"",
+		fmt.Sprintf("name of a Secret in the namespace with a %s that authenticates requests to rerun, cancel and trigger pipelines, if empty, these are not served", auth.TokenKey),
+	)
+	logIfError(viper.BindPFlag("admin-token-secret", cmd.Flags().Lookup("admin-token-secret")))
+
+	cmd.Flags().Int(
+		"admin-port",
+		8081,
+		"port to serve the admin endpoint for replaying hooks on",
+	)
+	logIfError(viper.BindPFlag("admin-port", cmd.Flags().Lookup("admin-port")))
+
+	cmd.Flags().String(
+		"admin-address",
+		"127.0.0.1",
+		"address to serve the admin endpoint for replaying hooks on, other addresses than the loopback address need an admin-token-secret",
+	)
+	logIfError(viper.BindPFlag("admin-address", cmd.Flags().Lookup("admin-address")))
+
+	cmd.Flags().Bool(
+		"metrics-repo-label",
+		false,
+		"label the conversions metric with the repository, this creates a series for each repository",
+	)
+	logIfError(viper.BindPFlag("metrics-repo-label", cmd.Flags().Lookup("metrics-repo-label")))
+
+	cmd.Flags().String(
+		"tracing-exporter",
+		tracing.NoExporter,
+		"where spans for hooks and PipelineRuns are exported to, one of otlp or none",
+	)
+	logIfError(viper.BindPFlag("tracing-exporter", cmd.Flags().Lookup("tracing-exporter")))
+
+	cmd.Flags().String(
+		"otlp-endpoint",
+		"localhost:55680",
+		"address of the OpenTelemetry collector to export spans to with the otlp exporter",
+	)
+	logIfError(viper.BindPFlag("otlp-endpoint", cmd.Flags().Lookup("otlp-endpoint")))
+
+	cmd.Flags().Bool(
+		"otlp-insecure",
+		false,
+		"if true, spans are exported to the OpenTelemetry collector without TLS",
+	)
+	logIfError(viper.BindPFlag("otlp-insecure", cmd.Flags().Lookup("otlp-insecure")))
+
 	cmd.Flags().Int(
 		"port",
 		8080,
@@ -104,6 +383,62 @@ func makeHTTPCmd() *cobra.Command {
 	)
 	logIfError(viper.BindPFlag("commit-statuses", cmd.Flags().Lookup("commit-statuses")))
 
+	cmd.Flags().Bool(
+		"pull-request-comments",
+		false,
+		"if true, will comment on pull requests with a summary of completed PipelineRuns",
+	)
+	logIfError(viper.BindPFlag("pull-request-comments", cmd.Flags().Lookup("pull-request-comments")))
+
+	cmd.Flags().String(
+		"dashboard-url",
+		"",
+		"base URL of a Tekton Dashboard, used to link to the logs for tasks in pull request comments",
+	)
+	logIfError(viper.BindPFlag("dashboard-url", cmd.Flags().Lookup("dashboard-url")))
+
+	cmd.Flags().Bool(
+		"archive-logs",
+		false,
+		"if true, the logs of completed PipelineRuns are archived in the bucket at the archive-url",
+	)
+	logIfError(viper.BindPFlag("archive-logs", cmd.Flags().Lookup("archive-logs")))
+
+	cmd.Flags().Bool(
+		"ui",
+		false,
+		"if true, a read-only UI for PipelineRuns, including the logs for their steps, is served from /ui/ on the ui-port",
+	)
+	logIfError(viper.BindPFlag("ui", cmd.Flags().Lookup("ui")))
+
+	cmd.Flags().Bool(
+		"logs-api",
+		false,
+		"if true, the logs of PipelineRuns are served from /api/logs/, this needs an admin-token-secret",
+	)
+	logIfError(viper.BindPFlag("logs-api", cmd.Flags().Lookup("logs-api")))
+
+	cmd.Flags().Int(
+		"ui-port",
+		8082,
+		"port to serve the UI on",
+	)
+	logIfError(viper.BindPFlag("ui-port", cmd.Flags().Lookup("ui-port")))
+
+	cmd.Flags().String(
+		"ui-address",
+		"127.0.0.1",
+		"address to serve the UI on, the UI is not authenticated, so anyone that can connect to this address can read the logs of PipelineRuns",
+	)
+	logIfError(viper.BindPFlag("ui-address", cmd.Flags().Lookup("ui-address")))
+
+	cmd.Flags().String(
+		"ui-url",
+		"",
+		"external URL of the UI e.g. https://tekton-ci.example.com, if set, commit-statuses link to PipelineRuns in the UI",
+	)
+	logIfError(viper.BindPFlag("ui-url", cmd.Flags().Lookup("ui-url")))
+
 	cmd.Flags().String(
 		"driver",
 		"github",
@@ -111,6 +446,41 @@ func makeHTTPCmd() *cobra.Command {
 	)
 	logIfError(viper.BindPFlag("driver", cmd.Flags().Lookup("driver")))
 
+	cmd.Flags().String(
+		"scm-server-url",
+		"",
+		"server URL for the go-scm driver e.g. https://github.example.com, defaults to the public service for the driver",
+	)
+	logIfError(viper.BindPFlag("scm-server-url", cmd.Flags().Lookup("scm-server-url")))
+
+	cmd.Flags().String(
+		"scm-ca-bundle",
+		"",
+		"path to a PEM encoded bundle of CA certificates to trust for the Git hosting services, in addition to the system certificates",
+	)
+	logIfError(viper.BindPFlag("scm-ca-bundle", cmd.Flags().Lookup("scm-ca-bundle")))
+
+	cmd.Flags().StringSlice(
+		"drivers",
+		[]string{},
+		"additional go-scm drivers to accept hooks from, optionally with a server URL e.g. gitlab=https://gitlab.example.com",
+	)
+	logIfError(viper.BindPFlag("drivers", cmd.Flags().Lookup("drivers")))
+
+	cmd.Flags().StringSlice(
+		"command-allowlist",
+		[]string{},
+		"users who can issue commands in pull request comments, in addition to users with write access",
+	)
+	logIfError(viper.BindPFlag("command-allowlist", cmd.Flags().Lookup("command-allowlist")))
+
+	cmd.Flags().StringSlice(
+		"trusted-users",
+		[]string{},
+		"users whose pull requests are processed without approval, in addition to users with write access and organisation members",
+	)
+	logIfError(viper.BindPFlag("trusted-users", cmd.Flags().Lookup("trusted-users")))
+
 	cmd.Flags().String(
 		"namespace",
 		"default",
@@ -118,17 +488,288 @@ func makeHTTPCmd() *cobra.Command {
 	)
 	logIfError(viper.BindPFlag("namespace", cmd.Flags().Lookup("namespace")))
 
+	cmd.Flags().Bool(
+		"repository-resources",
+		false,
+		"if true, repositories are configured with Repository resources, rather than the routes ConfigMap",
+	)
+	logIfError(viper.BindPFlag("repository-resources", cmd.Flags().Lookup("repository-resources")))
+
+	cmd.Flags().StringSlice(
+		"repository-namespaces",
+		nil,
+		"namespaces other than the namespace that Repository resources are accepted from",
+	)
+	logIfError(viper.BindPFlag("repository-namespaces", cmd.Flags().Lookup("repository-namespaces")))
+
+	cmd.Flags().String(
+		"routes-configmap",
+		"",
+		"name of a ConfigMap in the namespace with routes for repositories to other namespaces",
+	)
+	logIfError(viper.BindPFlag("routes-configmap", cmd.Flags().Lookup("routes-configmap")))
+
+	cmd.Flags().String(
+		"github-app-secret",
+		"",
+		fmt.Sprintf("name of a Secret in the namespace with the %s and %s of a GitHub App to authenticate as", credentials.GitHubAppIDKey, credentials.GitHubAppPrivateKeyKey),
+	)
+	logIfError(viper.BindPFlag("github-app-secret", cmd.Flags().Lookup("github-app-secret")))
+
+	cmd.Flags().Bool(
+		"clone-with-token",
+		false,
+		"if true, repositories are cloned with the API token for the repository, allowing private repositories to be cloned",
+	)
+	logIfError(viper.BindPFlag("clone-with-token", cmd.Flags().Lookup("clone-with-token")))
+
 	bindConfigurationFlags(cmd)
 	return cmd
 }
 
+// newAdminServer returns the server for the admin endpoint that lists and
+// replays hook deliveries.
+//
+// The recorded hooks include their bodies and headers, so if an
+// admin-token-secret is configured, requests are authenticated with it, and
+// without one, the endpoint is only served on the loopback address.
+func newAdminServer(store deliveries.Store, coreClient kubernetes.Interface, namespace string, l logger.Logger) (*http.Server, error) {
+	// Deliveries are replayed through the hook handlers, so that they're
+	// recorded again.
+	var admin http.Handler = deliveries.NewAdminHandler(store, http.DefaultServeMux, l)
+	address := viper.GetString("admin-address")
+	if name := viper.GetString("admin-token-secret"); name != "" {
+		admin = auth.New(coreClient, namespace, name, admin, l)
+	} else if ip := net.ParseIP(address); ip == nil || !ip.IsLoopback() {
+		return nil, fmt.Errorf("the admin endpoint can only be served on %q with an admin-token-secret", address)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(deliveries.AdminPath, admin)
+	mux.Handle(deliveries.AdminPath+"/", admin)
+	return &http.Server{Addr: net.JoinHostPort(address, strconv.Itoa(viper.GetInt("admin-port"))), Handler: mux}, nil
+}
+
+// newUIServer returns the server for the UI.
+//
+// The UI isn't authenticated, so it has its own listener, which is on the
+// loopback address by default.
+func newUIServer(h http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(ui.Path+"/", h)
+	return &http.Server{Addr: net.JoinHostPort(viper.GetString("ui-address"), strconv.Itoa(viper.GetInt("ui-port"))), Handler: mux}
+}
+
+// newRouter returns the router for repositories, and the namespace that should
+// be watched for PipelineRuns.
+//
+// If routes are configured, PipelineRuns can be created in any namespace.
+//
+// If Repository resources are used, they are reconciled until the stop
+// channel is closed.
+func newRouter(namespace string, clusterConfig *rest.Config, coreClient kubernetes.Interface, l logger.Logger, stop <-chan struct{}) (routing.Router, string, error) {
+	defaultRoute := routing.Route{Namespace: namespace}
+	if viper.GetBool("repository-resources") {
+		dynamicClient, err := dynamic.NewForConfig(clusterConfig)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create the dynamic client: %v", err)
+		}
+		informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, repositoryResyncPeriod)
+		informer := informerFactory.ForResource(v1alpha1.RepositoryResource)
+		namespaces := append([]string{namespace}, viper.GetStringSlice("repository-namespaces")...)
+		router := repository.NewRouter(informer.Lister(), defaultRoute, namespaces)
+		controller := repository.NewController(informer.Informer(), informer.Lister(),
+			repository.NewReconciler(dynamicClient, coreClient, router, l), l)
+		informerFactory.Start(stop)
+		go controller.Run(stop)
+		return router, metav1.NamespaceAll, nil
+	}
+	name := viper.GetString("routes-configmap")
+	if name == "" {
+		return routing.NewStatic(defaultRoute), namespace, nil
+	}
+	return routing.New(namespace, name, coreClient, defaultRoute), metav1.NamespaceAll, nil
+}
+
+// newQueue returns the queue for processing hooks, or nil if hooks are
+// processed synchronously.
+func newQueue(met metrics.Interface, done func(string, error), l logger.Logger) *queue.Queue {
+	workers := viper.GetInt("hook-workers")
+	if workers <= 0 {
+		return nil
+	}
+	q := queue.New(queue.Config{
+		Workers:    workers,
+		Size:       viper.GetInt("hook-queue-size"),
+		MaxRetries: viper.GetInt("hook-retries"),
+		Backoff:    viper.GetDuration("hook-retry-backoff"),
+		MaxBackoff: maxHookRetryBackoff,
+		Done:       done,
+		Retryable:  hookerrors.Retryable,
+	}, met, l)
+	q.Start()
+	return q
+}
+
+// setupTracing configures the global TracerProvider to export spans, and
+// returns a function that flushes the spans when shutting down.
+func setupTracing(ctx context.Context) (func(), error) {
+	tp, err := tracing.NewProvider(ctx, tracing.Config{
+		Exporter:    viper.GetString("tracing-exporter"),
+		Endpoint:    viper.GetString("otlp-endpoint"),
+		Insecure:    viper.GetBool("otlp-insecure"),
+		ServiceName: "tekton-ci",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tp == nil {
+		return func() {}, nil
+	}
+	otel.SetTracerProvider(tp)
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Printf("failed to shutdown tracing: %s", err)
+		}
+	}, nil
+}
+
+// newDeliveryStore returns the store for recording hook deliveries, or nil if
+// deliveries are not recorded.
+func newDeliveryStore(coreClient kubernetes.Interface, namespace string) (deliveries.Store, error) {
+	switch s := viper.GetString("hook-store"); s {
+	case "configmap":
+		return deliveries.NewConfigMapStore(coreClient, namespace), nil
+	case "file":
+		return deliveries.NewFileStore(viper.GetString("hook-store-dir"))
+	case "none", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown hook-store %q, must be one of configmap, file or none", s)
+	}
+}
+
+// newRunStore returns the store for the results of completed PipelineRuns, or
+// nil if results are not recorded.
+func newRunStore() (*runs.BoltStore, error) {
+	path := viper.GetString("run-store-path")
+	if path == "" {
+		return nil, nil
+	}
+	return runs.NewBoltStore(path)
+}
+
+// newLogArchive opens the bucket at the archive-url for archiving the logs of
+// completed PipelineRuns, if archiving logs is enabled.
+func newLogArchive(ctx context.Context) (*logs.Archive, error) {
+	if !viper.GetBool("archive-logs") {
+		return nil, nil
+	}
+	bucketURL := viper.GetString("archive-url")
+	b, err := blob.OpenBucket(ctx, bucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the bucket for archiving logs: %w", err)
+	}
+	return logs.NewArchive(b, bucketURL), nil
+}
+
+// runsHandler serves GET requests with the runs API, and other requests with
+// the admin handler, if either is nil, those requests are not found.
+type runsHandler struct {
+	api   http.Handler
+	admin http.Handler
+}
+
+func (h runsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	next := h.admin
+	if r.Method == http.MethodGet {
+		next = h.api
+	}
+	if next == nil {
+		http.NotFound(w, r)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// recordDeliveries wraps the handler to record hook deliveries, if the
+// recorder is nil, the handler is returned.
+func recordDeliveries(r *deliveries.Recorder, h http.Handler) http.Handler {
+	if r == nil {
+		return h
+	}
+	return r.Handler(h)
+}
+
+// prune periodically deletes hook deliveries or runs that are older than the
+// retention, until the stop channel is closed.
+func prune(name string, p func(context.Context, time.Time) (int, error), retention time.Duration, l logger.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(prunePeriod)
+	defer ticker.Stop()
+	for {
+		deleted, err := p(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			l.Errorf("error pruning %s: %s", name, err)
+		} else if deleted > 0 {
+			l.Infof("pruned %d %s", deleted, name)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// serve serves requests until the stop channel is closed, and then waits for
+// in-flight requests and queued hooks to complete.
+func serve(servers []*http.Server, q *queue.Queue, l logger.Logger, stop <-chan struct{}) error {
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+	}
+	l.Infof("shutting down, waiting up to %s for in-flight hooks", viper.GetDuration("shutdown-timeout"))
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("shutdown-timeout"))
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	if q != nil {
+		return q.Shutdown(ctx)
+	}
+	return nil
+}
+
 func newDSLConfig() *dsl.Configuration {
 	return &dsl.Configuration{
 		ArchiverImage:             viper.GetString("archiver-image"),
 		ArchiveURL:                viper.GetString("archive-url"),
+		GitImage:                  viper.GetString("git-image"),
 		PipelineRunPrefix:         viper.GetString("pipelinerun-prefix"),
 		DefaultServiceAccountName: viper.GetString("pipelinerun-serviceaccount-name"),
 		VolumeSize:                resource.MustParse(viper.GetString("pipelinerun-volume-size")),
+		CommandAllowList:          viper.GetStringSlice("command-allowlist"),
+	}
+}
+
+func newWatcherConfig(history runs.Store, archive *logs.Archive, coreClient kubernetes.Interface) *watcher.Config {
+	return &watcher.Config{
+		CommitStatuses:      viper.GetBool("commit-statuses"),
+		PullRequestComments: viper.GetBool("pull-request-comments"),
+		DashboardURL:        viper.GetString("dashboard-url"),
+		UIURL:               viper.GetString("ui-url"),
+		Runs:                history,
+		LogArchive:          archive,
+		LogStreamer:         logs.NewKubeStreamer(coreClient),
 	}
 }
 
@@ -149,6 +790,13 @@ func bindConfigurationFlags(cmd *cobra.Command) {
 	logIfError(viper.BindPFlag("archive-url", cmd.Flags().Lookup("archive-url")))
 	logIfError(cmd.MarkFlagRequired("archive-url"))
 
+	cmd.Flags().String(
+		"git-image",
+		defaultGitImage,
+		"image with git to execute for sparse checkouts and fetching LFS objects in generated PipelineRuns",
+	)
+	logIfError(viper.BindPFlag("git-image", cmd.Flags().Lookup("git-image")))
+
 	cmd.Flags().String(
 		"pipelinerun-prefix",
 		defaultPipelineRunPrefix,
@@ -171,7 +819,3 @@ func bindConfigurationFlags(cmd *cobra.Command) {
 	logIfError(viper.BindPFlag("pipelinerun-volume-size", cmd.Flags().Lookup("pipelinerun-volume-size")))
 
 }
-
-func githubToken() string {
-	return os.Getenv("GITHUB_TOKEN")
-}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+)
+
+// The flags for the logs command are bound with a prefix, as the names are
+// also used by other commands.
+func makeLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs <hook-id|pipelinerun|namespace/pipelinerun>",
+		Short: "print the logs for the steps of a PipelineRun, in task order",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			u, err := logsURL(viper.GetString("logs-api-url"), args[0], logs.Options{
+				Follow:    viper.GetBool("logs-follow"),
+				StripANSI: viper.GetBool("logs-strip-ansi"),
+			})
+			if err != nil {
+				return err
+			}
+			resp, err := doRequest(http.MethodGet, u, viper.GetString("logs-token"))
+			if err != nil {
+				return fmt.Errorf("failed to get logs: %w", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					return err
+				}
+				return fmt.Errorf("failed to get logs: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+			}
+			_, err = io.Copy(os.Stdout, resp.Body)
+			return err
+		},
+	}
+
+	cmd.Flags().BoolP(
+		"follow",
+		"f",
+		false,
+		"wait for tasks to start, and stream the logs until the PipelineRun completes",
+	)
+	logIfError(viper.BindPFlag("logs-follow", cmd.Flags().Lookup("follow")))
+
+	cmd.Flags().Bool(
+		"strip-ansi",
+		false,
+		"remove colours and other terminal escape sequences from the logs",
+	)
+	logIfError(viper.BindPFlag("logs-strip-ansi", cmd.Flags().Lookup("strip-ansi")))
+
+	cmd.Flags().String(
+		"api-url",
+		"http://localhost:8080",
+		"URL of the http command",
+	)
+	logIfError(viper.BindPFlag("logs-api-url", cmd.Flags().Lookup("api-url")))
+
+	cmd.Flags().String(
+		"token",
+		defaultToken(),
+		"token to authenticate to the logs API with, by default, this is $"+tokenEnvVar,
+	)
+	logIfError(viper.BindPFlag("logs-token", cmd.Flags().Lookup("token")))
+	return cmd
+}
+
+// logsURL returns the URL to get the logs for the PipelineRun identified by
+// the id, which can be a hook ID, a name, or a namespace/name.
+func logsURL(apiURL, id string, opts logs.Options) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the API URL: %w", err)
+	}
+	parts := strings.Split(id, "/")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid PipelineRun %q, expected a hook ID, name, or namespace/name", id)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + logs.APIPath + "/" + id
+	q := url.Values{}
+	q.Set("follow", strconv.FormatBool(opts.Follow))
+	q.Set("strip-ansi", strconv.FormatBool(opts.StripANSI))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
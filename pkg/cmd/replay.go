@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/gitops-tools/tekton-ci/pkg/deliveries"
+)
+
+func makeReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay --hook-id",
+		Short: "replay recorded hook deliveries",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			u, err := replayURL(viper.GetString("admin-url"), viper.GetString("hook-id"), viper.GetString("status"))
+			if err != nil {
+				return err
+			}
+			resp, err := doRequest(http.MethodPost, u, viper.GetString("replay-token"))
+			if err != nil {
+				return fmt.Errorf("failed to replay hooks: %w", err)
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to replay hooks: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+			}
+			fmt.Printf("%s\n", string(b))
+			return nil
+		},
+	}
+
+	cmd.Flags().String(
+		"hook-id",
+		"",
+		"ID of the hook delivery to replay",
+	)
+	logIfError(viper.BindPFlag("hook-id", cmd.Flags().Lookup("hook-id")))
+
+	cmd.Flags().String(
+		"status",
+		"",
+		"replay all hook deliveries with this status e.g. failed, rather than a single hook",
+	)
+	logIfError(viper.BindPFlag("status", cmd.Flags().Lookup("status")))
+
+	cmd.Flags().String(
+		"admin-url",
+		"http://localhost:8081",
+		"URL of the admin endpoint of the http command",
+	)
+	logIfError(viper.BindPFlag("admin-url", cmd.Flags().Lookup("admin-url")))
+
+	cmd.Flags().String(
+		"token",
+		defaultToken(),
+		"token to authenticate to the admin endpoint with, by default, this is $"+tokenEnvVar,
+	)
+	logIfError(viper.BindPFlag("replay-token", cmd.Flags().Lookup("token")))
+	return cmd
+}
+
+// replayURL returns the admin URL to replay the hook with the ID, or the hooks
+// with the status.
+func replayURL(adminURL, id, status string) (string, error) {
+	if (id == "") == (status == "") {
+		return "", errors.New("one of --hook-id or --status must be provided")
+	}
+	u, err := url.Parse(adminURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the admin URL: %w", err)
+	}
+	if id != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + deliveries.AdminPath + "/" + id + "/replay"
+		return u.String(), nil
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + deliveries.AdminPath + "/replay"
+	u.RawQuery = url.Values{"status": []string{status}}.Encode()
+	return u.String(), nil
+}
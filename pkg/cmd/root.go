@@ -24,6 +24,9 @@ func makeRootCmd() *cobra.Command {
 	}
 	cmd.AddCommand(makeHTTPCmd())
 	cmd.AddCommand(makeConvertCmd())
+	cmd.AddCommand(makeReplayCmd())
+	cmd.AddCommand(makeRunsCmd())
+	cmd.AddCommand(makeLogsCmd())
 	return cmd
 }
 
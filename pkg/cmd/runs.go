@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+)
+
+// The flags for the runs command are bound with a prefix, as the names are
+// also used by other commands.
+func makeRunsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "list the results of completed PipelineRuns",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			u, err := runsURL(viper.GetString("api-url"), runs.Filter{
+				Repo:   viper.GetString("runs-repo"),
+				Branch: viper.GetString("runs-branch"),
+				Status: viper.GetString("runs-status"),
+				Limit:  viper.GetInt("runs-limit"),
+				Offset: viper.GetInt("runs-offset"),
+			})
+			if err != nil {
+				return err
+			}
+			resp, err := doRequest(http.MethodGet, u, viper.GetString("runs-token"))
+			if err != nil {
+				return fmt.Errorf("failed to list runs: %w", err)
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to list runs: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+			}
+			list := runs.RunList{}
+			if err := json.Unmarshal(b, &list); err != nil {
+				return fmt.Errorf("failed to parse runs: %w", err)
+			}
+			return printRuns(os.Stdout, list)
+		},
+	}
+
+	cmd.Flags().String(
+		"repo",
+		"",
+		"only list runs for this repository e.g. my-org/my-repo",
+	)
+	logIfError(viper.BindPFlag("runs-repo", cmd.Flags().Lookup("repo")))
+
+	cmd.Flags().String(
+		"branch",
+		"",
+		"only list runs for this branch",
+	)
+	logIfError(viper.BindPFlag("runs-branch", cmd.Flags().Lookup("branch")))
+
+	cmd.Flags().String(
+		"status",
+		"",
+		"only list runs with this status, one of Successful or Failed",
+	)
+	logIfError(viper.BindPFlag("runs-status", cmd.Flags().Lookup("status")))
+
+	cmd.Flags().Int(
+		"limit",
+		20,
+		"maximum number of runs to list",
+	)
+	logIfError(viper.BindPFlag("runs-limit", cmd.Flags().Lookup("limit")))
+
+	cmd.Flags().Int(
+		"offset",
+		0,
+		"number of runs to skip, for listing the next page of runs",
+	)
+	logIfError(viper.BindPFlag("runs-offset", cmd.Flags().Lookup("offset")))
+
+	cmd.Flags().String(
+		"api-url",
+		"http://localhost:8080",
+		"URL of the http command",
+	)
+	logIfError(viper.BindPFlag("api-url", cmd.Flags().Lookup("api-url")))
+
+	cmd.Flags().String(
+		"token",
+		defaultToken(),
+		"token to authenticate to the runs API with, by default, this is $"+tokenEnvVar,
+	)
+	logIfError(viper.BindPFlag("runs-token", cmd.Flags().Lookup("token")))
+	return cmd
+}
+
+// runsURL returns the URL to list the runs that match the filter.
+func runsURL(apiURL string, f runs.Filter) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the API URL: %w", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + runs.APIPath
+	q := url.Values{}
+	for k, v := range map[string]string{"repo": f.Repo, "branch": f.Branch, "status": f.Status} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	q.Set("limit", strconv.Itoa(f.Limit))
+	q.Set("offset", strconv.Itoa(f.Offset))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func printRuns(out io.Writer, list runs.RunList) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREPO\tBRANCH\tSHA\tSTATUS\tDURATION\tCOMPLETED")
+	for _, r := range list.Runs {
+		sha := r.SHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, r.Repo, r.Branch, sha, r.Status,
+			r.Duration.Round(time.Second), r.Completed.Local().Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if list.NextOffset != 0 {
+		fmt.Fprintf(out, "\n%d of %d runs, use --offset %d for more\n", len(list.Runs), list.Total, list.NextOffset)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	cloneSecretPrefix = "tekton-ci-clone-"
+
+	// Tokens for GitHub Apps must be used with this username when cloning,
+	// GitHub ignores the username for personal access tokens.
+	cloneUsername = "x-access-token"
+)
+
+// CloneSecretCreator is implemented by values that can create Secrets with
+// the credentials to clone a repository.
+type CloneSecretCreator interface {
+	// Secret returns a basic-auth Secret for the namespace, with the
+	// credentials for the repository e.g. "my-org/my-repo".
+	//
+	// The Secret is named, but not created, so that it can be referenced
+	// before deciding whether or not to create it.
+	//
+	// If no credentials are needed, nil is returned.
+	Secret(ctx context.Context, ns, repo string) (*corev1.Secret, error)
+
+	// Create creates a Secret returned by Secret, the name can be changed
+	// before creating it.
+	//
+	// If a Secret with the name already exists, its credentials are
+	// replaced, so that retried work creates one Secret.
+	Create(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error)
+
+	// Delete deletes a created Secret, this is used when the Secret is not
+	// needed after all.
+	Delete(ctx context.Context, secret *corev1.Secret) error
+
+	// SetOwner updates the Secret so that it's deleted along with the owner.
+	SetOwner(ctx context.Context, secret *corev1.Secret, owner metav1.OwnerReference) error
+}
+
+// NewCloneSecrets creates and returns a KubeCloneSecrets that creates Secrets
+// with the token from the provider.
+func NewCloneSecrets(p Provider, c kubernetes.Interface) *KubeCloneSecrets {
+	return &KubeCloneSecrets{provider: p, coreClient: c}
+}
+
+// KubeCloneSecrets is an implementation of CloneSecretCreator.
+type KubeCloneSecrets struct {
+	provider   Provider
+	coreClient kubernetes.Interface
+}
+
+// Secret implements the CloneSecretCreator interface.
+//
+// If the provider has no token for the repository, nil is returned.
+func (k *KubeCloneSecrets) Secret(ctx context.Context, ns, repo string) (*corev1.Secret, error) {
+	token, err := k.provider.Token(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cloneSecretPrefix + utilrand.String(5),
+			Namespace: ns,
+			Labels:    map[string]string{"app.kubernetes.io/part-of": "Tekton-CI"},
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		StringData: map[string]string{
+			corev1.BasicAuthUsernameKey: cloneUsername,
+			corev1.BasicAuthPasswordKey: token,
+		},
+	}
+	return secret, nil
+}
+
+// Create implements the CloneSecretCreator interface.
+func (k *KubeCloneSecrets) Create(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	secrets := k.coreClient.CoreV1().Secrets(secret.ObjectMeta.Namespace)
+	created, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if !errors.IsAlreadyExists(err) {
+		return created, err
+	}
+	existing, err := secrets.Get(ctx, secret.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	updated := existing.DeepCopy()
+	updated.Data = nil
+	updated.StringData = secret.StringData
+	return secrets.Update(ctx, updated, metav1.UpdateOptions{})
+}
+
+// Delete implements the CloneSecretCreator interface.
+func (k *KubeCloneSecrets) Delete(ctx context.Context, secret *corev1.Secret) error {
+	return k.coreClient.CoreV1().Secrets(secret.ObjectMeta.Namespace).Delete(ctx, secret.ObjectMeta.Name, metav1.DeleteOptions{})
+}
+
+// SetOwner implements the CloneSecretCreator interface.
+func (k *KubeCloneSecrets) SetOwner(ctx context.Context, secret *corev1.Secret, owner metav1.OwnerReference) error {
+	updated := secret.DeepCopy()
+	updated.ObjectMeta.OwnerReferences = append(updated.ObjectMeta.OwnerReferences, owner)
+	_, err := k.coreClient.CoreV1().Secrets(secret.ObjectMeta.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	return err
+}
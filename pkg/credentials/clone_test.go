@@ -0,0 +1,144 @@
+package credentials
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ CloneSecretCreator = (*KubeCloneSecrets)(nil)
+
+func TestCloneSecretsSecret(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	c := NewCloneSecrets(NewStatic("test-token"), fakeClient)
+
+	secret, err := c.Secret(context.TODO(), testNS, "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(secret.ObjectMeta.Name, "tekton-ci-clone-") {
+		t.Fatalf("got name %q, want tekton-ci-clone- prefix", secret.ObjectMeta.Name)
+	}
+	want := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.ObjectMeta.Name,
+			Namespace: testNS,
+			Labels:    map[string]string{"app.kubernetes.io/part-of": "Tekton-CI"},
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		StringData: map[string]string{
+			"username": "x-access-token",
+			"password": "test-token",
+		},
+	}
+	if diff := cmp.Diff(want, secret); diff != "" {
+		t.Fatalf("secret incorrect:\n%s", diff)
+	}
+	assertSecretCount(t, fakeClient, 0)
+}
+
+func TestCloneSecretsSecretWithNoToken(t *testing.T) {
+	c := NewCloneSecrets(NewStatic(""), fake.NewSimpleClientset())
+
+	secret, err := c.Secret(context.TODO(), testNS, "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret != nil {
+		t.Fatalf("got %#v, want no secret", secret)
+	}
+}
+
+func TestCloneSecretsCreateAndDelete(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	c := NewCloneSecrets(NewStatic("test-token"), fakeClient)
+	secret := mustCreateSecret(t, c)
+
+	created, err := fakeClient.CoreV1().Secrets(testNS).Get(context.TODO(), secret.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := created.StringData[corev1.BasicAuthPasswordKey]; p != "test-token" {
+		t.Fatalf("got password %s, want test-token", p)
+	}
+
+	if err := c.Delete(context.TODO(), secret); err != nil {
+		t.Fatal(err)
+	}
+	assertSecretCount(t, fakeClient, 0)
+}
+
+func TestCloneSecretsCreateExisting(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	c := NewCloneSecrets(NewStatic("old-token"), fakeClient)
+	secret := mustCreateSecret(t, c)
+	c = NewCloneSecrets(NewStatic("new-token"), fakeClient)
+	replacement, err := c.Secret(context.TODO(), testNS, "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement.ObjectMeta.Name = secret.ObjectMeta.Name
+
+	if _, err := c.Create(context.TODO(), replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := fakeClient.CoreV1().Secrets(testNS).Get(context.TODO(), secret.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := updated.StringData[corev1.BasicAuthPasswordKey]; p != "new-token" {
+		t.Fatalf("got password %s, want new-token", p)
+	}
+	assertSecretCount(t, fakeClient, 1)
+}
+
+func assertSecretCount(t *testing.T, fakeClient *fake.Clientset, want int) {
+	t.Helper()
+	secrets, err := fakeClient.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != want {
+		t.Fatalf("got %d secrets, want %d", l, want)
+	}
+}
+
+func mustCreateSecret(t *testing.T, c *KubeCloneSecrets) *corev1.Secret {
+	t.Helper()
+	secret, err := c.Secret(context.TODO(), testNS, "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.Create(context.TODO(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestCloneSecretsSetOwner(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+	c := NewCloneSecrets(NewStatic("test-token"), fakeClient)
+	secret := mustCreateSecret(t, c)
+	owner := metav1.OwnerReference{APIVersion: "tekton.dev/v1beta1", Kind: "PipelineRun", Name: "my-run", UID: "test-uid"}
+
+	if err := c.SetOwner(context.TODO(), secret, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := fakeClient.CoreV1().Secrets(testNS).Get(context.TODO(), secret.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]metav1.OwnerReference{owner}, updated.ObjectMeta.OwnerReferences); diff != "" {
+		t.Fatalf("owner references incorrect:\n%s", diff)
+	}
+}
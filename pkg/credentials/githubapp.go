@@ -0,0 +1,226 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultGitHubAppName is the name of the Secret that the GitHub App
+	// credentials are read from.
+	DefaultGitHubAppName = "tekton-ci-github-app"
+
+	// GitHubAppIDKey is the key in the Secret for the App ID.
+	GitHubAppIDKey = "app-id"
+
+	// GitHubAppPrivateKeyKey is the key in the Secret for the PEM encoded
+	// private key.
+	GitHubAppPrivateKeyKey = "private-key"
+
+	// DefaultGitHubAPIURL is the API endpoint for github.com.
+	DefaultGitHubAPIURL = "https://api.github.com"
+
+	// Installation tokens are refreshed this long before they expire, so that
+	// they don't expire during a request.
+	tokenExpiryMargin = time.Minute
+)
+
+// InstallationRecorder is implemented by providers that can record the
+// GitHub App installation for a repository from an incoming hook.
+type InstallationRecorder interface {
+	// RecordInstallation records the installation ID for a repository e.g.
+	// "my-org/my-repo".
+	RecordInstallation(repo string, id int64)
+}
+
+// GitHubApp is an implementation of Provider that authenticates as a GitHub
+// App, and exchanges signed JWTs for installation tokens.
+type GitHubApp struct {
+	appID  int64
+	key    *rsa.PrivateKey
+	apiURL string
+	client *http.Client
+	now    func() time.Time
+
+	mu            sync.Mutex
+	installations map[string]int64
+	tokens        map[int64]cachedToken
+}
+
+// NewGitHubApp creates and returns a GitHubApp that uses the provided API URL
+// to create installation tokens.
+func NewGitHubApp(appID int64, key *rsa.PrivateKey, apiURL string, client *http.Client) *GitHubApp {
+	return &GitHubApp{
+		appID:         appID,
+		key:           key,
+		apiURL:        strings.TrimSuffix(apiURL, "/"),
+		client:        client,
+		now:           time.Now,
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]cachedToken),
+	}
+}
+
+// NewGitHubAppFromSecret reads the App ID and private key from the named
+// Secret and creates a GitHubApp.
+func NewGitHubAppFromSecret(ctx context.Context, c kubernetes.Interface, ns, name, apiURL string, client *http.Client) (*GitHubApp, error) {
+	secret, err := c.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	appID, err := strconv.ParseInt(strings.TrimSpace(string(secret.Data[GitHubAppIDKey])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the app ID in %s: %w", name, err)
+	}
+	key, err := ParsePrivateKey(secret.Data[GitHubAppPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the private key in %s: %w", name, err)
+	}
+	return NewGitHubApp(appID, key, apiURL, client), nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS1 or PKCS8 RSA private key.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// RecordInstallation implements the InstallationRecorder interface.
+func (g *GitHubApp) RecordInstallation(repo string, id int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.installations[repo] = id
+}
+
+// Token implements the Provider interface.
+//
+// The installation for the repository is taken from previously recorded
+// hooks, or is looked up in the API if no hook has been seen.
+func (g *GitHubApp) Token(ctx context.Context, name string) (string, error) {
+	id, err := g.installation(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	cached, ok := g.tokens[id]
+	g.mu.Unlock()
+	if ok && g.now().Add(tokenExpiryMargin).Before(cached.expires) {
+		return cached.token, nil
+	}
+	var created struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := g.do(ctx, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", id), http.StatusCreated, &created); err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	g.tokens[id] = cachedToken{token: created.Token, expires: created.ExpiresAt}
+	g.mu.Unlock()
+	return created.Token, nil
+}
+
+func (g *GitHubApp) installation(ctx context.Context, name string) (int64, error) {
+	g.mu.Lock()
+	id, ok := g.installations[name]
+	g.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	path := "/orgs/" + name + "/installation"
+	if strings.Contains(name, "/") {
+		path = "/repos/" + name + "/installation"
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := g.do(ctx, http.MethodGet, path, http.StatusOK, &installation); err != nil {
+		return 0, fmt.Errorf("failed to find the app installation for %s: %w", name, err)
+	}
+	g.RecordInstallation(name, installation.ID)
+	return installation.ID, nil
+}
+
+func (g *GitHubApp) do(ctx context.Context, method, path string, wantStatus int, v interface{}) error {
+	token, err := g.signedJWT()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("unexpected response from %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// signedJWT returns an RS256 signed JWT that authenticates as the App.
+//
+// The issued time is backdated to allow for clock drift, GitHub rejects JWTs
+// that expire more than 10 minutes in the future.
+func (g *GitHubApp) signedJWT() (string, error) {
+	now := g.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}{
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: now.Add(9 * time.Minute).Unix(),
+		Issuer:    strconv.FormatInt(g.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
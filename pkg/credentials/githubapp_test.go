@@ -0,0 +1,280 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ Provider = (*GitHubApp)(nil)
+var _ InstallationRecorder = (*GitHubApp)(nil)
+var _ InstallationRecorder = (*KubeProvider)(nil)
+
+const testAppID = 1234
+
+func TestGitHubAppToken(t *testing.T) {
+	key := makePrivateKey(t)
+	api := newFakeGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	app := NewGitHubApp(testAppID, key, api.URL, api.Client())
+	app.RecordInstallation("my-org/my-repo", 5678)
+
+	token, err := app.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "installation-5678-token-1" {
+		t.Fatalf("got %s, want installation-5678-token-1", token)
+	}
+}
+
+func TestGitHubAppTokenCachesTokens(t *testing.T) {
+	key := makePrivateKey(t)
+	api := newFakeGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	app := NewGitHubApp(testAppID, key, api.URL, api.Client())
+	app.RecordInstallation("my-org/my-repo", 5678)
+	app.RecordInstallation("my-org/other-repo", 5678)
+	now := time.Now()
+	app.now = func() time.Time { return now }
+
+	for _, repo := range []string{"my-org/my-repo", "my-org/other-repo"} {
+		token, err := app.Token(context.TODO(), repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "installation-5678-token-1" {
+			t.Fatalf("Token(%s) got %s, want installation-5678-token-1", repo, token)
+		}
+	}
+
+	// The fake tokens expire after an hour.
+	now = now.Add(time.Hour)
+	token, err := app.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "installation-5678-token-2" {
+		t.Fatalf("got %s, want installation-5678-token-2", token)
+	}
+}
+
+func TestGitHubAppTokenLooksUpInstallations(t *testing.T) {
+	key := makePrivateKey(t)
+	api := newFakeGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	app := NewGitHubApp(testAppID, key, api.URL, api.Client())
+
+	tokenTests := []struct {
+		name string
+		want string
+	}{
+		{"my-org/my-repo", "installation-100-token-1"},
+		{"my-org", "installation-200-token-1"},
+	}
+
+	for _, tt := range tokenTests {
+		token, err := app.Token(context.TODO(), tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != tt.want {
+			t.Errorf("Token(%s) got %s, want %s", tt.name, token, tt.want)
+		}
+	}
+}
+
+func TestGitHubAppTokenWithUnknownInstallation(t *testing.T) {
+	key := makePrivateKey(t)
+	api := newFakeGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	app := NewGitHubApp(testAppID, key, api.URL, api.Client())
+
+	_, err := app.Token(context.TODO(), "other-org/my-repo")
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Fatalf("got %v, want a not found error", err)
+	}
+}
+
+func TestKubeProviderRecordsInstallations(t *testing.T) {
+	key := makePrivateKey(t)
+	api := newFakeGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	app := NewGitHubApp(testAppID, key, api.URL, api.Client())
+	p := NewKubeProvider(testRouter, DefaultName, fake.NewSimpleClientset(), app, time.Minute)
+
+	p.RecordInstallation("my-org/my-repo", 5678)
+
+	token, err := p.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "installation-5678-token-1" {
+		t.Fatalf("got %s, want installation-5678-token-1", token)
+	}
+}
+
+func TestNewGitHubAppFromSecret(t *testing.T) {
+	key := makePrivateKey(t)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	fakeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultGitHubAppName, Namespace: testNS},
+		Data: map[string][]byte{
+			GitHubAppIDKey:         []byte("1234\n"),
+			GitHubAppPrivateKeyKey: keyPEM,
+		},
+	})
+
+	app, err := NewGitHubAppFromSecret(context.TODO(), fakeClient, testNS, DefaultGitHubAppName, DefaultGitHubAPIURL, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.appID != testAppID {
+		t.Fatalf("got app ID %d, want %d", app.appID, testAppID)
+	}
+	if !app.key.Equal(key) {
+		t.Fatal("private key was not parsed")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := makePrivateKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyTests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"PKCS1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), ""},
+		{"PKCS8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), ""},
+		{"not PEM", []byte("not a key"), "no PEM data found"},
+	}
+
+	for _, tt := range keyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParsePrivateKey(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.Equal(key) {
+				t.Fatal("parsed key does not match")
+			}
+		})
+	}
+}
+
+func makePrivateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newFakeGitHubAPI returns a server that verifies the JWT is signed by the
+// App, and issues a new token for each request for an installation token.
+//
+// The repository "my-org/my-repo" is installed with ID 100, and the
+// organisation "my-org" with ID 200.
+func newFakeGitHubAPI(t *testing.T, pub *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	issued := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/access_tokens") {
+			http.NotFound(w, r)
+			return
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/app/installations/"), "/access_tokens")
+		issued[id]++
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, map[string]interface{}{
+			"token":      fmt.Sprintf("installation-%s-token-%d", id, issued[id]),
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("/repos/my-org/my-repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{"id": 100})
+	})
+	mux.HandleFunc("/orgs/my-org/installation", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{"id": 200})
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifyJWT(pub, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+			t.Errorf("invalid JWT: %s", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func verifyJWT(pub *rsa.PublicKey, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("got %d parts, want 3", len(parts))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig); err != nil {
+		return err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return err
+	}
+	if claims.Issuer != fmt.Sprint(testAppID) {
+		return fmt.Errorf("got issuer %s, want %d", claims.Issuer, testAppID)
+	}
+	if claims.ExpiresAt-claims.IssuedAt > 600 {
+		return fmt.Errorf("token is valid for more than 10 minutes")
+	}
+	return nil
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+package credentials
+
+import (
+	"context"
+)
+
+// Provider is implemented by values that can find the API token to use for a
+// repository.
+type Provider interface {
+	// Token returns the token for a repository e.g. "my-org/my-repo", or for
+	// an organisation e.g. "my-org".
+	Token(ctx context.Context, name string) (string, error)
+}
@@ -0,0 +1,122 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+)
+
+// DefaultName is the name of the Secret that tokens are looked up in.
+const DefaultName = "tekton-ci-tokens"
+
+// KubeProvider is an implementation of Provider that reads tokens from
+// v1.Secrets.
+type KubeProvider struct {
+	coreClient kubernetes.Interface
+	router     routing.Router
+	name       string
+	fallback   Provider
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// NewKubeProvider creates and returns a KubeProvider.
+//
+// Tokens are looked up in the namespace that the repository is routed to, if
+// the route references a token, that is used, otherwise the named Secret is
+// checked for a key for the repository ("my-org_my-repo") and then the
+// organisation ("my-org").
+//
+// If no token is found, the fallback provider is used.
+//
+// Tokens are cached for the ttl, so that updates to the Secrets are picked up.
+func NewKubeProvider(r routing.Router, n string, c kubernetes.Interface, fallback Provider, ttl time.Duration) *KubeProvider {
+	return &KubeProvider{
+		coreClient: c,
+		router:     r,
+		name:       n,
+		fallback:   fallback,
+		ttl:        ttl,
+		now:        time.Now,
+		tokens:     make(map[string]cachedToken),
+	}
+}
+
+// Token implements the Provider interface.
+func (k *KubeProvider) Token(ctx context.Context, name string) (string, error) {
+	k.mu.Lock()
+	cached, ok := k.tokens[name]
+	k.mu.Unlock()
+	if ok && k.now().Before(cached.expires) {
+		return cached.token, nil
+	}
+	token, err := k.lookup(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	k.mu.Lock()
+	k.tokens[name] = cachedToken{token: token, expires: k.now().Add(k.ttl)}
+	k.mu.Unlock()
+	return token, nil
+}
+
+func (k *KubeProvider) lookup(ctx context.Context, name string) (string, error) {
+	route, err := k.router.Route(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if ref := route.TokenRef; ref != nil {
+		return k.secretKey(ctx, route.Namespace, ref.Name, ref.Key)
+	}
+	secret, err := k.coreClient.CoreV1().Secrets(route.Namespace).Get(ctx, k.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return k.fallback.Token(ctx, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	org := strings.SplitN(name, "/", 2)[0]
+	for _, key := range []string{strings.ReplaceAll(name, "/", "_"), org} {
+		if token, ok := secret.Data[key]; ok {
+			return string(token), nil
+		}
+	}
+	return k.fallback.Token(ctx, name)
+}
+
+func (k *KubeProvider) secretKey(ctx context.Context, ns, name, key string) (string, error) {
+	secret, err := k.coreClient.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	token, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("no token found, looked for %s in %s", key, name)
+	}
+	return string(token), nil
+}
+
+// RecordInstallation implements the InstallationRecorder interface, by
+// passing the installation to the fallback provider if it records
+// installations.
+func (k *KubeProvider) RecordInstallation(repo string, id int64) {
+	if r, ok := k.fallback.(InstallationRecorder); ok {
+		r.RecordInstallation(repo, id)
+	}
+}
@@ -0,0 +1,135 @@
+package credentials
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+)
+
+var _ Provider = (*KubeProvider)(nil)
+var _ Provider = StaticProvider{}
+
+const testNS = "testing"
+
+var testRouter = routing.NewStatic(routing.Route{Namespace: testNS})
+
+func TestToken(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(makeSecret(DefaultName, map[string]string{
+		"my-org_my-repo": "repo-token",
+		"my-org":         "org-token",
+	}))
+	p := NewKubeProvider(testRouter, DefaultName, fakeClient, NewStatic("global-token"), time.Minute)
+
+	tokenTests := []struct {
+		name string
+		want string
+	}{
+		{"my-org/my-repo", "repo-token"},
+		{"my-org/other-repo", "org-token"},
+		{"my-org", "org-token"},
+		{"other-org/my-repo", "global-token"},
+	}
+
+	for _, tt := range tokenTests {
+		token, err := p.Token(context.TODO(), tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != tt.want {
+			t.Errorf("Token(%s) got %s, want %s", tt.name, token, tt.want)
+		}
+	}
+}
+
+func TestTokenWithMissingSecret(t *testing.T) {
+	p := NewKubeProvider(testRouter, DefaultName, fake.NewSimpleClientset(), NewStatic("global-token"), time.Minute)
+
+	token, err := p.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "global-token" {
+		t.Fatalf("got %s, want global-token", token)
+	}
+}
+
+func TestTokenWithTokenRef(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(makeSecret("repo-secrets", map[string]string{"token": "ref-token"}))
+	router := routing.NewStatic(routing.Route{
+		Namespace: testNS,
+		TokenRef:  &v1alpha1.SecretKeyReference{Name: "repo-secrets", Key: "token"},
+	})
+	p := NewKubeProvider(router, DefaultName, fakeClient, NewStatic("global-token"), time.Minute)
+
+	token, err := p.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "ref-token" {
+		t.Fatalf("got %s, want ref-token", token)
+	}
+}
+
+func TestTokenWithMissingTokenRef(t *testing.T) {
+	router := routing.NewStatic(routing.Route{
+		Namespace: testNS,
+		TokenRef:  &v1alpha1.SecretKeyReference{Name: "repo-secrets", Key: "token"},
+	})
+	p := NewKubeProvider(router, DefaultName, fake.NewSimpleClientset(), NewStatic("global-token"), time.Minute)
+
+	_, err := p.Token(context.TODO(), "my-org/my-repo")
+	if err == nil {
+		t.Fatal("expected an error with a missing token secret")
+	}
+}
+
+func TestTokenIsRefreshed(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(makeSecret(DefaultName, map[string]string{"my-org": "old-token"}))
+	p := NewKubeProvider(testRouter, DefaultName, fakeClient, NewStatic("global-token"), time.Minute)
+	now := time.Date(2020, time.October, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	assertToken(t, p, "old-token")
+
+	_, err := fakeClient.CoreV1().Secrets(testNS).Update(context.TODO(), makeSecret(DefaultName, map[string]string{"my-org": "new-token"}), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertToken(t, p, "old-token")
+
+	now = now.Add(time.Minute * 2)
+	assertToken(t, p, "new-token")
+}
+
+func assertToken(t *testing.T, p Provider, want string) {
+	t.Helper()
+	token, err := p.Token(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != want {
+		t.Fatalf("got token %s, want %s", token, want)
+	}
+}
+
+func makeSecret(name string, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNS,
+		},
+		Data: map[string][]byte{},
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
@@ -0,0 +1,144 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// HookIDAnnotation is the annotation with the ID of the hook that a
+	// PipelineRun was created for.
+	HookIDAnnotation = "tekton.dev/ci-hook-id"
+
+	// HookIDLabel is the label with the ID of the hook that a PipelineRun was
+	// created for, this is used to find PipelineRuns for a hook.
+	HookIDLabel = "tekton.dev/ci-hook-id"
+
+	// DefaultSize is the number of recently seen hooks that are cached.
+	DefaultSize = 1000
+)
+
+// Deduplicator finds the PipelineRuns that were already created for a hook,
+// so that hooks that are redelivered or retried don't create duplicate
+// PipelineRuns.
+//
+// Recently seen hooks are cached, other hooks are found by the HookIDLabel.
+type Deduplicator struct {
+	client pipelineclientset.Interface
+	size   int
+
+	mu     sync.Mutex
+	recent map[string]types.NamespacedName
+	order  []string
+}
+
+// New creates and returns a Deduplicator that caches the size most recently
+// seen hooks.
+func New(c pipelineclientset.Interface, size int) *Deduplicator {
+	return &Deduplicator{
+		client: c,
+		size:   size,
+		recent: map[string]types.NamespacedName{},
+	}
+}
+
+// Recent returns the PipelineRun that was created for a recently seen hook,
+// or nil if the hook has not been seen.
+func (d *Deduplicator) Recent(ctx context.Context, id string) (*pipelinev1.PipelineRun, error) {
+	d.mu.Lock()
+	name, ok := d.recent[id]
+	d.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	pr, err := d.client.TektonV1beta1().PipelineRuns(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		d.forget(id)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// Find returns the PipelineRun that was created in the namespace for the
+// hook, or nil if no PipelineRun was created.
+func (d *Deduplicator) Find(ctx context.Context, ns, id string) (*pipelinev1.PipelineRun, error) {
+	pr, err := d.Recent(ctx, id)
+	if err != nil || pr != nil {
+		return pr, err
+	}
+	if len(validation.IsValidLabelValue(id)) > 0 {
+		return nil, nil
+	}
+	runs, err := d.client.TektonV1beta1().PipelineRuns(ns).List(ctx, metav1.ListOptions{LabelSelector: HookIDLabel + "=" + id})
+	if err != nil {
+		return nil, err
+	}
+	var found *pipelinev1.PipelineRun
+	for i := range runs.Items {
+		r := &runs.Items[i]
+		if r.ObjectMeta.Annotations[HookIDAnnotation] != id {
+			continue
+		}
+		if found == nil || r.ObjectMeta.CreationTimestamp.Before(&found.ObjectMeta.CreationTimestamp) {
+			found = r
+		}
+	}
+	if found != nil {
+		d.Created(id, found)
+	}
+	return found, nil
+}
+
+// Created records the PipelineRun that was created for the hook.
+func (d *Deduplicator) Created(id string, pr *pipelinev1.PipelineRun) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.recent[id]; !ok {
+		d.order = append(d.order, id)
+	}
+	d.recent[id] = types.NamespacedName{Namespace: pr.ObjectMeta.Namespace, Name: pr.ObjectMeta.Name}
+	for len(d.order) > d.size {
+		delete(d.recent, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+func (d *Deduplicator) forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.recent, id)
+	for i, v := range d.order {
+		if v == id {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Mark annotates the PipelineRun with the ID of the hook, and labels it if
+// the ID is a valid label value, so that it can be found by Find.
+func Mark(pr *pipelinev1.PipelineRun, id string) {
+	if id == "" {
+		return
+	}
+	if pr.ObjectMeta.Annotations == nil {
+		pr.ObjectMeta.Annotations = map[string]string{}
+	}
+	pr.ObjectMeta.Annotations[HookIDAnnotation] = id
+	if len(validation.IsValidLabelValue(id)) == 0 {
+		if pr.ObjectMeta.Labels == nil {
+			pr.ObjectMeta.Labels = map[string]string{}
+		}
+		pr.ObjectMeta.Labels[HookIDLabel] = id
+	}
+}
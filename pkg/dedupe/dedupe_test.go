@@ -0,0 +1,130 @@
+package dedupe
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testNS = "testing"
+
+func TestFindWithNoPipelineRuns(t *testing.T) {
+	d := New(fakeclientset.NewSimpleClientset(), DefaultSize)
+
+	pr, err := d.Find(context.TODO(), testNS, "hook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pr != nil {
+		t.Fatalf("got %#v, want nil", pr)
+	}
+}
+
+func TestFindWithLabelledPipelineRuns(t *testing.T) {
+	now := time.Now()
+	d := New(fakeclientset.NewSimpleClientset(
+		makePipelineRun("first-run", "hook-1", now),
+		makePipelineRun("second-run", "hook-1", now.Add(time.Minute)),
+		makePipelineRun("other-run", "hook-2", now),
+	), DefaultSize)
+
+	pr, err := d.Find(context.TODO(), testNS, "hook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pr == nil || pr.ObjectMeta.Name != "first-run" {
+		t.Fatalf("got %#v, want first-run", pr)
+	}
+}
+
+func TestFindWithRecentlyCreatedPipelineRun(t *testing.T) {
+	pr := makePipelineRun("first-run", "hook-1", time.Now())
+	// Recently created PipelineRuns are found even without the label.
+	pr.ObjectMeta.Labels = nil
+	d := New(fakeclientset.NewSimpleClientset(pr), DefaultSize)
+	d.Created("hook-1", pr)
+
+	found, err := d.Find(context.TODO(), testNS, "hook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found == nil || found.ObjectMeta.Name != "first-run" {
+		t.Fatalf("got %#v, want first-run", found)
+	}
+}
+
+func TestRecentWithDeletedPipelineRun(t *testing.T) {
+	d := New(fakeclientset.NewSimpleClientset(), DefaultSize)
+	d.Created("hook-1", makePipelineRun("first-run", "hook-1", time.Now()))
+
+	pr, err := d.Recent(context.TODO(), "hook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pr != nil {
+		t.Fatalf("got %#v, want nil", pr)
+	}
+	if _, ok := d.recent["hook-1"]; ok {
+		t.Fatal("deleted PipelineRun was not forgotten")
+	}
+}
+
+func TestCreatedEvictsOldestHooks(t *testing.T) {
+	d := New(fakeclientset.NewSimpleClientset(), 2)
+
+	for _, id := range []string{"hook-1", "hook-2", "hook-3"} {
+		d.Created(id, makePipelineRun(id+"-run", id, time.Now()))
+	}
+
+	if diff := cmp.Diff([]string{"hook-2", "hook-3"}, d.order); diff != "" {
+		t.Fatalf("got different recent hooks:\n%s", diff)
+	}
+	if _, ok := d.recent["hook-1"]; ok {
+		t.Fatal("oldest hook was not evicted")
+	}
+}
+
+func TestMark(t *testing.T) {
+	markTests := []struct {
+		id        string
+		wantLabel string
+	}{
+		{"72d3162e-cc78-11e3-81ab-4c9367dc0958", "72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+		{strings.Repeat("a", 64), ""},
+		{"invalid/label", ""},
+	}
+
+	for _, tt := range markTests {
+		pr := &pipelinev1.PipelineRun{}
+		Mark(pr, tt.id)
+
+		if a := pr.ObjectMeta.Annotations[HookIDAnnotation]; a != tt.id {
+			t.Errorf("Mark(%q) got annotation %q", tt.id, a)
+		}
+		if l := pr.ObjectMeta.Labels[HookIDLabel]; l != tt.wantLabel {
+			t.Errorf("Mark(%q) got label %q, want %q", tt.id, l, tt.wantLabel)
+		}
+	}
+}
+
+func makePipelineRun(name, id string, created time.Time) *pipelinev1.PipelineRun {
+	return &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNS,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{HookIDLabel: id},
+			Annotations:       map[string]string{HookIDAnnotation: id},
+		},
+	}
+}
@@ -0,0 +1,175 @@
+package deliveries
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// AdminPath is the path that the AdminHandler serves requests under.
+const AdminPath = "/admin/hooks"
+
+// ReplayResult is the response from replaying a delivery.
+type ReplayResult struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Body   string `json:"body,omitempty"`
+}
+
+// AdminHandler implements the http.Handler interface, it serves the recorded
+// deliveries, and replays them.
+//
+//	GET  /admin/hooks?status=failed     lists the deliveries
+//	GET  /admin/hooks/{id}              returns a delivery
+//	POST /admin/hooks/{id}/replay       replays a delivery
+//	POST /admin/hooks/replay?status=failed replays the deliveries with a status
+type AdminHandler struct {
+	store  Store
+	replay http.Handler
+	log    logger.Logger
+}
+
+// NewAdminHandler creates and returns a new AdminHandler, deliveries are
+// replayed by serving them to the replay handler.
+func NewAdminHandler(s Store, replay http.Handler, l logger.Logger) *AdminHandler {
+	return &AdminHandler{store: s, replay: replay, log: l}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPath), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		h.list(w, r)
+	case r.Method == http.MethodPost && path == "replay":
+		h.replayAll(w, r)
+	case r.Method == http.MethodGet && len(parts) == 1:
+		h.get(w, r, parts[0])
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "replay":
+		h.replayOne(w, r, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *AdminHandler) list(w http.ResponseWriter, r *http.Request) {
+	found, err := h.store.List(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		h.log.Errorf("error listing hook deliveries: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, found)
+}
+
+func (h *AdminHandler) get(w http.ResponseWriter, r *http.Request, id string) {
+	d, err := h.store.Get(r.Context(), id)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Errorf("error fetching hook delivery %s: %s", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, d)
+}
+
+func (h *AdminHandler) replayOne(w http.ResponseWriter, r *http.Request, id string) {
+	d, err := h.store.Get(r.Context(), id)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Errorf("error fetching hook delivery %s: %s", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := h.replayDelivery(r.Context(), d)
+	if err != nil {
+		h.log.Errorf("error replaying hook delivery %s: %s", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, result)
+}
+
+func (h *AdminHandler) replayAll(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = StatusFailed
+	}
+	found, err := h.store.List(r.Context(), status)
+	if err != nil {
+		h.log.Errorf("error listing hook deliveries: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results := []*ReplayResult{}
+	for _, d := range found {
+		result, err := h.replayDelivery(r.Context(), d)
+		if err != nil {
+			h.log.Errorf("error replaying hook delivery %s: %s", d.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, result)
+	}
+	h.writeJSON(w, results)
+}
+
+func (h *AdminHandler) replayDelivery(ctx context.Context, d *Delivery) (*ReplayResult, error) {
+	h.log.Infow("replaying hook delivery", "id", d.ID, "path", d.Path)
+	req, err := http.NewRequestWithContext(git.WithHookID(ctx, d.ID), http.MethodPost, d.Path, bytes.NewReader(d.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = d.Headers.Clone()
+	resp := newReplayResponse()
+	h.replay.ServeHTTP(resp, req)
+	return &ReplayResult{ID: d.ID, Status: resp.status, Body: strings.TrimSpace(resp.body.String())}, nil
+}
+
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.log.Errorf("error marshaling response: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		h.log.Errorf("error writing response: %s", err)
+	}
+}
+
+// replayResponse is the http.ResponseWriter for replayed deliveries.
+type replayResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newReplayResponse() *replayResponse {
+	return &replayResponse{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *replayResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *replayResponse) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *replayResponse) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
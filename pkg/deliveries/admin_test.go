@@ -0,0 +1,119 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+)
+
+func TestAdminHandlerListsDeliveries(t *testing.T) {
+	s := makeFileStore(t)
+	saveDeliveries(t, s)
+	h := makeAdminHandler(t, s, http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/hooks?status=failed", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	found := []*Delivery{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"hook-1", "hook-3"}, deliveryIDs(found)); diff != "" {
+		t.Fatalf("got different deliveries:\n%s", diff)
+	}
+}
+
+func TestAdminHandlerGetsDeliveries(t *testing.T) {
+	s := makeFileStore(t)
+	saveDeliveries(t, s)
+	h := makeAdminHandler(t, s, http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/hooks/hook-2", nil))
+
+	d := &Delivery{}
+	if err := json.Unmarshal(rec.Body.Bytes(), d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != "hook-2" {
+		t.Fatalf("got delivery %q, want hook-2", d.ID)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/hooks/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminHandlerReplaysDeliveries(t *testing.T) {
+	s := makeFileStore(t)
+	saveDeliveries(t, s)
+	replayed := []string{}
+	h := makeAdminHandler(t, s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path != "/pipeline" || r.Header.Get("X-GitHub-Event") != "push" || string(b) != `{"ref":"refs/heads/master"}` {
+			t.Fatalf("got a different request: %s %#v %s", r.URL.Path, r.Header, b)
+		}
+		replayed = append(replayed, git.HookIDFromContext(r.Context()))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/hooks/hook-2/replay", nil))
+
+	result := &ReplayResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&ReplayResult{ID: "hook-2", Status: http.StatusAccepted}, result); diff != "" {
+		t.Fatalf("got a different result:\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/hooks/replay", nil))
+
+	results := []*ReplayResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(results); l != 2 {
+		t.Fatalf("got %d results, want 2", l)
+	}
+	if diff := cmp.Diff([]string{"hook-2", "hook-1", "hook-3"}, replayed); diff != "" {
+		t.Fatalf("got different deliveries replayed:\n%s", diff)
+	}
+}
+
+func saveDeliveries(t *testing.T, s Store) {
+	t.Helper()
+	for _, d := range []*Delivery{
+		makeDelivery("hook-1", StatusFailed, testTime),
+		makeDelivery("hook-2", StatusProcessed, testTime.Add(1)),
+		makeDelivery("hook-3", StatusFailed, testTime.Add(2)),
+	} {
+		if err := s.Save(context.TODO(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func makeAdminHandler(t *testing.T, s Store, replay http.Handler) *AdminHandler {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	return NewAdminHandler(s, replay, logger.Sugar())
+}
@@ -0,0 +1,142 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	configMapPrefix = "tekton-ci-hook-"
+	deliveryKey     = "delivery.json"
+	statusLabel     = "tekton-ci.gitops-tools.dev/hook-status"
+	partOfLabel     = "app.kubernetes.io/part-of"
+	componentLabel  = "app.kubernetes.io/component"
+	maxNameLength   = 253
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ConfigMapStore is an implementation of Store that stores each delivery in
+// a ConfigMap.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+// NewConfigMapStore creates and returns a ConfigMapStore that stores the
+// deliveries in the namespace.
+func NewConfigMapStore(c kubernetes.Interface, ns string) *ConfigMapStore {
+	return &ConfigMapStore{client: c, namespace: ns}
+}
+
+// Save implements the Store interface.
+func (s *ConfigMapStore) Save(ctx context.Context, d *Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(d.ID),
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				partOfLabel:    "Tekton-CI",
+				componentLabel: "hook-delivery",
+				statusLabel:    d.Status,
+			},
+		},
+		Data: map[string]string{deliveryKey: string(b)},
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save hook delivery %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// Get implements the Store interface.
+func (s *ConfigMapStore) Get(ctx context.Context, id string) (*Delivery, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, configMapName(id), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfigMap(cm)
+}
+
+// List implements the Store interface.
+func (s *ConfigMapStore) List(ctx context.Context, status string) ([]*Delivery, error) {
+	selector := componentLabel + "=hook-delivery"
+	if status != "" {
+		selector += "," + statusLabel + "=" + status
+	}
+	l, err := s.client.CoreV1().ConfigMaps(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	found := []*Delivery{}
+	for i := range l.Items {
+		d, err := decodeConfigMap(&l.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, d)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Received.Before(found[j].Received)
+	})
+	return found, nil
+}
+
+// Prune implements the Store interface.
+func (s *ConfigMapStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	all, err := s.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, d := range all {
+		if !d.Received.Before(before) {
+			continue
+		}
+		err := s.client.CoreV1().ConfigMaps(s.namespace).Delete(ctx, configMapName(d.ID), metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func decodeConfigMap(cm *corev1.ConfigMap) (*Delivery, error) {
+	d := &Delivery{}
+	if err := json.Unmarshal([]byte(cm.Data[deliveryKey]), d); err != nil {
+		return nil, fmt.Errorf("failed to decode hook delivery in %s: %w", cm.ObjectMeta.Name, err)
+	}
+	return d, nil
+}
+
+// configMapName returns a valid resource name for the delivery ID.
+func configMapName(id string) string {
+	name := configMapPrefix + strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(id), "-"), "-.")
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	return name
+}
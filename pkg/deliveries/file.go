@@ -0,0 +1,136 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is an implementation of Store that stores each delivery in a
+// JSON file in a directory e.g. on a PersistentVolume.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore creates and returns a FileStore that stores the deliveries in
+// the directory, creating it if necessary.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the hook delivery directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save implements the Store interface.
+//
+// The delivery is written to a temporary file which is renamed, so that
+// partially written deliveries are never read.
+func (s *FileStore) Save(ctx context.Context, d *Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp, err := ioutil.TempFile(s.dir, ".delivery-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.filename(d.ID)); err != nil {
+		return fmt.Errorf("failed to save hook delivery %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// Get implements the Store interface.
+func (s *FileStore) Get(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := readDelivery(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// List implements the Store interface.
+func (s *FileStore) List(ctx context.Context, status string) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	found := []*Delivery{}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		d, err := readDelivery(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || d.Status == status {
+			found = append(found, d)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Received.Before(found[j].Received)
+	})
+	return found, nil
+}
+
+// Prune implements the Store interface.
+func (s *FileStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	all, err := s.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for _, d := range all {
+		if !d.Received.Before(before) {
+			continue
+		}
+		if err := os.Remove(s.filename(d.ID)); err != nil && !os.IsNotExist(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// The IDs are sanitised in the same way as ConfigMap names, so that IDs
+// can't escape the directory.
+func (s *FileStore) filename(id string) string {
+	return filepath.Join(s.dir, strings.TrimPrefix(configMapName(id), configMapPrefix)+".json")
+}
+
+func readDelivery(filename string) (*Delivery, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delivery{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("failed to decode hook delivery in %s: %w", filename, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,51 @@
+package deliveries
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The processing statuses of hook deliveries.
+const (
+	StatusReceived  = "received"
+	StatusQueued    = "queued"
+	StatusProcessed = "processed"
+	StatusFailed    = "failed"
+)
+
+// ErrNotFound is returned when there is no delivery with an ID.
+var ErrNotFound = errors.New("hook delivery not found")
+
+// Delivery is a hook request that was received, with the outcome of
+// processing it.
+type Delivery struct {
+	ID       string      `json:"id"`
+	Path     string      `json:"path"`
+	Headers  http.Header `json:"headers"`
+	Body     []byte      `json:"body"`
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Attempts int         `json:"attempts"`
+	Received time.Time   `json:"received"`
+	Updated  time.Time   `json:"updated"`
+}
+
+// Store implementations persist hook deliveries, so that they can be
+// replayed.
+type Store interface {
+	// Save creates or replaces the delivery with the same ID.
+	Save(ctx context.Context, d *Delivery) error
+
+	// Get returns the delivery with the ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Delivery, error)
+
+	// List returns the deliveries with the status, or all deliveries if the
+	// status is empty, ordered by the time they were received.
+	List(ctx context.Context, status string) ([]*Delivery, error)
+
+	// Prune deletes deliveries that were received before the time, and
+	// returns the number deleted.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
@@ -0,0 +1,159 @@
+package deliveries
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// Only the start of error responses is recorded.
+const maxErrorLength = 1024
+
+// Recorder records hook deliveries and the outcome of processing them in a
+// Store.
+type Recorder struct {
+	store Store
+	log   logger.Logger
+	now   func() time.Time
+
+	// This serialises updates to the status, so that deliveries that are
+	// processed by the queue before the response is written are not
+	// recorded as queued.
+	mu sync.Mutex
+}
+
+// NewRecorder creates and returns a new Recorder.
+func NewRecorder(s Store, l logger.Logger) *Recorder {
+	return &Recorder{store: s, log: l, now: time.Now}
+}
+
+// Handler records the requests to the next handler as deliveries.
+//
+// The delivery ID is passed to the next handler in the request context, so
+// that it is used as the ID of the hook, and replayed deliveries are
+// recorded as additional attempts of the same delivery.
+func (r *Recorder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			r.log.Errorf("error reading hook body: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		ctx := req.Context()
+		id := deliveryID(req)
+
+		r.mu.Lock()
+		d, err := r.store.Get(ctx, id)
+		if err != nil {
+			if err != ErrNotFound {
+				r.log.Errorf("error fetching hook delivery %s: %s", id, err)
+			}
+			d = &Delivery{ID: id, Received: r.now()}
+		}
+		d.Path = req.URL.Path
+		d.Headers = req.Header.Clone()
+		d.Body = body
+		d.Status = StatusReceived
+		d.Error = ""
+		d.Attempts++
+		r.save(ctx, d)
+		r.mu.Unlock()
+
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, req.WithContext(git.WithHookID(ctx, id)))
+		r.responded(ctx, id, rw)
+	})
+}
+
+// Completed records the outcome of processing a queued delivery, it can be
+// used as the Done function for a queue.
+func (r *Recorder) Completed(id string, err error) {
+	ctx := context.Background()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, getErr := r.store.Get(ctx, id)
+	if getErr != nil {
+		r.log.Errorf("error fetching hook delivery %s: %s", id, getErr)
+		return
+	}
+	d.Status, d.Error = StatusProcessed, ""
+	if err != nil {
+		d.Status, d.Error = StatusFailed, err.Error()
+	}
+	r.save(ctx, d)
+}
+
+func (r *Recorder) responded(ctx context.Context, id string, rw *responseWriter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, err := r.store.Get(ctx, id)
+	if err != nil {
+		r.log.Errorf("error fetching hook delivery %s: %s", id, err)
+		return
+	}
+	switch {
+	case rw.status == http.StatusAccepted:
+		// The queue may already have completed the delivery.
+		if d.Status != StatusReceived {
+			return
+		}
+		d.Status = StatusQueued
+	case rw.status < http.StatusBadRequest:
+		d.Status = StatusProcessed
+	default:
+		d.Status, d.Error = StatusFailed, strings.TrimSpace(rw.body.String())
+	}
+	r.save(ctx, d)
+}
+
+func (r *Recorder) save(ctx context.Context, d *Delivery) {
+	d.Updated = r.now()
+	if err := r.store.Save(ctx, d); err != nil {
+		r.log.Errorf("error saving hook delivery %s: %s", d.ID, err)
+	}
+}
+
+func deliveryID(r *http.Request) string {
+	if id := git.HookIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	if id := git.DeliveryID(r); id != "" {
+		return id
+	}
+	return string(uuid.NewUUID())
+}
+
+// responseWriter records the status code, and the start of the body for
+// error responses.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest && w.body.Len() < maxErrorLength {
+		remaining := maxErrorLength - w.body.Len()
+		if len(b) < remaining {
+			remaining = len(b)
+		}
+		w.body.Write(b[:remaining])
+	}
+	return w.ResponseWriter.Write(b)
+}
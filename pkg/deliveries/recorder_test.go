@@ -0,0 +1,135 @@
+package deliveries
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+)
+
+func TestRecorderHandler(t *testing.T) {
+	handlerTests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus string
+		wantError  string
+	}{
+		{"processed", func(w http.ResponseWriter, r *http.Request) {}, StatusProcessed, ""},
+		{"queued", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}, StatusQueued, ""},
+		{"failed", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "failed to fetch the pipeline", http.StatusInternalServerError)
+		}, StatusFailed, "failed to fetch the pipeline"},
+	}
+
+	for _, tt := range handlerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := makeFileStore(t)
+			rec := makeRecorder(t, s)
+			var body, hookID string
+			h := rec.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, hookID = string(b), git.HookIDFromContext(r.Context())
+				tt.handler(w, r)
+			}))
+
+			h.ServeHTTP(httptest.NewRecorder(), makeRequest())
+
+			if body != `{"ref":"refs/heads/master"}` {
+				t.Fatalf("got body %q", body)
+			}
+			if hookID != "delivery-1" {
+				t.Fatalf("got hook ID %q, want delivery-1", hookID)
+			}
+			d, err := s.Get(context.TODO(), "delivery-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Status != tt.wantStatus || d.Error != tt.wantError {
+				t.Fatalf("got %q, %q, want %q, %q", d.Status, d.Error, tt.wantStatus, tt.wantError)
+			}
+			if d.Path != "/pipeline" || d.Headers.Get("X-GitHub-Event") != "push" {
+				t.Fatalf("request not recorded: %#v", d)
+			}
+		})
+	}
+}
+
+func TestRecorderHandlerCountsAttempts(t *testing.T) {
+	s := makeFileStore(t)
+	h := makeRecorder(t, s).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), makeRequest())
+	h.ServeHTTP(httptest.NewRecorder(), makeRequest())
+
+	d, err := s.Get(context.TODO(), "delivery-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", d.Attempts)
+	}
+}
+
+func TestRecorderHandlerWithCompletedQueuedHook(t *testing.T) {
+	s := makeFileStore(t)
+	rec := makeRecorder(t, s)
+	// This simulates the queue processing the hook before the response is
+	// written.
+	h := rec.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.Completed(git.HookIDFromContext(r.Context()), nil)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), makeRequest())
+
+	d, err := s.Get(context.TODO(), "delivery-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusProcessed {
+		t.Fatalf("got status %q, want %q", d.Status, StatusProcessed)
+	}
+}
+
+func TestRecorderCompleted(t *testing.T) {
+	s := makeFileStore(t)
+	rec := makeRecorder(t, s)
+	if err := s.Save(context.TODO(), makeDelivery("delivery-1", StatusQueued, testTime)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.Completed("delivery-1", errors.New("failed to create PipelineRun"))
+
+	d, err := s.Get(context.TODO(), "delivery-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusFailed || d.Error != "failed to create PipelineRun" {
+		t.Fatalf("got %q, %q", d.Status, d.Error)
+	}
+}
+
+func makeRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/pipeline", strings.NewReader(`{"ref":"refs/heads/master"}`))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+	return req
+}
+
+func makeRecorder(t *testing.T, s Store) *Recorder {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	return NewRecorder(s, logger.Sugar())
+}
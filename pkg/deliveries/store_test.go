@@ -0,0 +1,203 @@
+package deliveries
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ Store = (*ConfigMapStore)(nil)
+var _ Store = (*FileStore)(nil)
+
+var testTime = time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+func TestStores(t *testing.T) {
+	storeTests := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"configmap", func(t *testing.T) Store {
+			return NewConfigMapStore(fake.NewSimpleClientset(), "testing")
+		}},
+		{"file", func(t *testing.T) Store {
+			return makeFileStore(t)
+		}},
+	}
+
+	for _, tt := range storeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("save and get", func(t *testing.T) {
+				testSaveAndGet(t, tt.store(t))
+			})
+			t.Run("list", func(t *testing.T) {
+				testList(t, tt.store(t))
+			})
+			t.Run("prune", func(t *testing.T) {
+				testPrune(t, tt.store(t))
+			})
+		})
+	}
+}
+
+func testSaveAndGet(t *testing.T, s Store) {
+	ctx := context.TODO()
+	d := makeDelivery("72d3162e-cc78-11e3-81ab-4c9367dc0958", StatusReceived, testTime)
+	if err := s.Save(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	d.Status = StatusFailed
+	d.Error = "failed to create PipelineRun"
+	if err := s.Save(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(d, got); diff != "" {
+		t.Fatalf("got a different delivery:\n%s", diff)
+	}
+
+	if _, err := s.Get(ctx, "unknown"); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, s Store) {
+	ctx := context.TODO()
+	for _, d := range []*Delivery{
+		makeDelivery("hook-3", StatusFailed, testTime.Add(2*time.Minute)),
+		makeDelivery("hook-1", StatusFailed, testTime),
+		makeDelivery("hook-2", StatusProcessed, testTime.Add(time.Minute)),
+	} {
+		if err := s.Save(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listTests := []struct {
+		status string
+		want   []string
+	}{
+		{"", []string{"hook-1", "hook-2", "hook-3"}},
+		{StatusFailed, []string{"hook-1", "hook-3"}},
+		{StatusQueued, []string{}},
+	}
+
+	for _, tt := range listTests {
+		found, err := s.List(ctx, tt.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, deliveryIDs(found)); diff != "" {
+			t.Errorf("List(%q) got a different list:\n%s", tt.status, diff)
+		}
+	}
+}
+
+func testPrune(t *testing.T, s Store) {
+	ctx := context.TODO()
+	for _, d := range []*Delivery{
+		makeDelivery("hook-1", StatusProcessed, testTime.Add(-48*time.Hour)),
+		makeDelivery("hook-2", StatusFailed, testTime.Add(-25*time.Hour)),
+		makeDelivery("hook-3", StatusFailed, testTime.Add(-time.Hour)),
+	} {
+		if err := s.Save(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := s.Prune(ctx, testTime.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 2 {
+		t.Fatalf("got %d deleted, want 2", deleted)
+	}
+	found, err := s.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"hook-3"}, deliveryIDs(found)); diff != "" {
+		t.Fatalf("got different deliveries after pruning:\n%s", diff)
+	}
+}
+
+func TestConfigMapName(t *testing.T) {
+	nameTests := []struct {
+		id   string
+		want string
+	}{
+		{"72d3162e-cc78-11e3-81ab-4c9367dc0958", "tekton-ci-hook-72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+		{"Hook_ID/../1", "tekton-ci-hook-hook-id-..-1"},
+		{strings.Repeat("a", 300), "tekton-ci-hook-" + strings.Repeat("a", 238)},
+	}
+
+	for _, tt := range nameTests {
+		if got := configMapName(tt.id); got != tt.want {
+			t.Errorf("configMapName(%q) got %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFileStoreKeepsDeliveriesInTheDirectory(t *testing.T) {
+	s := makeFileStore(t)
+
+	if err := s.Save(context.TODO(), makeDelivery("../../escaped", StatusReceived, testTime)); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(files); l != 1 {
+		t.Fatalf("got %d files in the directory, want 1", l)
+	}
+}
+
+func makeDelivery(id, status string, received time.Time) *Delivery {
+	return &Delivery{
+		ID:       id,
+		Path:     "/pipeline",
+		Headers:  http.Header{"X-Github-Event": []string{"push"}},
+		Body:     []byte(`{"ref":"refs/heads/master"}`),
+		Status:   status,
+		Attempts: 1,
+		Received: received,
+		Updated:  received,
+	}
+}
+
+func makeFileStore(t *testing.T) *FileStore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tekton-ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func deliveryIDs(found []*Delivery) []string {
+	ids := []string{}
+	for _, d := range found {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
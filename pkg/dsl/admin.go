@@ -0,0 +1,384 @@
+package dsl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/cel"
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+)
+
+const (
+	// RunsAdminPath is the path that the AdminHandler serves requests to
+	// rerun and cancel PipelineRuns under.
+	RunsAdminPath = "/api/runs"
+
+	// TriggerPath is the path that the AdminHandler triggers pipelines on.
+	TriggerPath = "/api/trigger"
+
+	managedByLabel = "app.kubernetes.io/managed-by"
+	archiverSuffix = "-archiver"
+)
+
+// TriggerRequest is the body of a request to trigger a pipeline.
+//
+// The ref can be a branch, a SHA, or a full ref e.g. refs/tags/v1.0.0.
+//
+// If the ID is not empty, it's used as the hook ID, and if a PipelineRun was
+// already created with the ID, it's returned rather than creating another.
+type TriggerRequest struct {
+	Repo string `json:"repo"`
+	Ref  string `json:"ref"`
+	ID   string `json:"id,omitempty"`
+}
+
+// AdminHandler implements the http.Handler interface, it reruns and cancels
+// the PipelineRuns created by the DSL handler, and converts the pipeline
+// definition for a repository without a hook.
+//
+//	POST /api/runs/{hook-id or name}/rerun?failed=true  recreates a PipelineRun
+//	POST /api/runs/{namespace}/{name}/rerun?failed=true recreates a PipelineRun
+//	POST /api/runs/{hook-id or name}/cancel             cancels a PipelineRun
+//	POST /api/runs/{namespace}/{name}/cancel            cancels a PipelineRun
+//	POST /api/trigger                                   creates a PipelineRun
+//
+// If failed is true, only the jobs that did not succeed are rerun.
+//
+// The AdminHandler doesn't authenticate requests.
+type AdminHandler struct {
+	converter *DSLConverter
+	namespace string
+	log       logger.Logger
+}
+
+// NewAdminHandler creates and returns a new AdminHandler for the PipelineRuns
+// in the namespace, which can be metav1.NamespaceAll.
+func NewAdminHandler(d *DSLConverter, namespace string, l logger.Logger) *AdminHandler {
+	return &AdminHandler{converter: d, namespace: namespace, log: l}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == TriggerPath {
+		h.trigger(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, RunsAdminPath+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, RunsAdminPath), "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	action := parts[len(parts)-1]
+	if action != "rerun" && action != "cancel" {
+		http.NotFound(w, r)
+		return
+	}
+	pr, err := h.find(r.Context(), parts[:len(parts)-1])
+	if err != nil {
+		h.log.Errorf("error finding PipelineRun %s: %s", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pr == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if action == "rerun" {
+		h.rerun(w, r, pr)
+		return
+	}
+	h.cancel(w, r, pr)
+}
+
+// find returns the PipelineRun created by the DSL handler for the hook ID or
+// name, or the namespace and name, or nil if there is no such PipelineRun.
+func (h *AdminHandler) find(ctx context.Context, ids []string) (*pipelinev1.PipelineRun, error) {
+	var pr *pipelinev1.PipelineRun
+	var err error
+	switch {
+	case len(ids) == 1:
+		pr, err = logs.Find(ctx, h.converter.pipelineClient, h.namespace, ids[0])
+	case h.namespace == metav1.NamespaceAll || ids[0] == h.namespace:
+		pr, err = h.converter.pipelineClient.TektonV1beta1().PipelineRuns(ids[0]).Get(ctx, ids[1], metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			pr, err = nil, nil
+		}
+	}
+	if err != nil || pr == nil {
+		return nil, err
+	}
+	if pr.ObjectMeta.Labels[managedByLabel] != "dsl" || pr.ObjectMeta.Labels["app.kubernetes.io/part-of"] != "Tekton-CI" {
+		return nil, nil
+	}
+	return pr, nil
+}
+
+func (h *AdminHandler) rerun(w http.ResponseWriter, r *http.Request, pr *pipelinev1.PipelineRun) {
+	failed := false
+	if s := r.URL.Query().Get("failed"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		failed = b
+	}
+	if failed {
+		if !pr.IsDone() {
+			http.Error(w, fmt.Sprintf("PipelineRun %s has not completed", pr.ObjectMeta.Name), http.StatusConflict)
+			return
+		}
+		pr = failedPipelineRun(pr)
+		if pr == nil {
+			http.Error(w, "PipelineRun has no failed jobs", http.StatusConflict)
+			return
+		}
+	}
+	repo := repoFromURL(pr.ObjectMeta.Annotations[ciSourceURLAnnotation])
+	if repo == "" {
+		http.Error(w, fmt.Sprintf("PipelineRun %s has no source repository", pr.ObjectMeta.Name), http.StatusConflict)
+		return
+	}
+	route, err := h.converter.router.Route(r.Context(), repo)
+	if err != nil {
+		h.log.Errorf("error finding route: %s", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	created, err := h.converter.rerun(r.Context(), route, repo, pr, "")
+	if err != nil {
+		h.log.Errorf("error rerunning PipelineRun %s: %s", pr.ObjectMeta.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.log.Infow("rerun PipelineRun", "repo", repo, "pipelinerun", pr.ObjectMeta.Name, "rerun", created.ObjectMeta.Name, "failed", failed)
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *AdminHandler) cancel(w http.ResponseWriter, r *http.Request, pr *pipelinev1.PipelineRun) {
+	if pr.IsDone() || pr.IsCancelled() {
+		http.Error(w, fmt.Sprintf("PipelineRun %s has already completed", pr.ObjectMeta.Name), http.StatusConflict)
+		return
+	}
+	cancelled, err := h.converter.cancelPipelineRun(r.Context(), pr)
+	if err != nil {
+		h.log.Errorf("error cancelling PipelineRun %s: %s", pr.ObjectMeta.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, cancelled)
+}
+
+func (h *AdminHandler) trigger(w http.ResponseWriter, r *http.Request) {
+	var req TriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode the request: %s", err), http.StatusBadRequest)
+		return
+	}
+	if req.Repo == "" || req.Ref == "" {
+		http.Error(w, "the repo and ref are required", http.StatusBadRequest)
+		return
+	}
+	evt, err := h.converter.pushHook(r.Context(), req.Repo, req.Ref, req.ID)
+	if git.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Errorf("error triggering pipeline for %s: %s", req.Repo, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	created, err := h.converter.convert(withPipelineSource(r.Context(), cel.APISource), evt, req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), hookerrors.StatusCode(err))
+		return
+	}
+	if created == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.log.Errorf("error marshaling response: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		h.log.Errorf("error writing response: %s", err)
+	}
+}
+
+// pushHook returns a synthetic push hook for the head of the ref in the
+// repository, with the id as the GUID, or a new GUID if the id is empty.
+func (d *DSLConverter) pushHook(ctx context.Context, fullName, ref, id string) (*scm.PushHook, error) {
+	repo, err := d.scmClient.FindRepository(ctx, fullName)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := d.scmClient.FindCommit(ctx, fullName, ref)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id, err = newTriggerID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &scm.PushHook{
+		Ref:    triggerRef(ref, commit.Sha),
+		After:  commit.Sha,
+		Repo:   *repo,
+		Commit: *commit,
+		GUID:   id,
+	}, nil
+}
+
+// cancelPipelineRun requests that Tekton cancels the PipelineRun.
+//
+// The status is set with a merge patch, so that it doesn't conflict with the
+// controller updating the PipelineRun.
+func (d *DSLConverter) cancelPipelineRun(ctx context.Context, pr *pipelinev1.PipelineRun) (*pipelinev1.PipelineRun, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"status": pipelinev1.PipelineRunSpecStatusCancelled,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.pipelineClient.TektonV1beta1().PipelineRuns(pr.ObjectMeta.Namespace).Patch(ctx, pr.ObjectMeta.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+}
+
+// failedPipelineRun returns a copy of the completed PipelineRun with only the
+// tasks for the jobs that did not succeed, or nil if all the jobs succeeded.
+//
+// The tasks that set up the workspace are always kept, as reruns get a new
+// volume, and the archivers for the kept jobs are kept.
+//
+// Where a kept task ran after a task that is removed, it runs after the tasks
+// that the removed task ran after instead.
+func failedPipelineRun(pr *pipelinev1.PipelineRun) *pipelinev1.PipelineRun {
+	if pr.Spec.PipelineSpec == nil {
+		return nil
+	}
+	succeeded := map[string]bool{}
+	for _, tr := range pr.Status.TaskRuns {
+		if tr.Status != nil && tr.Status.GetCondition(apis.ConditionSucceeded).IsTrue() {
+			succeeded[tr.PipelineTaskName] = true
+		}
+	}
+	removed := map[string][]string{}
+	keptJobs := map[string]bool{}
+	tasks := []pipelinev1.PipelineTask{}
+	for _, t := range pr.Spec.PipelineSpec.Tasks {
+		runAfter := []string{}
+		for _, name := range t.RunAfter {
+			if previous, ok := removed[name]; ok {
+				runAfter = appendMissing(runAfter, previous...)
+				continue
+			}
+			runAfter = appendMissing(runAfter, name)
+		}
+		setup := t.Name == gitCloneTaskName || t.Name == beforeStepTaskName
+		archiver := strings.HasSuffix(t.Name, archiverSuffix) && keptJobs[strings.TrimSuffix(t.Name, archiverSuffix)]
+		if succeeded[t.Name] && !setup && !archiver {
+			removed[t.Name] = runAfter
+			continue
+		}
+		if !setup && !archiver {
+			keptJobs[logs.JobName(t.Name)] = true
+		}
+		kept := t.DeepCopy()
+		kept.RunAfter = runAfter
+		tasks = append(tasks, *kept)
+	}
+	if len(keptJobs) == 0 {
+		return nil
+	}
+	failed := pr.DeepCopy()
+	failed.Spec.PipelineSpec.Tasks = tasks
+	return failed
+}
+
+func appendMissing(s []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range s {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s = append(s, v)
+		}
+	}
+	return s
+}
+
+// triggerRef returns the ref for the push hook, refs are used as-is, and refs
+// that match the SHA of the commit have no branch.
+func triggerRef(ref, sha string) string {
+	switch {
+	case strings.HasPrefix(ref, "refs/"):
+		return ref
+	case strings.HasPrefix(sha, ref):
+		return ""
+	}
+	return "refs/heads/" + ref
+}
+
+func newTriggerID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate an ID: %w", err)
+	}
+	return "trigger-" + hex.EncodeToString(b), nil
+}
+
+// repoFromURL returns the org/repo from a clone URL, or an empty string if
+// it can't be parsed.
+func repoFromURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Join(parts, "/"), ".git")
+}
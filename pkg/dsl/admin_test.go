@@ -0,0 +1,348 @@
+package dsl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+)
+
+const testTriggerSHA = "6dcb09b5b57875f334f61aebed695e2e4193db5e"
+
+func TestAdminHandlerRerun(t *testing.T) {
+	for _, u := range []string{"/api/runs/previous-run/rerun", "/api/runs/test-id/rerun", "/api/runs/testing/previous-run/rerun"} {
+		t.Run(u, func(t *testing.T) {
+			_, h, fakeTektonClient := makeAdminHandler(t)
+			previous := makeCommandPipelineRun("previous-run", testPullRequestSHA)
+			previous.ObjectMeta.Annotations[logs.ArchiveAnnotation] = "mem://logs/testing/previous-run.log"
+			dedupe.Mark(previous, "test-id")
+			createPipelineRun(t, fakeTektonClient, previous)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, u, nil))
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+			}
+			created := decodePipelineRun(t, rec)
+			if created.ObjectMeta.Annotations[ciSourceRefAnnotation] != testPullRequestSHA {
+				t.Fatalf("rerun got ref %s, want %s", created.ObjectMeta.Annotations[ciSourceRefAnnotation], testPullRequestSHA)
+			}
+			for _, k := range []string{notificationStateAnnotation, logs.ArchiveAnnotation} {
+				if _, ok := created.ObjectMeta.Annotations[k]; ok {
+					t.Fatalf("rerun copied the %s annotation", k)
+				}
+			}
+			if claim := created.Spec.Workspaces[0].PersistentVolumeClaim.ClaimName; claim == "previous-claim" {
+				t.Fatal("rerun reused the previous volume claim")
+			}
+		})
+	}
+}
+
+func TestAdminHandlerRerunFailed(t *testing.T) {
+	_, h, fakeTektonClient := makeAdminHandler(t)
+	createPipelineRun(t, fakeTektonClient, makeFailedPipelineRun())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/runs/previous-run/rerun?failed=true", nil))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	want := []pipelinev1.PipelineTask{
+		{Name: "git-clone"},
+		{Name: "test-stage-test", RunAfter: []string{"git-clone"}},
+		{Name: "test-archiver", RunAfter: []string{"git-clone"}},
+		{Name: "deploy-stage-deploy", RunAfter: []string{"git-clone", "test-stage-test", "test-archiver"}},
+	}
+	if diff := cmp.Diff(want, decodePipelineRun(t, rec).Spec.PipelineSpec.Tasks); diff != "" {
+		t.Fatalf("rerun tasks don't match:\n%s", diff)
+	}
+}
+
+func TestAdminHandlerRerunFailedWithoutFailedJobs(t *testing.T) {
+	_, h, fakeTektonClient := makeAdminHandler(t)
+	succeeded := makeFailedPipelineRun()
+	succeeded.Status.TaskRuns["previous-run-test"].Status.Conditions[0].Status = corev1.ConditionTrue
+	succeeded.Status.TaskRuns["previous-run-deploy"] = taskRunStatus("deploy-stage-deploy", corev1.ConditionTrue)
+	running := makeFailedPipelineRun()
+	running.ObjectMeta.Name = "running-run"
+	running.Status.Conditions[0].Status = corev1.ConditionUnknown
+	createPipelineRun(t, fakeTektonClient, succeeded)
+	createPipelineRun(t, fakeTektonClient, running)
+
+	rerunTests := []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"/api/runs/previous-run/rerun?failed=true", http.StatusConflict, "PipelineRun has no failed jobs\n"},
+		{"/api/runs/running-run/rerun?failed=true", http.StatusConflict, "PipelineRun running-run has not completed\n"},
+		{"/api/runs/previous-run/rerun?failed=maybe", http.StatusBadRequest, "strconv.ParseBool: parsing \"maybe\": invalid syntax\n"},
+	}
+
+	for _, tt := range rerunTests {
+		t.Run(tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.url, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", rec.Code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.wantBody, rec.Body.String()); diff != "" {
+				t.Fatalf("body doesn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerCancel(t *testing.T) {
+	_, h, fakeTektonClient := makeAdminHandler(t)
+	createPipelineRun(t, fakeTektonClient, makeCommandPipelineRun("running-run", testPullRequestSHA))
+	completed := makeFailedPipelineRun()
+	createPipelineRun(t, fakeTektonClient, completed)
+	// The PipelineRun was changed by the controller since it was read.
+	fakeTektonClient.PrependReactor("update", "pipelineruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewConflict(pipelinev1.Resource("pipelineruns"), "running-run", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/runs/running-run/cancel", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if s := decodePipelineRun(t, rec).Spec.Status; s != pipelinev1.PipelineRunSpecStatusCancelled {
+		t.Fatalf("got status %q, want %q", s, pipelinev1.PipelineRunSpecStatusCancelled)
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "running-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pr.IsCancelled() {
+		t.Fatal("PipelineRun was not cancelled")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/runs/previous-run/cancel", nil))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestAdminHandlerTrigger(t *testing.T) {
+	triggerTests := []struct {
+		ref        string
+		wantRef    string
+		wantBranch string
+	}{
+		{"main", testTriggerSHA, "main"},
+		{"refs/tags/v1.0.0", testTriggerSHA, "v1.0.0"},
+		{testTriggerSHA[:7], testTriggerSHA, ""},
+	}
+
+	for _, tt := range triggerTests {
+		t.Run(tt.ref, func(t *testing.T) {
+			data, h, _ := makeAdminHandler(t)
+			writeContent(t, data, "Codertocat/Hello-World", PipelineFilename, `
+image: golang:latest
+
+test:
+  script:
+    - go test ./...
+`)
+			data.Commits[tt.ref] = &scm.Commit{Sha: testTriggerSHA, Message: "Fix all the bugs"}
+			rec := httptest.NewRecorder()
+			body := `{"repo":"Codertocat/Hello-World","ref":"` + tt.ref + `"}`
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/trigger", strings.NewReader(body)))
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+			}
+			created := decodePipelineRun(t, rec)
+			want := map[string]string{
+				ciSourceURLAnnotation:    testCloneURL,
+				ciSourceRefAnnotation:    tt.wantRef,
+				ciSourceBranchAnnotation: tt.wantBranch,
+			}
+			for k, v := range want {
+				if got := created.ObjectMeta.Annotations[k]; got != v {
+					t.Errorf("got annotation %s = %q, want %q", k, got, v)
+				}
+			}
+			if id := created.ObjectMeta.Annotations[ciHookIDAnnotation]; !strings.HasPrefix(id, "trigger-") {
+				t.Errorf("got hook ID %q, want a trigger ID", id)
+			}
+			if !hasEnv(created.Spec.PipelineSpec.Tasks[1].TaskSpec.Steps[0].Env, "CI_PIPELINE_SOURCE", "api") {
+				t.Error("triggered PipelineRun doesn't have CI_PIPELINE_SOURCE=api")
+			}
+		})
+	}
+}
+
+func TestAdminHandlerTriggerWithID(t *testing.T) {
+	data, h, fakeTektonClient := makeAdminHandler(t)
+	data.Commits["main"] = &scm.Commit{Sha: testTriggerSHA}
+	existing := makeCommandPipelineRun("existing-run", testTriggerSHA)
+	dedupe.Mark(existing, "test-id")
+	createPipelineRun(t, fakeTektonClient, existing)
+
+	rec := httptest.NewRecorder()
+	body := `{"repo":"Codertocat/Hello-World","ref":"main","id":"test-id"}`
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/trigger", strings.NewReader(body)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if name := decodePipelineRun(t, rec).ObjectMeta.Name; name != "existing-run" {
+		t.Fatalf("got PipelineRun %q, want existing-run", name)
+	}
+}
+
+func TestAdminHandlerErrors(t *testing.T) {
+	_, h, fakeTektonClient := makeAdminHandler(t)
+	spec := makeCommandPipelineRun("spec-run", testPullRequestSHA)
+	spec.ObjectMeta.Labels[managedByLabel] = "spec"
+	createPipelineRun(t, fakeTektonClient, spec)
+
+	errorTests := []struct {
+		method   string
+		url      string
+		body     string
+		wantCode int
+	}{
+		{http.MethodGet, "/api/trigger", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/trigger", "{", http.StatusBadRequest},
+		{http.MethodPost, "/api/trigger", `{"repo":"Codertocat/Hello-World"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/trigger", `{"repo":"Codertocat/Hello-World","ref":"unknown"}`, http.StatusNotFound},
+		{http.MethodPost, "/api/runs/unknown/rerun", "", http.StatusNotFound},
+		{http.MethodPost, "/api/runs/spec-run/cancel", "", http.StatusNotFound},
+		{http.MethodPost, "/api/runs/other-ns/spec-run/cancel", "", http.StatusNotFound},
+		{http.MethodPost, "/api/runs/spec-run/delete", "", http.StatusNotFound},
+		{http.MethodPost, "/api/runs/spec-run", "", http.StatusNotFound},
+		{http.MethodPost, "/api/other", "", http.StatusNotFound},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTriggerRef(t *testing.T) {
+	refTests := []struct {
+		ref  string
+		want string
+	}{
+		{"main", "refs/heads/main"},
+		{"refs/tags/v1.0.0", "refs/tags/v1.0.0"},
+		{testTriggerSHA, ""},
+		{testTriggerSHA[:7], ""},
+	}
+
+	for _, tt := range refTests {
+		if got := triggerRef(tt.ref, testTriggerSHA); got != tt.want {
+			t.Errorf("triggerRef(%q) got %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func hasEnv(env []corev1.EnvVar, name, value string) bool {
+	for _, v := range env {
+		if v.Name == name && v.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func makeAdminHandler(t *testing.T) (*fakescm.Data, *AdminHandler, *fakeclientset.Clientset) {
+	t.Helper()
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.Repositories = append(data.Repositories, &scm.Repository{
+		Namespace: "Codertocat",
+		Name:      "Hello-World",
+		FullName:  "Codertocat/Hello-World",
+		Branch:    "main",
+		Clone:     testCloneURL,
+	})
+	return data, NewAdminHandler(converter, testNS, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar()), fakeTektonClient
+}
+
+// makeFailedPipelineRun returns a completed PipelineRun where the build job
+// succeeded, the test job failed, and the deploy job did not run.
+func makeFailedPipelineRun() *pipelinev1.PipelineRun {
+	pr := makeCommandPipelineRun("previous-run", testPullRequestSHA)
+	pr.Spec.PipelineSpec.Tasks = []pipelinev1.PipelineTask{
+		{Name: "git-clone"},
+		{Name: "build-stage-build", RunAfter: []string{"git-clone"}},
+		{Name: "build-archiver", RunAfter: []string{"git-clone"}},
+		{Name: "test-stage-test", RunAfter: []string{"git-clone"}},
+		{Name: "test-archiver", RunAfter: []string{"git-clone"}},
+		{Name: "deploy-stage-deploy", RunAfter: []string{"build-stage-build", "build-archiver", "test-stage-test", "test-archiver"}},
+	}
+	pr.Status.Conditions = duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse}}
+	pr.Status.TaskRuns = map[string]*pipelinev1.PipelineRunTaskRunStatus{
+		"previous-run-git-clone":      taskRunStatus("git-clone", corev1.ConditionTrue),
+		"previous-run-build":          taskRunStatus("build-stage-build", corev1.ConditionTrue),
+		"previous-run-build-archiver": taskRunStatus("build-archiver", corev1.ConditionTrue),
+		"previous-run-test":           taskRunStatus("test-stage-test", corev1.ConditionFalse),
+		"previous-run-test-archiver":  taskRunStatus("test-archiver", corev1.ConditionTrue),
+	}
+	return pr
+}
+
+func taskRunStatus(name string, s corev1.ConditionStatus) *pipelinev1.PipelineRunTaskRunStatus {
+	return &pipelinev1.PipelineRunTaskRunStatus{
+		PipelineTaskName: name,
+		Status: &pipelinev1.TaskRunStatus{
+			Status: duckv1beta1.Status{
+				Conditions: duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: s}},
+			},
+		},
+	}
+}
+
+func createPipelineRun(t *testing.T, c *fakeclientset.Clientset, pr *pipelinev1.PipelineRun) {
+	t.Helper()
+	if _, err := c.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), pr, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodePipelineRun(t *testing.T, rec *httptest.ResponseRecorder) *pipelinev1.PipelineRun {
+	t.Helper()
+	pr := &pipelinev1.PipelineRun{}
+	if err := json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(pr); err != nil {
+		t.Fatal(err)
+	}
+	return pr
+}
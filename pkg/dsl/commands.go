@@ -0,0 +1,378 @@
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labelsv1 "k8s.io/apimachinery/pkg/labels"
+
+	"github.com/gitops-tools/tekton-ci/pkg/ci"
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+	"github.com/gitops-tools/tekton-ci/pkg/resources"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
+)
+
+const (
+	retestCommand   = "retest"
+	runCommand      = "run"
+	cancelCommand   = "cancel"
+	okToTestCommand = "ok-to-test"
+
+	notificationStateAnnotation = "tekton.dev/ci-notification-state"
+)
+
+// command is a slash-command parsed from a pull request comment e.g.
+// "/run my-job".
+type command struct {
+	name string
+	args []string
+}
+
+func (c command) String() string {
+	return strings.Join(append([]string{"/" + c.name}, c.args...), " ")
+}
+
+// parseCommands returns the known commands in a comment body, each command
+// must be at the start of a line.
+func parseCommands(body string) []command {
+	commands := []command{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "/") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "/"))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case retestCommand, runCommand, cancelCommand, okToTestCommand:
+			commands = append(commands, command{name: fields[0], args: fields[1:]})
+		}
+	}
+	return commands
+}
+
+// commentCommands returns the commands in a new comment on a pull request.
+func commentCommands(evt *scm.IssueCommentHook) []command {
+	if evt.Action != scm.ActionCreate || !evt.Issue.PullRequest {
+		return nil
+	}
+	return parseCommands(evt.Comment.Body)
+}
+
+// runCommands executes the commands from a pull request comment, and replies
+// to the comment with the outcome.
+//
+// Commands are only executed for users with write access to the repository,
+// or who are in the configured allow list.
+//
+// If the id is not empty, it's the ID of the hook, and the PipelineRuns are
+// created with an ID for each command, so that a hook that is redelivered
+// returns the PipelineRuns that were already created rather than creating
+// more.
+//
+// Once PipelineRuns are created, a failure to reply is logged rather than
+// returned, so that the hook isn't retried.
+func (d *DSLConverter) runCommands(ctx context.Context, evt *scm.IssueCommentHook, commands []command, id string) ([]*pipelinev1.PipelineRun, error) {
+	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
+	user := evt.Comment.Author.Login
+	d.log.Infow("processing comment commands", "repo", repo, "number", evt.Issue.Number, "user", user)
+	route, err := d.router.Route(ctx, repo)
+	if err != nil {
+		return nil, hookerrors.Kubernetes(err)
+	}
+	if !route.Allows(routing.DSLHandler) {
+		d.log.Infow("repository is not routed to the DSL handler", "repo", repo)
+		return nil, nil
+	}
+	allowed, err := d.canRunCommands(ctx, repo, user)
+	if err != nil {
+		return nil, hookerrors.SCM(err)
+	}
+	if !allowed {
+		d.log.Infow("user not permitted to run commands", "repo", repo, "user", user)
+		return nil, hookerrors.SCM(d.scmClient.CreateComment(ctx, repo, evt.Issue.Number,
+			fmt.Sprintf("@%s you do not have permission to run commands in this repository", user)))
+	}
+
+	created := []*pipelinev1.PipelineRun{}
+	replies := []string{fmt.Sprintf("@%s", user)}
+	for i, c := range commands {
+		msg, pr, err := d.runCommand(ctx, route, evt, c, commandID(id, i))
+		if err != nil {
+			d.log.Errorf("error running command %s: %s", c, err)
+			replies = append(replies, fmt.Sprintf(" * `%s` failed: %s", c, err))
+			continue
+		}
+		if pr != nil {
+			created = append(created, pr)
+		}
+		replies = append(replies, fmt.Sprintf(" * `%s` %s", c, msg))
+	}
+	err = d.scmClient.CreateComment(ctx, repo, evt.Issue.Number, strings.Join(replies, "\n"))
+	if err != nil && len(created) > 0 {
+		d.log.Errorf("error replying to comment commands: %s", err)
+		return created, nil
+	}
+	return created, hookerrors.SCM(err)
+}
+
+// commandID returns the ID for the PipelineRun created by the command at the
+// index in the comment for the hook with the ID.
+func commandID(id string, i int) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d", id, i)
+}
+
+func (d *DSLConverter) runCommand(ctx context.Context, route *routing.Route, evt *scm.IssueCommentHook, c command, id string) (string, *pipelinev1.PipelineRun, error) {
+	switch c.name {
+	case retestCommand, runCommand:
+		if id == "" {
+			break
+		}
+		existing, err := d.dedupe.Find(ctx, route.Namespace, id)
+		if err != nil {
+			return "", nil, err
+		}
+		if existing != nil {
+			d.log.Infow("pipelinerun already created for command", "command", c.String(), "id", id, "pipelinerun", existing.ObjectMeta.Name)
+			return fmt.Sprintf("created PipelineRun `%s`", existing.ObjectMeta.Name), existing, nil
+		}
+	}
+	switch c.name {
+	case retestCommand:
+		pr, err := d.retest(ctx, route, evt, id)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("created PipelineRun `%s`", pr.ObjectMeta.Name), pr, nil
+	case runCommand:
+		if len(c.args) != 1 {
+			return "", nil, fmt.Errorf("expected a single task name")
+		}
+		pr, err := d.runTask(ctx, evt, c.args[0], id)
+		if err != nil {
+			return "", nil, err
+		}
+		if pr == nil {
+			return "did not create a PipelineRun", nil, nil
+		}
+		return fmt.Sprintf("created PipelineRun `%s`", pr.ObjectMeta.Name), pr, nil
+	case cancelCommand:
+		n, err := d.cancel(ctx, route, evt)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("cancelled %d PipelineRun(s)", n), nil, nil
+	case okToTestCommand:
+		// Adding the label triggers a pull request event, which is built
+		// with the definition from the base branch.
+		repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
+		if err := d.scmClient.AddLabel(ctx, repo, evt.Issue.Number, trust.ApprovalLabel); err != nil {
+			return "", nil, err
+		}
+		return "approved the pull request for testing", nil, nil
+	}
+	return "", nil, fmt.Errorf("unknown command %s", c)
+}
+
+func (d *DSLConverter) canRunCommands(ctx context.Context, repo, user string) (bool, error) {
+	for _, v := range d.config.CommandAllowList {
+		if v == user {
+			return true, nil
+		}
+	}
+	perm, err := d.scmClient.FindUserPermission(ctx, repo, user)
+	if err != nil {
+		return false, err
+	}
+	return perm == "admin" || perm == "write", nil
+}
+
+// retest recreates the most recent PipelineRun for the head of the pull
+// request, with a new volume.
+func (d *DSLConverter) retest(ctx context.Context, route *routing.Route, evt *scm.IssueCommentHook, id string) (*pipelinev1.PipelineRun, error) {
+	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
+	pull, err := d.scmClient.FindPullRequest(ctx, repo, evt.Issue.Number)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := d.pullRequestPipelineRuns(ctx, route.Namespace, evt)
+	if err != nil {
+		return nil, err
+	}
+	for _, pr := range runs {
+		if pr.ObjectMeta.Annotations[ciSourceRefAnnotation] == pull.Sha {
+			return d.rerun(ctx, route, repo, pr, id)
+		}
+	}
+	return nil, fmt.Errorf("no previous PipelineRun for commit %s", pull.Sha)
+}
+
+// runTask converts the pipeline definition for the head of the pull request,
+// executing only the named task.
+//
+// If the id is empty, the ID of the comment is used.
+func (d *DSLConverter) runTask(ctx context.Context, evt *scm.IssueCommentHook, name, id string) (*pipelinev1.PipelineRun, error) {
+	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
+	pull, err := d.scmClient.FindPullRequest(ctx, repo, evt.Issue.Number)
+	if err != nil {
+		return nil, err
+	}
+	hook := &scm.PullRequestHook{
+		Action:      scm.ActionSync,
+		Repo:        evt.Repo,
+		PullRequest: *pull,
+		Sender:      evt.Sender,
+		GUID:        fmt.Sprintf("comment-%d", evt.Comment.ID),
+	}
+	return d.convert(ctx, hook, id, func(p *ci.Pipeline) (*ci.Pipeline, error) {
+		return manualTaskPipeline(p, name)
+	})
+}
+
+// cancel cancels all incomplete PipelineRuns for the pull request.
+func (d *DSLConverter) cancel(ctx context.Context, route *routing.Route, evt *scm.IssueCommentHook) (int, error) {
+	runs, err := d.pullRequestPipelineRuns(ctx, route.Namespace, evt)
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, pr := range runs {
+		if pr.IsDone() || pr.IsCancelled() {
+			continue
+		}
+		if _, err := d.cancelPipelineRun(ctx, pr); err != nil {
+			return cancelled, err
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// rerun recreates the PipelineRun, with new volumes and clone credentials.
+//
+// If the id is not empty, the rerun is marked with it, so that it can be
+// found by the deduplicator.
+func (d *DSLConverter) rerun(ctx context.Context, route *routing.Route, repo string, pr *pipelinev1.PipelineRun, id string) (*pipelinev1.PipelineRun, error) {
+	cfg := configForRoute(d.config, route)
+	spec := pr.Spec.DeepCopy()
+	spec.Status = ""
+	if err := d.createVolumes(ctx, route.Namespace, "", cfg.VolumeSize, spec); err != nil {
+		return nil, err
+	}
+	var cloneSecret *corev1.Secret
+	if route.CloneSecret == "" {
+		replaced, err := d.replaceCloneSecret(ctx, route.Namespace, repo, spec)
+		if err != nil {
+			return nil, err
+		}
+		cloneSecret = replaced
+	}
+	rerun := resources.PipelineRun("dsl", pr.ObjectMeta.GenerateName, *spec, func(r *pipelinev1.PipelineRun) {
+		for k, v := range pr.ObjectMeta.Annotations {
+			if !rerunSkipsAnnotation(k) {
+				r.ObjectMeta.Annotations[k] = v
+			}
+		}
+	})
+	dedupe.Mark(rerun, id)
+	created, err := d.pipelineClient.TektonV1beta1().PipelineRuns(route.Namespace).Create(ctx, rerun, metav1.CreateOptions{})
+	if err != nil {
+		d.deleteCloneSecret(ctx, cloneSecret)
+		return nil, err
+	}
+	if id != "" {
+		d.dedupe.Created(id, created)
+	}
+	d.ownCloneSecret(ctx, cloneSecret, created)
+	return created, nil
+}
+
+// rerunSkipsAnnotation returns true if the annotation describes the previous
+// PipelineRun rather than its source, and shouldn't be copied to the rerun.
+//
+// The rerun wasn't created by the previous hook, so it's not part of that
+// hook's trace, and must not be found as a duplicate of it.
+func rerunSkipsAnnotation(k string) bool {
+	switch k {
+	case notificationStateAnnotation, logs.ArchiveAnnotation, tracing.TraceContextAnnotation, ciHookIDAnnotation:
+		return true
+	}
+	return false
+}
+
+// replaceCloneSecret creates new clone credentials for a PipelineRun that
+// was cloned with credentials, the previous credentials may have expired.
+//
+// This isn't used for routes with a CloneSecret, the PipelineRun already
+// references it.
+func (d *DSLConverter) replaceCloneSecret(ctx context.Context, ns, repo string, spec *pipelinev1.PipelineRunSpec) (*corev1.Secret, error) {
+	if spec.PipelineSpec == nil {
+		return nil, nil
+	}
+	var secret *corev1.Secret
+	for _, task := range spec.PipelineSpec.Tasks {
+		if task.TaskSpec == nil {
+			continue
+		}
+		for i, v := range task.TaskSpec.Volumes {
+			if v.Name != gitCredentialsVolume || v.Secret == nil {
+				continue
+			}
+			if secret == nil {
+				planned, err := d.cloneSecrets.Secret(ctx, ns, repo)
+				if err != nil {
+					return nil, err
+				}
+				if planned == nil {
+					return nil, fmt.Errorf("no clone credentials found for %s", repo)
+				}
+				created, err := d.cloneSecrets.Create(ctx, planned)
+				if err != nil {
+					return nil, err
+				}
+				secret = created
+			}
+			task.TaskSpec.Volumes[i].Secret.SecretName = secret.ObjectMeta.Name
+		}
+	}
+	return secret, nil
+}
+
+// pullRequestPipelineRuns returns the PipelineRuns created for the pull
+// request, most recent first.
+func (d *DSLConverter) pullRequestPipelineRuns(ctx context.Context, ns string, evt *scm.IssueCommentHook) ([]*pipelinev1.PipelineRun, error) {
+	list, err := d.pipelineClient.TektonV1beta1().PipelineRuns(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: labelsv1.Set(map[string]string{"app.kubernetes.io/part-of": "Tekton-CI"}).AsSelector().String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	runs := []*pipelinev1.PipelineRun{}
+	for i := range list.Items {
+		pr := &list.Items[i]
+		if pr.ObjectMeta.Annotations[ciSourceURLAnnotation] == evt.Repo.Clone &&
+			pr.ObjectMeta.Annotations[ciPullRequestAnnotation] == strconv.Itoa(evt.Issue.Number) {
+			runs = append(runs, pr)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[j].ObjectMeta.CreationTimestamp.Before(&runs[i].ObjectMeta.CreationTimestamp)
+	})
+	return runs, nil
+}
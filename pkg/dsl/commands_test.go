@@ -0,0 +1,380 @@
+package dsl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/resources"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
+	"github.com/gitops-tools/tekton-ci/pkg/volumes"
+	"github.com/gitops-tools/tekton-ci/test/hook"
+)
+
+const (
+	testPullRequestSHA = "ec26c3e57ca3a959ca5aad62de7213c562f8c821"
+	testCloneURL       = "https://github.com/Codertocat/Hello-World.git"
+)
+
+func TestParseCommands(t *testing.T) {
+	commandTests := []struct {
+		body string
+		want []command
+	}{
+		{"", []command{}},
+		{"this is a comment", []command{}},
+		{"/retest", []command{{name: "retest", args: []string{}}}},
+		{"looks good\n  /run deploy  \n/cancel", []command{
+			{name: "run", args: []string{"deploy"}},
+			{name: "cancel", args: []string{}},
+		}},
+		{"/ok-to-test", []command{{name: "ok-to-test", args: []string{}}}},
+		{"/unknown\n/", []command{}},
+	}
+
+	for _, tt := range commandTests {
+		got := parseCommands(tt.body)
+		if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(command{})); diff != "" {
+			t.Errorf("parseCommands(%#v) failed:\n%s", tt.body, diff)
+		}
+	}
+}
+
+func TestRunCommandsRetest(t *testing.T) {
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+	previous := makeCommandPipelineRun("previous-run", testPullRequestSHA)
+	_, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), previous, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: retestCommand}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(created); l != 1 {
+		t.Fatalf("got %d PipelineRuns created, want 1", l)
+	}
+	if created[0].ObjectMeta.Annotations[ciSourceRefAnnotation] != testPullRequestSHA {
+		t.Fatalf("retest got ref %s, want %s", created[0].ObjectMeta.Annotations[ciSourceRefAnnotation], testPullRequestSHA)
+	}
+	for _, k := range []string{notificationStateAnnotation, tracing.TraceContextAnnotation, ciHookIDAnnotation} {
+		if _, ok := created[0].ObjectMeta.Annotations[k]; ok {
+			t.Fatalf("retest copied the %s annotation", k)
+		}
+	}
+	if claim := created[0].Spec.Workspaces[0].PersistentVolumeClaim.ClaimName; claim == "previous-claim" {
+		t.Fatal("retest reused the previous volume claim")
+	}
+	wantComments := []string{"Codertocat/Hello-World#2:@Codertocat\n * `/retest` created PipelineRun ``"}
+	if diff := cmp.Diff(wantComments, data.PullRequestCommentsAdded); diff != "" {
+		t.Fatalf("comments incorrect:\n%s", diff)
+	}
+}
+
+func TestRunCommandsRetestRedelivered(t *testing.T) {
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+	previous := makeCommandPipelineRun("previous-run", testPullRequestSHA)
+	_, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), previous, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: retestCommand}}, "test-delivery"); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: retestCommand}}, "test-delivery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(created); l != 1 {
+		t.Fatalf("got %d PipelineRuns, want 1", l)
+	}
+	if id := created[0].ObjectMeta.Annotations[ciHookIDAnnotation]; id != "test-delivery-0" {
+		t.Fatalf("got hook ID %q, want %q", id, "test-delivery-0")
+	}
+	runs, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(runs.Items); l != 2 {
+		t.Fatalf("got %d PipelineRuns, want 2", l)
+	}
+}
+
+func TestRunCommandsIgnoresReplyFailuresAfterCreatingPipelineRuns(t *testing.T) {
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+	converter.scmClient = failingCommentsSCM{converter.scmClient}
+	_, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), makeCommandPipelineRun("previous-run", testPullRequestSHA), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: retestCommand}}, "test-delivery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(created); l != 1 {
+		t.Fatalf("got %d PipelineRuns created, want 1", l)
+	}
+}
+
+func TestRunCommandsReturnsReplyFailures(t *testing.T) {
+	data, converter, _ := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+	converter.scmClient = failingCommentsSCM{converter.scmClient}
+
+	_, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: cancelCommand}}, "test-delivery")
+	if err == nil {
+		t.Fatal("expected the failure to reply to be returned")
+	}
+}
+
+func TestRunCommandsRetestWithNoPreviousRun(t *testing.T) {
+	data, converter, _ := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "admin"}
+
+	created, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: retestCommand}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(created); l != 0 {
+		t.Fatalf("got %d PipelineRuns created, want 0", l)
+	}
+	wantComments := []string{"Codertocat/Hello-World#2:@Codertocat\n * `/retest` failed: no previous PipelineRun for commit " + testPullRequestSHA}
+	if diff := cmp.Diff(wantComments, data.PullRequestCommentsAdded); diff != "" {
+		t.Fatalf("comments incorrect:\n%s", diff)
+	}
+}
+
+func TestRerunDeletesCloneSecretWhenCreateFails(t *testing.T) {
+	fakeSCM, _ := fakescm.NewDefault()
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeTektonClient.PrependReactor("create", "pipelineruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("unavailable")
+	})
+	fakeClient := fake.NewSimpleClientset()
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, volumes.New(fakeClient), cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	previous := makeCommandPipelineRun("previous-run", testPullRequestSHA)
+	previous.Spec.PipelineSpec.Tasks = []pipelinev1.PipelineTask{
+		{
+			Name: gitCloneTaskName,
+			TaskSpec: &pipelinev1.EmbeddedTask{TaskSpec: pipelinev1.TaskSpec{
+				Volumes: []corev1.Volume{
+					{
+						Name:         gitCredentialsVolume,
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "expired-secret"}},
+					},
+				},
+			}},
+		},
+	}
+
+	_, err := converter.rerun(context.TODO(), &routing.Route{Namespace: testNS}, "Codertocat/Hello-World", previous, "")
+	if !errors.IsServiceUnavailable(err) {
+		t.Fatalf("got error %v, want service unavailable", err)
+	}
+
+	secrets, err := fakeClient.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != 0 {
+		t.Fatalf("got %d secrets, want 0", l)
+	}
+}
+
+func TestRunCommandsRunTask(t *testing.T) {
+	data, converter, _ := makeCommandConverter(t)
+	converter.config.CommandAllowList = []string{"Codertocat"}
+	writeContent(t, data, "Codertocat/Hello-World", PipelineFilename, `
+image: golang:latest
+
+test:
+  script:
+    - go test ./...
+
+deploy:
+  when: manual
+  script:
+    - ./deploy.sh
+`)
+
+	created, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: runCommand, args: []string{"deploy"}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(created); l != 1 {
+		t.Fatalf("got %d PipelineRuns created, want 1", l)
+	}
+	tasks := created[0].Spec.PipelineSpec.Tasks
+	if l := len(tasks); l != 2 {
+		t.Fatalf("got %d tasks, want 2", l)
+	}
+	if n := tasks[1].Name; n != "deploy-stage-default" {
+		t.Fatalf("got task %s, want deploy-stage-default", n)
+	}
+	if id := created[0].ObjectMeta.Annotations[ciHookIDAnnotation]; id != "comment-492700400" {
+		t.Fatalf("got hook ID %s, want comment-492700400", id)
+	}
+}
+
+func TestRunCommandsCancel(t *testing.T) {
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+	_, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), makeCommandPipelineRun("running-run", testPullRequestSHA), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: cancelCommand}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "running-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pr.IsCancelled() {
+		t.Fatal("PipelineRun was not cancelled")
+	}
+	wantComments := []string{"Codertocat/Hello-World#2:@Codertocat\n * `/cancel` cancelled 1 PipelineRun(s)"}
+	if diff := cmp.Diff(wantComments, data.PullRequestCommentsAdded); diff != "" {
+		t.Fatalf("comments incorrect:\n%s", diff)
+	}
+}
+
+func TestRunCommandsOkToTest(t *testing.T) {
+	data, converter, _ := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "write"}
+
+	_, err := converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: okToTestCommand}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"Codertocat/Hello-World#2:ok-to-test"}, data.PullRequestLabelsAdded); diff != "" {
+		t.Fatalf("labels incorrect:\n%s", diff)
+	}
+	wantComments := []string{"Codertocat/Hello-World#2:@Codertocat\n * `/ok-to-test` approved the pull request for testing"}
+	if diff := cmp.Diff(wantComments, data.PullRequestCommentsAdded); diff != "" {
+		t.Fatalf("comments incorrect:\n%s", diff)
+	}
+}
+
+func TestRunCommandsWithUnauthorisedUser(t *testing.T) {
+	data, converter, fakeTektonClient := makeCommandConverter(t)
+	data.UserPermissions["Codertocat/Hello-World"] = map[string]string{"Codertocat": "read"}
+	_, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Create(context.TODO(), makeCommandPipelineRun("running-run", testPullRequestSHA), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = converter.runCommands(context.TODO(), makeCommentHook(t), []command{{name: cancelCommand}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "running-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.IsCancelled() {
+		t.Fatal("PipelineRun was cancelled by an unauthorised user")
+	}
+	wantComments := []string{"Codertocat/Hello-World#2:@Codertocat you do not have permission to run commands in this repository"}
+	if diff := cmp.Diff(wantComments, data.PullRequestCommentsAdded); diff != "" {
+		t.Fatalf("comments incorrect:\n%s", diff)
+	}
+}
+
+// failingCommentsSCM fails to create comments.
+type failingCommentsSCM struct {
+	git.SCM
+}
+
+func (failingCommentsSCM) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	return errors.NewServiceUnavailable("unavailable")
+}
+
+func makeCommandConverter(t *testing.T) (*fakescm.Data, *DSLConverter, *fakeclientset.Clientset) {
+	t.Helper()
+	fakeSCM, data := fakescm.NewDefault()
+	data.PullRequests[2] = &scm.PullRequest{Number: 2, Sha: testPullRequestSHA}
+	gitClient := git.New(fakeSCM, nil, metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	return data, converter, fakeTektonClient
+}
+
+func makeCommentHook(t *testing.T) *scm.IssueCommentHook {
+	t.Helper()
+	return hook.MakeHookFromFixture(t, "../testdata/github_issue_comment.json", "issue_comment").(*scm.IssueCommentHook)
+}
+
+func makeCommandPipelineRun(name, sha string) *pipelinev1.PipelineRun {
+	pr := resources.PipelineRun("dsl", "my-pipeline-run-", pipelinev1.PipelineRunSpec{
+		Workspaces: []pipelinev1.WorkspaceBinding{
+			{
+				Name: workspaceName,
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: "previous-claim",
+				},
+			},
+		},
+		PipelineSpec: &pipelinev1.PipelineSpec{},
+	}, AnnotateSource("test-id", &Source{RepoURL: testCloneURL, Ref: sha}), AnnotatePullRequest(2))
+	pr.ObjectMeta.Name = name
+	pr.ObjectMeta.Annotations[notificationStateAnnotation] = "Failed"
+	pr.ObjectMeta.Annotations[tracing.TraceContextAnnotation] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	return pr
+}
+
+func writeContent(t *testing.T, data *fakescm.Data, repo, filename, body string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tekton-ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	data.ContentDir = dir
+	if err := os.MkdirAll(filepath.Join(dir, repo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, repo, filename), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,7 +8,9 @@ import (
 type Configuration struct {
 	ArchiverImage             string            // Executed for tasks that have artifacts to archive.
 	ArchiveURL                string            // Passed to the archiver along with the artifact paths.
+	GitImage                  string            // Executed for sparse checkouts and fetching LFS objects after the clone.
 	PipelineRunPrefix         string            // Used in the generateName property of the created PipelineRun.
 	DefaultServiceAccountName string            // The default service account for created PipelineRuns.
 	VolumeSize                resource.Quantity // The size to create volumes as.
+	CommandAllowList          []string          // Users who can issue comment commands without write access to the repository.
 }
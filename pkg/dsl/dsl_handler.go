@@ -3,77 +3,206 @@ package dsl
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/jenkins-x/go-scm/scm"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/gitops-tools/tekton-ci/pkg/cel"
 	"github.com/gitops-tools/tekton-ci/pkg/ci"
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
 	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
 	"github.com/gitops-tools/tekton-ci/pkg/logger"
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
 	"github.com/gitops-tools/tekton-ci/pkg/volumes"
 )
 
 const (
-	pipelineFilename = ".tekton_ci.yaml"
+	// PipelineFilename is the path to the pipeline definition in the
+	// repository.
+	PipelineFilename = ".tekton_ci.yaml"
+
+	// The prefix for the names of the Secrets with clone credentials that
+	// are created for hooks.
+	cloneSecretPrefix = "tekton-ci-clone-"
 )
 
 // Handler implements the GitEventHandler interface and processes
 // .tekton_ci.yaml files in a repository.
+//
+// If the Handler has a queue, hooks are acknowledged once they're parsed, and
+// processed asynchronously.
 type Handler struct {
 	scmClient git.SCM
 	log       logger.Logger
 	m         metrics.Interface
 	converter *DSLConverter
+	queue     *queue.Queue
 }
 
 // New creates and returns a new Handler for converting ci.Pipelines into
 // PipelineRuns.
-func New(scmClient git.SCM, l logger.Logger, m metrics.Interface, d *DSLConverter) *Handler {
+//
+// If the queue is nil, hooks are processed before responding.
+func New(scmClient git.SCM, l logger.Logger, m metrics.Interface, d *DSLConverter, q *queue.Queue) *Handler {
 	return &Handler{
 		scmClient: scmClient,
 		converter: d,
 		log:       l,
 		m:         m,
+		queue:     q,
 	}
 }
 
+// ServeHTTP implements the http.Handler interface.
+//
+// Hooks that are ignored get a 204 No Content response, and errors are
+// returned as JSON with a status code for the reason.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "webhook")
+	defer span.End()
+	r = r.WithContext(ctx)
 	hook, err := h.scmClient.ParseWebhookRequest(r)
+	if scm.IsUnknownWebhook(err) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if err != nil {
 		h.log.Errorf("error parsing webhook: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, git.HookID(r, nil), hookerrors.New(hookerrors.InvalidHook, err))
 		h.m.CountInvalidHook()
 		return
 	}
 
 	h.m.CountHook(hook)
 
-	if hook.Kind() == scm.WebhookKindPush {
-		created, err := h.converter.convert(r.Context(), hook.(*scm.PushHook))
+	id := git.HookID(r, hook)
+	span.SetAttributes(label.String("hook.kind", string(hook.Kind())), label.String("hook.id", id))
+	process := h.processHook(hook, id)
+	if process == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	process = h.timed(hook, span.SpanContext(), process)
+	if h.queue != nil {
+		existing, err := h.converter.dedupe.Recent(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			h.log.Errorf("error finding existing pipelinerun for hook %s: %s", id, err)
 		}
-
-		b, err := json.Marshal(created)
-		if err != nil {
-			h.log.Errorf("error marshaling response: %s", err)
+		if existing != nil {
+			h.writeJSON(w, existing)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(b)
+		err = h.queue.Add(id, func(ctx context.Context) error {
+			_, err := process(ctx)
+			return err
+		})
 		if err != nil {
-			h.log.Errorf("error writing response: %s", err)
+			h.log.Errorf("error queueing hook %s: %s", id, err)
+			h.writeError(w, id, hookerrors.New(hookerrors.Unavailable, err))
 			return
 		}
+		if err := queue.Accepted(w, id); err != nil {
+			h.log.Errorf("error writing response: %s", err)
+		}
+		return
+	}
+
+	created, err := process(r.Context())
+	if err != nil {
+		h.writeError(w, id, err)
+		return
+	}
+	if created == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, created)
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.log.Errorf("error marshaling response: %s", err)
+		h.writeError(w, "", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(b)
+	if err != nil {
+		h.log.Errorf("error writing response: %s", err)
+		return
+	}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, id string, err error) {
+	if err := hookerrors.Write(w, id, err); err != nil {
+		h.log.Errorf("error writing response: %s", err)
+	}
+}
+
+// timed records the time taken by the processing for the hook, in the
+// metrics and in a span that is a child of the span for the request.
+func (h *Handler) timed(hook scm.Webhook, parent trace.SpanContext, process func(context.Context) (interface{}, error)) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (created interface{}, err error) {
+		ctx, span := tracing.Start(tracing.WithParent(ctx, parent), "process_hook")
+		start := time.Now()
+		defer func() {
+			h.m.ObserveHookDuration(hook, time.Since(start))
+			tracing.End(span, err)
+		}()
+		return process(ctx)
+	}
+}
+
+// processHook returns the processing for a hook with the ID, or nil if the
+// hook is ignored.
+//
+// The processing returns nil if no PipelineRuns were created.
+func (h *Handler) processHook(hook scm.Webhook, id string) func(context.Context) (interface{}, error) {
+	if evt, ok := hook.(*scm.IssueCommentHook); ok {
+		commands := commentCommands(evt)
+		if len(commands) == 0 {
+			return nil
+		}
+		return func(ctx context.Context) (interface{}, error) {
+			created, err := h.converter.runCommands(ctx, evt, commands, id)
+			if err != nil {
+				h.log.Errorf("error running commands: %s", err)
+			}
+			if len(created) == 0 {
+				return nil, err
+			}
+			return created, err
+		}
+	}
+	if hook.Kind() == scm.WebhookKindPush || IsPullRequestBuild(hook) {
+		return func(ctx context.Context) (interface{}, error) {
+			created, err := h.converter.convert(ctx, hook, id)
+			if created == nil {
+				return nil, err
+			}
+			return created, err
+		}
 	}
+	return nil
 }
 
 // NewDSLConverter creates and returns a converter.
@@ -81,16 +210,21 @@ func NewDSLConverter(
 	scmClient git.SCM,
 	pipelineClient pipelineclientset.Interface,
 	volumeCreator volumes.Creator,
+	cloneSecrets credentials.CloneSecretCreator,
+	trustChecker trust.Checker,
 	m metrics.Interface, cfg *Configuration,
-	namespace string, l logger.Logger) *DSLConverter {
+	router routing.Router, l logger.Logger) *DSLConverter {
 	return &DSLConverter{
 		pipelineClient: pipelineClient,
 		volumeCreator:  volumeCreator,
+		cloneSecrets:   cloneSecrets,
+		trustChecker:   trustChecker,
 		log:            l,
 		config:         cfg,
 		m:              m,
-		namespace:      namespace,
+		router:         router,
 		scmClient:      scmClient,
+		dedupe:         dedupe.New(pipelineClient, dedupe.DefaultSize),
 	}
 
 }
@@ -99,71 +233,343 @@ type DSLConverter struct {
 	scmClient      git.SCM
 	log            logger.Logger
 	pipelineClient pipelineclientset.Interface
-	namespace      string
+	router         routing.Router
 	volumeCreator  volumes.Creator
+	cloneSecrets   credentials.CloneSecretCreator
+	trustChecker   trust.Checker
 	config         *Configuration
 	m              metrics.Interface
+	dedupe         *dedupe.Deduplicator
 }
 
-func (d *DSLConverter) convert(ctx context.Context, evt *scm.PushHook) (*pipelinev1.PipelineRun, error) {
-	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
-	logItems := []interface{}{"repo", repo, "sha", evt.Commit.Sha}
-	d.log.Infow("processing push event", logItems...)
-	content, err := d.scmClient.FileContents(ctx, repo, pipelineFilename, evt.Commit.Sha)
+// pipelineFilter is applied to the parsed pipeline definition before it's
+// converted.
+type pipelineFilter func(*ci.Pipeline) (*ci.Pipeline, error)
+
+// convert converts the pipeline definition in the repository for the hook.
+//
+// If the id is not empty, it's the ID of the hook, and if a PipelineRun was
+// already created for the hook, it's returned rather than creating another,
+// otherwise the GUID from the hook is used.
+//
+// The result of the conversion is recorded in the metrics, along with the
+// reason if no PipelineRun was created.
+func (d *DSLConverter) convert(ctx context.Context, evt scm.Webhook, id string, filters ...pipelineFilter) (created *pipelinev1.PipelineRun, err error) {
+	repo := fmt.Sprintf("%s/%s", evt.Repository().Namespace, evt.Repository().Name)
+	var skipped string
+	defer func() {
+		d.countConversion(repo, skipped, err)
+	}()
+	src := sourceFromEvent(evt)
+	logItems := []interface{}{"repo", repo, "sha", src.Ref}
+	d.log.Infow(fmt.Sprintf("processing %s event", evt.Kind()), logItems...)
+	route, err := d.router.Route(ctx, repo)
+	if err != nil {
+		d.log.Errorf("error finding route: %s", err)
+		return nil, hookerrors.Kubernetes(err)
+	}
+	if !route.Allows(routing.DSLHandler) {
+		d.log.Infow("repository is not routed to the DSL handler", logItems...)
+		skipped = "not_routed"
+		return nil, nil
+	}
+	if id != "" {
+		callCtx, done := d.kubernetesCall(ctx, "find_pipelinerun")
+		existing, err := d.dedupe.Find(callCtx, route.Namespace, id)
+		done(err)
+		if err != nil {
+			d.log.Errorf("error finding existing pipelinerun: %s", err)
+			return nil, hookerrors.Kubernetes(err)
+		}
+		if existing != nil {
+			d.log.Infow("pipelinerun already created for hook", append(logItems, "id", id, "pipelinerun", existing.ObjectMeta.Name)...)
+			skipped = "duplicate"
+			return existing, nil
+		}
+	} else {
+		id = hookID(evt)
+	}
+	cfg := configForRoute(d.config, route)
+	definitionRef := src.Ref
+	if pull, ok := evt.(*scm.PullRequestHook); ok {
+		result, err := d.trustChecker.Check(ctx, pull)
+		if err != nil {
+			d.log.Errorf("error checking pull request author: %s", err)
+			return nil, hookerrors.SCM(err)
+		}
+		switch result {
+		case trust.Held:
+			d.log.Infow("holding pull request from untrusted author", logItems...)
+			skipped = "held"
+			return nil, nil
+		case trust.Approved:
+			// The definition from untrusted authors is not used.
+			definitionRef = pull.PullRequest.Target
+		}
+	}
+	content, err := d.scmClient.FileContents(ctx, repo, PipelineFilename, definitionRef)
 	// This does not return an error if the pipeline definition can't be found.
 	if git.IsNotFound(err) {
 		d.log.Infof("no pipeline definition found in %s", repo)
+		skipped = "no_definition"
 		return nil, nil
 	}
 	if err != nil {
 		d.log.Errorf("error fetching pipeline file: %s", err)
-		return nil, err
+		return nil, hookerrors.SCM(err)
 	}
 	if skip(evt) {
 		d.log.Infow("skipping pipeline conversion", logItems...)
+		skipped = "ci_skip"
 		return nil, nil
 	}
 
-	celCtx, err := cel.New(evt)
-	if err != nil {
-		d.log.Errorf("error creating a CEL context: %s", err)
-		return nil, err
-	}
 	parsed, err := ci.Parse(bytes.NewReader(content))
 	if err != nil {
 		d.log.Errorf("error parsing pipeline definition: %s", err)
-		return nil, nil
+		return nil, hookerrors.Definition(err)
+	}
+	for _, f := range filters {
+		parsed, err = f(parsed)
+		if err != nil {
+			return nil, hookerrors.Definition(err)
+		}
 	}
 
-	vc, err := d.volumeCreator.Create(ctx, d.namespace, d.config.VolumeSize)
-	if err != nil {
-		d.log.Errorf("error creating volume: %s", err)
-		return nil, nil
+	// The clone Secret is named before evaluating the rules, the git-clone
+	// task references it, but it's only created if a PipelineRun is.
+	var cloneSecret *corev1.Secret
+	if route.CloneSecret != "" {
+		src.CredentialsSecret = route.CloneSecret
+	} else {
+		cloneSecret, err = d.cloneSecrets.Secret(ctx, route.Namespace, repo)
+		if err != nil {
+			d.log.Errorf("error getting clone credentials: %s", err)
+			return nil, hookerrors.Kubernetes(err)
+		}
+		if cloneSecret != nil {
+			cloneSecret.ObjectMeta.Name = hookResourceName(cloneSecretPrefix, id)
+			src.CredentialsSecret = cloneSecret.ObjectMeta.Name
+		}
 	}
-	pr, err := Convert(parsed, d.log, d.config, sourceFromPushEvent(evt), vc.ObjectMeta.Name, celCtx, evt.GUID)
+	pr, err := d.evaluate(ctx, evt, parsed, cfg, src, "", id)
 	if err != nil {
-		d.log.Errorf("error converting pipeline to pipelinerun: %s %#v", err, celCtx.Data)
-		return nil, nil
+		return nil, err
 	}
 	if pr == nil {
+		skipped = "no_matching_rules"
 		return nil, nil
 	}
-	created, err := d.pipelineClient.TektonV1beta1().PipelineRuns(d.namespace).Create(ctx, pr, metav1.CreateOptions{})
+	if pull, ok := evt.(*scm.PullRequestHook); ok {
+		AnnotatePullRequest(pull.PullRequest.Number)(pr)
+	}
+	dedupe.Mark(pr, id)
+
+	callCtx, done := d.kubernetesCall(ctx, "create_volume")
+	err = d.createVolumes(callCtx, route.Namespace, id, cfg.VolumeSize, &pr.Spec)
+	done(err)
+	if err != nil {
+		d.log.Errorf("error creating volume: %s", err)
+		return nil, hookerrors.Kubernetes(err)
+	}
+	if cloneSecret != nil {
+		callCtx, done := d.kubernetesCall(ctx, "create_secret")
+		cloneSecret, err = d.cloneSecrets.Create(callCtx, cloneSecret)
+		done(err)
+		if err != nil {
+			d.log.Errorf("error creating clone credentials: %s", err)
+			return nil, hookerrors.Kubernetes(err)
+		}
+	}
+	callCtx, done = d.kubernetesCall(ctx, "create_pipelinerun")
+	tracing.Inject(callCtx, pr.ObjectMeta.Annotations)
+	created, err = d.pipelineClient.TektonV1beta1().PipelineRuns(route.Namespace).Create(callCtx, pr, metav1.CreateOptions{})
+	done(err)
 	if err != nil {
 		d.log.Errorf("error creating pipelinerun file: %s", err)
-		return nil, nil
+		d.deleteCloneSecret(ctx, cloneSecret)
+		return nil, hookerrors.Kubernetes(err)
 	}
+	d.dedupe.Created(id, created)
+	d.ownCloneSecret(ctx, cloneSecret, created)
 	return created, nil
 }
 
-func sourceFromPushEvent(p *scm.PushHook) *Source {
-	return &Source{
-		RepoURL: p.Repo.Clone,
-		Ref:     p.Commit.Sha,
+// countConversion records the result of converting a hook for the repo, if
+// skipped is not empty, it's the reason that no PipelineRun was created.
+func (d *DSLConverter) countConversion(repo, skipped string, err error) {
+	switch {
+	case err != nil:
+		d.m.CountConversion(metrics.ConversionFailed, string(hookerrors.ReasonFor(err)), repo)
+	case skipped != "":
+		d.m.CountConversion(metrics.ConversionSkipped, skipped, repo)
+	default:
+		d.m.CountConversion(metrics.ConversionCreated, "", repo)
 	}
 }
 
-func skip(p *scm.PushHook) bool {
+// evaluate converts the pipeline definition, evaluating the CEL expressions
+// in the rules, in a span.
+func (d *DSLConverter) evaluate(ctx context.Context, evt scm.Webhook, parsed *ci.Pipeline, cfg *Configuration, src *Source, volumeName, id string) (pr *pipelinev1.PipelineRun, err error) {
+	_, span := tracing.Start(ctx, "cel_evaluation")
+	defer func() {
+		tracing.End(span, err)
+	}()
+	opts := []cel.Option{}
+	if s := pipelineSource(ctx); s != "" {
+		opts = append(opts, cel.WithPipelineSource(s))
+	}
+	celCtx, err := cel.New(evt, opts...)
+	if err != nil {
+		d.log.Errorf("error creating a CEL context: %s", err)
+		return nil, err
+	}
+	pr, err = Convert(parsed, d.log, cfg, src, volumeName, celCtx, id)
+	if err != nil {
+		d.log.Errorf("error converting pipeline to pipelinerun: %s %#v", err, celCtx.Data)
+		return nil, hookerrors.Definition(err)
+	}
+	return pr, nil
+}
+
+// kubernetesCall starts a span for the call to the Kubernetes API, and returns
+// a function that records the duration of the call, and ends the span.
+func (d *DSLConverter) kubernetesCall(ctx context.Context, name string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, name)
+	start := time.Now()
+	return ctx, func(err error) {
+		d.m.ObserveKubernetesCallDuration(name, time.Since(start))
+		tracing.End(span, err)
+	}
+}
+
+// ownCloneSecret makes the PipelineRun the owner of the Secret with the clone
+// credentials, so that the Secret is deleted along with the PipelineRun.
+func (d *DSLConverter) ownCloneSecret(ctx context.Context, secret *corev1.Secret, pr *pipelinev1.PipelineRun) {
+	if secret == nil {
+		return
+	}
+	owner := metav1.NewControllerRef(pr, pipelinev1.SchemeGroupVersion.WithKind("PipelineRun"))
+	if err := d.cloneSecrets.SetOwner(ctx, secret, *owner); err != nil {
+		d.log.Errorf("error setting the owner of the clone credentials: %s", err)
+	}
+}
+
+// deleteCloneSecret deletes clone credentials that were created for a
+// PipelineRun that couldn't be created, nothing else would delete them.
+func (d *DSLConverter) deleteCloneSecret(ctx context.Context, secret *corev1.Secret) {
+	if secret == nil {
+		return
+	}
+	if err := d.cloneSecrets.Delete(ctx, secret); err != nil {
+		d.log.Errorf("error deleting the clone credentials: %s", err)
+	}
+}
+
+// createVolumes creates a volume for each of the workspaces in the spec that
+// is bound to a PersistentVolumeClaim, and binds the workspace to it.
+//
+// If the id is not empty, the volumes are named for the hook, so that they're
+// reused if the hook is retried, otherwise the names are generated.
+func (d *DSLConverter) createVolumes(ctx context.Context, ns, id string, size resource.Quantity, spec *pipelinev1.PipelineRunSpec) error {
+	for i, w := range spec.Workspaces {
+		if w.PersistentVolumeClaim == nil {
+			continue
+		}
+		name := ""
+		if id != "" {
+			name = hookResourceName("tekton-ci-"+w.Name+"-", id)
+		}
+		vc, err := d.volumeCreator.Create(ctx, ns, name, size)
+		if err != nil {
+			return err
+		}
+		spec.Workspaces[i].PersistentVolumeClaim.ClaimName = vc.ObjectMeta.Name
+	}
+	return nil
+}
+
+// hookResourceName returns the name for a resource that's created for the
+// hook with the ID, from a hash of the ID, which can be any string.
+func hookResourceName(prefix, id string) string {
+	return prefix + fmt.Sprintf("%x", sha256.Sum256([]byte(id)))[:16]
+}
+
+// configForRoute returns a copy of the configuration, with any fields that
+// are set in the route overridden.
+func configForRoute(cfg *Configuration, r *routing.Route) *Configuration {
+	routed := *cfg
+	if r.ArchiverImage != "" {
+		routed.ArchiverImage = r.ArchiverImage
+	}
+	if r.ArchiveURL != "" {
+		routed.ArchiveURL = r.ArchiveURL
+	}
+	if r.PipelineRunPrefix != "" {
+		routed.PipelineRunPrefix = r.PipelineRunPrefix
+	}
+	if r.ServiceAccountName != "" {
+		routed.DefaultServiceAccountName = r.ServiceAccountName
+	}
+	if !r.VolumeSize.IsZero() {
+		routed.VolumeSize = r.VolumeSize
+	}
+	return &routed
+}
+
+// Pull requests are cloned from the base repository, the head commit is
+// fetchable from there, even for pull requests from forks.
+func sourceFromEvent(h scm.Webhook) *Source {
+	switch evt := h.(type) {
+	case *scm.PullRequestHook:
+		return &Source{
+			RepoURL:      evt.Repo.Clone,
+			Ref:          evt.PullRequest.Sha,
+			Branch:       evt.PullRequest.Source,
+			TargetBranch: evt.PullRequest.Target,
+		}
+	case *scm.PushHook:
+		return &Source{
+			RepoURL: evt.Repo.Clone,
+			Ref:     evt.Commit.Sha,
+			Branch:  scm.TrimRef(evt.Ref),
+		}
+	}
+	return nil
+}
+
+func hookID(h scm.Webhook) string {
+	switch evt := h.(type) {
+	case *scm.PullRequestHook:
+		return evt.GUID
+	case *scm.PushHook:
+		return evt.GUID
+	}
+	return ""
+}
+
+// IsPullRequestBuild returns true if the hook is for a pull request that
+// should be built, pull requests are built when they're opened, when new
+// commits are pushed to them, or when they're approved for testing.
+func IsPullRequestBuild(h scm.Webhook) bool {
+	evt, ok := h.(*scm.PullRequestHook)
+	if !ok {
+		return false
+	}
+	switch evt.Action {
+	case scm.ActionOpen, scm.ActionReopen, scm.ActionSync:
+		return true
+	case scm.ActionLabel:
+		return evt.Label.Name == trust.ApprovalLabel
+	}
+	return false
+}
+
+func skip(h scm.Webhook) bool {
+	p, ok := h.(*scm.PushHook)
+	if !ok {
+		return false
+	}
 	matches := []string{"[ci skip]", "[skip ci]"}
 	for _, m := range matches {
 		if strings.Contains(p.Commit.Message, m) {
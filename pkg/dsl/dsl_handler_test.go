@@ -2,32 +2,50 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/factory"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
 	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
 	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
 	"github.com/gitops-tools/tekton-ci/pkg/volumes"
 	"github.com/gitops-tools/tekton-ci/test"
 )
 
 const testNS = "testing"
 
+var testRouter = routing.NewStatic(routing.Route{Namespace: testNS})
+
+var noCloneSecrets = credentials.NewCloneSecrets(credentials.NewStatic(""), fake.NewSimpleClientset())
+
 func TestHandlePushEvent(t *testing.T) {
 	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
 	defer as.Close()
@@ -40,9 +58,10 @@ func TestHandlePushEvent(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset()
 	vc := volumes.New(fakeClient)
 	cfg := testConfiguration()
+	m := metrics.NewMock()
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, metrics.NewMock(), cfg, testNS, logger.Sugar())
-	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter)
+	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, noCloneSecrets, trust.NewMock(trust.Trusted), m, cfg, testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), m, converter, nil)
 	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
 	rec := httptest.NewRecorder()
 
@@ -52,15 +71,12 @@ func TestHandlePushEvent(t *testing.T) {
 	if w.StatusCode != http.StatusOK {
 		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNotFound, mustReadBody(t, w))
 	}
-	claim, err := fakeClient.CoreV1().PersistentVolumeClaims(testNS).Get(context.TODO(), "", metav1.GetOptions{})
-	if err != nil {
-		t.Fatal(err)
-	}
+	claim := mustGetOnlyClaim(t, fakeClient, testNS)
 	// TODO: This should probably be a call to a function in volumes.
 	wantClaim := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "simple-volume-",
-			Namespace:    testNS,
+			Name:      hookResourceName("tekton-ci-git-checkout-", req.Header.Get("X-GitHub-Delivery")),
+			Namespace: testNS,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			Resources: corev1.ResourceRequirements{
@@ -101,6 +117,444 @@ func TestHandlePushEvent(t *testing.T) {
 	if deliveryID := req.Header.Get("X-GitHub-Delivery"); prUUID != deliveryID {
 		t.Fatalf("PR UUID got %s, want %s", prUUID, deliveryID)
 	}
+	if c := m.Conversions(metrics.ConversionCreated, "", "Codertocat/Hello-World"); c != 1 {
+		t.Fatalf("got %d created conversions, want 1", c)
+	}
+	if c := m.KubernetesCalls("create_pipelinerun"); c != 1 {
+		t.Fatalf("got %d create_pipelinerun durations, want 1", c)
+	}
+	if c := m.HookDurations(); c != 1 {
+		t.Fatalf("got %d hook durations, want 1", c)
+	}
+}
+
+func TestHandlePushEventRecordsSpans(t *testing.T) {
+	tp, exporter := tracing.NewInMemory()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	spans := exporter.GetSpans()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+		if s.SpanContext.TraceID != spans[0].SpanContext.TraceID {
+			t.Errorf("span %s is in a different trace", s.Name)
+		}
+	}
+	want := []string{
+		"validate_signature", "find_pipelinerun", "file_contents", "cel_evaluation", "create_volume",
+		"create_pipelinerun", "process_hook", "webhook",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("recorded spans incorrect, diff\n%s", diff)
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := pr.ObjectMeta.Annotations[tracing.TraceContextAnnotation]; !strings.Contains(a, spans[0].SpanContext.TraceID.String()) {
+		t.Fatalf("got trace context annotation %q, want trace %s", a, spans[0].SpanContext.TraceID)
+	}
+}
+
+func TestHandlePushEventRedelivered(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeClient := fake.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	h.ServeHTTP(httptest.NewRecorder(), test.MakeHookRequest(t, "../testdata/github_push.json", "push"))
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	existing := &pipelinev1.PipelineRun{}
+	if err := json.NewDecoder(w.Body).Decode(existing); err != nil {
+		t.Fatal(err)
+	}
+	if id := req.Header.Get("X-GitHub-Delivery"); existing.ObjectMeta.Annotations[ciHookIDAnnotation] != id {
+		t.Fatalf("got PipelineRun for hook %q, want %q", existing.ObjectMeta.Annotations[ciHookIDAnnotation], id)
+	}
+	claims, err := fakeClient.CoreV1().PersistentVolumeClaims(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(claims.Items); l != 1 {
+		t.Fatalf("got %d volume claims, want 1", l)
+	}
+}
+
+func TestHandlePushEventWithQueue(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	m := metrics.NewMock()
+	q := queue.New(queue.Config{Workers: 1, Size: 1}, m, logger.Sugar())
+	q.Start()
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, q)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusAccepted {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusAccepted, mustReadBody(t, w))
+	}
+	var accepted map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&accepted); err != nil {
+		t.Fatal(err)
+	}
+	if id := req.Header.Get("X-GitHub-Delivery"); accepted["id"] != id {
+		t.Fatalf("got hook ID %s, want %s", accepted["id"], id)
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.QueueItems(queue.StatusProcessed); n != 1 {
+		t.Fatalf("got %d hooks processed, want 1", n)
+	}
+	if _, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlePushEventWithCloneCredentials(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeClient := fake.NewSimpleClientset()
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := pr.Spec.PipelineSpec.Tasks[0].TaskSpec
+	if n := clone.Steps[0].Container.Name; n != "git-credentials" {
+		t.Fatalf("got first step %s, want git-credentials", n)
+	}
+	secret := mustGetOnlySecret(t, fakeClient)
+	if v := clone.Volumes[0]; v.Secret.SecretName != secret.ObjectMeta.Name {
+		t.Fatalf("got volume for secret %s, want %s", v.Secret.SecretName, secret.ObjectMeta.Name)
+	}
+	if p := secret.StringData[corev1.BasicAuthPasswordKey]; p != "test-token" {
+		t.Fatalf("got password %s, want test-token", p)
+	}
+	if l := len(secret.ObjectMeta.OwnerReferences); l != 1 {
+		t.Fatalf("got %d owner references, want 1", l)
+	}
+	if k := secret.ObjectMeta.OwnerReferences[0].Kind; k != "PipelineRun" {
+		t.Fatalf("got owner kind %s, want PipelineRun", k)
+	}
+}
+
+func TestHandlePushEventWithRouteCloneSecret(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeClient := fake.NewSimpleClientset()
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
+	router := routing.NewStatic(routing.Route{Namespace: testNS, CloneSecret: "repo-ssh-key"})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), router, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := pr.Spec.PipelineSpec.Tasks[0].TaskSpec
+	if v := clone.Volumes[0]; v.Secret.SecretName != "repo-ssh-key" {
+		t.Fatalf("got volume for secret %s, want repo-ssh-key", v.Secret.SecretName)
+	}
+	secrets, err := fakeClient.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != 0 {
+		t.Fatalf("got %d secrets created, want 0", l)
+	}
+}
+
+func TestHandlePushEventWithRoute(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeClient := fake.NewSimpleClientset()
+	router := routing.NewStatic(routing.Route{
+		Namespace:          "routed-ns",
+		ServiceAccountName: "routed-sa",
+		VolumeSize:         resource.MustParse("5Gi"),
+	})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), router, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	claim := mustGetOnlyClaim(t, fakeClient, "routed-ns")
+	if size := claim.Spec.Resources.Requests["storage"]; size.String() != "5Gi" {
+		t.Fatalf("got volume size %s, want 5Gi", size.String())
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns("routed-ns").Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa := pr.Spec.ServiceAccountName; sa != "routed-sa" {
+		t.Fatalf("got service account %s, want routed-sa", sa)
+	}
+}
+
+func TestHandlePushEventWithRouteNotAllowingHandler(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	router := routing.NewStatic(routing.Route{Namespace: testNS, Handlers: []string{routing.SpecHandler}})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), router, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a repository not routed to the DSL handler")
+	}
+}
+
+func TestHandlePullRequestEvent(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "ec26c3e57ca3a959ca5aad62de7213c562f8c821", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeClient := fake.NewSimpleClientset()
+	vc := volumes.New(fakeClient)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(
+		context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/ko-app/git-init",
+		"-url", "https://github.com/Codertocat/Hello-World.git",
+		"-revision", "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+		"-path", "$(workspaces.source.path)",
+	}
+	if diff := cmp.Diff(want, pr.Spec.PipelineSpec.Tasks[0].TaskSpec.Steps[0].Container.Command); diff != "" {
+		t.Fatalf("git command incorrect, diff\n%s", diff)
+	}
+	if n := pr.ObjectMeta.Annotations[ciPullRequestAnnotation]; n != "2" {
+		t.Fatalf("pull request annotation got %s, want 2", n)
+	}
+}
+
+func TestHandlePullRequestEventWithApprovedPullRequest(t *testing.T) {
+	// The definition is fetched from the base branch.
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "master", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Approved), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(
+		context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := pr.ObjectMeta.Annotations[ciSourceRefAnnotation]; ref != "ec26c3e57ca3a959ca5aad62de7213c562f8c821" {
+		t.Fatalf("source ref got %s, want the pull request head", ref)
+	}
+}
+
+func TestHandlePullRequestEventWithHeldPullRequest(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	m := metrics.NewMock()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Held), m, testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), m, converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a held pull request")
+	}
+	if c := m.Conversions(metrics.ConversionSkipped, "held", "Codertocat/Hello-World"); c != 1 {
+		t.Fatalf("got %d held conversions, want 1", c)
+	}
+}
+
+func TestHandlePullRequestEventWithApprovalLabel(t *testing.T) {
+	labelTests := []struct {
+		label string
+		want  bool
+	}{
+		{trust.ApprovalLabel, true},
+		{"bug", false},
+	}
+
+	for _, tt := range labelTests {
+		hook := &scm.PullRequestHook{Action: scm.ActionLabel, Label: scm.Label{Name: tt.label}}
+		if b := IsPullRequestBuild(hook); b != tt.want {
+			t.Errorf("IsPullRequestBuild() with label %s got %v, want %v", tt.label, b, tt.want)
+		}
+	}
+}
+
+func TestHandlePullRequestEventWithIgnoredAction(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request", func(b map[string]interface{}) {
+		b["action"] = "closed"
+	})
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a closed pull request")
+	}
 }
 
 func TestHandlePushEventNoPipeline(t *testing.T) {
@@ -115,8 +569,8 @@ func TestHandlePushEventNoPipeline(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset()
 	vc := volumes.New(fakeClient)
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, metrics.NewMock(), testConfiguration(), testNS, logger.Sugar())
-	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter)
+	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
 
 	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
 	rec := httptest.NewRecorder()
@@ -124,8 +578,8 @@ func TestHandlePushEventNoPipeline(t *testing.T) {
 	h.ServeHTTP(rec, req)
 
 	w := rec.Result()
-	if w.StatusCode != http.StatusOK {
-		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
 	}
 	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
 	if !errors.IsNotFound(err) {
@@ -133,6 +587,85 @@ func TestHandlePushEventNoPipeline(t *testing.T) {
 	}
 }
 
+func TestHandlePushEventWithInvalidDefinition(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content_invalid.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	m := metrics.NewMock()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(gitClient, fakeclientset.NewSimpleClientset(), volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), m, testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), m, converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusUnprocessableEntity, mustReadBody(t, w))
+	}
+	assertErrorResponse(t, w, req.Header.Get("X-GitHub-Delivery"), hookerrors.InvalidDefinition)
+	if c := m.Conversions(metrics.ConversionFailed, string(hookerrors.InvalidDefinition), "Codertocat/Hello-World"); c != 1 {
+		t.Fatalf("got %d failed conversions, want 1", c)
+	}
+}
+
+func TestHandlePushEventWithSCMFailure(t *testing.T) {
+	as := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}))
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(gitClient, fakeclientset.NewSimpleClientset(), volumes.New(fake.NewSimpleClientset()), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusBadGateway, mustReadBody(t, w))
+	}
+	assertErrorResponse(t, w, req.Header.Get("X-GitHub-Delivery"), hookerrors.SCMFailure)
+}
+
+func TestHandlePushEventWithKubernetesFailure(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeClient := fake.NewSimpleClientset()
+	fakeClient.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("unavailable")
+	})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(gitClient, fakeclientset.NewSimpleClientset(), volumes.New(fakeClient), noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusServiceUnavailable, mustReadBody(t, w))
+	}
+	assertErrorResponse(t, w, req.Header.Get("X-GitHub-Delivery"), hookerrors.KubernetesFailure)
+}
+
 func TestHandlePushEventNoMatchingRules(t *testing.T) {
 	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content_match_only_master.json")
 	defer as.Close()
@@ -144,22 +677,59 @@ func TestHandlePushEventNoMatchingRules(t *testing.T) {
 	fakeTektonClient := fakeclientset.NewSimpleClientset()
 	fakeClient := fake.NewSimpleClientset()
 	vc := volumes.New(fakeClient)
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, metrics.NewMock(), testConfiguration(), testNS, logger.Sugar())
-	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter)
+	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
 	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
 	rec := httptest.NewRecorder()
 
 	h.ServeHTTP(rec, req)
 
 	w := rec.Result()
-	if w.StatusCode != http.StatusOK {
-		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
 	}
 	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
 	if !errors.IsNotFound(err) {
 		t.Fatal("pipelinerun was created with no matching rules")
 	}
+	assertNoSecretsOrVolumes(t, fakeClient)
+}
+
+func TestHandlePushEventDeletesCloneSecretWhenCreateFails(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	fakeTektonClient.PrependReactor("create", "pipelineruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("unavailable")
+	})
+	fakeClient := fake.NewSimpleClientset()
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusServiceUnavailable, mustReadBody(t, w))
+	}
+	secrets, err := fakeClient.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != 0 {
+		t.Fatalf("got %d secrets, want 0", l)
+	}
 }
 
 func TestHandlePushEventWithSkippableMessage(t *testing.T) {
@@ -174,8 +744,8 @@ func TestHandlePushEventWithSkippableMessage(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset()
 	vc := volumes.New(fakeClient)
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, metrics.NewMock(), testConfiguration(), testNS, logger.Sugar())
-	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter)
+	converter := NewDSLConverter(gitClient, fakeTektonClient, vc, noCloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
 	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push", func(b map[string]interface{}) {
 		b["head_commit"].(map[string]interface{})["message"] = "This is a [skip ci] commit"
 	})
@@ -184,8 +754,8 @@ func TestHandlePushEventWithSkippableMessage(t *testing.T) {
 	h.ServeHTTP(rec, req)
 
 	w := rec.Result()
-	if w.StatusCode != http.StatusOK {
-		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
 	}
 	_, err = fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
 	if !errors.IsNotFound(err) {
@@ -216,6 +786,17 @@ func TestSkip(t *testing.T) {
 
 }
 
+func assertErrorResponse(t *testing.T, w *http.Response, id string, reason hookerrors.Reason) {
+	t.Helper()
+	resp := hookerrors.Response{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != id || resp.Reason != reason || resp.Error == "" {
+		t.Fatalf("got error response %#v, want ID %q and reason %q", resp, id, reason)
+	}
+}
+
 func mustReadBody(t *testing.T, req *http.Response) []byte {
 	t.Helper()
 	b, err := ioutil.ReadAll(req.Body)
@@ -224,3 +805,90 @@ func mustReadBody(t *testing.T, req *http.Response) []byte {
 	}
 	return b
 }
+
+func TestHandlePushEventRetriedReusesVolumeAndSecret(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton_ci.yaml", "6113728f27ae82c7b1a177c8d03f9e96e0adf246", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeTektonClient := fakeclientset.NewSimpleClientset()
+	failures := 1
+	fakeTektonClient.PrependReactor("create", "pipelineruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.NewServiceUnavailable("unavailable")
+		}
+		return false, nil, nil
+	})
+	fakeClient := fake.NewSimpleClientset()
+	cloneSecrets := credentials.NewCloneSecrets(credentials.NewStatic("test-token"), fakeClient)
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	converter := NewDSLConverter(gitClient, fakeTektonClient, volumes.New(fakeClient), cloneSecrets, trust.NewMock(trust.Trusted), metrics.NewMock(), testConfiguration(), testRouter, logger.Sugar())
+	h := New(gitClient, logger.Sugar(), metrics.NewMock(), converter, nil)
+
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusOK} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, test.MakeHookRequest(t, "../testdata/github_push.json", "push"))
+		if w := rec.Result(); w.StatusCode != want {
+			t.Fatalf("got %d, want %d: %s", w.StatusCode, want, mustReadBody(t, w))
+		}
+	}
+
+	claim := mustGetOnlyClaim(t, fakeClient, testNS)
+	secret := mustGetOnlySecret(t, fakeClient)
+	pr, err := fakeTektonClient.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pr.Spec.Workspaces[0].PersistentVolumeClaim.ClaimName; n != claim.ObjectMeta.Name {
+		t.Fatalf("got claim %s, want %s", n, claim.ObjectMeta.Name)
+	}
+	if n := pr.Spec.PipelineSpec.Tasks[0].TaskSpec.Volumes[0].Secret.SecretName; n != secret.ObjectMeta.Name {
+		t.Fatalf("got secret %s, want %s", n, secret.ObjectMeta.Name)
+	}
+}
+
+func mustGetOnlySecret(t *testing.T, c *fake.Clientset) *corev1.Secret {
+	t.Helper()
+	secrets, err := c.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != 1 {
+		t.Fatalf("got %d secrets, want 1", l)
+	}
+	return &secrets.Items[0]
+}
+
+func mustGetOnlyClaim(t *testing.T, c *fake.Clientset, ns string) *corev1.PersistentVolumeClaim {
+	t.Helper()
+	claims, err := c.CoreV1().PersistentVolumeClaims(ns).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(claims.Items); l != 1 {
+		t.Fatalf("got %d volume claims, want 1", l)
+	}
+	return &claims.Items[0]
+}
+
+func assertNoSecretsOrVolumes(t *testing.T, c *fake.Clientset) {
+	t.Helper()
+	secrets, err := c.CoreV1().Secrets(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(secrets.Items); l != 0 {
+		t.Fatalf("got %d secrets, want 0", l)
+	}
+	claims, err := c.CoreV1().PersistentVolumeClaims(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(claims.Items); l != 0 {
+		t.Fatalf("got %d volume claims, want 0", l)
+	}
+}
@@ -0,0 +1,80 @@
+package dsl
+
+import (
+	"bytes"
+	"context"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/cel"
+	"github.com/gitops-tools/tekton-ci/pkg/ci"
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/schedule"
+)
+
+type pipelineSourceKey struct{}
+
+// withPipelineSource returns a context for converting a synthetic hook, with
+// the CI_PIPELINE_SOURCE for the conversion e.g. "schedule", rather than the
+// source for the kind of hook.
+func withPipelineSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, pipelineSourceKey{}, source)
+}
+
+// pipelineSource returns the CI_PIPELINE_SOURCE from the context, or an empty
+// string if the source is the kind of hook.
+func pipelineSource(ctx context.Context) string {
+	s, _ := ctx.Value(pipelineSourceKey{}).(string)
+	return s
+}
+
+// Schedules implements the schedule.Runner interface.
+//
+// If the repository has no pipeline definition, no schedules are returned.
+func (d *DSLConverter) Schedules(ctx context.Context, fullName string) ([]schedule.Schedule, error) {
+	repo, err := d.scmClient.FindRepository(ctx, fullName)
+	if err != nil {
+		return nil, err
+	}
+	content, err := d.scmClient.FileContents(ctx, fullName, PipelineFilename, repo.Branch)
+	if git.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ci.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	schedules := []schedule.Schedule{}
+	for _, s := range parsed.Schedules {
+		schedules = append(schedules, schedule.Schedule{
+			Name:   s.Name,
+			Repo:   fullName,
+			Branch: s.Branch,
+			Cron:   s.Cron,
+		})
+	}
+	return schedules, nil
+}
+
+// RunSchedule implements the schedule.Runner interface.
+//
+// The pipeline definition for the head of the branch is converted from a
+// synthetic push hook, with the CI_PIPELINE_SOURCE "schedule".
+func (d *DSLConverter) RunSchedule(ctx context.Context, s schedule.Schedule, id string) (*pipelinev1.PipelineRun, error) {
+	branch := s.Branch
+	if branch == "" {
+		repo, err := d.scmClient.FindRepository(ctx, s.Repo)
+		if err != nil {
+			return nil, err
+		}
+		branch = repo.Branch
+	}
+	evt, err := d.pushHook(ctx, s.Repo, "refs/heads/"+branch, id)
+	if err != nil {
+		return nil, err
+	}
+	return d.convert(withPipelineSource(ctx, cel.ScheduleSource), evt, id)
+}
@@ -0,0 +1,124 @@
+package dsl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jenkins-x/go-scm/scm"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/schedule"
+)
+
+var _ schedule.Runner = (*DSLConverter)(nil)
+
+const testScheduledPipeline = `
+image: golang:latest
+
+schedules:
+  - name: nightly
+    cron: "0 2 * * *"
+  - name: release
+    cron: "@weekly"
+    branch: release
+
+test:
+  script:
+    - go test ./...
+
+nightly:
+  rules:
+    - if: vars.CI_PIPELINE_SOURCE != 'schedule'
+      when: never
+  script:
+    - make nightly
+`
+
+func TestSchedules(t *testing.T) {
+	data, h, _ := makeAdminHandler(t)
+	writeContent(t, data, "Codertocat/Hello-World", PipelineFilename, testScheduledPipeline)
+
+	schedules, err := h.converter.Schedules(context.TODO(), "Codertocat/Hello-World")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []schedule.Schedule{
+		{Name: "nightly", Repo: "Codertocat/Hello-World", Cron: "0 2 * * *"},
+		{Name: "release", Repo: "Codertocat/Hello-World", Branch: "release", Cron: "@weekly"},
+	}
+	if diff := cmp.Diff(want, schedules); diff != "" {
+		t.Fatalf("schedules don't match:\n%s", diff)
+	}
+}
+
+func TestSchedulesWithNoPipeline(t *testing.T) {
+	_, h, _ := makeAdminHandler(t)
+
+	schedules, err := h.converter.Schedules(context.TODO(), "Codertocat/Hello-World")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schedules != nil {
+		t.Fatalf("got %#v, want no schedules", schedules)
+	}
+}
+
+func TestRunSchedule(t *testing.T) {
+	data, h, _ := makeAdminHandler(t)
+	writeContent(t, data, "Codertocat/Hello-World", PipelineFilename, testScheduledPipeline)
+	data.Commits["refs/heads/main"] = &scm.Commit{Sha: testTriggerSHA}
+	s := schedule.Schedule{Name: "nightly", Repo: "Codertocat/Hello-World", Cron: "0 2 * * *"}
+
+	pr, err := h.converter.RunSchedule(context.TODO(), s, "schedule-test-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		ciSourceRefAnnotation:    testTriggerSHA,
+		ciSourceBranchAnnotation: "main",
+		ciHookIDAnnotation:       "schedule-test-id",
+	}
+	for k, v := range want {
+		if got := pr.ObjectMeta.Annotations[k]; got != v {
+			t.Errorf("got annotation %s = %q, want %q", k, got, v)
+		}
+	}
+	if !hasTask(pr.Spec.PipelineSpec.Tasks, "nightly-stage-default") {
+		t.Fatalf("scheduled PipelineRun has no nightly job: %#v", pr.Spec.PipelineSpec.Tasks)
+	}
+	if !hasEnv(pr.Spec.PipelineSpec.Tasks[0].TaskSpec.Steps[0].Env, "CI_PIPELINE_SOURCE", "schedule") {
+		t.Error("scheduled PipelineRun doesn't have CI_PIPELINE_SOURCE=schedule")
+	}
+}
+
+func TestRunScheduleExcludesScheduledJobsFromPushes(t *testing.T) {
+	data, h, _ := makeAdminHandler(t)
+	writeContent(t, data, "Codertocat/Hello-World", PipelineFilename, testScheduledPipeline)
+	data.Commits["refs/heads/main"] = &scm.Commit{Sha: testTriggerSHA}
+
+	evt, err := h.converter.pushHook(context.TODO(), "Codertocat/Hello-World", "refs/heads/main", "push-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := h.converter.convert(context.TODO(), evt, "push-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hasTask(pr.Spec.PipelineSpec.Tasks, "nightly-stage-default") {
+		t.Fatal("pushed PipelineRun has the nightly job")
+	}
+}
+
+func hasTask(tasks []pipelinev1.PipelineTask, name string) bool {
+	for _, t := range tasks {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,10 @@ package dsl
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/google/cel-go/common/types"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
@@ -9,27 +13,63 @@ import (
 
 	"github.com/gitops-tools/tekton-ci/pkg/cel"
 	"github.com/gitops-tools/tekton-ci/pkg/ci"
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
 	"github.com/gitops-tools/tekton-ci/pkg/logger"
 	"github.com/gitops-tools/tekton-ci/pkg/resources"
 )
 
 const (
-	gitCloneTaskName      = "git-clone"
-	beforeStepTaskName    = "before-step"
-	afterStepTaskName     = "after-step"
-	workspaceName         = "git-checkout"
-	workspaceBindingName  = "source"
-	workspaceSourcePath   = "$(workspaces.source.path)"
-	ciHookIDAnnotation    = "tekton.dev/ci-hook-id"
-	ciSourceURLAnnotation = "tekton.dev/ci-source-url"
-	ciSourceRefAnnotation = "tekton.dev/ci-source-ref"
-	tektonGitInit         = "gcr.io/tekton-releases/github.com/tektoncd/pipeline/cmd/git-init"
+	gitCloneTaskName         = "git-clone"
+	beforeStepTaskName       = "before-step"
+	afterStepTaskName        = "after-step"
+	workspaceName            = "git-checkout"
+	workspaceBindingName     = "source"
+	workspaceSourcePath      = "$(workspaces.source.path)"
+	ciHookIDAnnotation       = dedupe.HookIDAnnotation
+	ciSourceURLAnnotation    = "tekton.dev/ci-source-url"
+	ciSourceRefAnnotation    = "tekton.dev/ci-source-ref"
+	ciSourceBranchAnnotation = "tekton.dev/ci-source-branch"
+	ciPullRequestAnnotation  = "tekton.dev/ci-pull-request"
+	tektonGitInit            = "gcr.io/tekton-releases/github.com/tektoncd/pipeline/cmd/git-init"
+	gitCredentialsImage      = "busybox"
+	gitCredentialsVolume     = "git-credentials"
+	gitCredentialsPath       = "/tekton/git-credentials"
+	sshKnownHostsKey         = "known_hosts"
+	manualWhen               = "manual"
+)
+
+// JUnitReportResult is the name of the result that JUnit reports from a task
+// are recorded in.
+const JUnitReportResult = "junit-report"
+
+const (
+	// The files that the script steps of tasks that record JUnit reports use
+	// to pass the exit code and reports to the report step, /tekton/home is
+	// shared between the steps of a task.
+	scriptExitCodePath = "/tekton/home/.tekton-ci-exit-code"
+	junitReportPath    = "/tekton/home/.tekton-ci-junit-report"
+
+	// The compressed reports, with any other results, must fit in the 4096
+	// byte termination message of the report step.
+	maxJUnitReportSize = 3072
 )
 
 // Source wraps a git clone URL and a specific ref to checkout.
+//
+// If CredentialsSecret is set, it's the name of a basic-auth or ssh-auth
+// Secret with the credentials to use when cloning.
+//
+// Branch is the branch that was pushed to, or the source branch of a pull
+// request.
+//
+// TargetBranch is the branch that a pull request will be merged into, it's
+// empty for pushes.
 type Source struct {
-	RepoURL string
-	Ref     string
+	RepoURL           string
+	Ref               string
+	Branch            string
+	CredentialsSecret string
+	TargetBranch      string
 }
 
 // AnnotateSource is a PipelineRun optionFunc which annodates the pipelinerun
@@ -39,16 +79,34 @@ func AnnotateSource(evtID string, src *Source) func(*pipelinev1.PipelineRun) {
 		pr.ObjectMeta.Annotations[ciSourceURLAnnotation] = src.RepoURL
 		pr.ObjectMeta.Annotations[ciSourceRefAnnotation] = src.Ref
 		pr.ObjectMeta.Annotations[ciHookIDAnnotation] = evtID
+		if src.Branch != "" {
+			pr.ObjectMeta.Annotations[ciSourceBranchAnnotation] = src.Branch
+		}
+	}
+}
+
+// AnnotatePullRequest is a PipelineRun optionFunc which annotates the
+// pipelinerun with the number of the pull request that triggered it.
+func AnnotatePullRequest(number int) func(*pipelinev1.PipelineRun) {
+	return func(pr *pipelinev1.PipelineRun) {
+		pr.ObjectMeta.Annotations[ciPullRequestAnnotation] = strconv.Itoa(number)
 	}
 }
 
 // Convert takes a Pipeline definition, a name, source and volume claim name,
 // and generates a TektonCD PipelineRun with an embedded Pipeline with the
 // tasks to execute.
+//
+// The variables from the CEL context are set in the environment of the steps,
+// with the id as the CI_PIPELINE_ID.
 func Convert(p *ci.Pipeline, log logger.Logger, config *Configuration, src *Source, volumeClaimName string, ctx *cel.Context, id string) (*pipelinev1.PipelineRun, error) {
-	env := makeEnv(p.Variables)
+	if ctx != nil {
+		ctx = ctx.With(cel.WithPipelineID(id))
+	}
+	predefined := predefinedVars(ctx)
+	env := makeEnv(p.Variables, predefined)
 	tasks := []pipelinev1.PipelineTask{
-		makeGitCloneTask(env, src),
+		makeGitCloneTask(env, src, p.Git, config.GitImage),
 	}
 	logMeta := []interface{}{"volumeClaimName", volumeClaimName, "ref", src.Ref, "repoURL", src.RepoURL}
 	log.Infow("converting pipeline", logMeta...)
@@ -64,13 +122,14 @@ func Convert(p *ci.Pipeline, log logger.Logger, config *Configuration, src *Sour
 		for _, taskName := range p.TasksForStage(stageName) {
 			task := p.Task(taskName)
 			log.Infow("processing task", append(logMeta, "task", taskName)...)
-			taskMatrix := makeTaskEnvMatrix(env, task)
+			jobEnv, jobCtx := jobEnvAndContext(env, ctx, taskName)
+			taskMatrix := makeTaskEnvMatrix(jobEnv, task)
 			for i, m := range taskMatrix {
 				image := p.Image
 				if task.Tekton != nil && task.Tekton.Image != "" {
 					image = task.Tekton.Image
 				}
-				stageTask, err := makeTaskForStage(task, stageName, previous, m, image, ctx)
+				stageTask, err := makeTaskForStage(task, stageName, previous, m, image, jobCtx)
 				if err != nil {
 					return nil, err
 				}
@@ -80,7 +139,7 @@ func Convert(p *ci.Pipeline, log logger.Logger, config *Configuration, src *Sour
 					}
 					tasks = append(tasks, *stageTask)
 					if len(task.Artifacts.Paths) > 0 {
-						archiverTask := makeArchiveArtifactsTask(previous, task.Name+"-archiver", env, config, task.Artifacts.Paths)
+						archiverTask := makeArchiveArtifactsTask(previous, task.Name+"-archiver", jobEnv, config, task.Artifacts.Paths)
 						tasks = append(tasks, archiverTask)
 						stageTask = &archiverTask
 					}
@@ -88,7 +147,9 @@ func Convert(p *ci.Pipeline, log logger.Logger, config *Configuration, src *Sour
 				}
 			}
 		}
-		previous = stageTasks
+		if len(stageTasks) > 0 {
+			previous = stageTasks
+		}
 	}
 	if len(p.AfterScript) > 0 {
 		tasks = append(tasks, makeScriptTask(afterStepTaskName, previous, env, p.Image, p.AfterScript))
@@ -118,6 +179,7 @@ func Convert(p *ci.Pipeline, log logger.Logger, config *Configuration, src *Sour
 	if p.TektonConfig != nil {
 		spec.ServiceAccountName = p.TektonConfig.ServiceAccountName
 	}
+	addTextParams(&spec, predefined)
 	return resources.PipelineRun("dsl", config.PipelineRunPrefix, spec, AnnotateSource(id, src)), nil
 }
 
@@ -132,7 +194,7 @@ func makeTaskForStage(job *ci.Task, stage string, runAfter []string, env []corev
 			ruleResults[i] = r.When
 		}
 	}
-	if hasNever(ruleResults) {
+	if hasNever(ruleResults) || isManual(job, ruleResults) {
 		return nil, nil
 	}
 	pt := &pipelinev1.PipelineTask{
@@ -152,12 +214,56 @@ func makeTaskForStage(job *ci.Task, stage string, runAfter []string, env []corev
 		pt.Params = params
 	} else {
 		pt.TaskSpec = makeTaskSpec(makeScriptSteps(env, image, job.Script)...)
+		if len(job.Artifacts.Reports.JUnit) > 0 {
+			captureJUnitReports(pt.TaskSpec, image, env, job.Artifacts.Reports.JUnit)
+		}
 	}
 	return pt, nil
 }
 
-func makeGitCloneTask(env []corev1.EnvVar, src *Source) pipelinev1.PipelineTask {
-	return pipelinev1.PipelineTask{
+// captureJUnitReports records the JUnit reports from a task in the
+// JUnitReportResult, compressed and base64 encoded, so that they fit in the
+// termination message.
+//
+// The reports are recorded by a step after the script, so that they're
+// captured when the tests fail, the script steps record the exit code of the
+// first failing step, and skip the remaining steps, and the report step exits
+// with the recorded code.
+//
+// Reports that are larger than maxJUnitReportSize when compressed are not
+// recorded, rather than failing the TaskRun.
+func captureJUnitReports(task *pipelinev1.EmbeddedTask, image string, env []corev1.EnvVar, paths []string) {
+	task.Results = append(task.Results, pipelinev1.TaskResult{
+		Name:        JUnitReportResult,
+		Description: "The compressed JUnit reports from the task",
+	})
+	for i := range task.Steps {
+		args := task.Steps[i].Args
+		task.Steps[i].Args = []string{"-c", fmt.Sprintf("if [ -f %[1]s ]; then exit 0; fi\nsh -c \"$1\" || echo $? > %[1]s", scriptExitCodePath), "sh", args[len(args)-1]}
+	}
+	report := strings.Join([]string{
+		"status=0",
+		fmt.Sprintf("if [ -f %[1]s ]; then read status < %[1]s; fi", scriptExitCodePath),
+		fmt.Sprintf("cat %s 2>/dev/null | gzip -c | base64 > %s", strings.Join(paths, " "), junitReportPath),
+		fmt.Sprintf("if [ `wc -c < %s` -le %d ]; then", junitReportPath, maxJUnitReportSize),
+		fmt.Sprintf("  cp %s $(results.%s.path)", junitReportPath, JUnitReportResult),
+		"else",
+		fmt.Sprintf("  echo \"the JUnit reports are larger than %d bytes when compressed, they're not recorded\" >&2", maxJUnitReportSize),
+		"fi",
+		"exit $status",
+	}, "\n")
+	task.Steps = append(task.Steps, pipelinev1.Step{
+		Container: container(JUnitReportResult, image, "sh", []string{"-c", report}, env, workspaceSourcePath),
+	})
+}
+
+func makeGitCloneTask(env []corev1.EnvVar, src *Source, git *ci.GitConfig, gitImage string) pipelinev1.PipelineTask {
+	if git == nil {
+		git = &ci.GitConfig{}
+	}
+	mergeBase := git.MergeBase && src.TargetBranch != ""
+	submodules := submoduleArgs(git, mergeBase)
+	task := pipelinev1.PipelineTask{
 		Name:       gitCloneTaskName,
 		Workspaces: workspacePipelineTaskBindings(),
 		TaskSpec: makeTaskSpec(
@@ -165,12 +271,144 @@ func makeGitCloneTask(env []corev1.EnvVar, src *Source) pipelinev1.PipelineTask
 				Container: corev1.Container{
 					Name:    "git-clone",
 					Image:   tektonGitInit,
-					Command: []string{"/ko-app/git-init", "-url", src.RepoURL, "-revision", src.Ref, "-path", workspaceSourcePath},
+					Command: append([]string{"/ko-app/git-init", "-url", src.RepoURL, "-revision", src.Ref, "-path", workspaceSourcePath}, gitInitArgs(git, submodules != nil)...),
 					Env:     append(env, corev1.EnvVar{Name: "TEKTON_RESOURCE_NAME", Value: "tekton-ci-git-clone"}),
 				},
 			},
 		),
 	}
+	withCredentials := src.CredentialsSecret != ""
+	if withCredentials {
+		addGitCredentials(task.TaskSpec, src)
+	}
+	// Values from the hook and the pipeline definition are passed to the
+	// script as arguments, so that they're never interpreted by the shell.
+	addStep := func(name string, args []string, commands ...string) {
+		stepArgs := []string{"-c", gitScript(withCredentials, commands...)}
+		if len(args) > 0 {
+			stepArgs = append(append(stepArgs, "sh"), args...)
+		}
+		task.TaskSpec.Steps = append(task.TaskSpec.Steps, pipelinev1.Step{
+			Container: container(name, gitImage, "sh", stepArgs, env, workspaceSourcePath),
+		})
+	}
+	if mergeBase {
+		addStep("merge-base", []string{src.TargetBranch, src.Ref},
+			"if [ -f .git/shallow ]; then git fetch --unshallow origin; fi",
+			`git fetch origin "$1"`,
+			"git checkout -q FETCH_HEAD",
+			`git -c user.name=tekton-ci -c user.email=tekton-ci@localhost merge --no-edit "$2"`)
+	}
+	if submodules != nil {
+		addStep("submodules", nil, strings.Join(submodules, " "))
+	}
+	if git.FetchTags {
+		addStep("fetch-tags", nil, "git fetch --tags origin")
+	}
+	if len(git.SparseCheckout) > 0 {
+		addStep("sparse-checkout", git.SparseCheckout, "git sparse-checkout init --cone", `git sparse-checkout set "$@"`)
+	}
+	if git.LFS {
+		addStep("git-lfs", nil, "git lfs install --local", "git lfs pull")
+	}
+	return task
+}
+
+// gitInitArgs returns the git-init arguments for the options in the git
+// configuration, options that aren't set use the git-init defaults.
+//
+// git-init always updates submodules recursively, if the submodules are
+// updated in a separate step, they're disabled in git-init.
+func gitInitArgs(git *ci.GitConfig, separateSubmodules bool) []string {
+	args := []string{}
+	if git.Depth != nil {
+		args = append(args, "-depth", strconv.Itoa(*git.Depth))
+	}
+	if git.Submodules == "false" || separateSubmodules {
+		args = append(args, "-submodules=false")
+	}
+	return args
+}
+
+// submoduleArgs returns the command to update the submodules after the
+// clone, or nil if git-init updates them, or they're disabled.
+//
+// When the pull request is merged into its target branch, the submodules
+// must be updated after the merge.
+func submoduleArgs(git *ci.GitConfig, mergeBase bool) []string {
+	args := []string{"git", "submodule", "update", "--init"}
+	switch {
+	case git.Submodules == "true":
+	case git.Submodules == "recursive", git.Submodules == "" && mergeBase:
+		args = append(args, "--recursive")
+	default:
+		return nil
+	}
+	if git.Depth != nil && *git.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(*git.Depth))
+	}
+	return args
+}
+
+// gitScript returns a script that executes the commands, stopping at the
+// first failure.
+//
+// ssh ignores $HOME, so when there are credentials, the key that was written
+// to $HOME/.ssh is passed explicitly.
+func gitScript(withCredentials bool, commands ...string) string {
+	lines := []string{"set -e"}
+	if withCredentials {
+		lines = append(lines, `if [ -f "$HOME/.ssh/id_rsa" ]; then export GIT_SSH_COMMAND="ssh -i $HOME/.ssh/id_rsa -o UserKnownHostsFile=$HOME/.ssh/known_hosts -o StrictHostKeyChecking=yes"; fi`)
+	}
+	return strings.Join(append(lines, commands...), "\n")
+}
+
+// addGitCredentials adds a step before the clone that writes the credentials
+// from the Secret to $HOME, which is shared between the steps in the task.
+//
+// Secrets with an SSH private key are written to $HOME/.ssh, along with the
+// known_hosts from the Secret, and HTTPS URLs for the host are rewritten to
+// SSH, otherwise the username and password are written to a git credential
+// store.
+//
+// Host keys are never accepted on first use, if the Secret has no
+// known_hosts, the step fails.
+func addGitCredentials(task *pipelinev1.EmbeddedTask, src *Source) {
+	host := src.RepoURL
+	if u, err := url.Parse(src.RepoURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	script := fmt.Sprintf(`if [ -f %[2]s/%[3]s ]; then
+  mkdir -p "$HOME/.ssh"
+  cp %[2]s/%[3]s "$HOME/.ssh/id_rsa"
+  chmod 600 "$HOME/.ssh/id_rsa"
+  if [ ! -f %[2]s/%[4]s ]; then
+    echo "the clone Secret has an %[3]s but no %[4]s" >&2
+    exit 1
+  fi
+  cp %[2]s/%[4]s "$HOME/.ssh/known_hosts"
+  printf '[url "git@%[1]s:"]\n\tinsteadOf = https://%[1]s/\n' > "$HOME/.gitconfig"
+else
+  printf 'https://%%s:%%s@%[1]s\n' "$(cat %[2]s/%[5]s)" "$(cat %[2]s/%[6]s)" > "$HOME/.git-credentials"
+  chmod 600 "$HOME/.git-credentials"
+  printf '[credential]\n\thelper = store\n' > "$HOME/.gitconfig"
+fi`, host, gitCredentialsPath, corev1.SSHAuthPrivateKey, sshKnownHostsKey, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+	task.Volumes = append(task.Volumes, corev1.Volume{
+		Name: gitCredentialsVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: src.CredentialsSecret},
+		},
+	})
+	task.Steps = append([]pipelinev1.Step{
+		{
+			Container: corev1.Container{
+				Name:         "git-credentials",
+				Image:        gitCredentialsImage,
+				Command:      []string{"sh", "-c", script},
+				VolumeMounts: []corev1.VolumeMount{{Name: gitCredentialsVolume, MountPath: gitCredentialsPath, ReadOnly: true}},
+			},
+		},
+	}, task.Steps...)
 }
 
 func makeScriptTask(name string, runAfter []string, env []corev1.EnvVar, image string, script []string) pipelinev1.PipelineTask {
@@ -229,8 +467,35 @@ func makeTaskSpec(steps ...pipelinev1.Step) *pipelinev1.EmbeddedTask {
 	}
 }
 
-func makeEnv(m map[string]string) []corev1.EnvVar {
+// textVars are the predefined variables with free text from the hook, which
+// can be large, and can contain "$(...)", which Tekton substitutes in env
+// values.
+//
+// These are passed to the tasks as params of the PipelineRun, so that they're
+// only recorded once, and the env of the steps refers to the params.
+var textVars = []string{"CI_COMMIT_MESSAGE", "CI_MERGE_REQUEST_DESCRIPTION", "CI_MERGE_REQUEST_TITLE"}
+
+// makeEnv returns the environment for the steps, the predefined variables
+// that are not empty, sorted by name, followed by the variables from the
+// pipeline definition, which take precedence.
+//
+// The textVars refer to the params added by addTextParams.
+func makeEnv(m, predefined map[string]string) []corev1.EnvVar {
 	vars := []corev1.EnvVar{}
+	names := []string{}
+	for k, v := range predefined {
+		if v != "" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := predefined[k]
+		if isTextVar(k) {
+			v = "$(params." + k + ")"
+		}
+		vars = append(vars, corev1.EnvVar{Name: k, Value: v})
+	}
 	for k, v := range m {
 		vars = append(vars, corev1.EnvVar{Name: k, Value: v})
 	}
@@ -238,6 +503,54 @@ func makeEnv(m map[string]string) []corev1.EnvVar {
 	return vars
 }
 
+// addTextParams adds the textVars that are not empty as params of the
+// PipelineRun, which are passed to each of the embedded tasks.
+func addTextParams(spec *pipelinev1.PipelineRunSpec, predefined map[string]string) {
+	for _, k := range textVars {
+		if predefined[k] == "" {
+			continue
+		}
+		spec.Params = append(spec.Params, pipelinev1.Param{Name: k, Value: pipelinev1.ArrayOrString{StringVal: predefined[k], Type: "string"}})
+		spec.PipelineSpec.Params = append(spec.PipelineSpec.Params, pipelinev1.ParamSpec{Name: k, Type: "string"})
+		for i := range spec.PipelineSpec.Tasks {
+			task := &spec.PipelineSpec.Tasks[i]
+			if task.TaskSpec == nil {
+				continue
+			}
+			task.TaskSpec.Params = append(task.TaskSpec.Params, pipelinev1.ParamSpec{Name: k, Type: "string"})
+			task.Params = append(task.Params, pipelinev1.Param{Name: k, Value: pipelinev1.ArrayOrString{StringVal: "$(params." + k + ")", Type: "string"}})
+		}
+	}
+}
+
+func isTextVar(name string) bool {
+	for _, k := range textVars {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// predefinedVars returns the variables that the CEL expressions are evaluated
+// with, so that they're also available to the steps.
+func predefinedVars(ctx *cel.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Vars()
+}
+
+// jobEnvAndContext returns the environment and CEL context for a job, with
+// the CI_JOB_NAME variable.
+func jobEnvAndContext(env []corev1.EnvVar, ctx *cel.Context, name string) ([]corev1.EnvVar, *cel.Context) {
+	jobEnv := append([]corev1.EnvVar{{Name: "CI_JOB_NAME", Value: name}}, env...)
+	if ctx == nil {
+		return jobEnv, nil
+	}
+	return jobEnv, ctx.With(cel.WithJobName(name))
+}
+
 func container(name, image, command string, args []string, env []corev1.EnvVar, workDir string) corev1.Container {
 	c := corev1.Container{
 		Name:       name,
@@ -262,6 +575,40 @@ func hasNever(whens []string) bool {
 	return false
 }
 
+// Returns true if the Task should only be executed when explicitly requested.
+func isManual(job *ci.Task, whens []string) bool {
+	if job.When == manualWhen {
+		return true
+	}
+	for _, v := range whens {
+		if v == manualWhen {
+			return true
+		}
+	}
+	return false
+}
+
+// manualTaskPipeline returns a copy of the pipeline with only the named Task,
+// which can be a manual Task.
+func manualTaskPipeline(p *ci.Pipeline, name string) (*ci.Pipeline, error) {
+	task := p.Task(name)
+	if task == nil {
+		return nil, fmt.Errorf("no task %#v in the pipeline definition", name)
+	}
+	manual := *task
+	manual.When = ""
+	manual.Rules = []ci.Rule{}
+	for _, r := range task.Rules {
+		if r.When != manualWhen {
+			manual.Rules = append(manual.Rules, r)
+		}
+	}
+	filtered := *p
+	filtered.Stages = []string{task.Stage}
+	filtered.Tasks = []*ci.Task{&manual}
+	return &filtered, nil
+}
+
 // This converts the CI TaskParam model to a Tekton Pipeline Param.
 //
 // It evaluates the values as CEL expressions, and places the resulting value
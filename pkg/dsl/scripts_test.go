@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
@@ -24,6 +25,7 @@ const (
 	testPipelineRunPrefix  = "my-pipeline-run-"
 	testArchiverImage      = "quay.io/testing/testing"
 	testArchiveURL         = "https://example/com/testing"
+	testGitImage           = "quay.io/testing/git"
 	testRepoURL            = "https://github.com/myorg/testing.git"
 	testServiceAccountName = "test-account"
 	testEvtID              = "26400635-d8f4-4cf5-a45f-bd03856bdf2b"
@@ -33,7 +35,7 @@ func TestMakeGitCloneTask(t *testing.T) {
 	env := []corev1.EnvVar{
 		{Name: "CI_PROJECT_DIR", Value: "$(workspaces.source.path)"},
 	}
-	task := makeGitCloneTask(env, &Source{RepoURL: testRepoURL, Ref: "master"})
+	task := makeGitCloneTask(env, &Source{RepoURL: testRepoURL, Ref: "master"}, nil, testGitImage)
 
 	want := pipelinev1.PipelineTask{
 		Name: gitCloneTaskName,
@@ -75,6 +77,171 @@ func TestMakeGitCloneTask(t *testing.T) {
 	}
 }
 
+func TestMakeGitCloneTaskWithCredentials(t *testing.T) {
+	task := makeGitCloneTask([]corev1.EnvVar{}, &Source{RepoURL: testRepoURL, Ref: "master", CredentialsSecret: "clone-secret"}, nil, testGitImage)
+
+	wantVolumes := []corev1.Volume{
+		{
+			Name: gitCredentialsVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "clone-secret"},
+			},
+		},
+	}
+	if diff := cmp.Diff(wantVolumes, task.TaskSpec.Volumes); diff != "" {
+		t.Fatalf("volumes don't match:\n%s", diff)
+	}
+	steps := task.TaskSpec.Steps
+	if l := len(steps); l != 2 {
+		t.Fatalf("got %d steps, want 2", l)
+	}
+	wantScript := `if [ -f /tekton/git-credentials/ssh-privatekey ]; then
+  mkdir -p "$HOME/.ssh"
+  cp /tekton/git-credentials/ssh-privatekey "$HOME/.ssh/id_rsa"
+  chmod 600 "$HOME/.ssh/id_rsa"
+  if [ ! -f /tekton/git-credentials/known_hosts ]; then
+    echo "the clone Secret has an ssh-privatekey but no known_hosts" >&2
+    exit 1
+  fi
+  cp /tekton/git-credentials/known_hosts "$HOME/.ssh/known_hosts"
+  printf '[url "git@github.com:"]\n\tinsteadOf = https://github.com/\n' > "$HOME/.gitconfig"
+else
+  printf 'https://%s:%s@github.com\n' "$(cat /tekton/git-credentials/username)" "$(cat /tekton/git-credentials/password)" > "$HOME/.git-credentials"
+  chmod 600 "$HOME/.git-credentials"
+  printf '[credential]\n\thelper = store\n' > "$HOME/.gitconfig"
+fi`
+	if diff := cmp.Diff([]string{"sh", "-c", wantScript}, steps[0].Container.Command); diff != "" {
+		t.Fatalf("credentials command doesn't match:\n%s", diff)
+	}
+	if n := steps[1].Container.Name; n != "git-clone" {
+		t.Fatalf("got step %s, want git-clone", n)
+	}
+}
+
+func TestMakeGitCloneTaskWithGitConfig(t *testing.T) {
+	depth := 0
+	env := []corev1.EnvVar{
+		{Name: "CI_PROJECT_DIR", Value: "$(workspaces.source.path)"},
+	}
+	task := makeGitCloneTask(env, &Source{RepoURL: testRepoURL, Ref: "master"}, &ci.GitConfig{
+		Depth:          &depth,
+		Submodules:     "false",
+		SparseCheckout: []string{"cmd", "pkg"},
+		LFS:            true,
+		FetchTags:      true,
+	}, testGitImage)
+
+	want := []pipelinev1.Step{
+		{
+			Container: corev1.Container{
+				Name:    "git-clone",
+				Image:   "gcr.io/tekton-releases/github.com/tektoncd/pipeline/cmd/git-init",
+				Command: []string{"/ko-app/git-init", "-url", testRepoURL, "-revision", "master", "-path", workspaceSourcePath, "-depth", "0", "-submodules=false"},
+				Env: []corev1.EnvVar{
+					{Name: "CI_PROJECT_DIR", Value: "$(workspaces.source.path)"},
+					{Name: "TEKTON_RESOURCE_NAME", Value: "tekton-ci-git-clone"},
+				},
+			},
+		},
+		{
+			Container: container("fetch-tags", testGitImage, "sh", []string{"-c", "set -e\ngit fetch --tags origin"}, env, workspaceSourcePath),
+		},
+		{
+			Container: container("sparse-checkout", testGitImage, "sh", []string{"-c", "set -e\ngit sparse-checkout init --cone\ngit sparse-checkout set \"$@\"", "sh", "cmd", "pkg"}, env, workspaceSourcePath),
+		},
+		{
+			Container: container("git-lfs", testGitImage, "sh", []string{"-c", "set -e\ngit lfs install --local\ngit lfs pull"}, env, workspaceSourcePath),
+		},
+	}
+	if diff := cmp.Diff(want, task.TaskSpec.Steps); diff != "" {
+		t.Fatalf("steps don't match:\n%s", diff)
+	}
+}
+
+func TestMakeGitCloneTaskWithSubmodules(t *testing.T) {
+	depth := 10
+	submoduleTests := []struct {
+		git       *ci.GitConfig
+		wantClone []string
+		wantStep  string
+	}{
+		{&ci.GitConfig{}, []string{}, ""},
+		{&ci.GitConfig{Submodules: "false"}, []string{"-submodules=false"}, ""},
+		{&ci.GitConfig{Submodules: "true"}, []string{"-submodules=false"}, "set -e\ngit submodule update --init"},
+		{&ci.GitConfig{Submodules: "recursive", Depth: &depth}, []string{"-depth", "10", "-submodules=false"}, "set -e\ngit submodule update --init --recursive --depth 10"},
+	}
+
+	for _, tt := range submoduleTests {
+		task := makeGitCloneTask([]corev1.EnvVar{}, &Source{RepoURL: testRepoURL, Ref: "master"}, tt.git, testGitImage)
+		steps := task.TaskSpec.Steps
+		wantClone := append([]string{"/ko-app/git-init", "-url", testRepoURL, "-revision", "master", "-path", workspaceSourcePath}, tt.wantClone...)
+		if diff := cmp.Diff(wantClone, steps[0].Container.Command); diff != "" {
+			t.Errorf("%#v: clone command doesn't match:\n%s", tt.git, diff)
+		}
+		if tt.wantStep == "" {
+			if l := len(steps); l != 1 {
+				t.Errorf("%#v: got %d steps, want 1", tt.git, l)
+			}
+			continue
+		}
+		if l := len(steps); l != 2 {
+			t.Errorf("%#v: got %d steps, want 2", tt.git, l)
+			continue
+		}
+		if diff := cmp.Diff([]string{"-c", tt.wantStep}, steps[1].Container.Args); diff != "" {
+			t.Errorf("%#v: submodules step doesn't match:\n%s", tt.git, diff)
+		}
+	}
+}
+
+func TestMakeGitCloneTaskWithMergeBase(t *testing.T) {
+	src := &Source{RepoURL: testRepoURL, Ref: "ec26c3e57ca3a959ca5aad62de7213c562f8c821", TargetBranch: "main", CredentialsSecret: "clone-secret"}
+	task := makeGitCloneTask([]corev1.EnvVar{}, src, &ci.GitConfig{MergeBase: true}, testGitImage)
+
+	steps := task.TaskSpec.Steps
+	if l := len(steps); l != 4 {
+		t.Fatalf("got %d steps, want 4", l)
+	}
+	wantClone := []string{"/ko-app/git-init", "-url", testRepoURL, "-revision", src.Ref, "-path", workspaceSourcePath, "-submodules=false"}
+	if diff := cmp.Diff(wantClone, steps[1].Container.Command); diff != "" {
+		t.Fatalf("clone command doesn't match:\n%s", diff)
+	}
+	wantMerge := `set -e
+if [ -f "$HOME/.ssh/id_rsa" ]; then export GIT_SSH_COMMAND="ssh -i $HOME/.ssh/id_rsa -o UserKnownHostsFile=$HOME/.ssh/known_hosts -o StrictHostKeyChecking=yes"; fi
+if [ -f .git/shallow ]; then git fetch --unshallow origin; fi
+git fetch origin "$1"
+git checkout -q FETCH_HEAD
+git -c user.name=tekton-ci -c user.email=tekton-ci@localhost merge --no-edit "$2"`
+	if diff := cmp.Diff([]string{"-c", wantMerge, "sh", "main", src.Ref}, steps[2].Container.Args); diff != "" {
+		t.Fatalf("merge step doesn't match:\n%s", diff)
+	}
+	if n := steps[3].Container.Name; n != "submodules" {
+		t.Fatalf("got step %s, want submodules", n)
+	}
+}
+
+func TestMakeGitCloneTaskWithMergeBaseQuotesBranch(t *testing.T) {
+	branch := "main;echo $(id)`id`"
+	src := &Source{RepoURL: testRepoURL, Ref: "ec26c3e57ca3a959ca5aad62de7213c562f8c821", TargetBranch: branch}
+	task := makeGitCloneTask([]corev1.EnvVar{}, src, &ci.GitConfig{MergeBase: true}, testGitImage)
+
+	args := task.TaskSpec.Steps[1].Container.Args
+	if strings.Contains(args[1], branch) {
+		t.Fatalf("branch was added to the script: %s", args[1])
+	}
+	if diff := cmp.Diff([]string{"sh", branch, src.Ref}, args[2:]); diff != "" {
+		t.Fatalf("merge step arguments don't match:\n%s", diff)
+	}
+}
+
+func TestMakeGitCloneTaskWithMergeBaseForPush(t *testing.T) {
+	task := makeGitCloneTask([]corev1.EnvVar{}, &Source{RepoURL: testRepoURL, Ref: "master"}, &ci.GitConfig{MergeBase: true}, testGitImage)
+
+	if l := len(task.TaskSpec.Steps); l != 1 {
+		t.Fatalf("got %d steps, want 1", l)
+	}
+}
+
 func TestMakeScriptTask(t *testing.T) {
 	image := "golang:latest"
 	beforeScript := []string{
@@ -168,7 +335,9 @@ func TestConvert(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	testEnv := makeEnv(p.Variables)
+	testEnv := makeEnv(p.Variables, nil)
+	formatEnv, _ := jobEnvAndContext(testEnv, nil, "format")
+	compileEnv, _ := jobEnvAndContext(testEnv, nil, "compile")
 	// TODO flatten this test
 	want := resources.PipelineRun("dsl", "my-pipeline-run-", pipelinev1.PipelineRunSpec{
 		ServiceAccountName: testServiceAccountName,
@@ -182,7 +351,7 @@ func TestConvert(t *testing.T) {
 		},
 		PipelineSpec: &pipelinev1.PipelineSpec{
 			Tasks: []pipelinev1.PipelineTask{
-				makeGitCloneTask(testEnv, source),
+				makeGitCloneTask(testEnv, source, nil, testGitImage),
 				makeScriptTask(beforeStepTaskName, []string{gitCloneTaskName}, testEnv, p.Image, p.BeforeScript),
 				{
 					Name: "format-stage-test",
@@ -195,7 +364,7 @@ func TestConvert(t *testing.T) {
 										Command:    []string{"sh"},
 										Args:       []string{"-c", "go fmt $(go list ./... | grep -v /vendor/)"},
 										WorkingDir: "$(workspaces.source.path)",
-										Env:        testEnv,
+										Env:        formatEnv,
 									},
 								},
 								{
@@ -204,7 +373,7 @@ func TestConvert(t *testing.T) {
 										Command:    []string{"sh"},
 										Args:       []string{"-c", "go vet $(go list ./... | grep -v /vendor/)"},
 										WorkingDir: "$(workspaces.source.path)",
-										Env:        testEnv,
+										Env:        formatEnv,
 									},
 								},
 								{
@@ -213,7 +382,7 @@ func TestConvert(t *testing.T) {
 										Command:    []string{"sh"},
 										Args:       []string{"-c", "go test -race $(go list ./... | grep -v /vendor/)"},
 										WorkingDir: "$(workspaces.source.path)",
-										Env:        testEnv,
+										Env:        formatEnv,
 									},
 								},
 							},
@@ -229,7 +398,7 @@ func TestConvert(t *testing.T) {
 						TaskSpec: pipelinev1.TaskSpec{
 							Steps: []pipelinev1.Step{
 								{
-									Container: container("", "test-compile-image", "sh", []string{"-c", `go build -race -ldflags "-extldflags '-static'" -o $CI_PROJECT_DIR/mybinary`}, testEnv, workspaceSourcePath),
+									Container: container("", "test-compile-image", "sh", []string{"-c", `go build -race -ldflags "-extldflags '-static'" -o $CI_PROJECT_DIR/mybinary`}, compileEnv, workspaceSourcePath),
 								},
 							},
 							Workspaces: []pipelinev1.WorkspaceDeclaration{{Name: "source"}},
@@ -248,7 +417,7 @@ func TestConvert(t *testing.T) {
 								{
 									Container: container("compile-archiver-archiver", testArchiverImage, "",
 										[]string{"archive", "--bucket-url",
-											testArchiveURL, "my-test-binary"}, testEnv, workspaceSourcePath),
+											testArchiveURL, "my-test-binary"}, compileEnv, workspaceSourcePath),
 								},
 							},
 							Workspaces: []pipelinev1.WorkspaceDeclaration{{Name: "source"}},
@@ -266,12 +435,61 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+func TestMakeTaskForStageWithJUnitReports(t *testing.T) {
+	job := &ci.Task{
+		Name:   "test",
+		Script: []string{"go test ./...", "go-junit-report < test.out > report.xml"},
+		Artifacts: ci.Artifacts{
+			Reports: ci.Reports{JUnit: []string{"report.xml", "reports/*.xml"}},
+		},
+	}
+	ctx, err := cel.New(hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := makeTaskForStage(job, "test", []string{gitCloneTaskName}, []corev1.EnvVar{}, "golang:latest", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantResults := []pipelinev1.TaskResult{
+		{Name: "junit-report", Description: "The compressed JUnit reports from the task"},
+	}
+	if diff := cmp.Diff(wantResults, task.TaskSpec.Results); diff != "" {
+		t.Fatalf("results don't match:\n%s", diff)
+	}
+	script := "if [ -f /tekton/home/.tekton-ci-exit-code ]; then exit 0; fi\nsh -c \"$1\" || echo $? > /tekton/home/.tekton-ci-exit-code"
+	for i, want := range [][]string{{"-c", script, "sh", "go test ./..."}, {"-c", script, "sh", "go-junit-report < test.out > report.xml"}} {
+		if diff := cmp.Diff(want, task.TaskSpec.Steps[i].Args); diff != "" {
+			t.Errorf("step %d args don't match:\n%s", i, diff)
+		}
+	}
+	report := task.TaskSpec.Steps[2]
+	if report.Name != "junit-report" || report.Image != "golang:latest" || report.WorkingDir != workspaceSourcePath {
+		t.Fatalf("got report step %s with image %s in %s", report.Name, report.Image, report.WorkingDir)
+	}
+	wantReport := []string{"-c", `status=0
+if [ -f /tekton/home/.tekton-ci-exit-code ]; then read status < /tekton/home/.tekton-ci-exit-code; fi
+cat report.xml reports/*.xml 2>/dev/null | gzip -c | base64 > /tekton/home/.tekton-ci-junit-report
+if [ ` + "`wc -c < /tekton/home/.tekton-ci-junit-report`" + ` -le 3072 ]; then
+  cp /tekton/home/.tekton-ci-junit-report $(results.junit-report.path)
+else
+  echo "the JUnit reports are larger than 3072 bytes when compressed, they're not recorded" >&2
+fi
+exit $status`}
+	if diff := cmp.Diff(wantReport, report.Args); diff != "" {
+		t.Fatalf("report step args don't match:\n%s", diff)
+	}
+}
+
 func TestConvertFixtures(t *testing.T) {
 	convertTests := []struct {
 		name string
 	}{
 		{"script_with_rules"},
 		{"pipeline_with_tekton_task"},
+		{"pipeline_with_tekton_task_tag"},
 		{"script_with_job_matrix"},
 	}
 
@@ -298,6 +516,119 @@ func TestConvertFixtures(t *testing.T) {
 
 }
 
+func TestConvertWithPredefinedVars(t *testing.T) {
+	p := &ci.Pipeline{
+		Image:  "golang:latest",
+		Stages: []string{"test"},
+		Tasks: []*ci.Task{
+			{
+				Name:   "format",
+				Stage:  "test",
+				Script: []string{"go fmt ./..."},
+				Rules:  []ci.Rule{{If: `vars.CI_JOB_NAME != "format"`, When: "never"}},
+			},
+			{
+				Name:   "lint",
+				Stage:  "test",
+				Script: []string{"golangci-lint run"},
+				Rules:  []ci.Rule{{If: `vars.CI_JOB_NAME != "format"`, When: "never"}},
+			},
+		},
+	}
+	ctx, err := cel.New(hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &Source{RepoURL: testRepoURL, Ref: "master"}
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+
+	pr, err := Convert(p, logger.Sugar(), testConfiguration(), source, "my-volume-claim-123", ctx, testEvtID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := pr.Spec.PipelineSpec.Tasks
+	if len(tasks) != 2 || tasks[1].Name != "format-stage-test" {
+		t.Fatalf("got tasks %#v, want git-clone and format-stage-test", tasks)
+	}
+	env := map[string]string{}
+	for _, v := range tasks[1].TaskSpec.Steps[0].Env {
+		env[v.Name] = v.Value
+	}
+	want := map[string]string{
+		"CI_JOB_NAME":        "format",
+		"CI_PIPELINE_ID":     testEvtID,
+		"CI_PIPELINE_SOURCE": "push",
+		"CI_COMMIT_TAG":      "simple-tag",
+		"CI_PROJECT_PATH":    "Codertocat/Hello-World",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("got %s = %q, want %q", k, env[k], v)
+		}
+	}
+	if _, ok := env["CI_MERGE_REQUEST_IID"]; ok {
+		t.Error("empty CI_MERGE_REQUEST_IID was set in the environment")
+	}
+}
+
+func TestConvertPassesTextVarsAsParams(t *testing.T) {
+	p := &ci.Pipeline{
+		Image:  "golang:latest",
+		Stages: []string{"test"},
+		Tasks: []*ci.Task{
+			{
+				Name:   "format",
+				Stage:  "test",
+				Script: []string{"go fmt ./..."},
+			},
+		},
+	}
+	ctx, err := cel.New(hook.MakeHookFromFixture(t, "../testdata/github_pull_request.json", "pull_request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &Source{RepoURL: testRepoURL, Ref: "master"}
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+
+	pr, err := Convert(p, logger.Sugar(), testConfiguration(), source, "my-volume-claim-123", ctx, testEvtID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantParams := []pipelinev1.Param{
+		{Name: "CI_MERGE_REQUEST_DESCRIPTION", Value: pipelinev1.ArrayOrString{StringVal: "This is a pretty simple change that we need to pull into master.", Type: "string"}},
+		{Name: "CI_MERGE_REQUEST_TITLE", Value: pipelinev1.ArrayOrString{StringVal: "Update the README with new information.", Type: "string"}},
+	}
+	if diff := cmp.Diff(wantParams, pr.Spec.Params); diff != "" {
+		t.Fatalf("params don't match:\n%s", diff)
+	}
+	wantSpecs := []pipelinev1.ParamSpec{
+		{Name: "CI_MERGE_REQUEST_DESCRIPTION", Type: "string"},
+		{Name: "CI_MERGE_REQUEST_TITLE", Type: "string"},
+	}
+	if diff := cmp.Diff(wantSpecs, pr.Spec.PipelineSpec.Params); diff != "" {
+		t.Fatalf("pipeline params don't match:\n%s", diff)
+	}
+	wantTaskParams := []pipelinev1.Param{
+		{Name: "CI_MERGE_REQUEST_DESCRIPTION", Value: pipelinev1.ArrayOrString{StringVal: "$(params.CI_MERGE_REQUEST_DESCRIPTION)", Type: "string"}},
+		{Name: "CI_MERGE_REQUEST_TITLE", Value: pipelinev1.ArrayOrString{StringVal: "$(params.CI_MERGE_REQUEST_TITLE)", Type: "string"}},
+	}
+	for _, task := range pr.Spec.PipelineSpec.Tasks {
+		if diff := cmp.Diff(wantTaskParams, task.Params); diff != "" {
+			t.Errorf("task %s params don't match:\n%s", task.Name, diff)
+		}
+		if diff := cmp.Diff(wantSpecs, task.TaskSpec.Params); diff != "" {
+			t.Errorf("task %s param specs don't match:\n%s", task.Name, diff)
+		}
+		for _, v := range task.TaskSpec.Steps[0].Env {
+			if v.Name == "CI_MERGE_REQUEST_TITLE" && v.Value != "$(params.CI_MERGE_REQUEST_TITLE)" {
+				t.Errorf("task %s got CI_MERGE_REQUEST_TITLE = %q", task.Name, v.Value)
+			}
+		}
+	}
+}
+
 func TestContainer(t *testing.T) {
 	env := []corev1.EnvVar{{Name: "TEST_DIR", Value: "/tmp/test"}}
 	got := container("test-name", "test-image", "run", []string{"this"}, env, "/tmp/dir")
@@ -318,9 +649,19 @@ func TestContainer(t *testing.T) {
 func TestMakeEnv(t *testing.T) {
 	env := makeEnv(map[string]string{
 		"TEST_KEY": "test_val",
+	}, map[string]string{
+		"CI_COMMIT_TAG":     "",
+		"CI_COMMIT_SHA":     "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+		"CI_COMMIT_BRANCH":  "master",
+		"CI_DEFAULT_BRANCH": "master",
+		"CI_COMMIT_MESSAGE": "Update $(params.url)",
 	})
 
 	want := []corev1.EnvVar{
+		{Name: "CI_COMMIT_BRANCH", Value: "master"},
+		{Name: "CI_COMMIT_MESSAGE", Value: "$(params.CI_COMMIT_MESSAGE)"},
+		{Name: "CI_COMMIT_SHA", Value: "6113728f27ae82c7b1a177c8d03f9e96e0adf246"},
+		{Name: "CI_DEFAULT_BRANCH", Value: "master"},
 		{Name: "TEST_KEY", Value: "test_val"},
 		{Name: "CI_PROJECT_DIR", Value: "$(workspaces.source.path)"},
 	}
@@ -386,6 +727,23 @@ func TestAnnotateSource(t *testing.T) {
 	}
 }
 
+func TestAnnotateSourceWithBranch(t *testing.T) {
+	cloneURL := "https://github.com/bigkevmcd/tekton-ci.git"
+	sha := "ec26c3e57ca3a959ca5aad62de7213c562f8c821"
+	src := &Source{RepoURL: cloneURL, Ref: sha, Branch: "main"}
+	pr := resources.PipelineRun("dsl", "test-", pipelinev1.PipelineRunSpec{}, AnnotateSource(testEvtID, src))
+
+	want := map[string]string{
+		"tekton.dev/ci-source-url":    cloneURL,
+		"tekton.dev/ci-source-ref":    sha,
+		"tekton.dev/ci-source-branch": "main",
+		"tekton.dev/ci-hook-id":       testEvtID,
+	}
+	if diff := cmp.Diff(want, pr.ObjectMeta.Annotations); diff != "" {
+		t.Fatalf("Source() failed: %s\n", diff)
+	}
+}
+
 func TestParamsToParams(t *testing.T) {
 	t.Skip()
 }
@@ -399,6 +757,7 @@ func testConfiguration() *Configuration {
 		PipelineRunPrefix:         testPipelineRunPrefix,
 		ArchiverImage:             testArchiverImage,
 		ArchiveURL:                testArchiveURL,
+		GitImage:                  testGitImage,
 		DefaultServiceAccountName: testServiceAccountName,
 		VolumeSize:                resource.MustParse("1G"),
 	}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
 	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
 	"github.com/jenkins-x/go-scm/scm"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // New creates and returns a new SCMClient.
@@ -25,9 +30,11 @@ type SCMClient struct {
 // ParseWebhookRequest parses an incoming hook request and returns a parsed
 // hook response if one can be matched.
 func (c *SCMClient) ParseWebhookRequest(req *http.Request) (scm.Webhook, error) {
+	ctx, span := tracing.Start(req.Context(), "validate_signature")
 	hook, err := c.client.Webhooks.Parse(req, func(hook scm.Webhook) (string, error) {
-		return c.secrets.Secret(req.Context(), hook)
+		return c.secrets.Secret(ctx, hook)
 	})
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -38,10 +45,17 @@ func (c *SCMClient) ParseWebhookRequest(req *http.Request) (scm.Webhook, error)
 //
 // If an HTTP error is returned by the upstream service, an error with the
 // response status code is returned.
-func (c *SCMClient) FileContents(ctx context.Context, repo, path, ref string) ([]byte, error) {
+func (c *SCMClient) FileContents(ctx context.Context, repo, path, ref string) (b []byte, err error) {
+	ctx, span := tracing.Start(ctx, "file_contents",
+		trace.WithAttributes(label.String("repo", repo), label.String("path", path), label.String("ref", ref)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	start := time.Now()
 	content, r, err := c.client.Contents.Find(ctx, repo, path, ref)
 	c.m.CountAPICall("file_contents")
-	if isErrorStatus(r.Status) {
+	c.observe("file_contents", start)
+	if isErrorResponse(r) {
 		return nil, scmError{msg: fmt.Sprintf("failed to get file %s from repo %s ref %s", path, repo, ref), Status: r.Status}
 	}
 	if err != nil {
@@ -56,10 +70,11 @@ func (c *SCMClient) FileContents(ctx context.Context, repo, path, ref string) ([
 // response status code is returned.
 func (c *SCMClient) CreateStatus(ctx context.Context, repo, commit string, s *scm.StatusInput) error {
 	c.m.CountAPICall("create_status")
+	defer c.observe("create_status", time.Now())
 	_, r, err := c.client.Repositories.CreateStatus(ctx, repo, commit, s)
-	errResponse := isErrorStatus(r.Status)
+	errResponse := isErrorResponse(r)
 	if errResponse || err != nil {
-		c.m.CountFailedAPICall("file_contents")
+		c.m.CountFailedAPICall("create_status")
 	}
 	if errResponse {
 		return scmError{msg: fmt.Sprintf("failed to create commitstatus in repo %s commit %s", repo, commit), Status: r.Status}
@@ -67,6 +82,204 @@ func (c *SCMClient) CreateStatus(ctx context.Context, repo, commit string, s *sc
 	return err
 }
 
+// CreateOrUpdateComment creates a comment on a pull request, or updates
+// the existing comment that contains the marker.
+//
+// This allows a single "sticky" comment to be maintained on a pull request.
+func (c *SCMClient) CreateOrUpdateComment(ctx context.Context, repo string, number int, marker, body string) error {
+	existing, err := c.findComment(ctx, repo, number, marker)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return c.CreateComment(ctx, repo, number, body)
+	}
+	c.m.CountAPICall("edit_comment")
+	defer c.observe("edit_comment", time.Now())
+	_, r, err := c.client.PullRequests.EditComment(ctx, repo, number, existing.ID, &scm.CommentInput{Body: body})
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("edit_comment")
+	}
+	if isErrorResponse(r) {
+		return scmError{msg: fmt.Sprintf("failed to edit comment %d in repo %s pull request %d", existing.ID, repo, number), Status: r.Status}
+	}
+	return err
+}
+
+// CreateComment creates a new comment on a pull request.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	c.m.CountAPICall("create_comment")
+	defer c.observe("create_comment", time.Now())
+	_, r, err := c.client.PullRequests.CreateComment(ctx, repo, number, &scm.CommentInput{Body: body})
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("create_comment")
+	}
+	if isErrorResponse(r) {
+		return scmError{msg: fmt.Sprintf("failed to create comment in repo %s pull request %d", repo, number), Status: r.Status}
+	}
+	return err
+}
+
+// FindPullRequest returns the pull request with the number in the repo.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) FindPullRequest(ctx context.Context, repo string, number int) (*scm.PullRequest, error) {
+	c.m.CountAPICall("find_pull_request")
+	defer c.observe("find_pull_request", time.Now())
+	pr, r, err := c.client.PullRequests.Find(ctx, repo, number)
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("find_pull_request")
+	}
+	if isErrorResponse(r) {
+		return nil, scmError{msg: fmt.Sprintf("failed to get pull request %d from repo %s", number, repo), Status: r.Status}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// FindUserPermission returns the permission that the user has on the repo.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) FindUserPermission(ctx context.Context, repo, user string) (string, error) {
+	c.m.CountAPICall("find_user_permission")
+	defer c.observe("find_user_permission", time.Now())
+	perm, r, err := c.client.Repositories.FindUserPermission(ctx, repo, user)
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("find_user_permission")
+	}
+	if isErrorResponse(r) {
+		return "", scmError{msg: fmt.Sprintf("failed to get permission for user %s in repo %s", user, repo), Status: r.Status}
+	}
+	return perm, err
+}
+
+// IsOrgMember returns true if the user is a member of the organisation that
+// owns the repo.
+//
+// If the driver doesn't support organisation membership, an unsupported error
+// is returned.
+func (c *SCMClient) IsOrgMember(ctx context.Context, repo, user string) (bool, error) {
+	c.m.CountAPICall("is_org_member")
+	defer c.observe("is_org_member", time.Now())
+	org := repo
+	if i := strings.LastIndex(repo, "/"); i >= 0 {
+		org = repo[:i]
+	}
+	member, r, err := c.client.Organizations.IsMember(ctx, org, user)
+	if err == scm.ErrNotSupported || (r != nil && r.Status == http.StatusNotImplemented) {
+		return false, unsupportedError{op: "organisation membership"}
+	}
+	if err != nil {
+		c.m.CountFailedAPICall("is_org_member")
+	}
+	return member, err
+}
+
+// AddLabel adds a label to a pull request.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) AddLabel(ctx context.Context, repo string, number int, label string) error {
+	c.m.CountAPICall("add_label")
+	defer c.observe("add_label", time.Now())
+	r, err := c.client.PullRequests.AddLabel(ctx, repo, number, label)
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("add_label")
+	}
+	if isErrorResponse(r) {
+		return scmError{msg: fmt.Sprintf("failed to add label %s to repo %s pull request %d", label, repo, number), Status: r.Status}
+	}
+	return err
+}
+
+// FindRepository returns the repository.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) FindRepository(ctx context.Context, repo string) (*scm.Repository, error) {
+	c.m.CountAPICall("find_repository")
+	defer c.observe("find_repository", time.Now())
+	found, r, err := c.client.Repositories.Find(ctx, repo)
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("find_repository")
+	}
+	if isErrorResponse(r) {
+		return nil, scmError{msg: fmt.Sprintf("failed to get repo %s", repo), Status: r.Status}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// FindCommit returns the commit for the ref in the repo.
+//
+// If an HTTP error is returned by the upstream service, an error with the
+// response status code is returned.
+func (c *SCMClient) FindCommit(ctx context.Context, repo, ref string) (*scm.Commit, error) {
+	c.m.CountAPICall("find_commit")
+	defer c.observe("find_commit", time.Now())
+	commit, r, err := c.client.Git.FindCommit(ctx, repo, ref)
+	if isErrorResponse(r) || err != nil {
+		c.m.CountFailedAPICall("find_commit")
+	}
+	if isErrorResponse(r) {
+		return nil, scmError{msg: fmt.Sprintf("failed to get commit %s from repo %s", ref, repo), Status: r.Status}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if commit == nil || commit.Sha == "" {
+		return nil, scmError{msg: fmt.Sprintf("failed to get commit %s from repo %s", ref, repo), Status: http.StatusNotFound}
+	}
+	return commit, nil
+}
+
+func (c *SCMClient) findComment(ctx context.Context, repo string, number int, marker string) (*scm.Comment, error) {
+	opts := scm.ListOptions{Page: 1, Size: 100}
+	for {
+		c.m.CountAPICall("list_comments")
+		start := time.Now()
+		comments, r, err := c.client.PullRequests.ListComments(ctx, repo, number, opts)
+		c.observe("list_comments", start)
+		if isErrorResponse(r) || err != nil {
+			c.m.CountFailedAPICall("list_comments")
+		}
+		if isErrorResponse(r) {
+			return nil, scmError{msg: fmt.Sprintf("failed to list comments in repo %s pull request %d", repo, number), Status: r.Status}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range comments {
+			if strings.Contains(v.Body, marker) {
+				return v, nil
+			}
+		}
+		if r == nil || r.Page.Next == 0 {
+			return nil, nil
+		}
+		opts.Page = r.Page.Next
+	}
+}
+
+// observe records the duration of the API call that started at start.
+func (c *SCMClient) observe(name string, start time.Time) {
+	c.m.ObserveAPICallDuration(name, time.Since(start))
+}
+
+// The fake go-scm driver returns nil responses.
+func isErrorResponse(r *scm.Response) bool {
+	return r != nil && isErrorStatus(r.Status)
+}
+
 func isErrorStatus(i int) bool {
 	return i >= 400
 }
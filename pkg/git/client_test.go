@@ -2,6 +2,8 @@ package git
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +15,7 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
 	"github.com/gitops-tools/tekton-ci/pkg/secrets"
 	"github.com/gitops-tools/tekton-ci/test"
 	"github.com/gitops-tools/tekton-ci/test/secret"
@@ -66,7 +69,7 @@ func TestParseWebhook(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	client := New(scmClient, secrets.New(hookSecret.ObjectMeta.Namespace, hookSecret.ObjectMeta.Name, fakeClient), metrics.NewMock())
+	client := New(scmClient, secrets.New(routing.NewStatic(routing.Route{Namespace: hookSecret.ObjectMeta.Namespace}), hookSecret.ObjectMeta.Name, fakeClient), metrics.NewMock())
 	hook, err := client.ParseWebhookRequest(req)
 	if err != nil {
 		t.Fatal(err)
@@ -85,7 +88,7 @@ func TestParseWebhookWithInvalidSignature(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	client := New(scmClient, secrets.New(hookSecret.ObjectMeta.Namespace, hookSecret.ObjectMeta.Name, fakeClient), metrics.NewMock())
+	client := New(scmClient, secrets.New(routing.NewStatic(routing.Route{Namespace: hookSecret.ObjectMeta.Namespace}), hookSecret.ObjectMeta.Name, fakeClient), metrics.NewMock())
 	_, err = client.ParseWebhookRequest(req)
 	if err != scm.ErrSignatureInvalid {
 		t.Fatal(err)
@@ -114,6 +117,9 @@ func TestCreateStatus(t *testing.T) {
 	if m.APICalls != 1 {
 		t.Fatalf("metrics count of API calls, got %d, want 1", m.APICalls)
 	}
+	if c := m.APICallDurations("create_status"); c != 1 {
+		t.Fatalf("metrics count of API call durations, got %d, want 1", c)
+	}
 }
 
 func TestCreateStatusWithNotFoundResponse(t *testing.T) {
@@ -136,8 +142,8 @@ func TestCreateStatusWithNotFoundResponse(t *testing.T) {
 	if !IsNotFound(err) {
 		t.Fatal(err)
 	}
-	if m.FailedAPICalls != 1 {
-		t.Fatalf("metrics count of failed API calls, got %d, want 1", m.FailedAPICalls)
+	if c := m.FailedAPICallsFor("create_status"); c != 1 {
+		t.Fatalf("metrics count of failed create_status API calls, got %d, want 1", c)
 	}
 }
 
@@ -167,3 +173,277 @@ func makeAPIServer(t *testing.T, urlPath, ref, fixture string) *httptest.Server
 		}
 	}))
 }
+
+func TestCreateOrUpdateCommentWithNoExistingComment(t *testing.T) {
+	m := metrics.NewMock()
+	var created string
+	as := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/Codertocat/Hello-World/issues/2/comments" {
+			t.Fatalf("request path got %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `[{"id": 1, "body": "this is a comment"}]`)
+		case http.MethodPost:
+			created = mustDecodeCommentBody(t, r)
+			fmt.Fprint(w, `{"id": 2, "body": "testing"}`)
+		default:
+			t.Fatalf("unexpected method %s", r.Method)
+		}
+	}))
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	err = client.CreateOrUpdateComment(context.TODO(), "Codertocat/Hello-World", 2, "<!-- testing -->", "<!-- testing -->\nnew comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<!-- testing -->\nnew comment"; created != want {
+		t.Fatalf("created comment got %s, want %s", created, want)
+	}
+	if m.APICalls != 2 {
+		t.Fatalf("metrics count of API calls, got %d, want 2", m.APICalls)
+	}
+}
+
+func TestCreateOrUpdateCommentWithExistingComment(t *testing.T) {
+	var edited string
+	as := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/Codertocat/Hello-World/issues/2/comments":
+			fmt.Fprint(w, `[{"id": 1, "body": "this is a comment"}, {"id": 5, "body": "<!-- testing -->\nold comment"}]`)
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/v3/repos/Codertocat/Hello-World/issues/comments/5":
+			edited = mustDecodeCommentBody(t, r)
+			fmt.Fprint(w, `{"id": 5, "body": "testing"}`)
+		default:
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, metrics.NewMock())
+
+	err = client.CreateOrUpdateComment(context.TODO(), "Codertocat/Hello-World", 2, "<!-- testing -->", "<!-- testing -->\nnew comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<!-- testing -->\nnew comment"; edited != want {
+		t.Fatalf("edited comment got %s, want %s", edited, want)
+	}
+}
+
+func mustDecodeCommentBody(t *testing.T, r *http.Request) string {
+	t.Helper()
+	var c struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	return c.Body
+}
+
+func TestFindPullRequest(t *testing.T) {
+	m := metrics.NewMock()
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World/pulls/1347", "", "testdata/pull_request.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	pr, err := client.FindPullRequest(context.TODO(), "octocat/Hello-World", 1347)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Sha != "6dcb09b5b57875f334f61aebed695e2e4193db5e" {
+		t.Fatalf("got SHA %s, want %s", pr.Sha, "6dcb09b5b57875f334f61aebed695e2e4193db5e")
+	}
+	if m.APICalls != 1 {
+		t.Fatalf("metrics count of API calls, got %d, want 1", m.APICalls)
+	}
+}
+
+func TestFindPullRequestWithNotFoundResponse(t *testing.T) {
+	m := metrics.NewMock()
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World/pulls/1347", "", "")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	_, err = client.FindPullRequest(context.TODO(), "octocat/Hello-World", 1347)
+	if !IsNotFound(err) {
+		t.Fatal(err)
+	}
+	if m.FailedAPICalls != 1 {
+		t.Fatalf("metrics count of failed API calls, got %d, want 1", m.FailedAPICalls)
+	}
+}
+
+func TestFindRepository(t *testing.T) {
+	m := metrics.NewMock()
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World", "", "testdata/repository.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	repo, err := client.FindRepository(context.TODO(), "octocat/Hello-World")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Clone != "https://github.com/octocat/Hello-World.git" || repo.Branch != "main" {
+		t.Fatalf("got clone URL %s and branch %s", repo.Clone, repo.Branch)
+	}
+	if m.APICalls != 1 {
+		t.Fatalf("metrics count of API calls, got %d, want 1", m.APICalls)
+	}
+}
+
+func TestFindCommit(t *testing.T) {
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World/commits/main", "", "testdata/commit.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, metrics.NewMock())
+
+	commit, err := client.FindCommit(context.TODO(), "octocat/Hello-World", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Sha != "6dcb09b5b57875f334f61aebed695e2e4193db5e" || commit.Message != "Fix all the bugs" {
+		t.Fatalf("got commit %s with message %q", commit.Sha, commit.Message)
+	}
+}
+
+func TestFindCommitWithNotFoundResponse(t *testing.T) {
+	m := metrics.NewMock()
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World/commits/unknown", "", "")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	_, err = client.FindCommit(context.TODO(), "octocat/Hello-World", "unknown")
+	if !IsNotFound(err) {
+		t.Fatal(err)
+	}
+	if m.FailedAPICalls != 1 {
+		t.Fatalf("metrics count of failed API calls, got %d, want 1", m.FailedAPICalls)
+	}
+}
+
+func TestFindUserPermission(t *testing.T) {
+	as := makeAPIServer(t, "/api/v3/repos/octocat/Hello-World/collaborators/octocat/permission", "", "testdata/user_permission.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, metrics.NewMock())
+
+	perm, err := client.FindUserPermission(context.TODO(), "octocat/Hello-World", "octocat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm != "admin" {
+		t.Fatalf("got permission %s, want admin", perm)
+	}
+}
+
+func TestIsOrgMember(t *testing.T) {
+	memberTests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusNoContent, true},
+		{http.StatusNotFound, false},
+	}
+
+	for _, tt := range memberTests {
+		as := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/orgs/Codertocat/members/octocat" {
+				t.Fatalf("request path got %s", r.URL.Path)
+			}
+			w.WriteHeader(tt.status)
+		}))
+		scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := New(scmClient, nil, metrics.NewMock())
+
+		member, err := client.IsOrgMember(context.TODO(), "Codertocat/Hello-World", "octocat")
+		as.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member != tt.want {
+			t.Errorf("IsOrgMember() with status %d got %v, want %v", tt.status, member, tt.want)
+		}
+	}
+}
+
+func TestIsOrgMemberWithUnsupportedDriver(t *testing.T) {
+	scmClient, err := factory.NewClient("bitbucket", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, metrics.NewMock())
+
+	_, err = client.IsOrgMember(context.TODO(), "Codertocat/Hello-World", "octocat")
+	if !IsUnsupported(err) {
+		t.Fatalf("got error %v, want an unsupported error", err)
+	}
+}
+
+func TestAddLabel(t *testing.T) {
+	m := metrics.NewMock()
+	var labels []string
+	as := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/repos/Codertocat/Hello-World/issues/2/labels" || r.Method != http.MethodPost {
+			t.Fatalf("request got %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, `[{"name": "ok-to-test"}]`)
+	}))
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(scmClient, nil, m)
+
+	err = client.AddLabel(context.TODO(), "Codertocat/Hello-World", 2, "ok-to-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"ok-to-test"}, labels); diff != "" {
+		t.Fatalf("labels incorrect:\n%s", diff)
+	}
+	if m.APICalls != 1 {
+		t.Fatalf("metrics count of API calls, got %d, want 1", m.APICalls)
+	}
+}
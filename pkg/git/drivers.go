@@ -0,0 +1,181 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+)
+
+// The hosts for drivers that have a public service.
+var defaultHosts = map[string]string{
+	"github":    "github.com",
+	"gitlab":    "gitlab.com",
+	"bitbucket": "bitbucket.org",
+}
+
+// DetectDriver returns the name of the go-scm driver for a hook request, from
+// the headers that each service sends, or "" if the service isn't known.
+//
+// Gitea also sends the GitHub and Gogs headers, so it's detected first.
+func DetectDriver(r *http.Request) string {
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		return "gitea"
+	case r.Header.Get("X-Gogs-Event") != "":
+		return "gogs"
+	case r.Header.Get("X-GitHub-Event") != "":
+		return "github"
+	case r.Header.Get("X-Gitlab-Event") != "":
+		return "gitlab"
+	case r.Header.Get("X-Event-Key") != "":
+		// Bitbucket Cloud identifies hooks with UUIDs, Bitbucket Server only
+		// sends a request ID.
+		if r.Header.Get("X-Hook-UUID") != "" || r.Header.Get("X-Request-UUID") != "" {
+			return "bitbucket"
+		}
+		return "stash"
+	}
+	return ""
+}
+
+// The headers that services send with the unique ID of each hook delivery.
+var deliveryHeaders = []string{
+	"X-GitHub-Delivery",
+	"X-Gitea-Delivery",
+	"X-Gogs-Delivery",
+	"X-Gitlab-Event-UUID",
+	"X-Request-UUID",
+	"X-Request-Id",
+}
+
+type hookIDKey struct{}
+
+// WithHookID returns a context with the ID for a hook, this takes precedence
+// over the IDs from the hook and request headers in HookID.
+func WithHookID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, hookIDKey{}, id)
+}
+
+// HookIDFromContext returns the ID for a hook from the context, or "" if
+// there is none.
+func HookIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(hookIDKey{}).(string)
+	return id
+}
+
+// HookID returns an ID for a hook, this is the ID from the request context,
+// the GUID parsed from the hook, or the delivery ID from the request headers.
+//
+// If the service provides no ID, a new one is generated.
+func HookID(r *http.Request, h scm.Webhook) string {
+	if id := HookIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	switch evt := h.(type) {
+	case *scm.PushHook:
+		if evt.GUID != "" {
+			return evt.GUID
+		}
+	case *scm.PullRequestHook:
+		if evt.GUID != "" {
+			return evt.GUID
+		}
+	}
+	if id := DeliveryID(r); id != "" {
+		return id
+	}
+	return string(uuid.NewUUID())
+}
+
+// DeliveryID returns the ID of the hook delivery from the request headers,
+// or "" if the service sent no ID.
+func DeliveryID(r *http.Request) string {
+	for _, header := range deliveryHeaders {
+		if id := r.Header.Get(header); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// DriverHost returns the host that repositories for the driver are hosted on.
+//
+// If the serverURL is empty, the host for the public service is returned, an
+// error is returned if the driver has no public service e.g. gitea, as it
+// needs a server URL.
+func DriverHost(driver, serverURL string) (string, error) {
+	if serverURL == "" {
+		host, ok := defaultHosts[driver]
+		if !ok {
+			return "", fmt.Errorf("driver %s has no public service, it needs a server URL", driver)
+		}
+		return host, nil
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the server URL for driver %s: %w", driver, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL for driver %s: %s", driver, serverURL)
+	}
+	return u.Host, nil
+}
+
+// CloneURL returns the HTTPS clone URL for a repository e.g. "my-org/my-repo",
+// on the server for the driver.
+//
+// The API paths that are part of server URLs for GitHub Enterprise and GitLab
+// are removed.
+func CloneURL(driver, serverURL, repo string) string {
+	if serverURL == "" {
+		return fmt.Sprintf("https://%s/%s.git", defaultHosts[driver], repo)
+	}
+	base := strings.TrimSuffix(serverURL, "/")
+	for _, suffix := range []string{"/api/v3", "/api/v4"} {
+		base = strings.TrimSuffix(base, suffix)
+	}
+	return fmt.Sprintf("%s/%s.git", base, repo)
+}
+
+// GitHubAPIURL returns the API URL for a GitHub server URL, or for
+// github.com if the server URL is empty.
+func GitHubAPIURL(serverURL string) string {
+	if serverURL == "" {
+		return credentials.DefaultGitHubAPIURL
+	}
+	base := strings.TrimSuffix(serverURL, "/")
+	if strings.HasSuffix(base, "/api/v3") {
+		return base
+	}
+	return base + "/api/v3"
+}
+
+// NewDriverMux creates and returns a DriverMux.
+//
+// Requests are dispatched to the handler for the driver detected from the
+// request, or to the handler for the default driver.
+func NewDriverMux(def string, handlers map[string]http.Handler) *DriverMux {
+	return &DriverMux{def: def, handlers: handlers}
+}
+
+// DriverMux is an http.Handler that dispatches hook requests to handlers by
+// the go-scm driver that the request is for.
+type DriverMux struct {
+	def      string
+	handlers map[string]http.Handler
+}
+
+func (d *DriverMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := d.handlers[DetectDriver(r)]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	d.handlers[d.def].ServeHTTP(w, r)
+}
@@ -0,0 +1,187 @@
+package git
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+func TestDetectDriver(t *testing.T) {
+	driverTests := []struct {
+		headers map[string]string
+		want    string
+	}{
+		{map[string]string{"X-GitHub-Event": "push"}, "github"},
+		{map[string]string{"X-Gitlab-Event": "Push Hook"}, "gitlab"},
+		{map[string]string{"X-Gitea-Event": "push", "X-Gogs-Event": "push", "X-GitHub-Event": "push"}, "gitea"},
+		{map[string]string{"X-Gogs-Event": "push"}, "gogs"},
+		{map[string]string{"X-Event-Key": "repo:push", "X-Hook-UUID": "test-uuid"}, "bitbucket"},
+		{map[string]string{"X-Event-Key": "repo:refs_changed", "X-Request-Id": "test-id"}, "stash"},
+		{map[string]string{}, ""},
+	}
+
+	for _, tt := range driverTests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		if got := DetectDriver(req); got != tt.want {
+			t.Errorf("DetectDriver(%v) got %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestDriverHost(t *testing.T) {
+	hostTests := []struct {
+		driver    string
+		serverURL string
+		want      string
+	}{
+		{"github", "", "github.com"},
+		{"gitlab", "", "gitlab.com"},
+		{"github", "https://ghe.example.com/api/v3", "ghe.example.com"},
+		{"gitea", "https://gitea.example.com:3000", "gitea.example.com:3000"},
+	}
+
+	for _, tt := range hostTests {
+		got, err := DriverHost(tt.driver, tt.serverURL)
+		if err != nil {
+			t.Errorf("DriverHost(%q, %q) failed: %s", tt.driver, tt.serverURL, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DriverHost(%q, %q) got %q, want %q", tt.driver, tt.serverURL, got, tt.want)
+		}
+	}
+}
+
+func TestDriverHostErrors(t *testing.T) {
+	errorTests := []struct {
+		driver    string
+		serverURL string
+	}{
+		{"gitea", ""},
+		{"gogs", ""},
+		{"stash", ""},
+		{"gitea", "gitea.example.com"},
+	}
+
+	for _, tt := range errorTests {
+		if _, err := DriverHost(tt.driver, tt.serverURL); err == nil {
+			t.Errorf("DriverHost(%q, %q) did not fail", tt.driver, tt.serverURL)
+		}
+	}
+}
+
+func TestDriverMux(t *testing.T) {
+	mux := NewDriverMux("github", map[string]http.Handler{
+		"github": namedHandler("github"),
+		"gitlab": namedHandler("gitlab"),
+	})
+
+	muxTests := []struct {
+		header string
+		want   string
+	}{
+		{"X-GitHub-Event", "github"},
+		{"X-Gitlab-Event", "gitlab"},
+		{"X-Gitea-Event", "github"},
+		{"", "github"},
+	}
+
+	for _, tt := range muxTests {
+		req := httptest.NewRequest(http.MethodPost, "/pipeline", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, "push")
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("request with %q got handler %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name))
+	})
+}
+
+func TestCloneURL(t *testing.T) {
+	cloneTests := []struct {
+		driver    string
+		serverURL string
+		want      string
+	}{
+		{"github", "", "https://github.com/my-org/my-repo.git"},
+		{"gitlab", "", "https://gitlab.com/my-org/my-repo.git"},
+		{"github", "https://ghe.example.com/api/v3/", "https://ghe.example.com/my-org/my-repo.git"},
+		{"gitlab", "https://gitlab.example.com/api/v4", "https://gitlab.example.com/my-org/my-repo.git"},
+		{"gitea", "https://example.com/gitea", "https://example.com/gitea/my-org/my-repo.git"},
+	}
+
+	for _, tt := range cloneTests {
+		if got := CloneURL(tt.driver, tt.serverURL, "my-org/my-repo"); got != tt.want {
+			t.Errorf("CloneURL(%q, %q) got %q, want %q", tt.driver, tt.serverURL, got, tt.want)
+		}
+	}
+}
+
+func TestGitHubAPIURL(t *testing.T) {
+	urlTests := []struct {
+		serverURL string
+		want      string
+	}{
+		{"", "https://api.github.com"},
+		{"https://ghe.example.com", "https://ghe.example.com/api/v3"},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com/api/v3"},
+	}
+
+	for _, tt := range urlTests {
+		if got := GitHubAPIURL(tt.serverURL); got != tt.want {
+			t.Errorf("GitHubAPIURL(%q) got %q, want %q", tt.serverURL, got, tt.want)
+		}
+	}
+}
+
+func TestHookID(t *testing.T) {
+	push := &scm.PushHook{GUID: "push-guid"}
+
+	idTests := []struct {
+		name    string
+		ctxID   string
+		headers map[string]string
+		hook    scm.Webhook
+		want    string
+	}{
+		{"from the hook", "", map[string]string{"X-GitHub-Delivery": "delivery-id"}, push, "push-guid"},
+		{"from the headers", "", map[string]string{"X-Gitlab-Event-UUID": "gitlab-id"}, &scm.IssueCommentHook{}, "gitlab-id"},
+		{"from the context", "context-id", map[string]string{"X-GitHub-Delivery": "delivery-id"}, push, "context-id"},
+	}
+
+	for _, tt := range idTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.ctxID != "" {
+				req = req.WithContext(WithHookID(req.Context(), tt.ctxID))
+			}
+			if got := HookID(req, tt.hook); got != tt.want {
+				t.Errorf("HookID() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookIDGeneratesIDs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	if id := HookID(req, &scm.IssueCommentHook{}); id == "" {
+		t.Fatal("no ID was generated")
+	}
+}
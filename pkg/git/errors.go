@@ -9,6 +9,21 @@ func IsNotFound(err error) bool {
 	return ok && e.Status == http.StatusNotFound
 }
 
+// IsUnsupported returns true if the error is because the upstream service
+// doesn't support the operation.
+func IsUnsupported(err error) bool {
+	_, ok := err.(unsupportedError)
+	return ok
+}
+
+type unsupportedError struct {
+	op string
+}
+
+func (u unsupportedError) Error() string {
+	return u.op + " is not supported by the driver"
+}
+
 type scmError struct {
 	msg    string
 	Status int
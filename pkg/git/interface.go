@@ -15,4 +15,25 @@ type SCM interface {
 	FileContents(ctx context.Context, repo, path, ref string) ([]byte, error)
 	// CreateStatus creates a new commit status for the repo/commit combination.
 	CreateStatus(ctx context.Context, repo, commit string, s *scm.StatusInput) error
+	// CreateOrUpdateComment creates a comment on a pull request, or updates
+	// the existing comment that contains the marker.
+	CreateOrUpdateComment(ctx context.Context, repo string, number int, marker, body string) error
+	// CreateComment creates a new comment on a pull request.
+	CreateComment(ctx context.Context, repo string, number int, body string) error
+	// FindPullRequest returns the pull request with the number in the repo.
+	FindPullRequest(ctx context.Context, repo string, number int) (*scm.PullRequest, error)
+	// FindUserPermission returns the permission that the user has on the repo
+	// e.g. "admin", "write", "read" or "none".
+	FindUserPermission(ctx context.Context, repo, user string) (string, error)
+	// IsOrgMember returns true if the user is a member of the organisation
+	// that owns the repo, if the service doesn't support organisation
+	// membership, an error that IsUnsupported recognises is returned.
+	IsOrgMember(ctx context.Context, repo, user string) (bool, error)
+	// AddLabel adds a label to a pull request.
+	AddLabel(ctx context.Context, repo string, number int, label string) error
+	// FindRepository returns the repository e.g. to get its clone URL.
+	FindRepository(ctx context.Context, repo string) (*scm.Repository, error)
+	// FindCommit returns the commit for a ref in the repo, the ref can be a
+	// branch, tag or SHA.
+	FindCommit(ctx context.Context, repo, ref string) (*scm.Commit, error)
 }
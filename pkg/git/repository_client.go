@@ -0,0 +1,216 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/factory"
+
+	"github.com/gitops-tools/tekton-ci/pkg/credentials"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+)
+
+// NewPerRepository creates and returns a new PerRepositoryClient.
+//
+// The driver and serverURL are passed to the go-scm factory along with the
+// token for the repository, if the repository is routed to a different server
+// URL, that is used instead.
+func NewPerRepository(driver, serverURL string, r routing.Router, p credentials.Provider, s secrets.SecretGetter, m metrics.Interface, opts ...factory.ClientOptionFunc) *PerRepositoryClient {
+	return &PerRepositoryClient{
+		driver:      driver,
+		serverURL:   serverURL,
+		router:      r,
+		credentials: p,
+		secrets:     s,
+		m:           m,
+		opts:        opts,
+	}
+}
+
+// PerRepositoryClient implements the SCM interface, creating a client with the
+// credentials for the repository or organisation for each request.
+type PerRepositoryClient struct {
+	driver      string
+	serverURL   string
+	router      routing.Router
+	credentials credentials.Provider
+	secrets     secrets.SecretGetter
+	m           metrics.Interface
+	opts        []factory.ClientOptionFunc
+}
+
+// ParseWebhookRequest implements the SCM interface.
+//
+// Parsing hooks does not require credentials, if the hook was sent by a GitHub
+// App installation, this is recorded for the repository.
+//
+// If the driver doesn't provide a clone URL for the repository, one is
+// derived from the server URL for the repository.
+func (c *PerRepositoryClient) ParseWebhookRequest(req *http.Request) (scm.Webhook, error) {
+	client, err := c.clientWithToken(c.serverURL, "")
+	if err != nil {
+		return nil, err
+	}
+	hook, err := client.ParseWebhookRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := c.credentials.(credentials.InstallationRecorder); ok {
+		if ref := hook.GetInstallationRef(); ref != nil && ref.ID != 0 {
+			repo := hook.Repository()
+			r.RecordInstallation(fmt.Sprintf("%s/%s", repo.Namespace, repo.Name), ref.ID)
+		}
+	}
+	if hook.Repository().Clone == "" {
+		if err := c.setCloneURL(req.Context(), hook); err != nil {
+			return nil, err
+		}
+	}
+	return hook, nil
+}
+
+// FileContents implements the SCM interface.
+func (c *PerRepositoryClient) FileContents(ctx context.Context, repo, path, ref string) ([]byte, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return client.FileContents(ctx, repo, path, ref)
+}
+
+// CreateStatus implements the SCM interface.
+func (c *PerRepositoryClient) CreateStatus(ctx context.Context, repo, commit string, s *scm.StatusInput) error {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return client.CreateStatus(ctx, repo, commit, s)
+}
+
+// CreateOrUpdateComment implements the SCM interface.
+func (c *PerRepositoryClient) CreateOrUpdateComment(ctx context.Context, repo string, number int, marker, body string) error {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return client.CreateOrUpdateComment(ctx, repo, number, marker, body)
+}
+
+// CreateComment implements the SCM interface.
+func (c *PerRepositoryClient) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return client.CreateComment(ctx, repo, number, body)
+}
+
+// FindRepository implements the SCM interface.
+func (c *PerRepositoryClient) FindRepository(ctx context.Context, repo string) (*scm.Repository, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return client.FindRepository(ctx, repo)
+}
+
+// FindCommit implements the SCM interface.
+func (c *PerRepositoryClient) FindCommit(ctx context.Context, repo, ref string) (*scm.Commit, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return client.FindCommit(ctx, repo, ref)
+}
+
+// FindPullRequest implements the SCM interface.
+func (c *PerRepositoryClient) FindPullRequest(ctx context.Context, repo string, number int) (*scm.PullRequest, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return client.FindPullRequest(ctx, repo, number)
+}
+
+// FindUserPermission implements the SCM interface.
+func (c *PerRepositoryClient) FindUserPermission(ctx context.Context, repo, user string) (string, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	return client.FindUserPermission(ctx, repo, user)
+}
+
+// IsOrgMember implements the SCM interface.
+func (c *PerRepositoryClient) IsOrgMember(ctx context.Context, repo, user string) (bool, error) {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return false, err
+	}
+	return client.IsOrgMember(ctx, repo, user)
+}
+
+// AddLabel implements the SCM interface.
+func (c *PerRepositoryClient) AddLabel(ctx context.Context, repo string, number int, label string) error {
+	client, err := c.clientFor(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return client.AddLabel(ctx, repo, number, label)
+}
+
+// clientFor creates a client with the token for a repository or
+// organisation.
+func (c *PerRepositoryClient) clientFor(ctx context.Context, name string) (*SCMClient, error) {
+	serverURL, err := c.serverURLFor(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.credentials.Token(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.clientWithToken(serverURL, token)
+}
+
+func (c *PerRepositoryClient) serverURLFor(ctx context.Context, name string) (string, error) {
+	route, err := c.router.Route(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if route.ServerURL != "" {
+		return route.ServerURL, nil
+	}
+	return c.serverURL, nil
+}
+
+func (c *PerRepositoryClient) setCloneURL(ctx context.Context, hook scm.Webhook) error {
+	repo := hook.Repository()
+	name := fmt.Sprintf("%s/%s", repo.Namespace, repo.Name)
+	serverURL, err := c.serverURLFor(ctx, name)
+	if err != nil {
+		return err
+	}
+	cloneURL := CloneURL(c.driver, serverURL, name)
+	switch evt := hook.(type) {
+	case *scm.PushHook:
+		evt.Repo.Clone = cloneURL
+	case *scm.PullRequestHook:
+		evt.Repo.Clone = cloneURL
+	case *scm.IssueCommentHook:
+		evt.Repo.Clone = cloneURL
+	}
+	return nil
+}
+
+func (c *PerRepositoryClient) clientWithToken(serverURL, token string) (*SCMClient, error) {
+	scmClient, err := factory.NewClient(c.driver, serverURL, token, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(scmClient, c.secrets, c.m), nil
+}
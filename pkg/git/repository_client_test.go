@@ -0,0 +1,110 @@
+package git
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+	"github.com/gitops-tools/tekton-ci/test"
+)
+
+var _ SCM = (*PerRepositoryClient)(nil)
+
+var testRouter = routing.NewStatic(routing.Route{Namespace: "testing"})
+
+func TestPerRepositoryClientUsesTokenForRepository(t *testing.T) {
+	var auth string
+	as := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		http.NotFound(w, r)
+	}))
+	defer as.Close()
+	tokens := stubProvider{"my-org/my-repo": "repo-token", "other-org/my-repo": "other-token"}
+	client := NewPerRepository("github", as.URL, testRouter, tokens, secrets.NewMock(), metrics.NewMock())
+
+	for repo, token := range tokens {
+		_, err := client.FileContents(context.TODO(), repo, ".tekton_ci.yaml", "master")
+		if !IsNotFound(err) {
+			t.Fatal(err)
+		}
+		if want := "Bearer " + token; auth != want {
+			t.Errorf("FileContents(%s) got Authorization %q, want %q", repo, auth, want)
+		}
+	}
+}
+
+func TestPerRepositoryClientRecordsInstallations(t *testing.T) {
+	tokens := &recordingProvider{installations: map[string]int64{}}
+	client := NewPerRepository("github", "", testRouter, tokens, secrets.NewMock(), metrics.NewMock())
+	req := test.MakeHookRequest(t, "testdata/push_hook.json", "push", func(body map[string]interface{}) {
+		body["installation"] = map[string]interface{}{"id": 5678}
+	})
+
+	_, err := client.ParseWebhookRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"Codertocat/Hello-World": 5678}
+	if diff := cmp.Diff(want, tokens.installations); diff != "" {
+		t.Fatalf("installations incorrect:\n%s", diff)
+	}
+}
+
+func TestPerRepositoryClientUsesServerURLForRepository(t *testing.T) {
+	var path string
+	as := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		http.NotFound(w, r)
+	}))
+	defer as.Close()
+	router := routing.NewStatic(routing.Route{ServerURL: as.URL + "/enterprise"})
+	client := NewPerRepository("github", "https://unused.example.com", router, stubProvider{}, secrets.NewMock(), metrics.NewMock())
+
+	_, err := client.FileContents(context.TODO(), "my-org/my-repo", ".tekton_ci.yaml", "master")
+	if !IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	if want := "/enterprise/api/v3/repos/my-org/my-repo/contents/.tekton_ci.yaml"; path != want {
+		t.Fatalf("got request to %s, want %s", path, want)
+	}
+}
+
+func TestPerRepositoryClientSetsMissingCloneURL(t *testing.T) {
+	router := routing.NewStatic(routing.Route{ServerURL: "https://github.example.com/api/v3"})
+	client := NewPerRepository("github", "", router, stubProvider{}, secrets.NewMock(), metrics.NewMock())
+	req := test.MakeHookRequest(t, "testdata/push_hook.json", "push", func(body map[string]interface{}) {
+		body["repository"].(map[string]interface{})["clone_url"] = ""
+	})
+
+	hook, err := client.ParseWebhookRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := hook.Repository().Clone; c != "https://github.example.com/Codertocat/Hello-World.git" {
+		t.Fatalf("got clone URL %s", c)
+	}
+}
+
+type recordingProvider struct {
+	stubProvider
+	installations map[string]int64
+}
+
+func (r *recordingProvider) RecordInstallation(repo string, id int64) {
+	r.installations[repo] = id
+}
+
+type stubProvider map[string]string
+
+func (s stubProvider) Token(ctx context.Context, name string) (string, error) {
+	return s[name], nil
+}
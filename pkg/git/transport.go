@@ -0,0 +1,48 @@
+package git
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/factory"
+	"github.com/jenkins-x/go-scm/scm/transport"
+	"golang.org/x/oauth2"
+)
+
+// NewTransport returns an http.Transport that trusts the certificates in the
+// PEM encoded CA bundle, in addition to the system certificates.
+func NewTransport(caBundle []byte) (*http.Transport, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("no certificates found in the CA bundle")
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return t, nil
+}
+
+// WithTransport returns a go-scm client option that sends requests with the
+// base transport, keeping the authentication that the client was created
+// with.
+func WithTransport(base http.RoundTripper) factory.ClientOptionFunc {
+	return func(c *scm.Client) {
+		if c.Client == nil || c.Client.Transport == nil {
+			c.Client = &http.Client{Transport: base}
+			return
+		}
+		switch t := c.Client.Transport.(type) {
+		case *oauth2.Transport:
+			t.Base = base
+		case *transport.PrivateToken:
+			t.Base = base
+		case *transport.Authorization:
+			t.Base = base
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package git
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm/factory"
+)
+
+func TestWithTransportAndCABundle(t *testing.T) {
+	var auth string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization") + r.Header.Get("Private-Token")
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	tr, err := NewTransport(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, driver := range []string{"github", "gitlab"} {
+		client, err := factory.NewClient(driver, ts.URL, "test-token", WithTransport(tr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth = ""
+		_, r, err := client.Contents.Find(context.TODO(), "my-org/my-repo", ".tekton_ci.yaml", "master")
+		if r == nil || r.Status != http.StatusNotFound {
+			t.Fatalf("%s: request failed: %v", driver, err)
+		}
+		if auth == "" {
+			t.Fatalf("%s: request was not authenticated", driver)
+		}
+	}
+}
+
+func TestNewTransportWithInvalidBundle(t *testing.T) {
+	_, err := NewTransport([]byte("not a certificate"))
+	if err == nil || err.Error() != "no certificates found in the CA bundle" {
+		t.Fatalf("got %v, want an error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package hookerrors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Reason classifies the errors from processing hooks.
+type Reason string
+
+// The reasons that processing a hook can fail for.
+const (
+	// InvalidHook is for hooks that can't be parsed or validated.
+	InvalidHook Reason = "InvalidHook"
+
+	// InvalidDefinition is for pipeline definitions that can't be parsed or
+	// converted.
+	InvalidDefinition Reason = "InvalidDefinition"
+
+	// SCMFailure is for failed requests to the Git hosting service.
+	SCMFailure Reason = "SCMFailure"
+
+	// KubernetesFailure is for failed requests to the Kubernetes API.
+	KubernetesFailure Reason = "KubernetesFailure"
+
+	// Unavailable is for hooks that can't be accepted for processing.
+	Unavailable Reason = "Unavailable"
+
+	// Unknown is for errors that are not classified.
+	Unknown Reason = "Unknown"
+)
+
+var statusCodes = map[Reason]int{
+	InvalidHook:       http.StatusBadRequest,
+	InvalidDefinition: http.StatusUnprocessableEntity,
+	SCMFailure:        http.StatusBadGateway,
+	KubernetesFailure: http.StatusServiceUnavailable,
+	Unavailable:       http.StatusServiceUnavailable,
+	Unknown:           http.StatusInternalServerError,
+}
+
+// Error is an error with the reason it occurred.
+type Error struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New wraps the error with the reason, if the error is nil, nil is returned.
+func New(reason Reason, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Reason: reason, Err: err}
+}
+
+// Definition returns an InvalidDefinition error.
+func Definition(err error) error {
+	return New(InvalidDefinition, err)
+}
+
+// SCM returns an SCMFailure error.
+func SCM(err error) error {
+	return New(SCMFailure, err)
+}
+
+// Kubernetes returns a KubernetesFailure error.
+func Kubernetes(err error) error {
+	return New(KubernetesFailure, err)
+}
+
+// ReasonFor returns the reason for the error, or Unknown if it's not
+// classified.
+func ReasonFor(err error) Reason {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	return Unknown
+}
+
+// StatusCode returns the HTTP status code for the error.
+func StatusCode(err error) int {
+	return statusCodes[ReasonFor(err)]
+}
+
+// Retryable returns true if processing the hook again might succeed, invalid
+// hooks and definitions are not retried.
+func Retryable(err error) bool {
+	switch ReasonFor(err) {
+	case InvalidHook, InvalidDefinition:
+		return false
+	}
+	return true
+}
+
+// Response is the body of error responses.
+type Response struct {
+	ID     string `json:"id"`
+	Reason Reason `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// Write writes a JSON error response for the hook with the ID, with the
+// status code for the error.
+func Write(w http.ResponseWriter, id string, err error) error {
+	b, merr := json.Marshal(Response{ID: id, Reason: ReasonFor(err), Error: err.Error()})
+	if merr != nil {
+		return merr
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(StatusCode(err))
+	_, werr := w.Write(b)
+	return werr
+}
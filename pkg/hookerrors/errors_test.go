@@ -0,0 +1,57 @@
+package hookerrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	failure := errors.New("failed")
+	codeTests := []struct {
+		err       error
+		want      int
+		retryable bool
+	}{
+		{New(InvalidHook, failure), http.StatusBadRequest, false},
+		{Definition(failure), http.StatusUnprocessableEntity, false},
+		{SCM(failure), http.StatusBadGateway, true},
+		{Kubernetes(failure), http.StatusServiceUnavailable, true},
+		{New(Unavailable, failure), http.StatusServiceUnavailable, true},
+		{fmt.Errorf("wrapped: %w", Definition(failure)), http.StatusUnprocessableEntity, false},
+		{failure, http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range codeTests {
+		if got := StatusCode(tt.err); got != tt.want {
+			t.Errorf("StatusCode(%v) got %d, want %d", tt.err, got, tt.want)
+		}
+		if got := Retryable(tt.err); got != tt.retryable {
+			t.Errorf("Retryable(%v) got %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
+
+func TestNewWithNilError(t *testing.T) {
+	if err := SCM(nil); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	if err := Write(rec, "hook-1", Definition(errors.New("invalid YAML"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	want := `{"id":"hook-1","reason":"InvalidDefinition","error":"invalid YAML"}`
+	if b := rec.Body.String(); b != want {
+		t.Fatalf("got body %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,156 @@
+package logs
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// APIPath is the path that the APIHandler serves requests under.
+const APIPath = "/api/logs"
+
+var partOfLabels = labels.Set{"app.kubernetes.io/part-of": "Tekton-CI"}
+
+// APIHandler implements the http.Handler interface, it serves the logs for
+// the PipelineRuns created by tekton-ci as plain text.
+//
+// If the logs for a PipelineRun were archived, they're served from the
+// archive, and this includes PipelineRuns that have been deleted, which are
+// identified by name.
+//
+//	GET /api/logs/{hook-id or name}?follow=true&strip-ansi=true
+//	GET /api/logs/{namespace}/{name}?follow=true&strip-ansi=true
+type APIHandler struct {
+	tektonClient pipelineclientset.Interface
+	writer       *Writer
+	archive      *Archive
+	namespace    string
+	log          logger.Logger
+}
+
+// NewAPIHandler creates and returns a new APIHandler, which serves the logs
+// for PipelineRuns in the namespace, which can be metav1.NamespaceAll.
+//
+// The archive is optional.
+func NewAPIHandler(c pipelineclientset.Interface, s Streamer, a *Archive, namespace string, l logger.Logger) *APIHandler {
+	return &APIHandler{tektonClient: c, writer: NewWriter(c, s), archive: a, namespace: namespace, log: l}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := parseOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/")
+	parts := strings.Split(path, "/")
+	// The namespace and name are used to find archived logs for deleted
+	// PipelineRuns.
+	var pr *pipelinev1.PipelineRun
+	var namespace, name string
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		namespace, name = h.namespace, parts[0]
+		pr, err = Find(r.Context(), h.tektonClient, h.namespace, parts[0])
+	case len(parts) == 2 && (h.namespace == metav1.NamespaceAll || parts[0] == h.namespace):
+		namespace, name = parts[0], parts[1]
+		pr, err = h.tektonClient.TektonV1beta1().PipelineRuns(parts[0]).Get(r.Context(), parts[1], metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			pr, err = nil, nil
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.log.Errorf("error finding PipelineRun %s: %s", path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pr != nil && !labels.SelectorFromSet(partOfLabels).Matches(labels.Set(pr.ObjectMeta.Labels)) {
+		http.NotFound(w, r)
+		return
+	}
+	if pr != nil {
+		namespace, name = pr.ObjectMeta.Namespace, pr.ObjectMeta.Name
+	}
+	if h.archive != nil && namespace != metav1.NamespaceAll && (pr == nil || Archived(pr)) {
+		if h.serveArchived(w, r, namespace, name, opts) {
+			return
+		}
+	}
+	if pr == nil {
+		http.NotFound(w, r)
+		return
+	}
+	setHeaders(w)
+	if err := h.writer.Write(r.Context(), flushWriter{w}, pr, opts); err != nil {
+		h.log.Infow("log stream ended", "namespace", pr.ObjectMeta.Namespace, "name", pr.ObjectMeta.Name, "error", err)
+	}
+}
+
+// serveArchived writes the archived logs for the PipelineRun, it returns false
+// if the logs were not archived, and nothing was written.
+func (h *APIHandler) serveArchived(w http.ResponseWriter, r *http.Request, namespace, name string, opts Options) bool {
+	rc, err := h.archive.Open(r.Context(), namespace, name)
+	if err == ErrNotArchived {
+		return false
+	}
+	if err != nil {
+		h.log.Errorf("error opening archived logs for %s/%s: %s", namespace, name, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return true
+	}
+	defer rc.Close()
+	setHeaders(w)
+	if err := copyLines(flushWriter{w}, rc, "", opts.StripANSI); err != nil {
+		h.log.Infow("archived log stream ended", "namespace", namespace, "name", name, "error", err)
+	}
+	return true
+}
+
+func setHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+func parseOptions(r *http.Request) (Options, error) {
+	opts := Options{}
+	q := r.URL.Query()
+	for k, v := range map[string]*bool{"follow": &opts.Follow, "strip-ansi": &opts.StripANSI} {
+		if s := q.Get(k); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return opts, err
+			}
+			*v = b
+		}
+	}
+	return opts, nil
+}
+
+// flushWriter flushes each write, so that logs are streamed to the client.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
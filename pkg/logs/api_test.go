@@ -0,0 +1,115 @@
+package logs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestAPIHandler(t *testing.T) {
+	notCI := makePipelineRun("run-2", "other-id", 0)
+	delete(notCI.ObjectMeta.Labels, "app.kubernetes.io/part-of")
+	h := makeAPIHandler(t, testNS, makeCompletedPipelineRun(), notCI)
+
+	apiTests := []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"/api/logs/test-id?strip-ansi=true", http.StatusOK, "[git-clone] cloning\n[build] building\n[build] built\n[test] testing\n[test] FAIL\n"},
+		{"/api/logs/run-1?strip-ansi=true", http.StatusOK, "[git-clone] cloning\n[build] building\n[build] built\n[test] testing\n[test] FAIL\n"},
+		{"/api/logs/testing/run-1", http.StatusOK, "[git-clone] cloning\n[build] \x1b[32mbuilding\x1b[0m\n[build] built\n[test] testing\n[test] FAIL\n"},
+		{"/api/logs/testing/run-1?follow=true&strip-ansi=false", http.StatusOK, "[git-clone] cloning\n[build] \x1b[32mbuilding\x1b[0m\n[build] built\n[test] testing\n[test] FAIL\n"},
+		{"/api/logs/other-ns/run-1", http.StatusNotFound, "404 page not found\n"},
+		{"/api/logs/testing/unknown", http.StatusNotFound, "404 page not found\n"},
+		{"/api/logs/other-id", http.StatusNotFound, "404 page not found\n"},
+		{"/api/logs/", http.StatusNotFound, "404 page not found\n"},
+		{"/api/logs/run-1?follow=maybe", http.StatusBadRequest, "strconv.ParseBool: parsing \"maybe\": invalid syntax\n"},
+	}
+
+	for _, tt := range apiTests {
+		t.Run(tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", rec.Code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.wantBody, rec.Body.String()); diff != "" {
+				t.Fatalf("body doesn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAPIHandlerWithArchivedLogs(t *testing.T) {
+	archived := makeCompletedPipelineRun()
+	archived.ObjectMeta.Annotations[ArchiveAnnotation] = "mem://logs/testing/run-1.log"
+	notArchived := makePipelineRun("run-2", "other-id", 0)
+	notArchived.Spec.PipelineSpec = archived.Spec.PipelineSpec
+	notArchived.Status = archived.Status
+	h := makeAPIHandler(t, testNS, archived, notArchived)
+	h.archive = NewArchive(memblob.OpenBucket(nil), "mem://")
+	for _, name := range []string{"run-1", "deleted-run"} {
+		if err := h.archive.bucket.WriteAll(context.TODO(), archiveKey(testNS, name), []byte("[build] \x1b[32marchived\x1b[0m\n"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apiTests := []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"/api/logs/test-id", http.StatusOK, "[build] \x1b[32marchived\x1b[0m\n"},
+		{"/api/logs/testing/run-1?strip-ansi=true", http.StatusOK, "[build] archived\n"},
+		{"/api/logs/testing/deleted-run", http.StatusOK, "[build] \x1b[32marchived\x1b[0m\n"},
+		{"/api/logs/deleted-run", http.StatusOK, "[build] \x1b[32marchived\x1b[0m\n"},
+		{"/api/logs/testing/run-2?strip-ansi=true", http.StatusOK, "[git-clone] cloning\n[build] building\n[build] built\n[test] testing\n[test] FAIL\n"},
+		{"/api/logs/testing/unknown", http.StatusNotFound, "404 page not found\n"},
+	}
+
+	for _, tt := range apiTests {
+		t.Run(tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d", rec.Code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.wantBody, rec.Body.String()); diff != "" {
+				t.Fatalf("body doesn't match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAPIHandlerRejectsOtherMethods(t *testing.T) {
+	h := makeAPIHandler(t, testNS)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/logs/run-1", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func makeAPIHandler(t *testing.T, namespace string, prs ...*pipelinev1.PipelineRun) *APIHandler {
+	t.Helper()
+	client := fakeclientset.NewSimpleClientset()
+	for _, pr := range prs {
+		if err := client.Tracker().Add(pr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewAPIHandler(client, makeStreamer(), nil, namespace, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+}
@@ -0,0 +1,112 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// ArchiveAnnotation is the annotation on PipelineRuns with the location of
+// their archived logs.
+const ArchiveAnnotation = "tekton.dev/ci-logs-url"
+
+// The logs are archived under this prefix, as the bucket can be shared with
+// artifacts.
+const archivePrefix = "logs"
+
+// ErrNotArchived is returned when the logs for a PipelineRun are not in the
+// archive.
+var ErrNotArchived = errors.New("logs not archived")
+
+// Archive stores the logs of completed PipelineRuns in a bucket, so that
+// they're available after the PipelineRuns and their pods are deleted.
+//
+// Logs are stored as logs/<namespace>/<name>.log in the bucket.
+type Archive struct {
+	bucket    *blob.Bucket
+	bucketURL string
+}
+
+// NewArchive creates and returns a new Archive that stores logs in the bucket,
+// the URL of the bucket is used to record the location of the logs.
+func NewArchive(b *blob.Bucket, bucketURL string) *Archive {
+	return &Archive{bucket: b, bucketURL: bucketURL}
+}
+
+// Close closes the bucket.
+func (a *Archive) Close() error {
+	return a.bucket.Close()
+}
+
+// Save writes the logs for all the steps of the PipelineRun to the archive,
+// and returns the location of the logs.
+//
+// If the logs were already archived, they're not replaced, the pods may have
+// been deleted since.
+func (a *Archive) Save(ctx context.Context, w *Writer, pr *pipelinev1.PipelineRun) (string, error) {
+	key := archiveKey(pr.ObjectMeta.Namespace, pr.ObjectMeta.Name)
+	exists, err := a.bucket.Exists(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for archived logs for %s/%s: %w", pr.ObjectMeta.Namespace, pr.ObjectMeta.Name, err)
+	}
+	if exists {
+		return a.location(key), nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bw, err := a.bucket.NewWriter(ctx, key, &blob.WriterOptions{ContentType: "text/plain; charset=utf-8"})
+	if err != nil {
+		return "", fmt.Errorf("failed to archive logs for %s/%s: %w", pr.ObjectMeta.Namespace, pr.ObjectMeta.Name, err)
+	}
+	if err := w.Write(ctx, bw, pr, Options{}); err != nil {
+		// Cancelling the context before closing discards the partial logs.
+		cancel()
+		bw.Close()
+		return "", fmt.Errorf("failed to archive logs for %s/%s: %w", pr.ObjectMeta.Namespace, pr.ObjectMeta.Name, err)
+	}
+	if err := bw.Close(); err != nil {
+		return "", fmt.Errorf("failed to archive logs for %s/%s: %w", pr.ObjectMeta.Namespace, pr.ObjectMeta.Name, err)
+	}
+	return a.location(key), nil
+}
+
+// Open returns the archived logs for a PipelineRun, or ErrNotArchived if they
+// were not archived.
+func (a *Archive) Open(ctx context.Context, namespace, name string) (io.ReadCloser, error) {
+	r, err := a.bucket.NewReader(ctx, archiveKey(namespace, name), nil)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, ErrNotArchived
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archived logs for %s/%s: %w", namespace, name, err)
+	}
+	return r, nil
+}
+
+// location returns the URL of the key in the bucket, without any query
+// parameters that configure the bucket.
+func (a *Archive) location(key string) string {
+	u, err := url.Parse(a.bucketURL)
+	if err != nil {
+		return key
+	}
+	u.Path = path.Join("/", u.Path, key)
+	u.RawQuery = ""
+	return u.String()
+}
+
+func archiveKey(namespace, name string) string {
+	return path.Join(archivePrefix, namespace, name+".log")
+}
+
+// Archived returns true if the logs for the PipelineRun were archived.
+func Archived(pr *pipelinev1.PipelineRun) bool {
+	return pr.ObjectMeta.Annotations[ArchiveAnnotation] != ""
+}
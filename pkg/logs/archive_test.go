@@ -0,0 +1,102 @@
+package logs
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestArchiveSave(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	a := NewArchive(memblob.OpenBucket(nil), "s3://my-bucket?region=us-east-1")
+	w := NewWriter(fakeclientset.NewSimpleClientset(pr), makeStreamer())
+
+	location, err := a.Save(context.TODO(), w, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if location != "s3://my-bucket/logs/testing/run-1.log" {
+		t.Fatalf("got location %q", location)
+	}
+	rc, err := a.Open(context.TODO(), testNS, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[git-clone] cloning\n" +
+		"[build] \x1b[32mbuilding\x1b[0m\n" +
+		"[build] built\n" +
+		"[test] testing\n" +
+		"[test] FAIL\n"
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("archived logs don't match:\n%s", diff)
+	}
+}
+
+func TestArchiveSaveDoesNotReplaceArchivedLogs(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	a := NewArchive(memblob.OpenBucket(nil), "mem://")
+	if _, err := a.Save(context.TODO(), NewWriter(fakeclientset.NewSimpleClientset(pr), makeStreamer()), pr); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pods have been deleted, so there are no logs to get.
+	location, err := a.Save(context.TODO(), NewWriter(fakeclientset.NewSimpleClientset(pr), NewMock()), pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if location != "mem:///logs/testing/run-1.log" {
+		t.Fatalf("got location %q", location)
+	}
+	rc, err := a.Open(context.TODO(), testNS, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); !strings.HasPrefix(s, "[git-clone] cloning\n") {
+		t.Fatalf("archived logs were replaced with %q", s)
+	}
+}
+
+func TestArchiveOpenWithUnknownPipelineRun(t *testing.T) {
+	a := NewArchive(memblob.OpenBucket(nil), "mem://")
+
+	_, err := a.Open(context.TODO(), testNS, "unknown")
+
+	if err != ErrNotArchived {
+		t.Fatalf("got %v, want %v", err, ErrNotArchived)
+	}
+}
+
+func TestArchiveLocation(t *testing.T) {
+	locationTests := []struct {
+		bucketURL string
+		want      string
+	}{
+		{"gs://my-bucket", "gs://my-bucket/logs/testing/run-1.log"},
+		{"s3://my-bucket?region=us-east-1", "s3://my-bucket/logs/testing/run-1.log"},
+		{"file:///var/artifacts/", "file:///var/artifacts/logs/testing/run-1.log"},
+	}
+
+	for _, tt := range locationTests {
+		a := NewArchive(nil, tt.bucketURL)
+		if got := a.location(archiveKey(testNS, "run-1")); got != tt.want {
+			t.Errorf("location() for %q got %q, want %q", tt.bucketURL, got, tt.want)
+		}
+	}
+}
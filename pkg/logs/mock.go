@@ -0,0 +1,40 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+var _ Streamer = (*MockStreamer)(nil)
+
+// MockStreamer is an implementation of Streamer that returns logs that were
+// added to it.
+type MockStreamer struct {
+	logs map[string]string
+}
+
+// NewMock creates and returns a new MockStreamer.
+func NewMock() *MockStreamer {
+	return &MockStreamer{logs: map[string]string{}}
+}
+
+// AddLogs records the logs for a container in a pod.
+func (m *MockStreamer) AddLogs(namespace, pod, container, logs string) {
+	m.logs[mockKey(namespace, pod, container)] = logs
+}
+
+// Stream implements the Streamer interface.
+func (m *MockStreamer) Stream(ctx context.Context, namespace, pod, container string, follow bool) (io.ReadCloser, error) {
+	l, ok := m.logs[mockKey(namespace, pod, container)]
+	if !ok {
+		return nil, fmt.Errorf("container %s not found in pod %s/%s", container, namespace, pod)
+	}
+	return ioutil.NopCloser(strings.NewReader(l)), nil
+}
+
+func mockKey(namespace, pod, container string) string {
+	return namespace + "/" + pod + "/" + container
+}
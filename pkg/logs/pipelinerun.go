@@ -0,0 +1,241 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+)
+
+// The DSL names the tasks for jobs <job>-stage-<stage>.
+const stageSeparator = "-stage-"
+
+// The interval between checks for tasks starting when following logs.
+const defaultInterval = 2 * time.Second
+
+// ansiEscapes matches the CSI and OSC escape sequences that colour and
+// format terminal output.
+var ansiEscapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// Options configures the logs that are written for a PipelineRun.
+type Options struct {
+	// Follow waits for tasks that haven't started, and streams the logs of
+	// running steps until the PipelineRun completes.
+	Follow bool
+	// StripANSI removes escape sequences for colours from the logs.
+	StripANSI bool
+}
+
+// Writer writes the logs for the steps of PipelineRuns.
+type Writer struct {
+	tektonClient pipelineclientset.Interface
+	streamer     Streamer
+	interval     time.Duration
+}
+
+// NewWriter creates and returns a new Writer.
+func NewWriter(c pipelineclientset.Interface, s Streamer) *Writer {
+	return &Writer{tektonClient: c, streamer: s, interval: defaultInterval}
+}
+
+// Find returns the PipelineRun for the id, which is either the ID of the hook
+// that the PipelineRun was created for, or the name of a PipelineRun in the
+// namespace.
+//
+// If more than one PipelineRun was created for the hook, the most recent is
+// returned, and if no PipelineRun is found, nil is returned.
+func Find(ctx context.Context, c pipelineclientset.Interface, namespace, id string) (*pipelinev1.PipelineRun, error) {
+	if len(validation.IsValidLabelValue(id)) == 0 {
+		runs, err := c.TektonV1beta1().PipelineRuns(namespace).List(ctx, metav1.ListOptions{LabelSelector: dedupe.HookIDLabel + "=" + id})
+		if err != nil {
+			return nil, err
+		}
+		var found *pipelinev1.PipelineRun
+		for i := range runs.Items {
+			r := &runs.Items[i]
+			if r.ObjectMeta.Annotations[dedupe.HookIDAnnotation] != id {
+				continue
+			}
+			if found == nil || found.ObjectMeta.CreationTimestamp.Before(&r.ObjectMeta.CreationTimestamp) {
+				found = r
+			}
+		}
+		if found != nil {
+			return found, nil
+		}
+	}
+	if namespace == metav1.NamespaceAll {
+		return nil, nil
+	}
+	pr, err := c.TektonV1beta1().PipelineRuns(namespace).Get(ctx, id, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return pr, err
+}
+
+// JobName returns the name of the DSL job that a pipeline task was created
+// for, tasks that weren't created for jobs e.g. git-clone are returned as-is.
+func JobName(task string) string {
+	if i := strings.LastIndex(task, stageSeparator); i > 0 {
+		return task[:i]
+	}
+	return task
+}
+
+// Write writes the logs for the steps of the PipelineRun to the out, in task
+// order, with each line prefixed by the name of the job.
+//
+// If the logs for a step can't be streamed e.g. because the pod was deleted,
+// the error is written in place of the logs.
+func (w *Writer) Write(ctx context.Context, out io.Writer, pr *pipelinev1.PipelineRun, opts Options) error {
+	namespace, name := pr.ObjectMeta.Namespace, pr.ObjectMeta.Name
+	written := map[string]bool{}
+	for {
+		following := opts.Follow && !pr.IsDone()
+		waiting, err := w.writeSteps(ctx, out, pr, written, following, opts)
+		if err != nil || !waiting {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.interval):
+		}
+		pr, err = w.tektonClient.TektonV1beta1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get PipelineRun %s/%s: %w", namespace, name, err)
+		}
+	}
+}
+
+// writeSteps writes the logs for the steps that haven't been written, it
+// returns true if following and the next step in task order hasn't started.
+func (w *Writer) writeSteps(ctx context.Context, out io.Writer, pr *pipelinev1.PipelineRun, written map[string]bool, following bool, opts Options) (bool, error) {
+	taskRuns := map[string]*pipelinev1.PipelineRunTaskRunStatus{}
+	for _, tr := range pr.Status.TaskRuns {
+		taskRuns[tr.PipelineTaskName] = tr
+	}
+	for _, task := range taskOrder(pr) {
+		tr := taskRuns[task]
+		taskFollowing := following && (tr == nil || tr.Status == nil || !isDone(tr.Status))
+		if tr == nil || tr.Status == nil || tr.Status.PodName == "" || len(tr.Status.Steps) == 0 {
+			if taskFollowing {
+				return true, nil
+			}
+			continue
+		}
+		for _, s := range tr.Status.Steps {
+			key := task + "/" + s.Name
+			if written[key] {
+				continue
+			}
+			if s.Waiting != nil {
+				if taskFollowing {
+					return true, nil
+				}
+				continue
+			}
+			if err := w.writeStep(ctx, out, pr.ObjectMeta.Namespace, tr.Status.PodName, s.ContainerName, JobName(task), taskFollowing, opts); err != nil {
+				return false, err
+			}
+			written[key] = true
+		}
+	}
+	return false, nil
+}
+
+func (w *Writer) writeStep(ctx context.Context, out io.Writer, namespace, pod, container, job string, follow bool, opts Options) error {
+	prefix := "[" + job + "] "
+	rc, err := w.streamer.Stream(ctx, namespace, pod, container, follow)
+	if err != nil {
+		_, err := fmt.Fprintf(out, "%sfailed to get logs: %s\n", prefix, err)
+		return err
+	}
+	defer rc.Close()
+	return copyLines(out, rc, prefix, opts.StripANSI)
+}
+
+// copyLines copies the lines from the reader to the out, with the prefix, and
+// optionally with the ANSI escape sequences removed.
+func copyLines(out io.Writer, in io.Reader, prefix string, stripANSI bool) error {
+	r := bufio.NewReader(in)
+	for {
+		line, readErr := r.ReadString('\n')
+		if line != "" {
+			if stripANSI {
+				line = ansiEscapes.ReplaceAllString(line, "")
+			}
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			if _, err := io.WriteString(out, prefix+line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			_, err := fmt.Fprintf(out, "%sfailed to read logs: %s\n", prefix, readErr)
+			return err
+		}
+	}
+}
+
+// taskOrder returns the names of the tasks in the order that they're declared
+// in the pipeline, or if the pipeline isn't known, the order that they
+// started.
+func taskOrder(pr *pipelinev1.PipelineRun) []string {
+	spec := pr.Status.PipelineSpec
+	if spec == nil {
+		spec = pr.Spec.PipelineSpec
+	}
+	names := []string{}
+	if spec != nil {
+		for _, t := range append(spec.Tasks, spec.Finally...) {
+			names = append(names, t.Name)
+		}
+		return names
+	}
+	taskRuns := []*pipelinev1.PipelineRunTaskRunStatus{}
+	for _, tr := range pr.Status.TaskRuns {
+		taskRuns = append(taskRuns, tr)
+	}
+	sort.Slice(taskRuns, func(i, j int) bool {
+		si, sj := startTime(taskRuns[i]), startTime(taskRuns[j])
+		if !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return taskRuns[i].PipelineTaskName < taskRuns[j].PipelineTaskName
+	})
+	for _, tr := range taskRuns {
+		names = append(names, tr.PipelineTaskName)
+	}
+	return names
+}
+
+func startTime(tr *pipelinev1.PipelineRunTaskRunStatus) time.Time {
+	if tr.Status == nil || tr.Status.StartTime == nil {
+		return time.Time{}
+	}
+	return tr.Status.StartTime.Time
+}
+
+func isDone(s *pipelinev1.TaskRunStatus) bool {
+	c := s.GetCondition(apis.ConditionSucceeded)
+	return c != nil && !c.IsUnknown()
+}
@@ -0,0 +1,243 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+	"github.com/gitops-tools/tekton-ci/pkg/resources"
+)
+
+const testNS = "testing"
+
+var testTime = time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+var _ Streamer = (*KubeStreamer)(nil)
+
+func TestJobName(t *testing.T) {
+	nameTests := []struct {
+		task string
+		want string
+	}{
+		{"build-stage-build", "build"},
+		{"unit-tests-stage-test", "unit-tests"},
+		{"test-stage-test-1", "test"},
+		{"git-clone", "git-clone"},
+		{"before-step", "before-step"},
+	}
+
+	for _, tt := range nameTests {
+		if got := JobName(tt.task); got != tt.want {
+			t.Errorf("JobName(%q) got %q, want %q", tt.task, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	older := makePipelineRun("run-1", "test-id", 0)
+	newer := makePipelineRun("run-2", "test-id", time.Minute)
+	other := makePipelineRun("run-3", "other-id", 0)
+	client := fakeclientset.NewSimpleClientset(older, newer, other)
+
+	findTests := []struct {
+		namespace string
+		id        string
+		want      string
+	}{
+		{testNS, "test-id", "run-2"},
+		{metav1.NamespaceAll, "test-id", "run-2"},
+		{testNS, "run-1", "run-1"},
+		{metav1.NamespaceAll, "run-1", ""},
+		{testNS, "unknown", ""},
+		{"other-ns", "other-id", ""},
+	}
+
+	for _, tt := range findTests {
+		pr, err := Find(context.TODO(), client, tt.namespace, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if pr != nil {
+			got = pr.ObjectMeta.Name
+		}
+		if got != tt.want {
+			t.Errorf("Find(%q, %q) got %q, want %q", tt.namespace, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestWriteWritesStepsInTaskOrder(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	s := makeStreamer()
+	w := NewWriter(fakeclientset.NewSimpleClientset(pr), s)
+	var b bytes.Buffer
+
+	if err := w.Write(context.TODO(), &b, pr, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[git-clone] cloning\n" +
+		"[build] \x1b[32mbuilding\x1b[0m\n" +
+		"[build] built\n" +
+		"[test] testing\n" +
+		"[test] FAIL\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("logs don't match:\n%s", diff)
+	}
+}
+
+func TestWriteStripsANSI(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	w := NewWriter(fakeclientset.NewSimpleClientset(pr), makeStreamer())
+	var b bytes.Buffer
+
+	if err := w.Write(context.TODO(), &b, pr, Options{StripANSI: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[git-clone] cloning\n" +
+		"[build] building\n" +
+		"[build] built\n" +
+		"[test] testing\n" +
+		"[test] FAIL\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("logs don't match:\n%s", diff)
+	}
+}
+
+func TestWriteWithMissingLogs(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	s := NewMock()
+	s.AddLogs(testNS, "run-1-clone-pod", "step-clone", "cloning\n")
+	w := NewWriter(fakeclientset.NewSimpleClientset(pr), s)
+	var b bytes.Buffer
+
+	if err := w.Write(context.TODO(), &b, pr, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[git-clone] cloning\n" +
+		"[build] failed to get logs: container step-unnamed-0 not found in pod testing/run-1-build-pod\n" +
+		"[build] failed to get logs: container step-unnamed-1 not found in pod testing/run-1-build-pod\n" +
+		"[test] failed to get logs: container step-unnamed-0 not found in pod testing/run-1-test-pod\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("logs don't match:\n%s", diff)
+	}
+}
+
+func TestWriteFollowsRunningPipelineRuns(t *testing.T) {
+	completed := makeCompletedPipelineRun()
+	running := completed.DeepCopy()
+	running.Status.Conditions = duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionUnknown}}
+	delete(running.Status.TaskRuns, "run-1-test")
+	w := NewWriter(fakeclientset.NewSimpleClientset(completed), makeStreamer())
+	w.interval = time.Millisecond
+	var b bytes.Buffer
+
+	if err := w.Write(context.TODO(), &b, running, Options{Follow: true, StripANSI: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[git-clone] cloning\n" +
+		"[build] building\n" +
+		"[build] built\n" +
+		"[test] testing\n" +
+		"[test] FAIL\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("logs don't match:\n%s", diff)
+	}
+}
+
+func TestWriteWithoutFollowingSkipsTasksThatHaveNotStarted(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	pr.Status.Conditions = duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionUnknown}}
+	delete(pr.Status.TaskRuns, "run-1-build")
+	w := NewWriter(fakeclientset.NewSimpleClientset(pr), makeStreamer())
+	var b bytes.Buffer
+
+	if err := w.Write(context.TODO(), &b, pr, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[git-clone] cloning\n" +
+		"[test] testing\n" +
+		"[test] FAIL\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("logs don't match:\n%s", diff)
+	}
+}
+
+func makeStreamer() *MockStreamer {
+	s := NewMock()
+	s.AddLogs(testNS, "run-1-clone-pod", "step-clone", "cloning\n")
+	s.AddLogs(testNS, "run-1-build-pod", "step-unnamed-0", "\x1b[32mbuilding\x1b[0m\n")
+	s.AddLogs(testNS, "run-1-build-pod", "step-unnamed-1", "built")
+	s.AddLogs(testNS, "run-1-test-pod", "step-unnamed-0", "testing\nFAIL\n")
+	return s
+}
+
+func makePipelineRun(name, hookID string, offset time.Duration) *pipelinev1.PipelineRun {
+	pr := resources.PipelineRun("dsl", "", pipelinev1.PipelineRunSpec{})
+	pr.ObjectMeta.Name = name
+	pr.ObjectMeta.Namespace = testNS
+	pr.ObjectMeta.CreationTimestamp = metav1.NewTime(testTime.Add(offset))
+	dedupe.Mark(pr, hookID)
+	return pr
+}
+
+// makeCompletedPipelineRun returns a PipelineRun where the tasks completed in
+// a different order to the order that they're declared in.
+func makeCompletedPipelineRun() *pipelinev1.PipelineRun {
+	pr := makePipelineRun("run-1", "test-id", 0)
+	pr.Spec.PipelineSpec = &pipelinev1.PipelineSpec{
+		Tasks: []pipelinev1.PipelineTask{
+			{Name: "git-clone"},
+			{Name: "build-stage-build", RunAfter: []string{"git-clone"}},
+			{Name: "test-stage-test", RunAfter: []string{"git-clone"}},
+		},
+	}
+	pr.Status.Conditions = duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse}}
+	pr.Status.TaskRuns = map[string]*pipelinev1.PipelineRunTaskRunStatus{
+		"run-1-git-clone": taskRun("git-clone", "run-1-clone-pod", testTime, corev1.ConditionTrue, "clone"),
+		"run-1-test":      taskRun("test-stage-test", "run-1-test-pod", testTime.Add(time.Second*10), corev1.ConditionFalse, "unnamed-0"),
+		"run-1-build":     taskRun("build-stage-build", "run-1-build-pod", testTime.Add(time.Second*20), corev1.ConditionTrue, "unnamed-0", "unnamed-1"),
+	}
+	return pr
+}
+
+func taskRun(name, pod string, start time.Time, s corev1.ConditionStatus, steps ...string) *pipelinev1.PipelineRunTaskRunStatus {
+	states := []pipelinev1.StepState{}
+	for _, step := range steps {
+		states = append(states, pipelinev1.StepState{
+			Name:          step,
+			ContainerName: "step-" + step,
+			ContainerState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{},
+			},
+		})
+	}
+	return &pipelinev1.PipelineRunTaskRunStatus{
+		PipelineTaskName: name,
+		Status: &pipelinev1.TaskRunStatus{
+			Status: duckv1beta1.Status{
+				Conditions: duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: s}},
+			},
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				PodName:   pod,
+				StartTime: &metav1.Time{Time: start},
+				Steps:     states,
+			},
+		},
+	}
+}
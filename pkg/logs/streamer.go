@@ -0,0 +1,35 @@
+package logs
+
+import (
+	"context"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Streamer implementations stream the logs from containers.
+type Streamer interface {
+	// Stream returns the logs from the container in the pod, if follow is
+	// true, the logs are streamed until the container exits.
+	Stream(ctx context.Context, namespace, pod, container string, follow bool) (io.ReadCloser, error)
+}
+
+// KubeStreamer is an implementation of Streamer that streams logs from the
+// Kubernetes pod log API.
+type KubeStreamer struct {
+	coreClient kubernetes.Interface
+}
+
+// NewKubeStreamer creates and returns a new KubeStreamer.
+func NewKubeStreamer(c kubernetes.Interface) *KubeStreamer {
+	return &KubeStreamer{coreClient: c}
+}
+
+// Stream implements the Streamer interface.
+func (s *KubeStreamer) Stream(ctx context.Context, namespace, pod, container string, follow bool) (io.ReadCloser, error) {
+	return s.coreClient.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Follow:    follow,
+	}).Stream(ctx)
+}
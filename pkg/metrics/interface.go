@@ -1,6 +1,17 @@
 package metrics
 
-import "github.com/jenkins-x/go-scm/scm"
+import (
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+// The results of converting a hook into a PipelineRun.
+const (
+	ConversionCreated = "created"
+	ConversionSkipped = "skipped"
+	ConversionFailed  = "failed"
+)
 
 // Interface implementations provide metrics for the system.
 type Interface interface {
@@ -10,9 +21,40 @@ type Interface interface {
 	// CountInvalidHook records "bad" hooks, probably due to non-matching secrets.
 	CountInvalidHook()
 
+	// ObserveHookDuration records the time taken to process a hook.
+	ObserveHookDuration(h scm.Webhook, d time.Duration)
+
 	// CountAPICall records API calls to the upstream hosting service.
 	CountAPICall(name string)
 
 	// CountFailedAPICall records failed API calls to the upstream hosting service.
 	CountFailedAPICall(name string)
+
+	// ObserveAPICallDuration records the time taken by API calls to the
+	// upstream hosting service.
+	ObserveAPICallDuration(name string, d time.Duration)
+
+	// ObserveKubernetesCallDuration records the time taken by calls to the
+	// Kubernetes API.
+	ObserveKubernetesCallDuration(name string, d time.Duration)
+
+	// CountConversion records the result of converting a hook for a repo, the
+	// reason is empty for created PipelineRuns.
+	CountConversion(result, reason, repo string)
+
+	// ObservePipelineRun records the outcome and duration of a completed
+	// PipelineRun.
+	ObservePipelineRun(outcome string, d time.Duration)
+
+	// SetRunningPipelineRuns records the number of PipelineRuns for
+	// repositories on the host that are not yet complete, the host is empty
+	// if the PipelineRuns are for any host.
+	SetRunningPipelineRuns(host string, n int)
+
+	// CountQueueItem records the status of hooks processed asynchronously
+	// e.g. "queued", "retried", "failed".
+	CountQueueItem(status string)
+
+	// SetQueueDepth records the number of hooks waiting to be processed.
+	SetQueueDepth(n int)
 }
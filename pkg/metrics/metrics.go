@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -8,16 +10,41 @@ import (
 // PrometheusMetrics is a wrapper around Prometheus metrics for counting
 // events in the system.
 type PrometheusMetrics struct {
-	hooks          *prometheus.CounterVec
-	invalidHooks   prometheus.Counter
-	apiCalls       *prometheus.CounterVec
-	failedAPICalls *prometheus.CounterVec
+	hooks                   *prometheus.CounterVec
+	invalidHooks            prometheus.Counter
+	hookDurations           *prometheus.HistogramVec
+	apiCalls                *prometheus.CounterVec
+	failedAPICalls          *prometheus.CounterVec
+	apiCallDurations        *prometheus.HistogramVec
+	kubernetesCallDurations *prometheus.HistogramVec
+	conversions             *prometheus.CounterVec
+	pipelineRunDurations    *prometheus.HistogramVec
+	runningPipelineRuns     *prometheus.GaugeVec
+	queueItems              *prometheus.CounterVec
+	queueDepth              prometheus.Gauge
+
+	repoLabels bool
+}
+
+// Option configures the PrometheusMetrics.
+type Option func(*PrometheusMetrics)
+
+// WithRepoLabels labels the conversions with the repository, the number of
+// label values grows with the number of repositories that hooks are received
+// for, so this is off by default.
+func WithRepoLabels() Option {
+	return func(pm *PrometheusMetrics) {
+		pm.repoLabels = true
+	}
 }
 
 // New creates and returns a PrometheusMetrics initialised with prometheus
 // counters.
-func New(ns string, reg prometheus.Registerer) *PrometheusMetrics {
+func New(ns string, reg prometheus.Registerer, opts ...Option) *PrometheusMetrics {
 	pm := &PrometheusMetrics{}
+	for _, o := range opts {
+		o(pm)
+	}
 	if reg == nil {
 		reg = prometheus.DefaultRegisterer
 	}
@@ -34,6 +61,13 @@ func New(ns string, reg prometheus.Registerer) *PrometheusMetrics {
 		Help:      "Count of invalid hooks received",
 	})
 
+	pm.hookDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ns,
+		Name:      "hook_duration_seconds",
+		Help:      "Time taken to process hooks",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
 	pm.apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: ns,
 		Name:      "api_calls_total",
@@ -46,10 +80,68 @@ func New(ns string, reg prometheus.Registerer) *PrometheusMetrics {
 		Help:      "Count of failed API Calls made",
 	}, []string{"kind"})
 
+	pm.apiCallDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ns,
+		Name:      "api_call_duration_seconds",
+		Help:      "Time taken by API Calls made",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	pm.kubernetesCallDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ns,
+		Name:      "kubernetes_call_duration_seconds",
+		Help:      "Time taken by calls to the Kubernetes API",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	conversionLabels := []string{"result", "reason"}
+	if pm.repoLabels {
+		conversionLabels = append(conversionLabels, "repo")
+	}
+	pm.conversions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "conversions_total",
+		Help:      "Count of hooks converted to PipelineRuns by result",
+	}, conversionLabels)
+
+	// PipelineRuns take from minutes to hours.
+	pm.pipelineRunDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ns,
+		Name:      "pipelinerun_duration_seconds",
+		Help:      "Time taken by completed PipelineRuns by outcome",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"outcome"})
+
+	pm.runningPipelineRuns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "pipelineruns_running",
+		Help:      "Number of PipelineRuns that are not yet complete by host",
+	}, []string{"host"})
+
+	pm.queueItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "queue_items_total",
+		Help:      "Count of hooks processed asynchronously by status",
+	}, []string{"status"})
+
+	pm.queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "queue_depth",
+		Help:      "Number of hooks waiting to be processed",
+	})
+
 	reg.MustRegister(pm.hooks)
 	reg.MustRegister(pm.invalidHooks)
+	reg.MustRegister(pm.hookDurations)
 	reg.MustRegister(pm.apiCalls)
 	reg.MustRegister(pm.failedAPICalls)
+	reg.MustRegister(pm.apiCallDurations)
+	reg.MustRegister(pm.kubernetesCallDurations)
+	reg.MustRegister(pm.conversions)
+	reg.MustRegister(pm.pipelineRunDurations)
+	reg.MustRegister(pm.runningPipelineRuns)
+	reg.MustRegister(pm.queueItems)
+	reg.MustRegister(pm.queueDepth)
 	return pm
 }
 
@@ -63,6 +155,11 @@ func (m *PrometheusMetrics) CountInvalidHook() {
 	m.invalidHooks.Inc()
 }
 
+// ObserveHookDuration records the time taken to process a hook.
+func (m *PrometheusMetrics) ObserveHookDuration(h scm.Webhook, d time.Duration) {
+	m.hookDurations.With(prometheus.Labels{"kind": string(h.Kind())}).Observe(d.Seconds())
+}
+
 // CountAPICall records outgoing API calls to upstream services.
 func (m *PrometheusMetrics) CountAPICall(name string) {
 	m.apiCalls.With(prometheus.Labels{"kind": name}).Inc()
@@ -72,3 +169,47 @@ func (m *PrometheusMetrics) CountAPICall(name string) {
 func (m *PrometheusMetrics) CountFailedAPICall(name string) {
 	m.failedAPICalls.With(prometheus.Labels{"kind": name}).Inc()
 }
+
+// ObserveAPICallDuration records the time taken by outgoing API calls to
+// upstream services.
+func (m *PrometheusMetrics) ObserveAPICallDuration(name string, d time.Duration) {
+	m.apiCallDurations.With(prometheus.Labels{"kind": name}).Observe(d.Seconds())
+}
+
+// ObserveKubernetesCallDuration records the time taken by calls to the
+// Kubernetes API.
+func (m *PrometheusMetrics) ObserveKubernetesCallDuration(name string, d time.Duration) {
+	m.kubernetesCallDurations.With(prometheus.Labels{"kind": name}).Observe(d.Seconds())
+}
+
+// CountConversion records the result of converting a hook for a repo, the
+// repo is only recorded with WithRepoLabels.
+func (m *PrometheusMetrics) CountConversion(result, reason, repo string) {
+	labels := prometheus.Labels{"result": result, "reason": reason}
+	if m.repoLabels {
+		labels["repo"] = repo
+	}
+	m.conversions.With(labels).Inc()
+}
+
+// ObservePipelineRun records the outcome and duration of a completed
+// PipelineRun.
+func (m *PrometheusMetrics) ObservePipelineRun(outcome string, d time.Duration) {
+	m.pipelineRunDurations.With(prometheus.Labels{"outcome": outcome}).Observe(d.Seconds())
+}
+
+// SetRunningPipelineRuns records the number of PipelineRuns for repositories
+// on the host that are not yet complete.
+func (m *PrometheusMetrics) SetRunningPipelineRuns(host string, n int) {
+	m.runningPipelineRuns.With(prometheus.Labels{"host": host}).Set(float64(n))
+}
+
+// CountQueueItem records the status of hooks processed asynchronously.
+func (m *PrometheusMetrics) CountQueueItem(status string) {
+	m.queueItems.With(prometheus.Labels{"status": status}).Inc()
+}
+
+// SetQueueDepth records the number of hooks waiting to be processed.
+func (m *PrometheusMetrics) SetQueueDepth(n int) {
+	m.queueDepth.Set(float64(n))
+}
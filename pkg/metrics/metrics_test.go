@@ -3,6 +3,7 @@ package metrics
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -69,3 +70,136 @@ dsl_failed_api_calls_total{kind="commit_status"} 1
 		t.Fatal(err)
 	}
 }
+
+func TestCountQueueItem(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.CountQueueItem("queued")
+	m.CountQueueItem("queued")
+	m.CountQueueItem("failed")
+
+	err := testutil.CollectAndCompare(m.queueItems, strings.NewReader(`
+# HELP dsl_queue_items_total Count of hooks processed asynchronously by status
+# TYPE dsl_queue_items_total counter
+dsl_queue_items_total{status="failed"} 1
+dsl_queue_items_total{status="queued"} 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetQueueDepth(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.SetQueueDepth(5)
+
+	err := testutil.CollectAndCompare(m.queueDepth, strings.NewReader(`
+# HELP dsl_queue_depth Number of hooks waiting to be processed
+# TYPE dsl_queue_depth gauge
+dsl_queue_depth 5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObserveHookDuration(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	hook := hook.MakeHookFromFixture(t, "../testdata/github_pull_request.json", "pull_request")
+
+	m.ObserveHookDuration(hook, time.Second)
+
+	if c := testutil.CollectAndCount(m.hookDurations); c != 1 {
+		t.Fatalf("got %d hook durations, want 1", c)
+	}
+}
+
+func TestObserveCallDurations(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.ObserveAPICallDuration("file_contents", time.Millisecond*100)
+	m.ObserveAPICallDuration("create_status", time.Millisecond*100)
+	m.ObserveKubernetesCallDuration("create_pipelinerun", time.Millisecond*10)
+
+	if c := testutil.CollectAndCount(m.apiCallDurations); c != 2 {
+		t.Fatalf("got %d API call durations, want 2", c)
+	}
+	if c := testutil.CollectAndCount(m.kubernetesCallDurations); c != 1 {
+		t.Fatalf("got %d Kubernetes call durations, want 1", c)
+	}
+}
+
+func TestCountConversion(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.CountConversion(ConversionCreated, "", "my-org/my-repo")
+	m.CountConversion(ConversionCreated, "", "my-org/other-repo")
+	m.CountConversion(ConversionFailed, "SCMFailure", "my-org/other-repo")
+
+	err := testutil.CollectAndCompare(m.conversions, strings.NewReader(`
+# HELP dsl_conversions_total Count of hooks converted to PipelineRuns by result
+# TYPE dsl_conversions_total counter
+dsl_conversions_total{reason="",result="created"} 2
+dsl_conversions_total{reason="SCMFailure",result="failed"} 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountConversionWithRepoLabels(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry(), WithRepoLabels())
+	m.CountConversion(ConversionCreated, "", "my-org/my-repo")
+	m.CountConversion(ConversionSkipped, "held", "my-org/my-repo")
+	m.CountConversion(ConversionFailed, "SCMFailure", "my-org/other-repo")
+
+	err := testutil.CollectAndCompare(m.conversions, strings.NewReader(`
+# HELP dsl_conversions_total Count of hooks converted to PipelineRuns by result
+# TYPE dsl_conversions_total counter
+dsl_conversions_total{reason="",repo="my-org/my-repo",result="created"} 1
+dsl_conversions_total{reason="SCMFailure",repo="my-org/other-repo",result="failed"} 1
+dsl_conversions_total{reason="held",repo="my-org/my-repo",result="skipped"} 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObservePipelineRun(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.ObservePipelineRun("Successful", time.Minute*5)
+
+	err := testutil.CollectAndCompare(m.pipelineRunDurations, strings.NewReader(`
+# HELP dsl_pipelinerun_duration_seconds Time taken by completed PipelineRuns by outcome
+# TYPE dsl_pipelinerun_duration_seconds histogram
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="30"} 0
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="60"} 0
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="120"} 0
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="240"} 0
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="480"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="960"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="1920"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="3840"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="7680"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="15360"} 1
+dsl_pipelinerun_duration_seconds_bucket{outcome="Successful",le="+Inf"} 1
+dsl_pipelinerun_duration_seconds_sum{outcome="Successful"} 300
+dsl_pipelinerun_duration_seconds_count{outcome="Successful"} 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetRunningPipelineRuns(t *testing.T) {
+	m := New("dsl", prometheus.NewRegistry())
+	m.SetRunningPipelineRuns("github.com", 3)
+	m.SetRunningPipelineRuns("gitlab.com", 1)
+
+	err := testutil.CollectAndCompare(m.runningPipelineRuns, strings.NewReader(`
+# HELP dsl_pipelineruns_running Number of PipelineRuns that are not yet complete by host
+# TYPE dsl_pipelineruns_running gauge
+dsl_pipelineruns_running{host="github.com"} 3
+dsl_pipelineruns_running{host="gitlab.com"} 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"sync"
+	"time"
+
 	"github.com/jenkins-x/go-scm/scm"
 )
 
@@ -13,11 +16,30 @@ type MockMetrics struct {
 	InvalidHooks   int
 	APICalls       int
 	FailedAPICalls int
+	QueueDepth     int
+
+	mu                  sync.Mutex
+	queueItems          map[string]int
+	failedAPICalls      map[string]int
+	hookDurations       int
+	apiCallDurations    map[string]int
+	kubernetesCalls     map[string]int
+	conversions         map[string]int
+	pipelineRuns        map[string]int
+	runningPipelineRuns map[string]int
 }
 
 // NewMock creates and returns a MockMetrics.
 func NewMock() *MockMetrics {
-	return &MockMetrics{}
+	return &MockMetrics{
+		queueItems:          map[string]int{},
+		runningPipelineRuns: map[string]int{},
+		failedAPICalls:      map[string]int{},
+		apiCallDurations:    map[string]int{},
+		kubernetesCalls:     map[string]int{},
+		conversions:         map[string]int{},
+		pipelineRuns:        map[string]int{},
+	}
 }
 
 // CountHook records this hook as having been received, along with it's kind.
@@ -30,6 +52,20 @@ func (m *MockMetrics) CountInvalidHook() {
 	m.InvalidHooks++
 }
 
+// ObserveHookDuration records the time taken to process a hook.
+func (m *MockMetrics) ObserveHookDuration(h scm.Webhook, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hookDurations++
+}
+
+// HookDurations returns the number of hook durations recorded.
+func (m *MockMetrics) HookDurations() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hookDurations
+}
+
 // CountAPICall records outgoing API calls to upstream services.
 func (m *MockMetrics) CountAPICall(name string) {
 	m.APICalls++
@@ -37,5 +73,119 @@ func (m *MockMetrics) CountAPICall(name string) {
 
 // CountFailedAPICall records failed outgoing API calls to upstream services.
 func (m *MockMetrics) CountFailedAPICall(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.FailedAPICalls++
+	m.failedAPICalls[name]++
+}
+
+// FailedAPICallsFor returns the number of failed API calls recorded with the
+// name.
+func (m *MockMetrics) FailedAPICallsFor(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.failedAPICalls[name]
+}
+
+// ObserveAPICallDuration records the time taken by outgoing API calls to
+// upstream services.
+func (m *MockMetrics) ObserveAPICallDuration(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiCallDurations[name]++
+}
+
+// APICallDurations returns the number of durations recorded for the API call.
+func (m *MockMetrics) APICallDurations(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.apiCallDurations[name]
+}
+
+// ObserveKubernetesCallDuration records the time taken by calls to the
+// Kubernetes API.
+func (m *MockMetrics) ObserveKubernetesCallDuration(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kubernetesCalls[name]++
+}
+
+// KubernetesCalls returns the number of durations recorded for the
+// Kubernetes call.
+func (m *MockMetrics) KubernetesCalls(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.kubernetesCalls[name]
+}
+
+// CountConversion records the result of converting a hook for a repo.
+func (m *MockMetrics) CountConversion(result, reason, repo string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversions[conversionKey(result, reason, repo)]++
+}
+
+// Conversions returns the number of conversions recorded with the result,
+// reason and repo.
+func (m *MockMetrics) Conversions(result, reason, repo string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conversions[conversionKey(result, reason, repo)]
+}
+
+// ObservePipelineRun records the outcome and duration of a completed
+// PipelineRun.
+func (m *MockMetrics) ObservePipelineRun(outcome string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pipelineRuns[outcome]++
+}
+
+// PipelineRuns returns the number of completed PipelineRuns recorded with the
+// outcome.
+func (m *MockMetrics) PipelineRuns(outcome string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pipelineRuns[outcome]
+}
+
+// SetRunningPipelineRuns records the number of PipelineRuns for the host that
+// are not yet complete.
+func (m *MockMetrics) SetRunningPipelineRuns(host string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runningPipelineRuns[host] = n
+}
+
+// RunningPipelineRuns returns the last number of running PipelineRuns
+// recorded for the host.
+func (m *MockMetrics) RunningPipelineRuns(host string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runningPipelineRuns[host]
+}
+
+// CountQueueItem records the status of hooks processed asynchronously.
+func (m *MockMetrics) CountQueueItem(status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueItems[status]++
+}
+
+// QueueItems returns the number of hooks recorded with the status.
+func (m *MockMetrics) QueueItems(status string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queueItems[status]
+}
+
+// SetQueueDepth records the number of hooks waiting to be processed.
+func (m *MockMetrics) SetQueueDepth(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.QueueDepth = n
+}
+
+func conversionKey(result, reason, repo string) string {
+	return result + "/" + reason + "/" + repo
 }
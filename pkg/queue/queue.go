@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+)
+
+// The statuses that queued items are counted with.
+const (
+	StatusQueued    = "queued"
+	StatusDuplicate = "duplicate"
+	StatusRejected  = "rejected"
+	StatusRetried   = "retried"
+	StatusProcessed = "processed"
+	StatusFailed    = "failed"
+)
+
+var (
+	// ErrFull is returned when the queue has no space for more items.
+	ErrFull = errors.New("the hook queue is full")
+
+	// ErrShutdown is returned when items are added after Shutdown.
+	ErrShutdown = errors.New("the hook queue is shut down")
+)
+
+// Work is the processing for a hook, if it returns an error, it's retried.
+type Work func(ctx context.Context) error
+
+// Config configures the number of workers and the retries.
+type Config struct {
+	Workers    int           // The number of items that are processed concurrently.
+	Size       int           // The number of items that can be waiting to be processed.
+	MaxRetries int           // Items that fail are retried this many times.
+	Backoff    time.Duration // The delay before the first retry, this doubles for each retry.
+	MaxBackoff time.Duration // The maximum delay between retries.
+
+	// Done is called with the ID and the final error, if any, when an item
+	// has been processed.
+	Done func(id string, err error)
+
+	// Retryable returns false for errors that won't succeed if they're
+	// retried, if this is nil, all errors are retried.
+	Retryable func(err error) bool
+}
+
+type item struct {
+	id   string
+	work Work
+}
+
+// Queue processes hooks with a bounded pool of workers, retrying failed
+// items with exponential backoff.
+type Queue struct {
+	config Config
+	items  chan item
+	m      metrics.Interface
+	log    logger.Logger
+	wg     sync.WaitGroup
+	stop   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	// The IDs of the items that are queued or being processed.
+	pending map[string]bool
+}
+
+// New creates and returns a Queue, Start must be called to start processing
+// items.
+func New(cfg Config, m metrics.Interface, l logger.Logger) *Queue {
+	return &Queue{
+		config:  cfg,
+		items:   make(chan item, cfg.Size),
+		stop:    make(chan struct{}),
+		pending: make(map[string]bool),
+		m:       m,
+		log:     l,
+	}
+}
+
+// Start starts the workers.
+func (q *Queue) Start() {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for it := range q.items {
+				q.m.SetQueueDepth(len(q.items))
+				q.process(it)
+			}
+		}()
+	}
+}
+
+// Add queues the work for the hook with the ID.
+//
+// If the queue is full, or has been shut down, an error is returned and the
+// work is not processed.
+//
+// If an item with the same ID is already queued or being processed, e.g. for
+// a hook that was redelivered, the work is not added, and no error is
+// returned.
+func (q *Queue) Add(id string, w Work) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		q.m.CountQueueItem(StatusRejected)
+		return ErrShutdown
+	}
+	if id != "" && q.pending[id] {
+		q.log.Infow("hook is already queued", "id", id)
+		q.m.CountQueueItem(StatusDuplicate)
+		return nil
+	}
+	select {
+	case q.items <- item{id: id, work: w}:
+		if id != "" {
+			q.pending[id] = true
+		}
+		q.m.CountQueueItem(StatusQueued)
+		q.m.SetQueueDepth(len(q.items))
+		return nil
+	default:
+		q.m.CountQueueItem(StatusRejected)
+		return ErrFull
+	}
+}
+
+// Shutdown stops accepting new items, and waits for the queued and in-flight
+// items to be processed, or for the context to be done.
+//
+// Items that are waiting to be retried are not retried again, they fail with
+// the error from their last attempt.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) process(it item) {
+	for attempt := 0; ; attempt++ {
+		err := it.work(context.Background())
+		if err == nil {
+			q.m.CountQueueItem(StatusProcessed)
+			q.done(it.id, nil)
+			return
+		}
+		if attempt >= q.config.MaxRetries || !q.retryable(err) {
+			q.log.Errorw("failed to process hook", "id", it.id, "attempts", attempt+1, "error", err)
+			q.m.CountQueueItem(StatusFailed)
+			q.done(it.id, err)
+			return
+		}
+		delay := q.backoff(attempt)
+		q.log.Infow("retrying hook", "id", it.id, "attempt", attempt+1, "delay", delay, "error", err)
+		if !q.wait(delay) {
+			q.log.Errorw("abandoned hook retry on shutdown", "id", it.id, "attempts", attempt+1, "error", err)
+			q.m.CountQueueItem(StatusFailed)
+			q.done(it.id, err)
+			return
+		}
+		q.m.CountQueueItem(StatusRetried)
+	}
+}
+
+// wait waits for the delay, it returns false if the queue is shut down
+// before the delay is over.
+func (q *Queue) wait(delay time.Duration) bool {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-q.stop:
+		return false
+	}
+}
+
+func (q *Queue) retryable(err error) bool {
+	return q.config.Retryable == nil || q.config.Retryable(err)
+}
+
+func (q *Queue) done(id string, err error) {
+	q.mu.Lock()
+	delete(q.pending, id)
+	q.mu.Unlock()
+	if q.config.Done != nil {
+		q.config.Done(id, err)
+	}
+}
+
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.config.Backoff
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if q.config.MaxBackoff > 0 && delay >= q.config.MaxBackoff {
+			return q.config.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Accepted writes a 202 Accepted response with the ID of the queued hook.
+func Accepted(w http.ResponseWriter, id string) error {
+	b, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_, err = w.Write(b)
+	return err
+}
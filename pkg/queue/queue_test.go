@@ -0,0 +1,368 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+)
+
+func TestQueueProcessesItems(t *testing.T) {
+	m := metrics.NewMock()
+	q := makeQueue(t, Config{Workers: 2, Size: 10}, m)
+	q.Start()
+
+	var mu sync.Mutex
+	processed := []string{}
+	for _, id := range []string{"hook-1", "hook-2", "hook-3"} {
+		id := id
+		err := q.Add(id, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			processed = append(processed, id)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(processed); l != 3 {
+		t.Fatalf("got %d items processed, want 3", l)
+	}
+	if n := m.QueueItems(StatusProcessed); n != 3 {
+		t.Fatalf("got %d items counted as processed, want 3", n)
+	}
+}
+
+func TestQueueRetriesFailedItems(t *testing.T) {
+	m := metrics.NewMock()
+	completed := make(chan struct{})
+	q := makeQueue(t, Config{Workers: 1, Size: 10, MaxRetries: 2, Backoff: time.Millisecond, Done: closeOnDone(completed)}, m)
+	q.Start()
+
+	attempts := 0
+	err := q.Add("hook-1", func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-completed
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", attempts)
+	}
+	if n := m.QueueItems(StatusRetried); n != 2 {
+		t.Fatalf("got %d retries, want 2", n)
+	}
+	if n := m.QueueItems(StatusProcessed); n != 1 {
+		t.Fatalf("got %d items counted as processed, want 1", n)
+	}
+}
+
+func TestQueueGivesUpAfterMaxRetries(t *testing.T) {
+	m := metrics.NewMock()
+	completed := make(chan struct{})
+	q := makeQueue(t, Config{Workers: 1, Size: 10, MaxRetries: 1, Backoff: time.Millisecond, Done: closeOnDone(completed)}, m)
+	q.Start()
+
+	attempts := 0
+	err := q.Add("hook-1", func(ctx context.Context) error {
+		attempts++
+		return errors.New("failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-completed
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", attempts)
+	}
+	if n := m.QueueItems(StatusFailed); n != 1 {
+		t.Fatalf("got %d items counted as failed, want 1", n)
+	}
+}
+
+func TestQueueDoesNotRetryPermanentFailures(t *testing.T) {
+	m := metrics.NewMock()
+	permanent := errors.New("permanent")
+	cfg := Config{Workers: 1, Size: 10, MaxRetries: 3, Backoff: time.Millisecond, Retryable: func(err error) bool {
+		return err != permanent
+	}}
+	q := makeQueue(t, cfg, m)
+	q.Start()
+
+	attempts := 0
+	err := q.Add("hook-1", func(ctx context.Context) error {
+		attempts++
+		return permanent
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", attempts)
+	}
+	if n := m.QueueItems(StatusFailed); n != 1 {
+		t.Fatalf("got %d items counted as failed, want 1", n)
+	}
+}
+
+func TestQueueReportsCompletedItems(t *testing.T) {
+	done := map[string]error{}
+	cfg := Config{Workers: 1, Size: 10, Done: func(id string, err error) {
+		done[id] = err
+	}}
+	q := makeQueue(t, cfg, metrics.NewMock())
+	q.Start()
+
+	failure := errors.New("failed")
+	if err := q.Add("hook-1", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add("hook-2", func(ctx context.Context) error { return failure }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err, ok := done["hook-1"]; !ok || err != nil {
+		t.Fatalf("hook-1 got %v, %v, want nil, true", err, ok)
+	}
+	if err := done["hook-2"]; err != failure {
+		t.Fatalf("hook-2 got %v, want %v", err, failure)
+	}
+}
+
+func TestQueueSkipsItemsWithTheSameID(t *testing.T) {
+	m := metrics.NewMock()
+	completed := make(chan struct{})
+	q := makeQueue(t, Config{Workers: 2, Size: 10, Done: closeOnDone(completed)}, m)
+	q.Start()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	slow := func(ctx context.Context) error {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		close(started)
+		<-release
+		return nil
+	}
+
+	if err := q.Add("hook-1", slow); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := q.Add("hook-1", slow); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-completed
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+	if n := m.QueueItems(StatusDuplicate); n != 1 {
+		t.Fatalf("got %d items counted as duplicates, want 1", n)
+	}
+}
+
+func TestQueueProcessesItemsWithTheSameIDAfterCompletion(t *testing.T) {
+	completed := make(chan struct{}, 2)
+	q := makeQueue(t, Config{Workers: 1, Size: 10, Done: func(string, error) { completed <- struct{}{} }}, metrics.NewMock())
+	q.Start()
+	calls := 0
+	work := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+
+	if err := q.Add("hook-1", work); err != nil {
+		t.Fatal(err)
+	}
+	<-completed
+	if err := q.Add("hook-1", work); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("got %d calls, want 2", calls)
+	}
+}
+
+func TestQueueRejectsItemsWhenFull(t *testing.T) {
+	m := metrics.NewMock()
+	q := makeQueue(t, Config{Workers: 1, Size: 1}, m)
+
+	noop := func(ctx context.Context) error { return nil }
+	if err := q.Add("hook-1", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add("hook-2", noop); err != ErrFull {
+		t.Fatalf("got %v, want ErrFull", err)
+	}
+	if n := m.QueueItems(StatusRejected); n != 1 {
+		t.Fatalf("got %d items counted as rejected, want 1", n)
+	}
+}
+
+func TestQueueRejectsItemsAfterShutdown(t *testing.T) {
+	q := makeQueue(t, Config{Workers: 1, Size: 1}, metrics.NewMock())
+	q.Start()
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := q.Add("hook-1", func(ctx context.Context) error { return nil })
+	if err != ErrShutdown {
+		t.Fatalf("got %v, want ErrShutdown", err)
+	}
+}
+
+func TestQueueShutdownWaitsForInFlightItems(t *testing.T) {
+	q := makeQueue(t, Config{Workers: 1, Size: 1}, metrics.NewMock())
+	q.Start()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := false
+	err := q.Add("hook-1", func(ctx context.Context) error {
+		close(started)
+		<-release
+		done = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Fatal("in-flight item was not completed")
+	}
+}
+
+func TestQueueShutdownAbandonsRetries(t *testing.T) {
+	m := metrics.NewMock()
+	done := map[string]error{}
+	cfg := Config{Workers: 1, Size: 1, MaxRetries: 3, Backoff: time.Hour, Done: func(id string, err error) {
+		done[id] = err
+	}}
+	q := makeQueue(t, cfg, m)
+	q.Start()
+	failure := errors.New("failed")
+	attempted := make(chan struct{})
+	err := q.Add("hook-1", func(ctx context.Context) error {
+		close(attempted)
+		return failure
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-attempted
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := done["hook-1"]; err != failure {
+		t.Fatalf("hook-1 got %v, want %v", err, failure)
+	}
+	if n := m.QueueItems(StatusFailed); n != 1 {
+		t.Fatalf("got %d items counted as failed, want 1", n)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := makeQueue(t, Config{Backoff: time.Second, MaxBackoff: 5 * time.Second}, metrics.NewMock())
+
+	backoffTests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 5 * time.Second},
+	}
+
+	for _, tt := range backoffTests {
+		if got := q.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) got %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestAccepted(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	if err := Accepted(rec, "hook-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if b := rec.Body.String(); b != `{"id":"hook-1"}` {
+		t.Fatalf("got body %s", b)
+	}
+}
+
+func makeQueue(t *testing.T, cfg Config, m metrics.Interface) *Queue {
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	return New(cfg, m, logger.Sugar())
+}
+
+func closeOnDone(c chan struct{}) func(string, error) {
+	return func(string, error) {
+		close(c)
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// Controller reconciles Repositories as they change.
+type Controller struct {
+	informer   cache.SharedIndexInformer
+	lister     cache.GenericLister
+	queue      workqueue.RateLimitingInterface
+	reconciler *Reconciler
+	log        logger.Logger
+}
+
+// NewController creates and returns a new Controller that reconciles the
+// Repositories from the informer.
+func NewController(informer cache.SharedIndexInformer, lister cache.GenericLister, r *Reconciler, l logger.Logger) *Controller {
+	c := &Controller{
+		informer:   informer,
+		lister:     lister,
+		queue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		reconciler: r,
+		log:        l,
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	return c
+}
+
+// Run processes changes to Repositories until the stop channel is closed.
+//
+// The informer must be started separately.
+func (c *Controller) Run(stop <-chan struct{}) {
+	defer c.queue.ShutDown()
+	c.log.Infow("starting to reconcile Repositories")
+	if !cache.WaitForCacheSync(stop, c.informer.HasSynced) {
+		c.log.Errorf("failed to sync the Repository cache")
+		return
+	}
+	go wait.Until(c.runWorker, time.Second, stop)
+	<-stop
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.Errorf("failed to get key for Repository: %s", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+	err := c.reconcile(context.Background(), key.(string))
+	if err != nil {
+		c.log.Errorf("failed to reconcile Repository %s: %s", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	obj, err := c.lister.Get(key)
+	// The Repository has been deleted since it was queued.
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	repo, err := fromObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to reconcile %s: %w", key, err)
+	}
+	return c.reconciler.Reconcile(ctx, repo)
+}
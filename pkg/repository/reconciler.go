@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x/go-scm/scm/factory"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// The key in ssh-auth clone Secrets with the known hosts for the server.
+const sshKnownHostsKey = "known_hosts"
+
+// Reconciler validates Repositories, and records the outcome in the status.
+type Reconciler struct {
+	dynamicClient dynamic.Interface
+	coreClient    kubernetes.Interface
+	router        *Router
+	log           logger.Logger
+}
+
+// NewReconciler creates and returns a new Reconciler.
+//
+// The router is used to find other Repositories that claim the same
+// repository.
+func NewReconciler(d dynamic.Interface, c kubernetes.Interface, router *Router, l logger.Logger) *Reconciler {
+	return &Reconciler{dynamicClient: d, coreClient: c, router: router, log: l}
+}
+
+// Reconcile validates the Repository and updates the status.
+//
+// A Repository is Ready if the URL and driver are valid, the pipelines are
+// known, the referenced Secrets exist, and no older Repository claims the
+// same repository.
+func (r *Reconciler) Reconcile(ctx context.Context, repo *v1alpha1.Repository) error {
+	repo = repo.DeepCopy()
+	repo.Status.ObservedGeneration = repo.ObjectMeta.Generation
+	fullName, err := FullNameFromURL(repo.Spec.URL)
+	if err != nil {
+		repo.Status.FullName = ""
+		repo.Status.MarkNotReady("InvalidURL", "%s", err)
+		return r.updateStatus(ctx, repo)
+	}
+	repo.Status.FullName = fullName
+	reason, msg, err := r.validate(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		repo.Status.MarkNotReady(reason, "%s", msg)
+	} else {
+		repo.Status.MarkReady()
+	}
+	r.log.Infow("reconciled Repository", "name", repo.ObjectMeta.Name, "ns", repo.ObjectMeta.Namespace, "ready", repo.Status.IsReady())
+	return r.updateStatus(ctx, repo)
+}
+
+// validate returns a reason and message if the Repository is not valid.
+//
+// Errors are only returned if the validation could not be completed.
+func (r *Reconciler) validate(ctx context.Context, repo *v1alpha1.Repository) (string, string, error) {
+	if repo.Spec.Driver != "" {
+		if _, err := factory.NewWebHookService(repo.Spec.Driver); err != nil {
+			return "UnknownDriver", fmt.Sprintf("unknown driver %q", repo.Spec.Driver), nil
+		}
+	}
+	for _, p := range repo.Spec.Pipelines {
+		if _, ok := pipelineHandlers[p]; !ok {
+			return "UnknownPipeline", fmt.Sprintf("unknown pipeline %q", p), nil
+		}
+	}
+	for _, ref := range []*v1alpha1.SecretKeyReference{repo.Spec.WebhookSecretRef, repo.Spec.TokenRef} {
+		if ref == nil {
+			continue
+		}
+		secret, err := r.coreClient.CoreV1().Secrets(repo.ObjectMeta.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return "SecretNotFound", fmt.Sprintf("secret %q not found", ref.Name), nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return "SecretKeyNotFound", fmt.Sprintf("key %q not found in secret %q", ref.Key, ref.Name), nil
+		}
+	}
+	if repo.Spec.CloneSecret != "" {
+		secret, err := r.coreClient.CoreV1().Secrets(repo.ObjectMeta.Namespace).Get(ctx, repo.Spec.CloneSecret, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return "SecretNotFound", fmt.Sprintf("secret %q not found", repo.Spec.CloneSecret), nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		_, hasKey := secret.Data[corev1.SSHAuthPrivateKey]
+		if _, ok := secret.Data[sshKnownHostsKey]; hasKey && !ok {
+			return "SecretKeyNotFound", fmt.Sprintf("key %q not found in ssh-auth secret %q", sshKnownHostsKey, repo.Spec.CloneSecret), nil
+		}
+	}
+	conflict, err := r.router.conflict(repo)
+	if err != nil {
+		return "", "", err
+	}
+	if conflict != nil {
+		return "Conflict", fmt.Sprintf("repository %s is already claimed by Repository %s/%s", repo.Status.FullName, conflict.ObjectMeta.Namespace, conflict.ObjectMeta.Name), nil
+	}
+	return "", "", nil
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, repo *v1alpha1.Repository) error {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(repo)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(v1alpha1.SchemeGroupVersion.WithKind("Repository"))
+	_, err = r.dynamicClient.Resource(v1alpha1.RepositoryResource).Namespace(repo.ObjectMeta.Namespace).UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	return err
+}
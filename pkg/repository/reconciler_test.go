@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+)
+
+const testNS = "testing"
+
+func TestReconcile(t *testing.T) {
+	reconcileTests := []struct {
+		name       string
+		opts       []func(*v1alpha1.Repository)
+		wantReason string
+	}{
+		{"valid", nil, ""},
+		{"invalid url", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) { r.Spec.URL = "not-a-url" }}, "InvalidURL"},
+		{"unknown driver", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) { r.Spec.Driver = "unknown" }}, "UnknownDriver"},
+		{"unknown pipeline", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) { r.Spec.Pipelines = []string{"unknown.yaml"} }}, "UnknownPipeline"},
+		{"missing secret", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) {
+			r.Spec.TokenRef = &v1alpha1.SecretKeyReference{Name: "missing", Key: "token"}
+		}}, "SecretNotFound"},
+		{"missing secret key", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) {
+			r.Spec.WebhookSecretRef = &v1alpha1.SecretKeyReference{Name: "repo-secrets", Key: "missing"}
+		}}, "SecretKeyNotFound"},
+		{"missing clone secret", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) {
+			r.Spec.CloneSecret = "missing"
+		}}, "SecretNotFound"},
+		{"ssh clone secret without known hosts", []func(*v1alpha1.Repository){func(r *v1alpha1.Repository) {
+			r.Spec.CloneSecret = "ssh-key"
+		}}, "SecretKeyNotFound"},
+	}
+
+	for _, tt := range reconcileTests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]func(*v1alpha1.Repository){func(r *v1alpha1.Repository) {
+				r.Spec.Driver = "github"
+				r.Spec.Pipelines = []string{".tekton_ci.yaml"}
+				r.Spec.TokenRef = &v1alpha1.SecretKeyReference{Name: "repo-secrets", Key: "token"}
+			}}, tt.opts...)
+			repo := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", opts...)
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), mustToUnstructured(t, repo))
+			coreClient := fake.NewSimpleClientset(makeSecret("repo-secrets", "token"), makeSecret("ssh-key", "ssh-privatekey"))
+			logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+			r := NewReconciler(dynamicClient, coreClient, NewRouter(makeLister(t), testDefaultRoute, []string{testNS}), logger.Sugar())
+
+			if err := r.Reconcile(context.TODO(), repo); err != nil {
+				t.Fatal(err)
+			}
+
+			updated := getRepository(t, dynamicClient, repo.ObjectMeta.Name)
+			cond := updated.Status.GetCondition(apis.ConditionReady)
+			if cond == nil {
+				t.Fatal("no Ready condition")
+			}
+			if tt.wantReason == "" {
+				if !updated.Status.IsReady() {
+					t.Fatalf("Repository not ready: %s %s", cond.Reason, cond.Message)
+				}
+				if updated.Status.FullName != "Codertocat/Hello-World" {
+					t.Fatalf("got full name %s, want Codertocat/Hello-World", updated.Status.FullName)
+				}
+				return
+			}
+			if updated.Status.IsReady() || cond.Reason != tt.wantReason {
+				t.Fatalf("got Ready %s with reason %s, want False with reason %s", cond.Status, cond.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReconcileWithConflictingRepository(t *testing.T) {
+	older := makeRepository("first", "https://github.com/Codertocat/Hello-World.git", markReady, createdAt(time.Now().Add(-time.Hour)))
+	newer := makeRepository("second", "https://github.com/Codertocat/Hello-World.git", createdAt(time.Now()))
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), mustToUnstructured(t, older), mustToUnstructured(t, newer))
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	r := NewReconciler(dynamicClient, fake.NewSimpleClientset(), NewRouter(makeLister(t, older, newer), testDefaultRoute, []string{testNS}), logger.Sugar())
+
+	for _, repo := range []*v1alpha1.Repository{older, newer} {
+		if err := r.Reconcile(context.TODO(), repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if updated := getRepository(t, dynamicClient, older.ObjectMeta.Name); !updated.Status.IsReady() {
+		t.Fatal("older Repository is not ready")
+	}
+	cond := getRepository(t, dynamicClient, newer.ObjectMeta.Name).Status.GetCondition(apis.ConditionReady)
+	if cond == nil || cond.IsTrue() || cond.Reason != "Conflict" {
+		t.Fatalf("got Ready condition %#v, want False with reason Conflict", cond)
+	}
+	if want := "repository Codertocat/Hello-World is already claimed by Repository testing/first"; cond.Message != want {
+		t.Fatalf("got message %q, want %q", cond.Message, want)
+	}
+}
+
+func getRepository(t *testing.T, c *dynamicfake.FakeDynamicClient, name string) *v1alpha1.Repository {
+	t.Helper()
+	u, err := c.Resource(v1alpha1.RepositoryResource).Namespace(testNS).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fromObject(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func makeSecret(name, key string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNS,
+		},
+		Data: map[string][]byte{
+			key: []byte("secret-token"),
+		},
+	}
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/spec"
+)
+
+// pipelineHandlers maps the paths to pipeline definitions to the handler that
+// processes them.
+var pipelineHandlers = map[string]string{
+	dsl.PipelineFilename:     routing.DSLHandler,
+	spec.PullRequestFilename: routing.SpecHandler,
+	spec.PushFilename:        routing.SpecHandler,
+}
+
+// Router is an implementation of routing.Router that routes repositories to
+// the namespace of the matching Repository resource.
+//
+// Only Repositories that are Ready, in the allowed namespaces, are used, so
+// that a Repository in any other namespace can't claim the routing and
+// secrets for a repository.
+type Router struct {
+	lister       cache.GenericLister
+	defaultRoute routing.Route
+	namespaces   []string
+	driver       string
+}
+
+// NewRouter creates and returns a Router that finds Repositories with the
+// provided lister, in the namespaces.
+//
+// The default route is used for repositories that don't have a Repository,
+// and to fill in the configuration that Repositories don't override.
+func NewRouter(l cache.GenericLister, def routing.Route, namespaces []string) *Router {
+	return &Router{lister: l, defaultRoute: def, namespaces: namespaces}
+}
+
+// ForDriver returns a copy of the Router that only routes to Repositories for
+// the go-scm driver, Repositories with no driver are for github.
+//
+// This is used when hooks are accepted from multiple drivers, so that a
+// Repository on one service isn't used for a repository with the same name
+// on another.
+func (r *Router) ForDriver(driver string) *Router {
+	routed := *r
+	routed.driver = driver
+	return &routed
+}
+
+// Route implements the routing.Router interface.
+//
+// If more than one Repository claims the repository, the oldest is used, so
+// that the route doesn't depend on the order they're listed in, the others
+// are marked as conflicting when they're reconciled.
+func (r *Router) Route(ctx context.Context, repo string) (*routing.Route, error) {
+	found, err := r.find(repo)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		def := r.defaultRoute
+		return &def, nil
+	}
+	return routing.Merge(routeForRepository(found), r.defaultRoute), nil
+}
+
+// find returns the Repository that claims the repo, or nil if there is none.
+func (r *Router) find(repo string) (*v1alpha1.Repository, error) {
+	objs, err := r.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var found *v1alpha1.Repository
+	for _, obj := range objs {
+		repository, err := fromObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		if !r.allowed(repository) {
+			continue
+		}
+		fullName, err := FullNameFromURL(repository.Spec.URL)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(fullName, repo) && (found == nil || precedes(repository, found)) {
+			found = repository
+		}
+	}
+	return found, nil
+}
+
+// conflict returns the Repository that is used for the same repository as
+// repo, in preference to it, or nil if there is none.
+func (r *Router) conflict(repo *v1alpha1.Repository) (*v1alpha1.Repository, error) {
+	fullName, err := FullNameFromURL(repo.Spec.URL)
+	if err != nil {
+		return nil, nil
+	}
+	found, err := r.ForDriver(driverFor(repo)).find(fullName)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	if found.ObjectMeta.Namespace == repo.ObjectMeta.Namespace && found.ObjectMeta.Name == repo.ObjectMeta.Name {
+		return nil, nil
+	}
+	if !precedes(found, repo) {
+		return nil, nil
+	}
+	return found, nil
+}
+
+// precedes returns true if a is used in preference to b, the oldest
+// Repository is used, and the namespace and name break ties.
+func precedes(a, b *v1alpha1.Repository) bool {
+	if !a.ObjectMeta.CreationTimestamp.Equal(&b.ObjectMeta.CreationTimestamp) {
+		return a.ObjectMeta.CreationTimestamp.Before(&b.ObjectMeta.CreationTimestamp)
+	}
+	if a.ObjectMeta.Namespace != b.ObjectMeta.Namespace {
+		return a.ObjectMeta.Namespace < b.ObjectMeta.Namespace
+	}
+	return a.ObjectMeta.Name < b.ObjectMeta.Name
+}
+
+func (r *Router) allowed(repository *v1alpha1.Repository) bool {
+	if !repository.Status.IsReady() {
+		return false
+	}
+	if r.driver != "" && r.driver != driverFor(repository) {
+		return false
+	}
+	for _, ns := range r.namespaces {
+		if ns == repository.ObjectMeta.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func driverFor(r *v1alpha1.Repository) string {
+	if r.Spec.Driver == "" {
+		return "github"
+	}
+	return r.Spec.Driver
+}
+
+// FullNameFromURL returns the org/repo path from a repository URL.
+func FullNameFromURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %w", s, err)
+	}
+	name := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if u.Host == "" || !strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid repository URL: %s", s)
+	}
+	return name, nil
+}
+
+func routeForRepository(r *v1alpha1.Repository) routing.Route {
+	route := routing.Route{
+		Namespace:          r.ObjectMeta.Namespace,
+		ServiceAccountName: r.Spec.Defaults.ServiceAccountName,
+		ArchiverImage:      r.Spec.Defaults.ArchiverImage,
+		ArchiveURL:         r.Spec.Defaults.ArchiveURL,
+		PipelineRunPrefix:  r.Spec.Defaults.PipelineRunPrefix,
+		WebhookSecretRef:   r.Spec.WebhookSecretRef,
+		TokenRef:           r.Spec.TokenRef,
+		ServerURL:          r.Spec.ServerURL,
+		CloneSecret:        r.Spec.CloneSecret,
+	}
+	if r.Spec.Defaults.VolumeSize != nil {
+		route.VolumeSize = *r.Spec.Defaults.VolumeSize
+	}
+	for _, p := range r.Spec.Pipelines {
+		h, ok := pipelineHandlers[p]
+		if ok && !hasHandler(route.Handlers, h) {
+			route.Handlers = append(route.Handlers, h)
+		}
+	}
+	return route
+}
+
+func hasHandler(handlers []string, h string) bool {
+	for _, v := range handlers {
+		if v == h {
+			return true
+		}
+	}
+	return false
+}
+
+func fromObject(obj runtime.Object) (*v1alpha1.Repository, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	r := &v1alpha1.Repository{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, r); err != nil {
+		return nil, fmt.Errorf("failed to convert %s to a Repository: %w", u.GetName(), err)
+	}
+	return r, nil
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+)
+
+var _ routing.Router = (*Router)(nil)
+
+var testDefaultRoute = routing.Route{
+	Namespace:          "default-ns",
+	ServiceAccountName: "default-sa",
+	VolumeSize:         resource.MustParse("1G"),
+}
+
+func TestRoute(t *testing.T) {
+	size := resource.MustParse("5Gi")
+	repo := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", func(r *v1alpha1.Repository) {
+		r.Spec.Pipelines = []string{".tekton/push.yaml", ".tekton/pull_request.yaml"}
+		r.Spec.WebhookSecretRef = &v1alpha1.SecretKeyReference{Name: "hook-secret", Key: "token"}
+		r.Spec.ServerURL = "https://github.example.com"
+		r.Spec.CloneSecret = "clone-secret"
+		r.Spec.Defaults = v1alpha1.RepositoryDefaults{
+			ArchiverImage: "quay.io/testing/archiver",
+			VolumeSize:    &size,
+		}
+	}, markReady)
+	router := NewRouter(makeLister(t, repo), testDefaultRoute, []string{testNS})
+
+	route, err := router.Route(context.TODO(), "codertocat/hello-world")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &routing.Route{
+		Namespace:          testNS,
+		ServiceAccountName: "default-sa",
+		VolumeSize:         size,
+		Handlers:           []string{routing.SpecHandler},
+		ArchiverImage:      "quay.io/testing/archiver",
+		WebhookSecretRef:   &v1alpha1.SecretKeyReference{Name: "hook-secret", Key: "token"},
+		ServerURL:          "https://github.example.com",
+		CloneSecret:        "clone-secret",
+	}
+	if diff := cmp.Diff(want, route); diff != "" {
+		t.Fatalf("Route() failed:\n%s", diff)
+	}
+}
+
+func TestRouteWithUnknownRepository(t *testing.T) {
+	repo := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", markReady)
+	router := NewRouter(makeLister(t, repo), testDefaultRoute, []string{testNS})
+
+	route, err := router.Route(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(&testDefaultRoute, route); diff != "" {
+		t.Fatalf("Route() failed:\n%s", diff)
+	}
+}
+
+func TestRouteIgnoresRepositories(t *testing.T) {
+	ignoreTests := []struct {
+		name string
+		repo *v1alpha1.Repository
+	}{
+		{"not ready", makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git")},
+		{"other namespace", makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", markReady, func(r *v1alpha1.Repository) {
+			r.ObjectMeta.Namespace = "other-ns"
+		})},
+	}
+
+	for _, tt := range ignoreTests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(makeLister(t, tt.repo), testDefaultRoute, []string{testNS})
+
+			route, err := router.Route(context.TODO(), "Codertocat/Hello-World")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(&testDefaultRoute, route); diff != "" {
+				t.Fatalf("Route() failed:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRouteForDriver(t *testing.T) {
+	gitlab := makeRepository("hello-world", "https://gitlab.com/Codertocat/Hello-World.git", markReady, func(r *v1alpha1.Repository) {
+		r.ObjectMeta.Namespace = "gitlab-ns"
+		r.Spec.Driver = "gitlab"
+	})
+	github := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", markReady)
+	router := NewRouter(makeLister(t, gitlab, github), testDefaultRoute, []string{testNS, "gitlab-ns"})
+
+	driverTests := []struct {
+		driver string
+		want   string
+	}{
+		{"github", testNS},
+		{"gitlab", "gitlab-ns"},
+		{"gitea", testDefaultRoute.Namespace},
+	}
+
+	for _, tt := range driverTests {
+		t.Run(tt.driver, func(t *testing.T) {
+			route, err := router.ForDriver(tt.driver).Route(context.TODO(), "Codertocat/Hello-World")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if route.Namespace != tt.want {
+				t.Fatalf("got namespace %q, want %q", route.Namespace, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteWithConflictingRepositories(t *testing.T) {
+	older := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", markReady, createdAt(time.Now().Add(-time.Hour)), func(r *v1alpha1.Repository) {
+		r.ObjectMeta.Namespace = "older-ns"
+	})
+	newer := makeRepository("hello-world", "https://github.com/Codertocat/Hello-World.git", markReady, createdAt(time.Now()))
+
+	orderTests := []struct {
+		name  string
+		repos []*v1alpha1.Repository
+	}{
+		{"older first", []*v1alpha1.Repository{older, newer}},
+		{"newer first", []*v1alpha1.Repository{newer, older}},
+	}
+
+	for _, tt := range orderTests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(makeLister(t, tt.repos...), testDefaultRoute, []string{testNS, "older-ns"})
+
+			route, err := router.Route(context.TODO(), "Codertocat/Hello-World")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if route.Namespace != "older-ns" {
+				t.Fatalf("got namespace %q, want %q", route.Namespace, "older-ns")
+			}
+		})
+	}
+}
+
+func TestFullNameFromURL(t *testing.T) {
+	urlTests := []struct {
+		url     string
+		want    string
+		wantErr string
+	}{
+		{"https://github.com/Codertocat/Hello-World.git", "Codertocat/Hello-World", ""},
+		{"https://github.com/Codertocat/Hello-World", "Codertocat/Hello-World", ""},
+		{"https://gitlab.com/group/subgroup/project.git", "group/subgroup/project", ""},
+		{"https://github.com/Codertocat", "", "invalid repository URL: https://github.com/Codertocat"},
+		{"Codertocat/Hello-World", "", "invalid repository URL: Codertocat/Hello-World"},
+	}
+
+	for _, tt := range urlTests {
+		got, err := FullNameFromURL(tt.url)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("FullNameFromURL(%s) got error %v, want %s", tt.url, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FullNameFromURL(%s) failed: %s", tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FullNameFromURL(%s) got %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func makeLister(t *testing.T, repos ...*v1alpha1.Repository) cache.GenericLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, r := range repos {
+		if err := indexer.Add(mustToUnstructured(t, r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cache.NewGenericLister(indexer, v1alpha1.RepositoryResource.GroupResource())
+}
+
+func makeRepository(name, url string, opts ...func(*v1alpha1.Repository)) *v1alpha1.Repository {
+	r := &v1alpha1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNS,
+		},
+		Spec: v1alpha1.RepositorySpec{
+			URL: url,
+		},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+func markReady(r *v1alpha1.Repository) {
+	r.Status.MarkReady()
+}
+
+func createdAt(t time.Time) func(*v1alpha1.Repository) {
+	return func(r *v1alpha1.Repository) {
+		r.ObjectMeta.CreationTimestamp = metav1.NewTime(t)
+	}
+}
+
+func mustToUnstructured(t *testing.T, r *v1alpha1.Repository) *unstructured.Unstructured {
+	t.Helper()
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
@@ -0,0 +1,66 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RoutesKey is the key in the ConfigMap that contains the routes.
+const RoutesKey = "routes.yaml"
+
+// ConfigMapRouter is an implementation of Router that reads the routes from a
+// v1.ConfigMap.
+type ConfigMapRouter struct {
+	coreClient   kubernetes.Interface
+	name         string
+	namespace    string
+	defaultRoute Route
+}
+
+// New creates and returns a ConfigMapRouter that reads the routes from the
+// named ConfigMap.
+//
+// The default route is used for repositories that don't match any of the
+// routes, and to fill in empty fields in the routes that do match.
+func New(ns, n string, c kubernetes.Interface, def Route) *ConfigMapRouter {
+	return &ConfigMapRouter{
+		coreClient:   c,
+		name:         n,
+		namespace:    ns,
+		defaultRoute: def,
+	}
+}
+
+// Route implements the Router interface.
+//
+// The ConfigMap is read for each lookup, the first route that matches the
+// repository is returned.
+func (c ConfigMapRouter) Route(ctx context.Context, repo string) (*Route, error) {
+	cm, err := c.coreClient.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return c.routeForUnknown(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	routes, err := ParseRoutes(strings.NewReader(cm.Data[RoutesKey]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse routes from %s: %w", c.name, err)
+	}
+	for _, r := range routes {
+		if r.matches(repo) {
+			return Merge(r, c.defaultRoute), nil
+		}
+	}
+	return c.routeForUnknown(), nil
+}
+
+func (c ConfigMapRouter) routeForUnknown() *Route {
+	r := c.defaultRoute
+	return &r
+}
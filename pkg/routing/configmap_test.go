@@ -0,0 +1,89 @@
+package routing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ Router = (*ConfigMapRouter)(nil)
+var _ Router = StaticRouter{}
+
+var testDefaultRoute = Route{
+	Namespace:          "default-ns",
+	ServiceAccountName: "default-sa",
+	VolumeSize:         resource.MustParse("1G"),
+}
+
+func TestConfigMapRouter(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(makeConfigMap(`
+- repositories:
+    - my-org/*
+  namespace: my-org-ci
+  handlers:
+    - dsl
+- repositories:
+    - other-org/private
+  serviceAccountName: private-sa
+  volumeSize: 5Gi
+`))
+	r := New("testing", "tekton-ci-routes", fakeClient, testDefaultRoute)
+
+	routeTests := []struct {
+		repo string
+		want *Route
+	}{
+		{"my-org/my-repo", &Route{Repositories: []string{"my-org/*"}, Namespace: "my-org-ci", ServiceAccountName: "default-sa", VolumeSize: resource.MustParse("1G"), Handlers: []string{"dsl"}}},
+		{"other-org/private", &Route{Repositories: []string{"other-org/private"}, Namespace: "default-ns", ServiceAccountName: "private-sa", VolumeSize: resource.MustParse("5Gi")}},
+		{"other-org/public", &testDefaultRoute},
+	}
+
+	for _, tt := range routeTests {
+		got, err := r.Route(context.TODO(), tt.repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Route(%s) failed:\n%s", tt.repo, diff)
+		}
+	}
+}
+
+func TestConfigMapRouterWithMissingConfigMap(t *testing.T) {
+	r := New("testing", "tekton-ci-routes", fake.NewSimpleClientset(), testDefaultRoute)
+
+	got, err := r.Route(context.TODO(), "my-org/my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(&testDefaultRoute, got); diff != "" {
+		t.Fatalf("Route() failed:\n%s", diff)
+	}
+}
+
+func TestConfigMapRouterWithInvalidRoutes(t *testing.T) {
+	r := New("testing", "tekton-ci-routes", fake.NewSimpleClientset(makeConfigMap("not: a list")), testDefaultRoute)
+
+	_, err := r.Route(context.TODO(), "my-org/my-repo")
+	if err == nil {
+		t.Fatal("expected an error parsing invalid routes")
+	}
+}
+
+func makeConfigMap(routes string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tekton-ci-routes",
+			Namespace: "testing",
+		},
+		Data: map[string]string{
+			RoutesKey: routes,
+		},
+	}
+}
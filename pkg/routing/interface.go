@@ -0,0 +1,10 @@
+package routing
+
+import (
+	"context"
+)
+
+// Router is implemented by values that can find the Route for a repository.
+type Router interface {
+	Route(ctx context.Context, repo string) (*Route, error)
+}
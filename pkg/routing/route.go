@@ -0,0 +1,143 @@
+package routing
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+)
+
+const (
+	// DSLHandler is the name of the handler for .tekton_ci.yaml files.
+	DSLHandler = "dsl"
+	// SpecHandler is the name of the handler for .tekton/*.yaml files.
+	SpecHandler = "spec"
+)
+
+// Route determines where the PipelineRuns for matching repositories are
+// executed.
+//
+// Empty fields are filled from the default Route.
+type Route struct {
+	// Repositories are patterns matched against the full name of the
+	// repository e.g. "my-org/*", see path.Match for the syntax.
+	Repositories []string `json:"repositories,omitempty"`
+	// Namespace is where the PipelineRuns, volumes and hook secret are.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccountName overrides the default service account for
+	// PipelineRuns.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// VolumeSize overrides the default size of the volumes created for
+	// PipelineRuns.
+	VolumeSize resource.Quantity `json:"volumeSize,omitempty"`
+	// Handlers lists the hook handlers that can process hooks for the
+	// repositories, if this is empty, all handlers are allowed.
+	Handlers []string `json:"handlers,omitempty"`
+	// ArchiverImage overrides the default image for archiving artifacts.
+	ArchiverImage string `json:"archiverImage,omitempty"`
+	// ArchiveURL overrides the default URL passed to the archiver.
+	ArchiveURL string `json:"archiveURL,omitempty"`
+	// PipelineRunPrefix overrides the default generateName for PipelineRuns.
+	PipelineRunPrefix string `json:"pipelineRunPrefix,omitempty"`
+	// WebhookSecretRef references the key in a Secret in the Namespace with
+	// the shared secret for validating hooks.
+	WebhookSecretRef *v1alpha1.SecretKeyReference `json:"webhookSecretRef,omitempty"`
+	// TokenRef references the key in a Secret in the Namespace with the API
+	// token for accessing the repositories.
+	TokenRef *v1alpha1.SecretKeyReference `json:"tokenRef,omitempty"`
+	// ServerURL overrides the server URL for the go-scm driver e.g. for a
+	// GitHub Enterprise server.
+	ServerURL string `json:"serverURL,omitempty"`
+	// CloneSecret is the name of a Secret in the Namespace with the
+	// credentials for cloning the repositories, either a basic-auth Secret, or
+	// an ssh-auth Secret with a "known_hosts" key.
+	CloneSecret string `json:"cloneSecret,omitempty"`
+}
+
+// Allows returns true if the named handler is allowed to process hooks for
+// the route.
+func (r *Route) Allows(handler string) bool {
+	if len(r.Handlers) == 0 {
+		return true
+	}
+	for _, v := range r.Handlers {
+		if v == handler {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Route) matches(repo string) bool {
+	for _, p := range r.Repositories {
+		if ok, _ := path.Match(p, repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns a copy of the route with the empty fields filled from the
+// default route.
+func Merge(r, def Route) *Route {
+	if r.Namespace == "" {
+		r.Namespace = def.Namespace
+	}
+	if r.ServiceAccountName == "" {
+		r.ServiceAccountName = def.ServiceAccountName
+	}
+	if r.VolumeSize.IsZero() {
+		r.VolumeSize = def.VolumeSize
+	}
+	if len(r.Handlers) == 0 {
+		r.Handlers = def.Handlers
+	}
+	if r.ArchiverImage == "" {
+		r.ArchiverImage = def.ArchiverImage
+	}
+	if r.ArchiveURL == "" {
+		r.ArchiveURL = def.ArchiveURL
+	}
+	if r.PipelineRunPrefix == "" {
+		r.PipelineRunPrefix = def.PipelineRunPrefix
+	}
+	if r.WebhookSecretRef == nil {
+		r.WebhookSecretRef = def.WebhookSecretRef
+	}
+	if r.TokenRef == nil {
+		r.TokenRef = def.TokenRef
+	}
+	if r.ServerURL == "" {
+		r.ServerURL = def.ServerURL
+	}
+	if r.CloneSecret == "" {
+		r.CloneSecret = def.CloneSecret
+	}
+	return &r
+}
+
+// ParseRoutes decodes YAML describing a list of Routes.
+func ParseRoutes(in io.Reader) ([]Route, error) {
+	body, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read YAML: %w", err)
+	}
+	var routes []Route
+	err = yaml.Unmarshal(body, &routes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode YAML: %w", err)
+	}
+	for i, r := range routes {
+		for _, p := range r.Repositories {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid repository pattern %q in route %d: %w", p, i, err)
+			}
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(strings.NewReader(`
+- repositories:
+    - my-org/*
+  namespace: my-org-ci
+  serviceAccountName: ci-bot
+  volumeSize: 5Gi
+  handlers:
+    - dsl
+  serverURL: https://github.example.com
+  cloneSecret: my-org-clone
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Route{
+		{
+			Repositories:       []string{"my-org/*"},
+			Namespace:          "my-org-ci",
+			ServiceAccountName: "ci-bot",
+			VolumeSize:         resource.MustParse("5Gi"),
+			Handlers:           []string{"dsl"},
+			ServerURL:          "https://github.example.com",
+			CloneSecret:        "my-org-clone",
+		},
+	}
+	if diff := cmp.Diff(want, routes); diff != "" {
+		t.Fatalf("ParseRoutes() failed:\n%s", diff)
+	}
+}
+
+func TestParseRoutesWithInvalidPattern(t *testing.T) {
+	_, err := ParseRoutes(strings.NewReader(`
+- repositories:
+    - "my-org/[*"
+`))
+	if err == nil || !strings.Contains(err.Error(), `invalid repository pattern "my-org/[*"`) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestRouteAllows(t *testing.T) {
+	allowTests := []struct {
+		handlers []string
+		handler  string
+		want     bool
+	}{
+		{nil, DSLHandler, true},
+		{[]string{DSLHandler}, DSLHandler, true},
+		{[]string{DSLHandler}, SpecHandler, false},
+		{[]string{SpecHandler, DSLHandler}, DSLHandler, true},
+	}
+
+	for _, tt := range allowTests {
+		r := &Route{Handlers: tt.handlers}
+		if b := r.Allows(tt.handler); b != tt.want {
+			t.Errorf("Allows(%s) with %v got %v, want %v", tt.handler, tt.handlers, b, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package routing
+
+import (
+	"context"
+)
+
+// NewStatic creates and returns a StaticRouter.
+func NewStatic(r Route) StaticRouter {
+	return StaticRouter{route: r}
+}
+
+// StaticRouter implements the Router interface, returning the same Route for
+// every repository.
+type StaticRouter struct {
+	route Route
+}
+
+// Route implements the Router interface.
+func (s StaticRouter) Route(ctx context.Context, repo string) (*Route, error) {
+	r := s.route
+	return &r, nil
+}
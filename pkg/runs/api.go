@@ -0,0 +1,188 @@
+package runs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// APIPath is the path that the APIHandler serves requests under.
+const APIPath = "/api/runs"
+
+// StatsPath is the path that the StatsHandler serves requests on.
+const StatsPath = "/api/stats"
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+
+	// DefaultWindow is the period that stats are calculated over by default.
+	DefaultWindow = 7 * 24 * time.Hour
+)
+
+// RunList is the response from listing runs.
+//
+// NextOffset is the offset to request the next page of runs with, it's zero
+// if there are no more runs.
+type RunList struct {
+	Runs       []*Run `json:"runs"`
+	Total      int    `json:"total"`
+	NextOffset int    `json:"nextOffset,omitempty"`
+}
+
+// APIHandler implements the http.Handler interface, it serves the run
+// history.
+//
+//	GET /api/runs?repo=org/repo&branch=main&status=Failed&limit=20&offset=0
+//	GET /api/runs/{namespace}/{name}
+type APIHandler struct {
+	store Store
+	log   logger.Logger
+}
+
+// NewAPIHandler creates and returns a new APIHandler.
+func NewAPIHandler(s Store, l logger.Logger) *APIHandler {
+	return &APIHandler{store: s, log: l}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		h.list(w, r)
+	case r.Method == http.MethodGet && len(parts) == 2:
+		h.get(w, r, parts[0], parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *APIHandler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{
+		Repo:   q.Get("repo"),
+		Branch: q.Get("branch"),
+		Status: q.Get("status"),
+		Limit:  defaultLimit,
+	}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxLimit {
+			http.Error(w, "invalid limit: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			http.Error(w, "invalid offset: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	found, total, err := h.store.List(r.Context(), f)
+	if err != nil {
+		h.log.Errorf("error listing runs: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := RunList{Runs: found, Total: total}
+	if next := f.Offset + len(found); next < total {
+		list.NextOffset = next
+	}
+	writeJSON(w, list, h.log)
+}
+
+func (h *APIHandler) get(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	run, err := h.store.Get(r.Context(), namespace, name)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Errorf("error fetching run %s/%s: %s", namespace, name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, run, h.log)
+}
+
+// StatsHandler implements the http.Handler interface, it serves the stats for
+// the jobs and tests in the run history.
+//
+//	GET /api/stats?repo=org/repo&branch=main&window=168h&flaky=true
+//
+// If flaky is true, only the flaky jobs and tests are returned.
+type StatsHandler struct {
+	store Store
+	log   logger.Logger
+	now   func() time.Time
+}
+
+// NewStatsHandler creates and returns a new StatsHandler.
+func NewStatsHandler(s Store, l logger.Logger) *StatsHandler {
+	return &StatsHandler{store: s, log: l, now: time.Now}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	window := DefaultWindow
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid window: "+v, http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	f := Filter{Repo: q.Get("repo"), Branch: q.Get("branch"), Since: h.now().Add(-window)}
+	found, _, err := h.store.List(r.Context(), f)
+	if err != nil {
+		h.log.Errorf("error listing runs: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats := Analyze(found)
+	stats.Since = f.Since
+	if q.Get("flaky") == "true" {
+		stats = onlyFlaky(stats)
+	}
+	writeJSON(w, stats, h.log)
+}
+
+func onlyFlaky(s *Stats) *Stats {
+	flaky := &Stats{Since: s.Since, Jobs: []*JobStats{}, Tests: []*TestStats{}}
+	for _, j := range s.Jobs {
+		if j.Flaky {
+			flaky.Jobs = append(flaky.Jobs, j)
+		}
+	}
+	for _, t := range s.Tests {
+		if t.Flaky {
+			flaky.Tests = append(flaky.Tests, t)
+		}
+	}
+	return flaky
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, l logger.Logger) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		l.Errorf("error marshaling response: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		l.Errorf("error writing response: %s", err)
+	}
+}
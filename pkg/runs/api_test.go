@@ -0,0 +1,96 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAPIHandlerListsRuns(t *testing.T) {
+	h := makeAPIHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs?repo=org/repo&status=Failed&limit=1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	list := RunList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"run-3"}, runNames(list.Runs)); diff != "" {
+		t.Fatalf("got different runs:\n%s", diff)
+	}
+	if list.Total != 2 || list.NextOffset != 1 {
+		t.Fatalf("got total %d and next offset %d, want 2 and 1", list.Total, list.NextOffset)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs?repo=org/repo&status=Failed&limit=1&offset=1", nil))
+	list = RunList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"run-2"}, runNames(list.Runs)); diff != "" {
+		t.Fatalf("got different runs:\n%s", diff)
+	}
+	if list.NextOffset != 0 {
+		t.Fatalf("got next offset %d, want 0", list.NextOffset)
+	}
+}
+
+func TestAPIHandlerWithInvalidPaging(t *testing.T) {
+	h := makeAPIHandler(t)
+
+	for _, q := range []string{"limit=0", "limit=101", "limit=a", "offset=-1"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s got %d, want %d", q, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIHandlerGetsRuns(t *testing.T) {
+	h := makeAPIHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/testing/run-2", nil))
+
+	r := &Run{}
+	if err := json.Unmarshal(rec.Body.Bytes(), r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "run-2" || r.HookID != "hook-run-2" {
+		t.Fatalf("got run %q for hook %q, want run-2", r.Name, r.HookID)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/testing/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func makeAPIHandler(t *testing.T) *APIHandler {
+	s := makeBoltStore(t)
+	for _, r := range []*Run{
+		makeRun("run-1", "org/repo", "main", "Successful", 0),
+		makeRun("run-2", "org/repo", "main", "Failed", time.Minute),
+		makeRun("run-3", "org/repo", "feature", "Failed", time.Minute*2),
+	} {
+		if err := s.Save(context.TODO(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	return NewAPIHandler(s, logger.Sugar())
+}
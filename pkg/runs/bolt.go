@@ -0,0 +1,176 @@
+package runs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Runs are keyed by the time they completed, so that they're ordered.
+	runsBucket = []byte("runs")
+	// The keys of runs by namespace and name.
+	namesBucket = []byte("names")
+)
+
+// The format of the completion time in keys, this is fixed width so that
+// keys sort in time order.
+const keyTimeFormat = "20060102T150405.000000000Z"
+
+// BoltStore is an implementation of Store that records runs in an embedded
+// bolt database file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the database file at the path, and returns a
+// store that records runs in it.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run history %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{runsBucket, namesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create run history buckets: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the database file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Save creates or replaces the run with the same namespace and name.
+func (s *BoltStore) Save(ctx context.Context, r *Run) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		runs, names := tx.Bucket(runsBucket), tx.Bucket(namesBucket)
+		name := nameKey(r.Namespace, r.Name)
+		if existing := names.Get(name); existing != nil {
+			if err := runs.Delete(existing); err != nil {
+				return err
+			}
+		}
+		key := runKey(r)
+		if err := runs.Put(key, b); err != nil {
+			return err
+		}
+		return names.Put(name, key)
+	})
+}
+
+// Get returns the run with the namespace and name, or ErrNotFound.
+func (s *BoltStore) Get(ctx context.Context, namespace, name string) (*Run, error) {
+	var r *Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(namesBucket).Get(nameKey(namespace, name))
+		if key == nil {
+			return ErrNotFound
+		}
+		b := tx.Bucket(runsBucket).Get(key)
+		if b == nil {
+			return ErrNotFound
+		}
+		r = &Run{}
+		return json.Unmarshal(b, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// List returns the runs that match the filter, most recently completed first,
+// and the total number of matching runs.
+//
+// Runs are keyed by their completion time, so if the filter has a Since time,
+// only the runs that completed since then are read.
+func (s *BoltStore) List(ctx context.Context, f Filter) ([]*Run, int, error) {
+	found := []*Run{}
+	total := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if !f.Since.IsZero() && bytes.Compare(k, timeKey(f.Since)) < 0 {
+				break
+			}
+			r := &Run{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return fmt.Errorf("failed to parse run %s: %w", k, err)
+			}
+			if !f.Matches(r) {
+				continue
+			}
+			if total >= f.Offset && (f.Limit == 0 || len(found) < f.Limit) {
+				found = append(found, r)
+			}
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return found, total, nil
+}
+
+// Prune deletes the runs that completed before a time, and returns the number
+// of runs that were deleted.
+func (s *BoltStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		runs, names := tx.Bucket(runsBucket), tx.Bucket(namesBucket)
+		// Deleting with the cursor skips keys, so the keys are collected first.
+		expired := [][]byte{}
+		c := runs.Cursor()
+		end := timeKey(before)
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			// The key is the completion time followed by the name key.
+			name := k[bytes.IndexByte(k, '/')+1:]
+			if bytes.Equal(names.Get(name), k) {
+				if err := names.Delete(name); err != nil {
+					return err
+				}
+			}
+			if err := runs.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
+
+func nameKey(namespace, name string) []byte {
+	return []byte(namespace + "/" + name)
+}
+
+func runKey(r *Run) []byte {
+	return append(timeKey(r.Completed), append([]byte("/"), nameKey(r.Namespace, r.Name)...)...)
+}
+
+// timeKey returns the prefix of the keys of runs that completed at a time.
+func timeKey(t time.Time) []byte {
+	return []byte(t.UTC().Format(keyTimeFormat))
+}
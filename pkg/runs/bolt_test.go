@@ -0,0 +1,222 @@
+package runs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ Store = (*BoltStore)(nil)
+
+var testTime = time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+func TestBoltStoreSaveAndGet(t *testing.T) {
+	ctx := context.TODO()
+	s := makeBoltStore(t)
+	r := makeRun("run-1", "org/repo", "main", "Successful", 0)
+
+	if err := s.Save(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, "testing", "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(r, got); diff != "" {
+		t.Fatalf("got a different run:\n%s", diff)
+	}
+	if _, err := s.Get(ctx, "testing", "unknown"); err != ErrNotFound {
+		t.Fatalf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestBoltStoreSaveReplacesRuns(t *testing.T) {
+	ctx := context.TODO()
+	s := makeBoltStore(t)
+	if err := s.Save(ctx, makeRun("run-1", "org/repo", "main", "Failed", 0)); err != nil {
+		t.Fatal(err)
+	}
+	replacement := makeRun("run-1", "org/repo", "main", "Successful", time.Minute)
+	if err := s.Save(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	found, total, err := s.List(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("got %d runs, want 1", total)
+	}
+	if diff := cmp.Diff([]*Run{replacement}, found); diff != "" {
+		t.Fatalf("got different runs:\n%s", diff)
+	}
+}
+
+func TestBoltStoreList(t *testing.T) {
+	ctx := context.TODO()
+	s := makeBoltStore(t)
+	for _, r := range []*Run{
+		makeRun("run-1", "org/repo", "main", "Successful", 0),
+		makeRun("run-2", "org/repo", "feature", "Failed", time.Minute),
+		makeRun("run-3", "org/other", "main", "Failed", time.Minute*2),
+		makeRun("run-4", "org/repo", "main", "Failed", time.Minute*3),
+	} {
+		if err := s.Save(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listTests := []struct {
+		filter    Filter
+		want      []string
+		wantTotal int
+	}{
+		{Filter{}, []string{"run-4", "run-3", "run-2", "run-1"}, 4},
+		{Filter{Repo: "org/repo"}, []string{"run-4", "run-2", "run-1"}, 3},
+		{Filter{Branch: "main"}, []string{"run-4", "run-3", "run-1"}, 3},
+		{Filter{Repo: "org/repo", Status: "Failed"}, []string{"run-4", "run-2"}, 2},
+		{Filter{Since: testTime.Add(time.Minute * 2)}, []string{"run-4", "run-3"}, 2},
+		{Filter{Since: testTime.Add(time.Minute * 2), Repo: "org/repo"}, []string{"run-4"}, 1},
+		{Filter{Since: testTime.Add(time.Hour)}, []string{}, 0},
+		{Filter{Limit: 2}, []string{"run-4", "run-3"}, 4},
+		{Filter{Offset: 2, Limit: 1}, []string{"run-2"}, 4},
+		{Filter{Offset: 4}, []string{}, 4},
+		{Filter{Repo: "org/unknown"}, []string{}, 0},
+	}
+
+	for _, tt := range listTests {
+		found, total, err := s.List(ctx, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != tt.wantTotal {
+			t.Errorf("List(%#v) got total %d, want %d", tt.filter, total, tt.wantTotal)
+		}
+		if diff := cmp.Diff(tt.want, runNames(found)); diff != "" {
+			t.Errorf("List(%#v) got different runs:\n%s", tt.filter, diff)
+		}
+	}
+}
+
+func TestBoltStorePrune(t *testing.T) {
+	ctx := context.TODO()
+	s := makeBoltStore(t)
+	for _, r := range []*Run{
+		makeRun("run-1", "org/repo", "main", "Successful", 0),
+		makeRun("run-2", "org/repo", "main", "Failed", time.Minute),
+		makeRun("run-3", "org/repo", "main", "Failed", time.Minute*2),
+	} {
+		if err := s.Save(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := s.Prune(ctx, testTime.Add(time.Minute*2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 2 {
+		t.Fatalf("got %d runs deleted, want 2", deleted)
+	}
+	found, _, err := s.List(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"run-3"}, runNames(found)); diff != "" {
+		t.Fatalf("got different runs:\n%s", diff)
+	}
+	if _, err := s.Get(ctx, "testing", "run-1"); err != ErrNotFound {
+		t.Fatalf("got error %v, want ErrNotFound", err)
+	}
+	// A pruned run can be recorded again.
+	if err := s.Save(ctx, makeRun("run-1", "org/repo", "main", "Successful", time.Minute*3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "testing", "run-1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewBoltStoreWithExistingFile(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(makeTempDir(t), "runs.db")
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, makeRun("run-1", "org/repo", "main", "Successful", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Get(ctx, "testing", "run-1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeRun(name, repo, branch, status string, offset time.Duration) *Run {
+	completed := testTime.Add(offset)
+	return &Run{
+		Name:      name,
+		Namespace: "testing",
+		Repo:      repo,
+		RepoURL:   "https://github.com/" + repo + ".git",
+		Branch:    branch,
+		SHA:       "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+		HookID:    "hook-" + name,
+		Status:    status,
+		Started:   completed.Add(-time.Minute),
+		Completed: completed,
+		Duration:  time.Minute,
+		Tasks: []TaskResult{
+			{Name: "git-clone", Status: "Successful", Started: completed.Add(-time.Minute), Completed: completed, Duration: time.Minute},
+		},
+	}
+}
+
+func runNames(runs []*Run) []string {
+	names := []string{}
+	for _, r := range runs {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func makeBoltStore(t *testing.T) *BoltStore {
+	t.Helper()
+	s, err := NewBoltStore(filepath.Join(makeTempDir(t), "runs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	return s
+}
+
+func makeTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tekton-ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
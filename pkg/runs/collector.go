@@ -0,0 +1,89 @@
+package runs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// Collector implements the prometheus.Collector interface, it calculates the
+// stats for the jobs and tests in the run history over a window when metrics
+// are collected.
+//
+// Only flaky tests are collected, to limit the number of series.
+type Collector struct {
+	store  Store
+	window time.Duration
+	log    logger.Logger
+	now    func() time.Time
+
+	jobRuns        *prometheus.Desc
+	jobSuccessRate *prometheus.Desc
+	jobDuration    *prometheus.Desc
+	jobFlaky       *prometheus.Desc
+	testFlaky      *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates and returns a new Collector, with metrics in the
+// namespace.
+func NewCollector(ns string, s Store, window time.Duration, l logger.Logger) *Collector {
+	return &Collector{
+		store:  s,
+		window: window,
+		log:    l,
+		now:    time.Now,
+		jobRuns: prometheus.NewDesc(prometheus.BuildFQName(ns, "", "job_runs"),
+			"Count of completed runs of jobs in the window", []string{"repo", "job"}, nil),
+		jobSuccessRate: prometheus.NewDesc(prometheus.BuildFQName(ns, "", "job_success_rate"),
+			"Ratio of runs of jobs that succeeded in the window", []string{"repo", "job"}, nil),
+		jobDuration: prometheus.NewDesc(prometheus.BuildFQName(ns, "", "job_duration_seconds"),
+			"Percentiles of the time taken by jobs in the window", []string{"repo", "job", "quantile"}, nil),
+		jobFlaky: prometheus.NewDesc(prometheus.BuildFQName(ns, "", "job_flaky"),
+			"Whether or not jobs passed and failed for the same SHA in the window", []string{"repo", "job"}, nil),
+		testFlaky: prometheus.NewDesc(prometheus.BuildFQName(ns, "", "test_flaky"),
+			"Tests that passed and failed for the same SHA in the window", []string{"repo", "job", "test"}, nil),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.jobRuns
+	ch <- c.jobSuccessRate
+	ch <- c.jobDuration
+	ch <- c.jobFlaky
+	ch <- c.testFlaky
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	found, _, err := c.store.List(context.Background(), Filter{Since: c.now().Add(-c.window)})
+	if err != nil {
+		c.log.Errorf("error listing runs for metrics: %s", err)
+		return
+	}
+	stats := Analyze(found)
+	for _, j := range stats.Jobs {
+		ch <- prometheus.MustNewConstMetric(c.jobRuns, prometheus.GaugeValue, float64(j.Runs), j.Repo, j.Job)
+		ch <- prometheus.MustNewConstMetric(c.jobSuccessRate, prometheus.GaugeValue, j.SuccessRate, j.Repo, j.Job)
+		ch <- prometheus.MustNewConstMetric(c.jobDuration, prometheus.GaugeValue, j.P50.Seconds(), j.Repo, j.Job, "0.5")
+		ch <- prometheus.MustNewConstMetric(c.jobDuration, prometheus.GaugeValue, j.P95.Seconds(), j.Repo, j.Job, "0.95")
+		ch <- prometheus.MustNewConstMetric(c.jobFlaky, prometheus.GaugeValue, boolValue(j.Flaky), j.Repo, j.Job)
+	}
+	for _, t := range stats.Tests {
+		if t.Flaky {
+			ch <- prometheus.MustNewConstMetric(c.testFlaky, prometheus.GaugeValue, 1, t.Repo, t.Job, t.Test)
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when there is no run with a name.
+var ErrNotFound = errors.New("run not found")
+
+// The status of completed runs and tasks, tasks that didn't run are
+// "Pending".
+const (
+	StatusSuccessful = "Successful"
+	StatusFailed     = "Failed"
+)
+
+// Run is the result of a completed PipelineRun.
+type Run struct {
+	Name        string        `json:"name"`
+	Namespace   string        `json:"namespace"`
+	Repo        string        `json:"repo"`
+	RepoURL     string        `json:"repoURL"`
+	Branch      string        `json:"branch,omitempty"`
+	SHA         string        `json:"sha"`
+	HookID      string        `json:"hookID,omitempty"`
+	PullRequest int           `json:"pullRequest,omitempty"`
+	Status      string        `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	Message     string        `json:"message,omitempty"`
+	Started     time.Time     `json:"started"`
+	Completed   time.Time     `json:"completed"`
+	Duration    time.Duration `json:"duration"`
+	Tasks       []TaskResult  `json:"tasks"`
+}
+
+// TaskResult is the result of a task in a PipelineRun.
+//
+// Tests are the test cases from the JUnit reports recorded by the task.
+type TaskResult struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"`
+	Reason    string        `json:"reason,omitempty"`
+	Started   time.Time     `json:"started"`
+	Completed time.Time     `json:"completed"`
+	Duration  time.Duration `json:"duration"`
+	Tests     []TestResult  `json:"tests,omitempty"`
+}
+
+// Filter selects runs, empty fields match all runs.
+type Filter struct {
+	Repo   string
+	Branch string
+	Status string
+	Since  time.Time // If set, only runs that completed since this time match.
+	Offset int
+	Limit  int // If this is 0, all the matching runs are returned.
+}
+
+// Matches returns true if the run matches the filter.
+func (f Filter) Matches(r *Run) bool {
+	return (f.Repo == "" || f.Repo == r.Repo) &&
+		(f.Branch == "" || f.Branch == r.Branch) &&
+		(f.Status == "" || f.Status == r.Status) &&
+		(f.Since.IsZero() || !r.Completed.Before(f.Since))
+}
+
+// Store implementations persist the history of runs.
+type Store interface {
+	// Save creates or replaces the run with the same namespace and name.
+	Save(ctx context.Context, r *Run) error
+
+	// Get returns the run with the namespace and name, or ErrNotFound.
+	Get(ctx context.Context, namespace, name string) (*Run, error)
+
+	// List returns the runs that match the filter, most recently completed
+	// first, and the total number of matching runs.
+	List(ctx context.Context, f Filter) ([]*Run, int, error)
+}
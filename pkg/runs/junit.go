@@ -0,0 +1,95 @@
+package runs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The status of tests in JUnit reports.
+const (
+	TestPassed  = "passed"
+	TestFailed  = "failed"
+	TestSkipped = "skipped"
+)
+
+// TestResult is the result of a test case in a JUnit report.
+type TestResult struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration"`
+}
+
+type junitTestCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Time      string    `xml:"time,attr"`
+	Failure   *struct{} `xml:"failure"`
+	Error     *struct{} `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+// ParseJUnit parses the test cases from JUnit reports, the reports can be
+// concatenated, and test suites can be nested.
+//
+// Tests are named with their classname and name e.g. "pkg/runs.TestParse".
+func ParseJUnit(r io.Reader) ([]TestResult, error) {
+	results := []TestResult{}
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JUnit report: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "testcase" {
+			continue
+		}
+		tc := junitTestCase{}
+		if err := d.DecodeElement(&tc, &start); err != nil {
+			return nil, fmt.Errorf("failed to parse JUnit test case: %w", err)
+		}
+		results = append(results, tc.result())
+	}
+}
+
+// DecodeJUnitReport parses the test cases from the gzip compressed and base64
+// encoded JUnit reports recorded by a task.
+func DecodeJUnitReport(s string) ([]TestResult, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JUnit report: %w", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress JUnit report: %w", err)
+	}
+	defer gz.Close()
+	return ParseJUnit(gz)
+}
+
+func (tc junitTestCase) result() TestResult {
+	r := TestResult{Name: tc.Name, Status: TestPassed}
+	if tc.Classname != "" {
+		r.Name = tc.Classname + "." + tc.Name
+	}
+	switch {
+	case tc.Failure != nil || tc.Error != nil:
+		r.Status = TestFailed
+	case tc.Skipped != nil:
+		r.Status = TestSkipped
+	}
+	if secs, err := strconv.ParseFloat(tc.Time, 64); err == nil {
+		r.Duration = time.Duration(secs * float64(time.Second))
+	}
+	return r
+}
@@ -0,0 +1,94 @@
+package runs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testJUnitResults = []TestResult{
+	{Name: "runs.TestParse", Status: TestPassed, Duration: time.Millisecond * 10},
+	{Name: "runs.TestAnalyze", Status: TestFailed, Duration: time.Millisecond * 5},
+	{Name: "runs.TestSkipped", Status: TestSkipped},
+	{Name: "test_deploy", Status: TestFailed, Duration: time.Millisecond * 1500},
+}
+
+func TestParseJUnit(t *testing.T) {
+	f, err := os.Open("testdata/junit.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	results, err := ParseJUnit(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(testJUnitResults, results); diff != "" {
+		t.Fatalf("ParseJUnit() failed:\n%s", diff)
+	}
+}
+
+func TestParseJUnitWithInvalidReport(t *testing.T) {
+	_, err := ParseJUnit(strings.NewReader(`<testsuite><testcase name="test"></testsuite>`))
+
+	if err == nil {
+		t.Fatal("expected an error parsing an invalid report")
+	}
+}
+
+func TestDecodeJUnitReport(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/junit.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := DecodeJUnitReport(encodeReport(t, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(testJUnitResults, results); diff != "" {
+		t.Fatalf("DecodeJUnitReport() failed:\n%s", diff)
+	}
+}
+
+func TestDecodeJUnitReportWithNoReports(t *testing.T) {
+	results, err := DecodeJUnitReport(encodeReport(t, []byte{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 0 {
+		t.Fatalf("got %d results, want 0", len(results))
+	}
+}
+
+// This encodes the report in the same way as the step in the task, including
+// wrapping the lines.
+func encodeReport(t *testing.T, b []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+	var lines []string
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	return strings.Join(append(lines, encoded), "\n") + "\n"
+}
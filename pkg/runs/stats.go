@@ -0,0 +1,182 @@
+package runs
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats summarises the results of jobs and tests in runs.
+type Stats struct {
+	Since time.Time    `json:"since"`
+	Jobs  []*JobStats  `json:"jobs"`
+	Tests []*TestStats `json:"tests"`
+}
+
+// JobStats summarises the results of a job in a repository.
+//
+// Jobs are flaky if they both passed and failed for the same SHA, the
+// FlakySHAs are the SHAs that they did.
+type JobStats struct {
+	Repo        string        `json:"repo"`
+	Job         string        `json:"job"`
+	Runs        int           `json:"runs"`
+	Failures    int           `json:"failures"`
+	SuccessRate float64       `json:"successRate"`
+	P50         time.Duration `json:"p50"`
+	P95         time.Duration `json:"p95"`
+	Flaky       bool          `json:"flaky"`
+	FlakySHAs   []string      `json:"flakySHAs,omitempty"`
+}
+
+// TestStats summarises the results of a test case from the JUnit reports of a
+// job in a repository.
+//
+// Tests are flaky if they both passed and failed for the same SHA.
+type TestStats struct {
+	Repo      string   `json:"repo"`
+	Job       string   `json:"job"`
+	Test      string   `json:"test"`
+	Runs      int      `json:"runs"`
+	Failures  int      `json:"failures"`
+	Flaky     bool     `json:"flaky"`
+	FlakySHAs []string `json:"flakySHAs,omitempty"`
+}
+
+// Analyze summarises the results of the jobs and tests in the runs.
+//
+// Jobs that didn't complete, and tests that were skipped, are not counted.
+func Analyze(runs []*Run) *Stats {
+	jobs := map[statsKey]*outcomes{}
+	tests := map[statsKey]*outcomes{}
+	for _, r := range runs {
+		for _, t := range r.Tasks {
+			if t.Status != StatusSuccessful && t.Status != StatusFailed {
+				continue
+			}
+			key := statsKey{repo: r.Repo, job: t.Name}
+			outcomesFor(jobs, key).add(r.SHA, t.Status == StatusSuccessful, t.Duration)
+			for _, tc := range t.Tests {
+				if tc.Status == TestSkipped {
+					continue
+				}
+				key.test = tc.Name
+				outcomesFor(tests, key).add(r.SHA, tc.Status == TestPassed, tc.Duration)
+			}
+		}
+	}
+
+	stats := &Stats{Jobs: []*JobStats{}, Tests: []*TestStats{}}
+	for _, k := range sortedKeys(jobs) {
+		o := jobs[k]
+		flaky := o.flakySHAs()
+		stats.Jobs = append(stats.Jobs, &JobStats{
+			Repo:        k.repo,
+			Job:         k.job,
+			Runs:        o.runs,
+			Failures:    o.failures,
+			SuccessRate: float64(o.runs-o.failures) / float64(o.runs),
+			P50:         o.percentile(0.5),
+			P95:         o.percentile(0.95),
+			Flaky:       len(flaky) > 0,
+			FlakySHAs:   flaky,
+		})
+	}
+	for _, k := range sortedKeys(tests) {
+		o := tests[k]
+		flaky := o.flakySHAs()
+		stats.Tests = append(stats.Tests, &TestStats{
+			Repo:      k.repo,
+			Job:       k.job,
+			Test:      k.test,
+			Runs:      o.runs,
+			Failures:  o.failures,
+			Flaky:     len(flaky) > 0,
+			FlakySHAs: flaky,
+		})
+	}
+	return stats
+}
+
+type statsKey struct {
+	repo string
+	job  string
+	test string
+}
+
+// outcomes are the results of a job or test, and whether or not it passed
+// and failed for each SHA.
+type outcomes struct {
+	runs      int
+	failures  int
+	durations []time.Duration
+	passed    map[string]bool
+	failed    map[string]bool
+}
+
+func outcomesFor(m map[statsKey]*outcomes, k statsKey) *outcomes {
+	o, ok := m[k]
+	if !ok {
+		o = &outcomes{passed: map[string]bool{}, failed: map[string]bool{}}
+		m[k] = o
+	}
+	return o
+}
+
+func (o *outcomes) add(sha string, passed bool, d time.Duration) {
+	o.runs++
+	o.durations = append(o.durations, d)
+	if !passed {
+		o.failures++
+	}
+	if sha == "" {
+		return
+	}
+	if passed {
+		o.passed[sha] = true
+	} else {
+		o.failed[sha] = true
+	}
+}
+
+func (o *outcomes) flakySHAs() []string {
+	shas := []string{}
+	for sha := range o.failed {
+		if o.passed[sha] {
+			shas = append(shas, sha)
+		}
+	}
+	if len(shas) == 0 {
+		return nil
+	}
+	sort.Strings(shas)
+	return shas
+}
+
+// percentile uses the nearest-rank method.
+func (o *outcomes) percentile(p float64) time.Duration {
+	sorted := append([]time.Duration{}, o.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func sortedKeys(m map[statsKey]*outcomes) []statsKey {
+	keys := []statsKey{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].repo != keys[j].repo {
+			return keys[i].repo < keys[j].repo
+		}
+		if keys[i].job != keys[j].job {
+			return keys[i].job < keys[j].job
+		}
+		return keys[i].test < keys[j].test
+	})
+	return keys
+}
@@ -0,0 +1,158 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	testSHA1 = "ec26c3e57ca3a959ca5aad62de7213c562f8c821"
+	testSHA2 = "9bb041d2f04027d96db99979c58531c3f6e39312"
+)
+
+func TestAnalyze(t *testing.T) {
+	stats := Analyze(makeStatsRuns())
+
+	wantJobs := []*JobStats{
+		{Repo: "org/other", Job: "test", Runs: 1, SuccessRate: 1, P50: time.Minute, P95: time.Minute},
+		{Repo: "org/repo", Job: "build", Runs: 3, SuccessRate: 1, P50: time.Second * 20, P95: time.Second * 30},
+		{Repo: "org/repo", Job: "test", Runs: 4, Failures: 2, SuccessRate: 0.5, P50: time.Minute * 2, P95: time.Minute * 4,
+			Flaky: true, FlakySHAs: []string{testSHA2, testSHA1}},
+	}
+	if diff := cmp.Diff(wantJobs, stats.Jobs); diff != "" {
+		t.Fatalf("got different jobs:\n%s", diff)
+	}
+	wantTests := []*TestStats{
+		{Repo: "org/repo", Job: "test", Test: "runs.TestAnalyze", Runs: 2, Failures: 1, Flaky: true, FlakySHAs: []string{testSHA1}},
+		{Repo: "org/repo", Job: "test", Test: "runs.TestParse", Runs: 3, Failures: 1},
+	}
+	if diff := cmp.Diff(wantTests, stats.Tests); diff != "" {
+		t.Fatalf("got different tests:\n%s", diff)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	s := makeBoltStore(t)
+	for _, r := range makeStatsRuns() {
+		if err := s.Save(context.TODO(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewStatsHandler(s, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+	h.now = func() time.Time { return testTime.Add(time.Hour) }
+
+	statsTests := []struct {
+		query    string
+		wantJobs []string
+	}{
+		{"", []string{"org/other/test", "org/repo/build", "org/repo/test"}},
+		{"?repo=org/repo", []string{"org/repo/build", "org/repo/test"}},
+		{"?flaky=true", []string{"org/repo/test"}},
+		{"?window=30m", []string{"org/repo/build", "org/repo/test"}},
+	}
+
+	for _, tt := range statsTests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats"+tt.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q got %d, want %d", tt.query, rec.Code, http.StatusOK)
+		}
+		stats := &Stats{}
+		if err := json.Unmarshal(rec.Body.Bytes(), stats); err != nil {
+			t.Fatal(err)
+		}
+		jobs := []string{}
+		for _, j := range stats.Jobs {
+			jobs = append(jobs, j.Repo+"/"+j.Job)
+		}
+		if diff := cmp.Diff(tt.wantJobs, jobs); diff != "" {
+			t.Errorf("%q got different jobs:\n%s", tt.query, diff)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats?window=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	s := makeBoltStore(t)
+	for _, r := range makeStatsRuns() {
+		if err := s.Save(context.TODO(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCollector("dsl", s, time.Hour*3, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+	c.now = func() time.Time { return testTime.Add(time.Hour) }
+
+	want := `
+# HELP dsl_job_flaky Whether or not jobs passed and failed for the same SHA in the window
+# TYPE dsl_job_flaky gauge
+dsl_job_flaky{job="build",repo="org/repo"} 0
+dsl_job_flaky{job="test",repo="org/other"} 0
+dsl_job_flaky{job="test",repo="org/repo"} 1
+# HELP dsl_job_success_rate Ratio of runs of jobs that succeeded in the window
+# TYPE dsl_job_success_rate gauge
+dsl_job_success_rate{job="build",repo="org/repo"} 1
+dsl_job_success_rate{job="test",repo="org/other"} 1
+dsl_job_success_rate{job="test",repo="org/repo"} 0.5
+# HELP dsl_test_flaky Tests that passed and failed for the same SHA in the window
+# TYPE dsl_test_flaky gauge
+dsl_test_flaky{job="test",repo="org/repo",test="runs.TestAnalyze"} 1
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want), "dsl_job_flaky", "dsl_job_success_rate", "dsl_test_flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c); n != 16 {
+		t.Fatalf("got %d metrics, want 16", n)
+	}
+}
+
+// The test job in org/repo passes and fails for both SHAs, and TestAnalyze
+// passes and fails for testSHA1.
+func makeStatsRuns() []*Run {
+	return []*Run{
+		makeStatsRun("run-1", "org/repo", testSHA1, -time.Hour,
+			task("build", StatusSuccessful, time.Second*10),
+			task("test", StatusSuccessful, time.Minute, test("runs.TestParse", TestPassed), test("runs.TestAnalyze", TestPassed))),
+		makeStatsRun("run-2", "org/repo", testSHA1, 0,
+			task("build", StatusSuccessful, time.Second*20),
+			task("test", StatusFailed, time.Minute*2, test("runs.TestParse", TestPassed), test("runs.TestAnalyze", TestFailed))),
+		makeStatsRun("run-3", "org/repo", testSHA2, time.Minute*40,
+			task("build", StatusSuccessful, time.Second*30),
+			task("test", StatusFailed, time.Minute*3, test("runs.TestParse", TestFailed), test("runs.TestAnalyze", TestSkipped))),
+		makeStatsRun("run-4", "org/repo", testSHA2, time.Minute*15,
+			task("test", StatusSuccessful, time.Minute*4),
+			task("deploy", "Pending", 0)),
+		makeStatsRun("run-5", "org/other", testSHA1, time.Minute*10,
+			task("test", StatusSuccessful, time.Minute)),
+	}
+}
+
+func makeStatsRun(name, repo, sha string, offset time.Duration, tasks ...TaskResult) *Run {
+	r := makeRun(name, repo, "main", StatusSuccessful, offset)
+	r.SHA = sha
+	r.Tasks = tasks
+	return r
+}
+
+func task(name, status string, d time.Duration, tests ...TestResult) TaskResult {
+	return TaskResult{Name: name, Status: status, Duration: d, Tests: tests}
+}
+
+func test(name, status string) TestResult {
+	return TestResult{Name: name, Status: status}
+}
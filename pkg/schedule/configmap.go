@@ -0,0 +1,43 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigMapSource is an implementation of Source that reads the schedule
+// configuration from a v1.ConfigMap.
+type ConfigMapSource struct {
+	coreClient kubernetes.Interface
+	namespace  string
+	name       string
+}
+
+// NewConfigMapSource creates and returns a ConfigMapSource that reads the
+// configuration from the named ConfigMap.
+func NewConfigMapSource(ns, n string, c kubernetes.Interface) *ConfigMapSource {
+	return &ConfigMapSource{coreClient: c, namespace: ns, name: n}
+}
+
+// Config implements the Source interface.
+//
+// If the ConfigMap doesn't exist, the configuration is empty.
+func (c ConfigMapSource) Config(ctx context.Context) (*Config, error) {
+	cm, err := c.coreClient.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(strings.NewReader(cm.Data[ConfigKey]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schedules from %s: %w", c.name, err)
+	}
+	return cfg, nil
+}
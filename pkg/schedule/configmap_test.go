@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ Source = (*ConfigMapSource)(nil)
+
+func TestConfigMapSource(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "tekton-ci-schedules", Namespace: testNS},
+		Data: map[string]string{ConfigKey: `
+schedules:
+  - name: nightly
+    repo: my-org/my-repo
+    cron: "0 2 * * *"
+`},
+	})
+	s := NewConfigMapSource(testNS, "tekton-ci-schedules", fakeClient)
+
+	cfg, err := s.Config(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{Schedules: []Schedule{{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"}}}
+	if diff := cmp.Diff(want, cfg); diff != "" {
+		t.Fatalf("config doesn't match:\n%s", diff)
+	}
+}
+
+func TestConfigMapSourceWithMissingConfigMap(t *testing.T) {
+	s := NewConfigMapSource(testNS, "tekton-ci-schedules", fake.NewSimpleClientset())
+
+	cfg, err := s.Config(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(&Config{}, cfg); diff != "" {
+		t.Fatalf("config doesn't match:\n%s", diff)
+	}
+}
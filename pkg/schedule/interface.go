@@ -0,0 +1,26 @@
+package schedule
+
+import (
+	"context"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+// Source provides the schedule configuration.
+type Source interface {
+	Config(ctx context.Context) (*Config, error)
+}
+
+// Runner finds the schedules declared in repositories, and runs the pipelines
+// for schedules.
+type Runner interface {
+	// Schedules returns the schedules declared in the pipeline definition on
+	// the default branch of the repository.
+	Schedules(ctx context.Context, repo string) ([]Schedule, error)
+	// RunSchedule runs the pipeline for the schedule, the id identifies the
+	// scheduled run, and at most one PipelineRun is created for it.
+	//
+	// If no PipelineRun is created e.g. because no jobs match, this returns
+	// nil.
+	RunSchedule(ctx context.Context, s Schedule, id string) (*pipelinev1.PipelineRun, error)
+}
@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigKey is the key in the ConfigMap that contains the schedule
+// configuration.
+const ConfigKey = "schedules.yaml"
+
+// Schedule runs the DSL pipeline for a branch of a repository on a cron
+// expression.
+type Schedule struct {
+	Name string `json:"name"`
+	// Repo is the full name of the repository e.g. "my-org/my-repo".
+	Repo string `json:"repo"`
+	// Branch is the branch to run the pipeline for, if this is empty, the
+	// default branch of the repository is used.
+	Branch string `json:"branch,omitempty"`
+	// Cron is a standard cron expression e.g. "0 2 * * *", or a descriptor
+	// e.g. "@daily", evaluated in UTC.
+	Cron string `json:"cron"`
+	// Driver is the go-scm driver for the repository, if this is empty, the
+	// default driver is used.
+	Driver string `json:"driver,omitempty"`
+}
+
+// Repository is a repository with schedules declared in its pipeline
+// definition.
+type Repository struct {
+	Repo   string `json:"repo"`
+	Driver string `json:"driver,omitempty"`
+}
+
+// Config is the schedule configuration held by the server.
+type Config struct {
+	Schedules []Schedule `json:"schedules,omitempty"`
+	// Repositories are checked for schedules that are declared in the
+	// pipeline definition on their default branch.
+	Repositories []Repository `json:"repositories,omitempty"`
+}
+
+// ParseConfig parses the YAML schedule configuration.
+func ParseConfig(in io.Reader) (*Config, error) {
+	body, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(body, cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode schedules: %w", err)
+	}
+	for _, s := range cfg.Schedules {
+		if s.Name == "" || s.Repo == "" || s.Cron == "" {
+			return nil, fmt.Errorf("invalid schedule %#v: missing name, repo or cron", s.Name)
+		}
+	}
+	for _, r := range cfg.Repositories {
+		if r.Repo == "" {
+			return nil, fmt.Errorf("invalid repository: missing repo")
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(`
+schedules:
+  - name: nightly
+    repo: my-org/my-repo
+    cron: "0 2 * * *"
+  - name: weekly
+    repo: my-org/other-repo
+    branch: release
+    cron: "@weekly"
+    driver: gitlab
+repositories:
+  - repo: my-org/my-repo
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Schedules: []Schedule{
+			{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"},
+			{Name: "weekly", Repo: "my-org/other-repo", Branch: "release", Cron: "@weekly", Driver: "gitlab"},
+		},
+		Repositories: []Repository{{Repo: "my-org/my-repo"}},
+	}
+	if diff := cmp.Diff(want, cfg); diff != "" {
+		t.Fatalf("config doesn't match:\n%s", diff)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	parseTests := []struct {
+		body    string
+		wantErr string
+	}{
+		{"schedules: [", "failed to decode schedules: error converting YAML to JSON: yaml: line 1: did not find expected node content"},
+		{"schedules:\n  - name: nightly\n    repo: my-org/my-repo\n", `invalid schedule "nightly": missing name, repo or cron`},
+		{"repositories:\n  - driver: gitlab\n", "invalid repository: missing repo"},
+	}
+
+	for _, tt := range parseTests {
+		_, err := ParseConfig(strings.NewReader(tt.body))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("ParseConfig(%q) got error %v, want %s", tt.body, err, tt.wantErr)
+		}
+	}
+}
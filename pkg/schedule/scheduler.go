@@ -0,0 +1,178 @@
+package schedule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+)
+
+// Schedules are checked for runs that are due this often.
+const checkInterval = time.Minute
+
+// Scheduler runs the pipelines for schedules when they're due.
+//
+// The schedules are read from the Source, and from the pipeline definitions
+// of the repositories in the configuration, and are read again after the
+// refresh period.
+//
+// Runs that were due while the Scheduler was not running are not caught up.
+type Scheduler struct {
+	source  Source
+	def     string
+	runners map[string]Runner
+	refresh time.Duration
+	log     logger.Logger
+	clock   func() time.Time
+
+	schedules []entry
+	refreshed time.Time
+	next      map[string]time.Time
+}
+
+type entry struct {
+	Schedule
+	cron cron.Schedule
+}
+
+// New creates and returns a new Scheduler.
+//
+// The runners are keyed by the go-scm driver, schedules without a driver are
+// run by the runner for the default driver.
+func New(s Source, def string, runners map[string]Runner, refresh time.Duration, l logger.Logger) *Scheduler {
+	return &Scheduler{
+		source:  s,
+		def:     def,
+		runners: runners,
+		refresh: refresh,
+		log:     l,
+		clock:   time.Now,
+		next:    map[string]time.Time{},
+	}
+}
+
+// Run checks for schedules that are due every minute, until the stop channel
+// is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		s.check(context.Background(), s.clock().UTC())
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check runs the pipelines for the schedules that are due at the time.
+//
+// Schedules that weren't known at the previous check are first due at their
+// next time after now.
+func (s *Scheduler) check(ctx context.Context, now time.Time) {
+	if s.refreshed.IsZero() || now.Sub(s.refreshed) >= s.refresh {
+		s.load(ctx)
+		s.refreshed = now
+	}
+	next := map[string]time.Time{}
+	for _, e := range s.schedules {
+		k := key(e.Schedule)
+		due, ok := s.next[k]
+		if ok && !now.Before(due) {
+			s.run(ctx, e.Schedule, due)
+		}
+		if !ok || !now.Before(due) {
+			due = e.cron.Next(now)
+		}
+		next[k] = due
+	}
+	s.next = next
+}
+
+// load reads the schedules, if the configuration can't be read, the previous
+// schedules are kept.
+func (s *Scheduler) load(ctx context.Context) {
+	cfg, err := s.source.Config(ctx)
+	if err != nil {
+		s.log.Errorf("error reading the schedule configuration: %s", err)
+		return
+	}
+	schedules := append([]Schedule{}, cfg.Schedules...)
+	for _, r := range cfg.Repositories {
+		runner, err := s.runner(r.Driver)
+		if err != nil {
+			s.log.Errorw("error reading schedules", "repo", r.Repo, "error", err)
+			continue
+		}
+		declared, err := runner.Schedules(ctx, r.Repo)
+		if err != nil {
+			s.log.Errorw("error reading schedules", "repo", r.Repo, "error", err)
+			continue
+		}
+		for _, d := range declared {
+			d.Driver = r.Driver
+			schedules = append(schedules, d)
+		}
+	}
+	entries := []entry{}
+	for _, sc := range schedules {
+		c, err := cron.ParseStandard(sc.Cron)
+		if err != nil {
+			s.log.Errorw("invalid schedule", "repo", sc.Repo, "schedule", sc.Name, "error", err)
+			continue
+		}
+		entries = append(entries, entry{Schedule: sc, cron: c})
+	}
+	s.schedules = entries
+}
+
+func (s *Scheduler) run(ctx context.Context, sc Schedule, due time.Time) {
+	logItems := []interface{}{"repo", sc.Repo, "schedule", sc.Name, "due", due}
+	runner, err := s.runner(sc.Driver)
+	if err != nil {
+		s.log.Errorw("error running schedule", append(logItems, "error", err)...)
+		return
+	}
+	pr, err := runner.RunSchedule(ctx, sc, runID(sc, due))
+	if err != nil {
+		s.log.Errorw("error running schedule", append(logItems, "error", err)...)
+		return
+	}
+	if pr == nil {
+		s.log.Infow("no PipelineRun created for schedule", logItems...)
+		return
+	}
+	s.log.Infow("created PipelineRun for schedule", append(logItems, "pipelinerun", pr.ObjectMeta.Name)...)
+}
+
+func (s *Scheduler) runner(driver string) (Runner, error) {
+	if driver == "" {
+		driver = s.def
+	}
+	r, ok := s.runners[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown driver %q", driver)
+	}
+	return r, nil
+}
+
+// key identifies a schedule, changing the branch or cron expression of a
+// schedule makes it a new schedule.
+func key(s Schedule) string {
+	return strings.Join([]string{s.Driver, s.Repo, s.Name, s.Branch, s.Cron}, "\x00")
+}
+
+// runID returns the hook ID for the run of the schedule that's due at the
+// time, this is the same for every replica of the http command, so that
+// PipelineRuns already created for the run are found.
+func runID(s Schedule, due time.Time) string {
+	h := sha256.Sum256([]byte(key(s)))
+	return fmt.Sprintf("schedule-%s-%d", hex.EncodeToString(h[:8]), due.Unix())
+}
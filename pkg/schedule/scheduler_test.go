@@ -0,0 +1,185 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testNS = "testing"
+
+var testTime = time.Date(2020, time.November, 1, 1, 59, 30, 0, time.UTC)
+
+func TestSchedulerRunsDueSchedules(t *testing.T) {
+	runner := newMockRunner()
+	s := makeScheduler(t, staticSource{Schedules: []Schedule{
+		{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"},
+		{Name: "hourly", Repo: "my-org/other-repo", Cron: "@hourly"},
+	}}, runner)
+
+	s.check(context.TODO(), testTime)
+	s.check(context.TODO(), testTime.Add(time.Minute))
+	s.check(context.TODO(), testTime.Add(time.Minute*2))
+
+	want := []string{
+		"my-org/my-repo/nightly@2020-11-01T02:00:00Z",
+		"my-org/other-repo/hourly@2020-11-01T02:00:00Z",
+	}
+	if diff := cmp.Diff(want, runner.runs); diff != "" {
+		t.Fatalf("runs don't match:\n%s", diff)
+	}
+}
+
+func TestSchedulerDoesNotRunNewSchedulesUntilTheyAreDue(t *testing.T) {
+	runner := newMockRunner()
+	s := makeScheduler(t, staticSource{Schedules: []Schedule{
+		{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"},
+	}}, runner)
+
+	s.check(context.TODO(), testTime.Add(time.Minute))
+
+	if len(runner.runs) != 0 {
+		t.Fatalf("got runs %v, want none", runner.runs)
+	}
+}
+
+func TestSchedulerWithDeclaredSchedules(t *testing.T) {
+	runner := newMockRunner()
+	runner.declared["my-org/my-repo"] = []Schedule{{Name: "declared", Repo: "my-org/my-repo", Cron: "0 2 * * *"}}
+	gitlab := newMockRunner()
+	gitlab.declared["my-org/my-repo"] = []Schedule{{Name: "other-declared", Repo: "my-org/my-repo", Cron: "0 2 * * *"}}
+	s := makeScheduler(t, staticSource{Repositories: []Repository{
+		{Repo: "my-org/my-repo"},
+		{Repo: "my-org/my-repo", Driver: "gitlab"},
+		{Repo: "my-org/unknown", Driver: "unknown"},
+	}}, runner)
+	s.runners["gitlab"] = gitlab
+
+	s.check(context.TODO(), testTime)
+	s.check(context.TODO(), testTime.Add(time.Minute))
+
+	if diff := cmp.Diff([]string{"my-org/my-repo/declared@2020-11-01T02:00:00Z"}, runner.runs); diff != "" {
+		t.Fatalf("runs don't match:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"my-org/my-repo/other-declared@2020-11-01T02:00:00Z"}, gitlab.runs); diff != "" {
+		t.Fatalf("gitlab runs don't match:\n%s", diff)
+	}
+}
+
+func TestSchedulerRefreshesSchedules(t *testing.T) {
+	runner := newMockRunner()
+	source := &staticSource{Schedules: []Schedule{{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"}}}
+	s := makeScheduler(t, source, runner)
+
+	s.check(context.TODO(), testTime)
+	source.Schedules = []Schedule{{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 3 * * *"}}
+	s.check(context.TODO(), testTime.Add(time.Minute*5))
+	s.check(context.TODO(), testTime.Add(time.Hour+time.Minute))
+
+	if diff := cmp.Diff([]string{"my-org/my-repo/nightly@2020-11-01T03:00:00Z"}, runner.runs); diff != "" {
+		t.Fatalf("runs don't match:\n%s", diff)
+	}
+}
+
+func TestSchedulerKeepsSchedulesWhenTheConfigurationFails(t *testing.T) {
+	runner := newMockRunner()
+	source := &staticSource{Schedules: []Schedule{{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"}}}
+	s := makeScheduler(t, source, runner)
+
+	s.check(context.TODO(), testTime)
+	source.err = errors.New("failed")
+	s.check(context.TODO(), testTime.Add(time.Minute*5))
+
+	if diff := cmp.Diff([]string{"my-org/my-repo/nightly@2020-11-01T02:00:00Z"}, runner.runs); diff != "" {
+		t.Fatalf("runs don't match:\n%s", diff)
+	}
+}
+
+func TestSchedulerSkipsInvalidSchedules(t *testing.T) {
+	runner := newMockRunner()
+	s := makeScheduler(t, staticSource{Schedules: []Schedule{
+		{Name: "invalid", Repo: "my-org/my-repo", Cron: "every day"},
+		{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"},
+	}}, runner)
+
+	s.check(context.TODO(), testTime)
+	s.check(context.TODO(), testTime.Add(time.Minute))
+
+	if diff := cmp.Diff([]string{"my-org/my-repo/nightly@2020-11-01T02:00:00Z"}, runner.runs); diff != "" {
+		t.Fatalf("runs don't match:\n%s", diff)
+	}
+}
+
+func TestRunID(t *testing.T) {
+	nightly := Schedule{Name: "nightly", Repo: "my-org/my-repo", Cron: "0 2 * * *"}
+	due := time.Date(2020, time.November, 1, 2, 0, 0, 0, time.UTC)
+
+	id := runID(nightly, due)
+
+	if id != runID(nightly, due) {
+		t.Fatal("run IDs are not stable")
+	}
+	for _, other := range []string{
+		runID(nightly, due.Add(time.Hour*24)),
+		runID(Schedule{Name: "nightly", Repo: "my-org/other-repo", Cron: "0 2 * * *"}, due),
+	} {
+		if id == other {
+			t.Fatalf("got the same run ID %s for different runs", id)
+		}
+	}
+	if l := len(id); l > 63 {
+		t.Fatalf("run ID %s is too long for a label value: %d", id, l)
+	}
+}
+
+func makeScheduler(t *testing.T, s Source, r Runner) *Scheduler {
+	t.Helper()
+	return New(s, "github", map[string]Runner{"github": r}, time.Minute*5, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+}
+
+type staticSource struct {
+	Schedules    []Schedule
+	Repositories []Repository
+	err          error
+}
+
+func (s staticSource) Config(ctx context.Context) (*Config, error) {
+	return &Config{Schedules: s.Schedules, Repositories: s.Repositories}, s.err
+}
+
+type mockRunner struct {
+	declared map[string][]Schedule
+	runs     []string
+}
+
+func newMockRunner() *mockRunner {
+	return &mockRunner{declared: map[string][]Schedule{}}
+}
+
+func (m *mockRunner) Schedules(ctx context.Context, repo string) ([]Schedule, error) {
+	return m.declared[repo], nil
+}
+
+func (m *mockRunner) RunSchedule(ctx context.Context, s Schedule, id string) (*pipelinev1.PipelineRun, error) {
+	m.runs = append(m.runs, fmt.Sprintf("%s/%s@%s", s.Repo, s.Name, dueFromID(id)))
+	return &pipelinev1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: id}}, nil
+}
+
+// dueFromID returns the due time from a run ID, formatted as RFC3339.
+func dueFromID(id string) string {
+	n, err := strconv.ParseInt(id[strings.LastIndex(id, "-")+1:], 10, 64)
+	if err != nil {
+		return err.Error()
+	}
+	return time.Unix(n, 0).UTC().Format(time.RFC3339)
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/jenkins-x/go-scm/scm"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
 )
 
 // DefaultName is the name that is used for comparing GitHub hooks.
@@ -17,15 +19,18 @@ const DefaultName = "tekton-ci-hook-secrets"
 type KubeSecretGetter struct {
 	coreClient kubernetes.Interface
 	name       string
-	namespace  string
+	router     routing.Router
 }
 
 // New creates and returns a KubeSecretGetter that looks up the hook secret as a
 // key in a known v1.Secret.
-func New(ns, n string, c kubernetes.Interface) *KubeSecretGetter {
+//
+// The v1.Secret is looked up in the namespace that the hook's repository is
+// routed to, if the route references a webhook secret, that is used instead.
+func New(r routing.Router, n string, c kubernetes.Interface) *KubeSecretGetter {
 	return &KubeSecretGetter{
 		name:       n,
-		namespace:  ns,
+		router:     r,
 		coreClient: c,
 	}
 }
@@ -33,15 +38,22 @@ func New(ns, n string, c kubernetes.Interface) *KubeSecretGetter {
 // Secret finds the secret to use to match against for the repo associated with
 // the provided hook, or returns an error.
 func (k KubeSecretGetter) Secret(ctx context.Context, hook scm.Webhook) (string, error) {
-	secret, err := k.coreClient.CoreV1().Secrets(k.namespace).Get(ctx, k.name, metav1.GetOptions{})
+	fullName := hook.Repository().FullName
+	route, err := k.router.Route(ctx, fullName)
+	if err != nil {
+		return "", err
+	}
+	name, keyName := k.name, fullNameToKey(fullName)
+	if ref := route.WebhookSecretRef; ref != nil {
+		name, keyName = ref.Name, ref.Key
+	}
+	secret, err := k.coreClient.CoreV1().Secrets(route.Namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
-	fullName := hook.Repository().FullName
-	keyName := fullNameToKey(fullName)
 	token, ok := secret.Data[keyName]
 	if !ok {
-		return "", fmt.Errorf("no secret for repository %s, looked for %s in %s", fullName, keyName, k.name)
+		return "", fmt.Errorf("no secret for repository %s, looked for %s in %s", fullName, keyName, name)
 	}
 	return string(token), nil
 }
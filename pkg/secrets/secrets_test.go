@@ -6,6 +6,8 @@ import (
 
 	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/gitops-tools/tekton-ci/pkg/apis/ci/v1alpha1"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
 	"github.com/gitops-tools/tekton-ci/test/hook"
 	"github.com/gitops-tools/tekton-ci/test/secret"
 )
@@ -15,7 +17,7 @@ var _ SecretGetter = (*KubeSecretGetter)(nil)
 func TestSecretForKnownRepository(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset(secret.Create("Codertocat_Hello-World"))
 	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
-	g := New("testing", "tekton-ci-auth", fakeClient)
+	g := New(routing.NewStatic(routing.Route{Namespace: "testing"}), "tekton-ci-auth", fakeClient)
 
 	secret, err := g.Secret(context.TODO(), hook)
 	if err != nil {
@@ -30,7 +32,7 @@ func TestSecretForKnownRepository(t *testing.T) {
 func TestSecretWithMissingSecret(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset()
 	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
-	g := New("testing", "tekton-ci-auth", fakeClient)
+	g := New(routing.NewStatic(routing.Route{Namespace: "testing"}), "tekton-ci-auth", fakeClient)
 
 	_, err := g.Secret(context.TODO(), hook)
 	if err.Error() != `secrets "tekton-ci-auth" not found` {
@@ -41,10 +43,39 @@ func TestSecretWithMissingSecret(t *testing.T) {
 func TestSecretForUnknownRepository(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset(secret.Create("my-org_hello-world"))
 	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
-	g := New("testing", "tekton-ci-auth", fakeClient)
+	g := New(routing.NewStatic(routing.Route{Namespace: "testing"}), "tekton-ci-auth", fakeClient)
 
 	_, err := g.Secret(context.TODO(), hook)
 	if err.Error() != "no secret for repository Codertocat/Hello-World, looked for Codertocat_Hello-World in tekton-ci-auth" {
 		t.Fatal(err)
 	}
 }
+
+func TestSecretForRoutedRepository(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(secret.Create("Codertocat_Hello-World"))
+	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
+	g := New(routing.NewStatic(routing.Route{Namespace: "other-ns"}), "tekton-ci-auth", fakeClient)
+
+	_, err := g.Secret(context.TODO(), hook)
+	if err.Error() != `secrets "tekton-ci-auth" not found` {
+		t.Fatal(err)
+	}
+}
+
+func TestSecretWithWebhookSecretRef(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(secret.Create("hook-secret"))
+	hook := hook.MakeHookFromFixture(t, "../testdata/github_push.json", "push")
+	g := New(routing.NewStatic(routing.Route{
+		Namespace:        "testing",
+		WebhookSecretRef: &v1alpha1.SecretKeyReference{Name: "tekton-ci-auth", Key: "hook-secret"},
+	}), DefaultName, fakeClient)
+
+	secret, err := g.Secret(context.TODO(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret != "secret-token" {
+		t.Fatalf("got %s, want secret-token", secret)
+	}
+}
@@ -6,112 +6,317 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/jenkins-x/go-scm/scm"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
 	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
 	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
 )
 
 const (
-	pullRequestFilename      = ".tekton/pull_request.yaml"
-	pushFilename             = ".tekton/push.yaml"
+	// PullRequestFilename is the path to the definition for pull requests.
+	PullRequestFilename = ".tekton/pull_request.yaml"
+	// PushFilename is the path to the definition for pushes.
+	PushFilename             = ".tekton/push.yaml"
 	defaultPipelineRunPrefix = "test-pipelinerun-"
 )
 
 // Handler implements the http.Handler interface, it grabs pipeline
 // configurations from the incoming Hook's repository and attempts to generate a
 // PipelineRun from them.
+//
+// If the Handler has a queue, hooks are acknowledged once they're parsed, and
+// processed asynchronously.
 type Handler struct {
 	scmClient      git.SCM
 	log            logger.Logger
 	pipelineClient pipelineclientset.Interface
-	namespace      string
+	trustChecker   trust.Checker
+	router         routing.Router
+	m              metrics.Interface
+	queue          *queue.Queue
+	dedupe         *dedupe.Deduplicator
 }
 
 // New creates and returns a new Handler.
-func New(scmClient git.SCM, pipelineClient pipelineclientset.Interface, namespace string, l logger.Logger) *Handler {
+//
+// If the queue is nil, hooks are processed before responding.
+func New(scmClient git.SCM, pipelineClient pipelineclientset.Interface, trustChecker trust.Checker, router routing.Router, l logger.Logger, m metrics.Interface, q *queue.Queue) *Handler {
 	return &Handler{
 		scmClient:      scmClient,
 		pipelineClient: pipelineClient,
+		trustChecker:   trustChecker,
 		log:            l,
-		namespace:      namespace,
+		router:         router,
+		m:              m,
+		queue:          q,
+		dedupe:         dedupe.New(pipelineClient, dedupe.DefaultSize),
 	}
 }
 
 // ServeHTTP implements the http.Handler interface.
+//
+// Hooks that are ignored get a 204 No Content response, and errors are
+// returned as JSON with a status code for the reason.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "webhook")
+	defer span.End()
+	r = r.WithContext(ctx)
 	hook, err := h.scmClient.ParseWebhookRequest(r)
+	if scm.IsUnknownWebhook(err) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	if err != nil {
 		h.log.Errorf("error parsing webhook: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, git.HookID(r, nil), hookerrors.New(hookerrors.InvalidHook, err))
 		return
 	}
 
+	id := git.HookID(r, hook)
+	span.SetAttributes(label.String("hook.kind", string(hook.Kind())), label.String("hook.id", id))
+	var process func(context.Context) (*pipelinev1.PipelineRun, error)
 	switch evt := hook.(type) {
 	case *scm.PullRequestHook:
-		h.pullRequest(r.Context(), evt, w)
+		if !dsl.IsPullRequestBuild(evt) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		process = func(ctx context.Context) (*pipelinev1.PipelineRun, error) {
+			return h.pullRequest(ctx, evt, id)
+		}
 	case *scm.PushHook:
-		h.push(r.Context(), evt, w)
+		process = func(ctx context.Context) (*pipelinev1.PipelineRun, error) {
+			return h.push(ctx, evt, id)
+		}
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	process = h.timed(hook, span.SpanContext(), process)
+
+	if h.queue != nil {
+		existing, err := h.dedupe.Recent(r.Context(), id)
+		if err != nil {
+			h.log.Errorf("error finding existing pipelinerun for hook %s: %s", id, err)
+		}
+		if existing != nil {
+			h.writeJSON(w, existing)
+			return
+		}
+		err = h.queue.Add(id, func(ctx context.Context) error {
+			_, err := process(ctx)
+			return err
+		})
+		if err != nil {
+			h.log.Errorf("error queueing hook %s: %s", id, err)
+			h.writeError(w, id, hookerrors.New(hookerrors.Unavailable, err))
+			return
+		}
+		if err := queue.Accepted(w, id); err != nil {
+			h.log.Errorf("error writing response: %s", err)
+		}
+		return
+	}
+
+	created, err := process(r.Context())
+	if err != nil {
+		h.writeError(w, id, err)
+		return
+	}
+	if created == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, created)
+	h.log.Infow("completed request")
+}
+
+// timed records the time taken by the processing for the hook, in the
+// metrics and in a span that is a child of the span for the request.
+func (h *Handler) timed(hook scm.Webhook, parent trace.SpanContext, process func(context.Context) (*pipelinev1.PipelineRun, error)) func(context.Context) (*pipelinev1.PipelineRun, error) {
+	return func(ctx context.Context) (created *pipelinev1.PipelineRun, err error) {
+		ctx, span := tracing.Start(tracing.WithParent(ctx, parent), "process_hook")
+		start := time.Now()
+		defer func() {
+			h.m.ObserveHookDuration(hook, time.Since(start))
+			tracing.End(span, err)
+		}()
+		return process(ctx)
+	}
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, pr *pipelinev1.PipelineRun) {
+	b, err := json.Marshal(pr)
+	if err != nil {
+		h.log.Errorf("error marshaling response: %s", err)
+		h.writeError(w, "", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(b)
+	if err != nil {
+		h.log.Errorf("error writing response: %s", err)
+	}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, id string, err error) {
+	if err := hookerrors.Write(w, id, err); err != nil {
+		h.log.Errorf("error writing response: %s", err)
 	}
 }
 
 // TODO: refactor to remove the duplication.
-func (h *Handler) pullRequest(ctx context.Context, evt *scm.PullRequestHook, w http.ResponseWriter) {
+func (h *Handler) pullRequest(ctx context.Context, evt *scm.PullRequestHook, id string) (*pipelinev1.PipelineRun, error) {
 	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
-	h.handleEvent(ctx, repo, evt.PullRequest.Ref, pullRequestFilename, evt, w)
+	return h.handleEvent(ctx, repo, evt.PullRequest.Ref, PullRequestFilename, evt, id)
 }
 
-func (h *Handler) push(ctx context.Context, evt *scm.PushHook, w http.ResponseWriter) {
+func (h *Handler) push(ctx context.Context, evt *scm.PushHook, id string) (*pipelinev1.PipelineRun, error) {
 	repo := fmt.Sprintf("%s/%s", evt.Repo.Namespace, evt.Repo.Name)
-	h.handleEvent(ctx, repo, evt.Ref, pushFilename, evt, w)
+	return h.handleEvent(ctx, repo, evt.Ref, PushFilename, evt, id)
 }
 
-func (h *Handler) handleEvent(ctx context.Context, repo, ref, filename string, evt scm.Webhook, w http.ResponseWriter) {
+// handleEvent creates a PipelineRun from the definition in the repository,
+// if a PipelineRun was already created for the hook with the ID, it's
+// returned rather than creating another.
+//
+// The author of a pull request is only checked once the repository is known
+// to be routed to this handler.
+//
+// The result is recorded in the metrics, along with the reason if no
+// PipelineRun was created.
+func (h *Handler) handleEvent(ctx context.Context, repo, ref, filename string, evt scm.Webhook, id string) (created *pipelinev1.PipelineRun, err error) {
+	var skipped string
+	defer func() {
+		h.countConversion(repo, skipped, err)
+	}()
 	h.log.Infow(fmt.Sprintf("processing event '%T'", evt), "repo", repo)
+	route, err := h.router.Route(ctx, repo)
+	if err != nil {
+		h.log.Errorf("error finding route: %s", err)
+		return nil, hookerrors.Kubernetes(err)
+	}
+	if !route.Allows(routing.SpecHandler) {
+		h.log.Infow("repository is not routed to the spec handler", "repo", repo)
+		skipped = "not_routed"
+		return nil, nil
+	}
+	callCtx, done := h.kubernetesCall(ctx, "find_pipelinerun")
+	existing, err := h.dedupe.Find(callCtx, route.Namespace, id)
+	done(err)
+	if err != nil {
+		h.log.Errorf("error finding existing pipelinerun: %s", err)
+		return nil, hookerrors.Kubernetes(err)
+	}
+	if existing != nil {
+		h.log.Infow("pipelinerun already created for hook", "repo", repo, "id", id, "pipelinerun", existing.ObjectMeta.Name)
+		skipped = "duplicate"
+		return existing, nil
+	}
+	if pull, ok := evt.(*scm.PullRequestHook); ok {
+		result, err := h.trustChecker.Check(ctx, pull)
+		if err != nil {
+			h.log.Errorf("error checking pull request author: %s", err)
+			return nil, hookerrors.SCM(err)
+		}
+		switch result {
+		case trust.Held:
+			h.log.Infow("holding pull request from untrusted author", "repo", repo)
+			skipped = "held"
+			return nil, nil
+		case trust.Approved:
+			// The definition from untrusted authors is not used.
+			ref = pull.PullRequest.Target
+		}
+	}
 	content, err := h.scmClient.FileContents(ctx, repo, filename, ref)
 	if git.IsNotFound(err) {
 		h.log.Infof("no pipeline definition found in %s", repo)
-		return
+		skipped = "no_definition"
+		return nil, nil
 	}
 	if err != nil {
 		h.log.Errorf("error fetching pipeline file: %s", err)
-		// TODO: should this return a 404?
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, hookerrors.SCM(err)
 	}
 	parsed, err := Parse(bytes.NewReader(content))
 	if err != nil {
 		h.log.Errorf("error parsing pipeline definition: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, hookerrors.Definition(err)
 	}
+	_, celSpan := tracing.Start(ctx, "cel_evaluation")
 	pr, err := Execute(parsed, evt, defaultPipelineRunPrefix)
+	tracing.End(celSpan, err)
 	if err != nil {
 		h.log.Errorf("error executing pipeline definition: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, hookerrors.Definition(err)
+	}
+	// The service account from the definition takes precedence.
+	if pr.Spec.ServiceAccountName == "" {
+		pr.Spec.ServiceAccountName = route.ServiceAccountName
 	}
-	created, err := h.pipelineClient.TektonV1beta1().PipelineRuns(h.namespace).Create(ctx, pr, metav1.CreateOptions{})
+	dedupe.Mark(pr, id)
+	annotateSource(pr, evt, id)
+	callCtx, done = h.kubernetesCall(ctx, "create_pipelinerun")
+	tracing.Inject(callCtx, pr.ObjectMeta.Annotations)
+	created, err = h.pipelineClient.TektonV1beta1().PipelineRuns(route.Namespace).Create(callCtx, pr, metav1.CreateOptions{})
+	done(err)
 	if err != nil {
 		h.log.Errorf("error creating pipelinerun file: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, hookerrors.Kubernetes(err)
 	}
-	b, err := json.Marshal(created)
-	if err != nil {
-		h.log.Errorf("error marshaling response: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	h.dedupe.Created(id, created)
+	return created, nil
+}
+
+// annotateSource records the repository, commit and branch that the
+// PipelineRun was created for, in the same way as the DSL handler, so that
+// they can be reported on.
+func annotateSource(pr *pipelinev1.PipelineRun, evt scm.Webhook, id string) {
+	switch evt := evt.(type) {
+	case *scm.PushHook:
+		dsl.AnnotateSource(id, &dsl.Source{RepoURL: evt.Repo.Clone, Ref: evt.Commit.Sha, Branch: scm.TrimRef(evt.Ref)})(pr)
+	case *scm.PullRequestHook:
+		dsl.AnnotateSource(id, &dsl.Source{RepoURL: evt.Repo.Clone, Ref: evt.PullRequest.Sha, Branch: evt.PullRequest.Source})(pr)
+		dsl.AnnotatePullRequest(evt.PullRequest.Number)(pr)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write(b)
-	if err != nil {
-		h.log.Errorf("error writing response: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+}
+
+// countConversion records the result of converting a hook for the repo, if
+// skipped is not empty, it's the reason that no PipelineRun was created.
+func (h *Handler) countConversion(repo, skipped string, err error) {
+	switch {
+	case err != nil:
+		h.m.CountConversion(metrics.ConversionFailed, string(hookerrors.ReasonFor(err)), repo)
+	case skipped != "":
+		h.m.CountConversion(metrics.ConversionSkipped, skipped, repo)
+	default:
+		h.m.CountConversion(metrics.ConversionCreated, "", repo)
+	}
+}
+
+// kubernetesCall starts a span for the call to the Kubernetes API, and returns
+// a function that records the duration of the call, and ends the span.
+func (h *Handler) kubernetesCall(ctx context.Context, name string) (context.Context, func(error)) {
+	ctx, span := tracing.Start(ctx, name)
+	start := time.Now()
+	return ctx, func(err error) {
+		h.m.ObserveKubernetesCallDuration(name, time.Since(start))
+		tracing.End(span, err)
 	}
-	h.log.Infow("completed request")
 }
@@ -2,6 +2,7 @@ package spec
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -16,14 +17,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
 	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/hookerrors"
 	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/queue"
+	"github.com/gitops-tools/tekton-ci/pkg/routing"
 	"github.com/gitops-tools/tekton-ci/pkg/secrets"
+	"github.com/gitops-tools/tekton-ci/pkg/trust"
 	"github.com/gitops-tools/tekton-ci/test"
 )
 
 const testNS = "testing"
 
+var testRouter = routing.NewStatic(routing.Route{Namespace: testNS})
+
 func TestHandlePullRequestOpenedEvent(t *testing.T) {
 	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "testdata/content.json")
 	defer as.Close()
@@ -34,7 +42,7 @@ func TestHandlePullRequestOpenedEvent(t *testing.T) {
 	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
 	fakeKube := fakeclientset.NewSimpleClientset()
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	h := New(gitClient, fakeKube, testNS, logger.Sugar())
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), nil)
 	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
 	rec := httptest.NewRecorder()
 
@@ -65,10 +73,21 @@ func TestHandlePullRequestOpenedEvent(t *testing.T) {
 	if diff := cmp.Diff(want, pr.Spec.Params); diff != "" {
 		t.Fatalf("pipelinerun parameters incorrect, diff\n%s", diff)
 	}
+	wantAnnotations := map[string]string{
+		"tekton.dev/ci-source-url":    "https://github.com/Codertocat/Hello-World.git",
+		"tekton.dev/ci-source-ref":    "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+		"tekton.dev/ci-source-branch": "changes",
+		"tekton.dev/ci-pull-request":  "2",
+	}
+	for k, v := range wantAnnotations {
+		if a := pr.ObjectMeta.Annotations[k]; a != v {
+			t.Errorf("got annotation %s = %q, want %q", k, a, v)
+		}
+	}
 }
 
-func TestHandlePullRequestEventNoPipeline(t *testing.T) {
-	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "")
+func TestHandlePullRequestOpenedEventRedelivered(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "testdata/content.json")
 	defer as.Close()
 	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
 	if err != nil {
@@ -77,7 +96,8 @@ func TestHandlePullRequestEventNoPipeline(t *testing.T) {
 	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
 	fakeKube := fakeclientset.NewSimpleClientset()
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	h := New(gitClient, fakeKube, testNS, logger.Sugar())
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), nil)
+	h.ServeHTTP(httptest.NewRecorder(), test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request"))
 	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
 	rec := httptest.NewRecorder()
 
@@ -87,12 +107,244 @@ func TestHandlePullRequestEventNoPipeline(t *testing.T) {
 	if w.StatusCode != http.StatusOK {
 		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
 	}
+	existing := &pipelinev1.PipelineRun{}
+	if err := json.NewDecoder(w.Body).Decode(existing); err != nil {
+		t.Fatal(err)
+	}
+	if id := req.Header.Get("X-GitHub-Delivery"); existing.ObjectMeta.Annotations[dedupe.HookIDAnnotation] != id {
+		t.Fatalf("got PipelineRun for hook %q, want %q", existing.ObjectMeta.Annotations[dedupe.HookIDAnnotation], id)
+	}
+	runs, err := fakeKube.TektonV1beta1().PipelineRuns(testNS).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(runs.Items); l != 1 {
+		t.Fatalf("got %d PipelineRuns, want 1", l)
+	}
+}
+
+func TestHandlePullRequestOpenedEventWithQueue(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	q := queue.New(queue.Config{Workers: 1, Size: 1}, metrics.NewMock(), logger.Sugar())
+	q.Start()
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), q)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusAccepted {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusAccepted, mustReadBody(t, w))
+	}
+	if err := q.Shutdown(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlePullRequestEventNoPipeline(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
 	_, err = fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), defaultPipelineRunPrefix, metav1.GetOptions{})
 	if !errors.IsNotFound(err) {
 		t.Fatalf("pipelinerun was created when no pipeline definition exists")
 	}
 }
 
+func TestHandlePullRequestEventWithApprovedPullRequest(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "master", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Approved), testRouter, logger.Sugar(), metrics.NewMock(), nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	_, err = fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlePullRequestEventWithHeldPullRequest(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	m := metrics.NewMock()
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Held), testRouter, logger.Sugar(), m, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	_, err = fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a held pull request")
+	}
+	if c := m.Conversions(metrics.ConversionSkipped, "held", "Codertocat/Hello-World"); c != 1 {
+		t.Fatalf("got %d held conversions, want 1", c)
+	}
+}
+
+func TestHandlePullRequestEventWithRoute(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/pull_request.yaml", "refs/pull/2/head", "testdata/content.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	router := routing.NewStatic(routing.Route{Namespace: "routed-ns", ServiceAccountName: "routed-sa"})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), router, logger.Sugar(), metrics.NewMock(), nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusOK {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusOK, mustReadBody(t, w))
+	}
+	pr, err := fakeKube.TektonV1beta1().PipelineRuns("routed-ns").Get(context.TODO(), "", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa := pr.Spec.ServiceAccountName; sa != "routed-sa" {
+		t.Fatalf("got service account %s, want routed-sa", sa)
+	}
+}
+
+func TestHandlePullRequestEventWithRouteNotAllowingHandler(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	router := routing.NewStatic(routing.Route{Namespace: testNS, Handlers: []string{routing.DSLHandler}})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), router, logger.Sugar(), metrics.NewMock(), nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	_, err = fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a repository not routed to the spec handler")
+	}
+}
+
+func TestHandlePullRequestEventDoesNotCheckAuthorForUnroutedRepository(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	router := routing.NewStatic(routing.Route{Namespace: testNS, Handlers: []string{routing.DSLHandler}})
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	m := metrics.NewMock()
+	h := New(gitClient, fakeclientset.NewSimpleClientset(), trust.NewMock(trust.Held), router, logger.Sugar(), m, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	if c := m.Conversions(metrics.ConversionSkipped, "held", "Codertocat/Hello-World"); c != 0 {
+		t.Fatalf("got %d held conversions, want 0", c)
+	}
+	if c := m.Conversions(metrics.ConversionSkipped, "not_routed", "Codertocat/Hello-World"); c != 1 {
+		t.Fatalf("got %d not_routed conversions, want 1", c)
+	}
+}
+
+func TestHandlePullRequestEventIgnoresActionsThatAreNotBuilt(t *testing.T) {
+	scmClient, err := factory.NewClient("github", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	fakeKube := fakeclientset.NewSimpleClientset()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	m := metrics.NewMock()
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Held), testRouter, logger.Sugar(), m, nil)
+	req := test.MakeHookRequest(t, "../testdata/github_pull_request.json", "pull_request", func(b map[string]interface{}) {
+		b["action"] = "closed"
+	})
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusNoContent, mustReadBody(t, w))
+	}
+	if c := m.Conversions(metrics.ConversionSkipped, "held", "Codertocat/Hello-World"); c != 0 {
+		t.Fatalf("got %d held conversions, want 0", c)
+	}
+	_, err = fakeKube.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), "", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatal("pipelinerun was created for a closed pull request")
+	}
+}
+
 func TestHandlePushEvent(t *testing.T) {
 	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/push.yaml", "refs/tags/simple-tag", "testdata/push_content.json")
 	defer as.Close()
@@ -103,7 +355,7 @@ func TestHandlePushEvent(t *testing.T) {
 	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
 	fakeKube := fakeclientset.NewSimpleClientset()
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
-	h := New(gitClient, fakeKube, testNS, logger.Sugar())
+	h := New(gitClient, fakeKube, trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), nil)
 	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
 	rec := httptest.NewRecorder()
 
@@ -136,6 +388,34 @@ func TestHandlePushEvent(t *testing.T) {
 	}
 }
 
+func TestHandlePushEventWithInvalidDefinition(t *testing.T) {
+	as := test.MakeAPIServer(t, "/api/v3/repos/Codertocat/Hello-World/contents/.tekton/push.yaml", "refs/tags/simple-tag", "testdata/content_invalid.json")
+	defer as.Close()
+	scmClient, err := factory.NewClient("github", as.URL, "", factory.Client(as.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient := git.New(scmClient, secrets.NewMock(), metrics.NewMock())
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.FatalLevel))
+	h := New(gitClient, fakeclientset.NewSimpleClientset(), trust.NewMock(trust.Trusted), testRouter, logger.Sugar(), metrics.NewMock(), nil)
+	req := test.MakeHookRequest(t, "../testdata/github_push.json", "push")
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	w := rec.Result()
+	if w.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want %d: %s", w.StatusCode, http.StatusUnprocessableEntity, mustReadBody(t, w))
+	}
+	resp := hookerrors.Response{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if id := req.Header.Get("X-GitHub-Delivery"); resp.ID != id || resp.Reason != hookerrors.InvalidDefinition {
+		t.Fatalf("got error response %#v", resp)
+	}
+}
+
 func mustReadBody(t *testing.T, req *http.Response) []byte {
 	t.Helper()
 	b, err := ioutil.ReadAll(req.Body)
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/export/trace/tracetest"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceContextAnnotation is the annotation on PipelineRuns that records
+	// the W3C traceparent of the hook that created them.
+	TraceContextAnnotation = "tekton.dev/ci-trace-context"
+
+	tracerName  = "github.com/gitops-tools/tekton-ci"
+	traceparent = "traceparent"
+)
+
+// The supported exporters for spans.
+const (
+	NoExporter   = "none"
+	OTLPExporter = "otlp"
+)
+
+// Config configures the export of spans.
+type Config struct {
+	Exporter    string // One of "none" or "otlp".
+	Endpoint    string // The address of the OTLP collector e.g. localhost:55680.
+	Insecure    bool   // Connect to the collector without TLS.
+	ServiceName string
+}
+
+// NewProvider creates and returns a TracerProvider that exports spans as
+// configured.
+//
+// With the "none" exporter, no provider is returned, and the default global
+// provider doesn't record spans.
+func NewProvider(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	switch cfg.Exporter {
+	case NoExporter, "":
+		return nil, nil
+	case OTLPExporter:
+		opts := []otlp.ExporterOption{otlp.WithAddress(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlp.WithInsecure())
+		}
+		exporter, err := otlp.NewExporter(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+		}
+		res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(cfg.ServiceName)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the tracing resource: %w", err)
+		}
+		return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+	}
+	return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+}
+
+// NewInMemory creates and returns a TracerProvider that records every span
+// in memory, and the exporter to get the spans from, for tests.
+func NewInMemory() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.AlwaysSample()}),
+		sdktrace.WithSyncer(exporter)), exporter
+}
+
+// Start starts a span with the name from the global TracerProvider.
+func Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// WithParent returns a context with the span context as the remote parent,
+// for processing that outlives the span e.g. queued hooks.
+func WithParent(ctx context.Context, sc trace.SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// End records the error in the span if it's not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject records the span context from the context in the annotations.
+func Inject(ctx context.Context, annotations map[string]string) {
+	propagation.TraceContext{}.Inject(ctx, annotationCarrier(annotations))
+}
+
+// Extract returns a context with the span context recorded in the
+// annotations as the remote parent.
+func Extract(ctx context.Context, annotations map[string]string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, annotationCarrier(annotations))
+}
+
+// annotationCarrier stores the traceparent in the TraceContextAnnotation,
+// the tracestate is not recorded.
+type annotationCarrier map[string]string
+
+func (c annotationCarrier) Get(key string) string {
+	if key != traceparent {
+		return ""
+	}
+	return c[TraceContextAnnotation]
+}
+
+func (c annotationCarrier) Set(key, value string) {
+	if key != traceparent {
+		return
+	}
+	c[TraceContextAnnotation] = value
+}
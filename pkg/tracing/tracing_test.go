@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectAndExtract(t *testing.T) {
+	tp, _ := NewInMemory()
+	ctx, span := tp.Tracer("testing").Start(context.Background(), "test-span")
+	defer span.End()
+	annotations := map[string]string{}
+
+	Inject(ctx, annotations)
+
+	if annotations[TraceContextAnnotation] == "" {
+		t.Fatalf("trace context was not recorded: %#v", annotations)
+	}
+	extracted := trace.RemoteSpanContextFromContext(Extract(context.Background(), annotations))
+	if extracted.TraceID != span.SpanContext().TraceID || extracted.SpanID != span.SpanContext().SpanID {
+		t.Fatalf("got span context %#v, want %#v", extracted, span.SpanContext())
+	}
+}
+
+func TestExtractWithNoAnnotation(t *testing.T) {
+	extracted := trace.RemoteSpanContextFromContext(Extract(context.Background(), map[string]string{}))
+
+	if extracted.IsValid() {
+		t.Fatalf("got valid span context %#v", extracted)
+	}
+}
+
+func TestStartAndEnd(t *testing.T) {
+	tp, exporter := NewInMemory()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	_, span := Start(context.Background(), "failing")
+	End(span, errors.New("failed"))
+
+	spans := exporter.GetSpans()
+	if l := len(spans); l != 1 {
+		t.Fatalf("got %d spans, want 1", l)
+	}
+	if spans[0].Name != "failing" || spans[0].StatusCode != codes.Error {
+		t.Fatalf("got span %s with status %v", spans[0].Name, spans[0].StatusCode)
+	}
+}
+
+func TestWithParent(t *testing.T) {
+	tp, exporter := NewInMemory()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	_, parent := Start(context.Background(), "parent")
+	parent.End()
+
+	_, child := Start(WithParent(context.Background(), parent.SpanContext()), "child")
+	child.End()
+
+	spans := exporter.GetSpans()
+	if spans[1].ParentSpanID != parent.SpanContext().SpanID {
+		t.Fatalf("got parent %s, want %s", spans[1].ParentSpanID, parent.SpanContext().SpanID)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	tp, err := NewProvider(context.Background(), Config{Exporter: NoExporter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp != nil {
+		t.Fatalf("got provider %#v, want nil", tp)
+	}
+
+	_, err = NewProvider(context.Background(), Config{Exporter: "unknown"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,38 @@
+package trust
+
+import (
+	"context"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+// Result is the outcome of checking a pull request.
+type Result int
+
+const (
+	// Held pull requests are not processed until they are approved.
+	Held Result = iota
+	// Trusted pull requests are processed using the definition from the head
+	// of the pull request.
+	Trusted
+	// Approved pull requests have an untrusted author, but have been approved
+	// for testing by a maintainer, the definition from the base branch is
+	// used.
+	Approved
+)
+
+func (r Result) String() string {
+	switch r {
+	case Trusted:
+		return "Trusted"
+	case Approved:
+		return "Approved"
+	}
+	return "Held"
+}
+
+// Checker is implemented by values that can determine how a pull request
+// should be processed.
+type Checker interface {
+	Check(ctx context.Context, hook *scm.PullRequestHook) (Result, error)
+}
@@ -0,0 +1,23 @@
+package trust
+
+import (
+	"context"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+// NewMock returns a simple checker that returns a fixed result for all pull
+// requests.
+func NewMock(r Result) MockChecker {
+	return MockChecker{result: r}
+}
+
+// MockChecker implements the Checker interface.
+type MockChecker struct {
+	result Result
+}
+
+// Check implements the Checker interface.
+func (m MockChecker) Check(ctx context.Context, hook *scm.PullRequestHook) (Result, error) {
+	return m.result, nil
+}
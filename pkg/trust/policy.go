@@ -0,0 +1,91 @@
+package trust
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x/go-scm/scm"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+)
+
+const (
+	// ApprovalLabel is the label that maintainers add to a pull request to
+	// approve it for testing.
+	ApprovalLabel = "ok-to-test"
+
+	// This is used to find the existing comment on a held pull request, so
+	// that it's only posted once.
+	heldMarker = "<!-- tekton-ci:held -->"
+)
+
+// New creates and returns a new Policy.
+//
+// Users in the allowList are always trusted.
+func New(scmClient git.SCM, allowList []string) *Policy {
+	return &Policy{scmClient: scmClient, allowList: allowList}
+}
+
+// Policy implements the Checker interface.
+//
+// The authors of pull requests are trusted if they have write access to the
+// repository, or are members of the organisation that owns it.
+//
+// Pull requests from other authors are held until a maintainer approves them,
+// either by commenting "/ok-to-test" or by adding the ApprovalLabel.
+type Policy struct {
+	scmClient git.SCM
+	allowList []string
+}
+
+// Check implements the Checker interface.
+//
+// When a pull request is held, a comment is added to the pull request
+// explaining how to approve it.
+func (p *Policy) Check(ctx context.Context, hook *scm.PullRequestHook) (Result, error) {
+	repo := fmt.Sprintf("%s/%s", hook.Repo.Namespace, hook.Repo.Name)
+	trusted, err := p.isTrusted(ctx, repo, hook.PullRequest.Author.Login)
+	if err != nil {
+		return Held, err
+	}
+	if trusted {
+		return Trusted, nil
+	}
+	if hasLabel(hook.PullRequest.Labels, ApprovalLabel) {
+		return Approved, nil
+	}
+	body := fmt.Sprintf("%s\nThis pull request from @%s has not been tested. A maintainer can approve it for testing by commenting `/ok-to-test` or adding the `%s` label.",
+		heldMarker, hook.PullRequest.Author.Login, ApprovalLabel)
+	return Held, p.scmClient.CreateOrUpdateComment(ctx, repo, hook.PullRequest.Number, heldMarker, body)
+}
+
+func (p *Policy) isTrusted(ctx context.Context, repo, user string) (bool, error) {
+	for _, v := range p.allowList {
+		if v == user {
+			return true, nil
+		}
+	}
+	perm, err := p.scmClient.FindUserPermission(ctx, repo, user)
+	// Users who are not collaborators have no permission.
+	if err != nil && !git.IsNotFound(err) {
+		return false, err
+	}
+	if perm == "admin" || perm == "write" {
+		return true, nil
+	}
+	member, err := p.scmClient.IsOrgMember(ctx, repo, user)
+	// Without organisation membership, only collaborators are trusted.
+	if git.IsUnsupported(err) {
+		return false, nil
+	}
+	return member, err
+}
+
+func hasLabel(labels []*scm.Label, name string) bool {
+	for _, l := range labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
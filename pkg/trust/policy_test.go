@@ -0,0 +1,122 @@
+package trust
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/factory"
+
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+)
+
+var _ Checker = (*Policy)(nil)
+
+func TestCheck(t *testing.T) {
+	checkTests := []struct {
+		name       string
+		allowList  []string
+		permission string
+		member     bool
+		labels     []string
+		want       Result
+	}{
+		{"allow listed", []string{"contributor"}, "read", false, nil, Trusted},
+		{"write access", nil, "write", false, nil, Trusted},
+		{"admin access", nil, "admin", false, nil, Trusted},
+		{"org member", nil, "read", true, nil, Trusted},
+		{"approved", nil, "read", false, []string{"bug", ApprovalLabel}, Approved},
+		{"untrusted", nil, "read", false, []string{"bug"}, Held},
+	}
+
+	for _, tt := range checkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &stubSCM{permission: tt.permission, member: tt.member}
+			p := New(client, tt.allowList)
+
+			r, err := p.Check(context.TODO(), makeHook(tt.labels...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r != tt.want {
+				t.Fatalf("Check() got %s, want %s", r, tt.want)
+			}
+			if held := client.comment != ""; held != (r == Held) {
+				t.Fatalf("Check() commented %v, held %v", held, r == Held)
+			}
+		})
+	}
+}
+
+func TestCheckWithHeldPullRequestComment(t *testing.T) {
+	client := &stubSCM{permission: "read"}
+	p := New(client, nil)
+
+	_, err := p.Check(context.TODO(), makeHook())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(client.comment, heldMarker) {
+		t.Fatalf("comment does not start with the marker: %q", client.comment)
+	}
+	if !strings.Contains(client.comment, "`/ok-to-test`") {
+		t.Fatalf("comment does not explain how to approve: %q", client.comment)
+	}
+}
+
+func TestCheckWithUnsupportedOrgMembership(t *testing.T) {
+	bitbucket, err := factory.NewClient("bitbucket", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unsupported := git.New(bitbucket, nil, metrics.NewMock()).IsOrgMember(context.TODO(), "Codertocat/Hello-World", "contributor")
+	client := &stubSCM{permission: "read", memberErr: unsupported}
+	p := New(client, nil)
+
+	r, err := p.Check(context.TODO(), makeHook())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r != Held {
+		t.Fatalf("Check() got %s, want %s", r, Held)
+	}
+}
+
+func makeHook(labels ...string) *scm.PullRequestHook {
+	pr := scm.PullRequest{Number: 2, Author: scm.User{Login: "contributor"}}
+	for _, l := range labels {
+		pr.Labels = append(pr.Labels, &scm.Label{Name: l})
+	}
+	return &scm.PullRequestHook{
+		Action:      scm.ActionOpen,
+		Repo:        scm.Repository{Namespace: "Codertocat", Name: "Hello-World"},
+		PullRequest: pr,
+	}
+}
+
+// stubSCM implements the methods of git.SCM that are used by the Policy.
+type stubSCM struct {
+	git.SCM
+	permission string
+	member     bool
+	memberErr  error
+	comment    string
+}
+
+func (s *stubSCM) FindUserPermission(ctx context.Context, repo, user string) (string, error) {
+	return s.permission, nil
+}
+
+func (s *stubSCM) IsOrgMember(ctx context.Context, repo, user string) (bool, error) {
+	return s.member, s.memberErr
+}
+
+func (s *stubSCM) CreateOrUpdateComment(ctx context.Context, repo string, number int, marker, body string) error {
+	s.comment = body
+	return nil
+}
@@ -0,0 +1,82 @@
+package ui
+
+import "html/template"
+
+const layout = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tekton CI</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+a { color: #0366d6; text-decoration: none; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 1em 0.3em 0; }
+code { font-size: 0.9em; }
+.Succeeded { color: #22863a; }
+.Failed { color: #cb2431; }
+.Running { color: #dbab09; }
+.Pending { color: #6a737d; }
+.graph { display: flex; align-items: flex-start; }
+.level { display: flex; flex-direction: column; margin-right: 1em; }
+.task { border: 1px solid #ccc; border-radius: 4px; padding: 0.5em; margin-bottom: 1em; min-width: 12em; }
+.task ul { padding-left: 1.2em; margin: 0.5em 0 0 0; }
+</style>
+</head>
+<body>
+<h1><a href="/ui/">Tekton CI</a></h1>
+{{template "content" .}}
+</body>
+</html>{{end}}`
+
+var listTemplate = template.Must(template.Must(template.New("list").Parse(layout)).Parse(`{{define "content"}}
+{{range .}}
+<h2>{{.Repo}}{{if .Branch}} <small>{{.Branch}}</small>{{end}}</h2>
+<table>
+<tr><th>PipelineRun</th><th>Status</th><th>Commit</th><th>Pull Request</th><th>Created</th><th>Duration</th></tr>
+{{range .Runs}}
+<tr>
+<td><a href="/ui/pipelineruns/{{.Namespace}}/{{.Name}}">{{.Name}}</a></td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td><code>{{printf "%.7s" .SHA}}</code></td>
+<td>{{if .PullRequest}}#{{.PullRequest}}{{end}}</td>
+<td>{{.Created.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.Duration}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>There are no PipelineRuns.</p>
+{{end}}
+{{end}}{{template "layout" .}}`))
+
+var showTemplate = template.Must(template.Must(template.New("show").Parse(layout)).Parse(`{{define "content"}}
+<h2>{{.Name}} <span class="{{.Status}}">{{.Status}}</span></h2>
+<table>
+<tr><th>Repository</th><td>{{if .RepoURL}}<a href="{{.RepoURL}}">{{.Repo}}</a>{{else}}{{.Repo}}{{end}}</td></tr>
+{{if .Branch}}<tr><th>Branch</th><td>{{.Branch}}</td></tr>{{end}}
+{{if .SHA}}<tr><th>Commit</th><td><code>{{.SHA}}</code></td></tr>{{end}}
+{{if .PullRequest}}<tr><th>Pull Request</th><td>#{{.PullRequest}}</td></tr>{{end}}
+{{if .HookID}}<tr><th>Hook</th><td><code>{{.HookID}}</code></td></tr>{{end}}
+<tr><th>Namespace</th><td>{{.Namespace}}</td></tr>
+<tr><th>Duration</th><td>{{.Duration}}</td></tr>
+{{if .Message}}<tr><th>Message</th><td>{{.Message}}</td></tr>{{end}}
+</table>
+<div class="graph">
+{{range .Levels}}
+<div class="level">
+{{range .}}
+<div class="task">
+<strong>{{.Name}}</strong><br>
+<span class="{{.Status}}">{{.Status}}</span> {{.Duration}}
+{{if .Steps}}
+<ul>
+{{range .Steps}}<li><a href="{{.LogURL}}" class="{{.Status}}">{{.Name}}</a></li>{{end}}
+</ul>
+{{end}}
+</div>
+{{end}}
+</div>
+{{end}}
+</div>
+{{end}}{{template "layout" .}}`))
@@ -0,0 +1,225 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labelsv1 "k8s.io/apimachinery/pkg/labels"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+)
+
+// Path is the path that the Handler serves the UI under.
+const Path = "/ui"
+
+// The most recent PipelineRuns are listed.
+const maxRuns = 100
+
+// PipelineRunURL returns the URL of the page for a PipelineRun in the UI
+// served from the baseURL, e.g. for the target URL of commit-statuses.
+func PipelineRunURL(baseURL, namespace, name string) string {
+	return fmt.Sprintf("%s%s/pipelineruns/%s/%s", strings.TrimSuffix(baseURL, "/"), Path, namespace, name)
+}
+
+// Handler implements the http.Handler interface, it serves a read-only UI for
+// the PipelineRuns created by tekton-ci.
+//
+//	GET /ui/                                               lists recent PipelineRuns
+//	GET /ui/pipelineruns/{namespace}/{name}                shows a PipelineRun
+//	GET /ui/pipelineruns/{namespace}/{name}/logs/{task}/{step} streams the logs for a step
+//
+// If the logs for a PipelineRun were archived, and the PipelineRun has been
+// deleted, its pages serve the archived logs.
+type Handler struct {
+	tektonClient pipelineclientset.Interface
+	logs         logs.Streamer
+	archive      *logs.Archive
+	namespace    string
+	log          logger.Logger
+}
+
+// New creates and returns a new Handler, which serves the PipelineRuns in the
+// namespace, which can be metav1.NamespaceAll.
+//
+// The archive is optional.
+func New(tektonClient pipelineclientset.Interface, s logs.Streamer, a *logs.Archive, namespace string, l logger.Logger) *Handler {
+	return &Handler{tektonClient: tektonClient, logs: s, archive: a, namespace: namespace, log: l}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), Path), "/")
+	parts := strings.Split(path, "/")
+	for i := range parts {
+		p, err := url.PathUnescape(parts[i])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		parts[i] = p
+	}
+	switch {
+	case path == "":
+		h.list(w, r)
+	case len(parts) == 3 && parts[0] == "pipelineruns":
+		h.show(w, r, parts[1], parts[2])
+	case len(parts) == 6 && parts[0] == "pipelineruns" && parts[3] == "logs":
+		h.streamLogs(w, r, parts[1], parts[2], parts[4], parts[5])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	prs, err := h.tektonClient.TektonV1beta1().PipelineRuns(h.namespace).List(r.Context(), metav1.ListOptions{
+		LabelSelector: labelsv1.Set(partOfLabels).AsSelector().String(),
+	})
+	if err != nil {
+		h.log.Errorf("error listing PipelineRuns: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := prs.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ObjectMeta.CreationTimestamp.After(items[j].ObjectMeta.CreationTimestamp.Time)
+	})
+	if len(items) > maxRuns {
+		items = items[:maxRuns]
+	}
+	h.render(w, listTemplate, groupRuns(items))
+}
+
+func (h *Handler) show(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	pr, ok := h.getPipelineRun(w, r, namespace, name)
+	if !ok {
+		return
+	}
+	h.render(w, showTemplate, describe(pr, Path))
+}
+
+// streamLogs copies the logs for the step to the response until the step
+// exits, or the request is cancelled.
+func (h *Handler) streamLogs(w http.ResponseWriter, r *http.Request, namespace, name, task, step string) {
+	pr, ok := h.getPipelineRun(w, r, namespace, name)
+	if !ok {
+		return
+	}
+	pod, container := findStep(pr, task, step)
+	if pod == "" {
+		http.NotFound(w, r)
+		return
+	}
+	rc, err := h.logs.Stream(r.Context(), namespace, pod, container, true)
+	if err != nil {
+		h.log.Errorf("error streaming logs for %s/%s: %s", namespace, pod, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(flushWriter{w}, rc); err != nil {
+		h.log.Infow("log stream ended", "pod", pod, "container", container, "error", err)
+	}
+}
+
+// getPipelineRun writes an error response if the PipelineRun can't be found,
+// or it wasn't created by tekton-ci.
+//
+// Deleted PipelineRuns serve their archived logs, if they were archived.
+func (h *Handler) getPipelineRun(w http.ResponseWriter, r *http.Request, namespace, name string) (*pipelinev1.PipelineRun, bool) {
+	if h.namespace != metav1.NamespaceAll && namespace != h.namespace {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	pr, err := h.tektonClient.TektonV1beta1().PipelineRuns(namespace).Get(r.Context(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		h.deleted(w, r, namespace, name)
+		return nil, false
+	}
+	if err != nil {
+		h.log.Errorf("error getting PipelineRun %s/%s: %s", namespace, name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !labelsv1.SelectorFromSet(partOfLabels).Matches(labelsv1.Set(pr.ObjectMeta.Labels)) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return pr, true
+}
+
+// deleted serves the archived logs for a PipelineRun that has been deleted,
+// or responds with a 404 if the logs weren't archived.
+func (h *Handler) deleted(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if h.archive == nil {
+		http.NotFound(w, r)
+		return
+	}
+	rc, err := h.archive.Open(r.Context(), namespace, name)
+	if err != nil {
+		if err != logs.ErrNotArchived {
+			h.log.Errorf("error opening archived logs for %s/%s: %s", namespace, name, err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(flushWriter{w}, rc); err != nil {
+		h.log.Infow("archived log stream ended", "namespace", namespace, "name", name, "error", err)
+	}
+}
+
+func (h *Handler) render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		h.log.Errorf("error rendering %s: %s", t.Name(), err)
+	}
+}
+
+// findStep returns the pod and container that executed the step in the task,
+// or empty strings if the step hasn't started.
+func findStep(pr *pipelinev1.PipelineRun, task, step string) (string, string) {
+	for _, tr := range pr.Status.TaskRuns {
+		if tr.PipelineTaskName != task || tr.Status == nil || tr.Status.PodName == "" {
+			continue
+		}
+		for _, s := range tr.Status.Steps {
+			if s.Name == step {
+				return tr.Status.PodName, s.ContainerName
+			}
+		}
+	}
+	return "", ""
+}
+
+var partOfLabels = map[string]string{"app.kubernetes.io/part-of": "Tekton-CI"}
+
+// flushWriter flushes each write, so that logs are streamed to the client.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,264 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"gocloud.dev/blob/memblob"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+	"github.com/gitops-tools/tekton-ci/pkg/resources"
+)
+
+const (
+	testNS  = "testing"
+	testSHA = "ec26c3e57ca3a959ca5aad62de7213c562f8c821"
+)
+
+var testTime = time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+func TestPipelineRunURL(t *testing.T) {
+	u := PipelineRunURL("https://ci.example.com/", testNS, "my-pipeline-run")
+
+	if u != "https://ci.example.com/ui/pipelineruns/testing/my-pipeline-run" {
+		t.Fatalf("got %s", u)
+	}
+}
+
+func TestHandlerListsPipelineRuns(t *testing.T) {
+	h := makeHandler(t, logs.NewMock(),
+		makePipelineRun("run-1", "https://github.com/org/repo.git", "main", 0),
+		makePipelineRun("run-2", "https://github.com/org/repo.git", "main", time.Minute),
+		makePipelineRun("run-3", "https://github.com/org/repo.git", "feature", 0),
+		makePipelineRun("run-4", "https://gitlab.com/group/sub/other.git", "main", 0))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	assertInOrder(t, body, "group/sub/other", "run-4", "org/repo", "feature", "run-3", "org/repo", "main", "run-2", "run-1")
+}
+
+func TestGroupRuns(t *testing.T) {
+	unknown := makePipelineRun("run-3", "", "", 0)
+	groups := groupRuns([]pipelinev1.PipelineRun{
+		*makePipelineRun("run-1", "https://github.com/org/repo.git", "main", 0),
+		*makePipelineRun("run-2", "https://github.com/org/repo.git", "main", time.Minute),
+		*unknown,
+	})
+
+	got := []string{}
+	for _, g := range groups {
+		for _, r := range g.Runs {
+			got = append(got, g.Repo+" "+g.Branch+" "+r.Name)
+		}
+	}
+	want := []string{"(unknown)  run-3", "org/repo main run-2", "org/repo main run-1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("groupRuns() failed:\n%s", diff)
+	}
+}
+
+func TestHandlerShowsPipelineRuns(t *testing.T) {
+	h := makeHandler(t, logs.NewMock(), makeCompletedPipelineRun())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	assertInOrder(t, rec.Body.String(), "run-1", "Failed", "org/repo", testSHA,
+		"git-clone", "Succeeded", "10s", "/ui/pipelineruns/testing/run-1/logs/git-clone/clone",
+		"test-stage-test", "Failed", "1m0s", "/ui/pipelineruns/testing/run-1/logs/test-stage-test/unnamed-0")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerOnlyShowsTektonCIPipelineRuns(t *testing.T) {
+	pr := makeCompletedPipelineRun()
+	pr.ObjectMeta.Labels = map[string]string{}
+	h := makeHandler(t, logs.NewMock(), pr)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-1", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerStreamsLogs(t *testing.T) {
+	m := logs.NewMock()
+	m.AddLogs(testNS, "run-1-test-pod", "step-unnamed-0", "--- FAIL: TestSomething\n")
+	h := makeHandler(t, m, makeCompletedPipelineRun())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-1/logs/test-stage-test/unnamed-0", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if b := rec.Body.String(); b != "--- FAIL: TestSomething\n" {
+		t.Fatalf("got logs %q", b)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-1/logs/test-stage-test/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerServesArchivedLogsForDeletedPipelineRuns(t *testing.T) {
+	m := logs.NewMock()
+	m.AddLogs(testNS, "run-1-test-pod", "step-unnamed-0", "--- FAIL: TestSomething\n")
+	h := makeHandler(t, m)
+	h.archive = logs.NewArchive(memblob.OpenBucket(nil), "mem://")
+	if _, err := h.archive.Save(context.TODO(), logs.NewWriter(h.tektonClient, m), makeCompletedPipelineRun()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if b := rec.Body.String(); !strings.Contains(b, "--- FAIL: TestSomething") {
+		t.Fatalf("got body %q", b)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/pipelineruns/testing/run-2", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	tasks := []pipelinev1.PipelineTask{
+		{Name: "git-clone"},
+		{Name: "lint", RunAfter: []string{"git-clone"}},
+		{Name: "test", RunAfter: []string{"git-clone"}},
+		{Name: "build", RunAfter: []string{"lint", "test"}},
+		{Name: "notify", RunAfter: []string{"git-clone"}},
+	}
+	nodes := map[string]*taskNode{}
+	for _, t := range tasks {
+		nodes[t.Name] = &taskNode{Name: t.Name}
+	}
+
+	got := [][]string{}
+	for _, level := range levels(tasks, nodes) {
+		names := []string{}
+		for _, n := range level {
+			names = append(names, n.Name)
+		}
+		got = append(got, names)
+	}
+
+	want := [][]string{{"git-clone"}, {"lint", "test", "notify"}, {"build"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("levels() failed:\n%s", diff)
+	}
+}
+
+func makeHandler(t *testing.T, s logs.Streamer, prs ...*pipelinev1.PipelineRun) *Handler {
+	t.Helper()
+	client := fakeclientset.NewSimpleClientset()
+	for _, pr := range prs {
+		if err := client.Tracker().Add(pr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(client, s, nil, testNS, zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+}
+
+func makePipelineRun(name, repoURL, branch string, offset time.Duration) *pipelinev1.PipelineRun {
+	pr := resources.PipelineRun("dsl", "", pipelinev1.PipelineRunSpec{},
+		dsl.AnnotateSource("test-id", &dsl.Source{RepoURL: repoURL, Ref: testSHA, Branch: branch}))
+	pr.ObjectMeta.Name = name
+	pr.ObjectMeta.Namespace = testNS
+	pr.ObjectMeta.CreationTimestamp = metav1.NewTime(testTime.Add(offset))
+	return pr
+}
+
+func makeCompletedPipelineRun() *pipelinev1.PipelineRun {
+	pr := makePipelineRun("run-1", "https://github.com/org/repo.git", "main", 0)
+	pr.Spec.PipelineSpec = &pipelinev1.PipelineSpec{
+		Tasks: []pipelinev1.PipelineTask{
+			{Name: "git-clone"},
+			{Name: "test-stage-test", RunAfter: []string{"git-clone"}},
+		},
+	}
+	pr.Status.Conditions = duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse}}
+	pr.Status.TaskRuns = map[string]*pipelinev1.PipelineRunTaskRunStatus{
+		"run-1-git-clone": taskRun("git-clone", "run-1-clone-pod", testTime, time.Second*10, corev1.ConditionTrue, "clone"),
+		"run-1-test":      taskRun("test-stage-test", "run-1-test-pod", testTime.Add(time.Second*10), time.Minute, corev1.ConditionFalse, "unnamed-0"),
+	}
+	return pr
+}
+
+func taskRun(name, pod string, start time.Time, d time.Duration, s corev1.ConditionStatus, step string) *pipelinev1.PipelineRunTaskRunStatus {
+	exitCode := int32(0)
+	if s == corev1.ConditionFalse {
+		exitCode = 1
+	}
+	return &pipelinev1.PipelineRunTaskRunStatus{
+		PipelineTaskName: name,
+		Status: &pipelinev1.TaskRunStatus{
+			Status: duckv1beta1.Status{
+				Conditions: duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: s}},
+			},
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				PodName:        pod,
+				StartTime:      &metav1.Time{Time: start},
+				CompletionTime: &metav1.Time{Time: start.Add(d)},
+				Steps: []pipelinev1.StepState{
+					{
+						Name:          step,
+						ContainerName: "step-" + step,
+						ContainerState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// assertInOrder fails if the strings don't appear in the body in order.
+func assertInOrder(t *testing.T, body string, want ...string) {
+	t.Helper()
+	rest := body
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i == -1 {
+			t.Fatalf("%q not found in order in:\n%s", w, body)
+		}
+		rest = rest[i+len(w):]
+	}
+}
@@ -0,0 +1,269 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+)
+
+const (
+	sourceURLAnnotation    = "tekton.dev/ci-source-url"
+	sourceRefAnnotation    = "tekton.dev/ci-source-ref"
+	sourceBranchAnnotation = "tekton.dev/ci-source-branch"
+	pullRequestAnnotation  = "tekton.dev/ci-pull-request"
+
+	unknownRepo = "(unknown)"
+)
+
+// The status of PipelineRuns, tasks and steps.
+const (
+	statusPending   = "Pending"
+	statusRunning   = "Running"
+	statusSucceeded = "Succeeded"
+	statusFailed    = "Failed"
+)
+
+// runGroup is the PipelineRuns for a branch of a repository.
+type runGroup struct {
+	Repo   string
+	Branch string
+	Runs   []*runSummary
+}
+
+type runSummary struct {
+	Namespace   string
+	Name        string
+	Repo        string
+	RepoURL     string
+	Branch      string
+	SHA         string
+	PullRequest string
+	HookID      string
+	Status      string
+	Message     string
+	Created     time.Time
+	Duration    string
+}
+
+type runDetail struct {
+	*runSummary
+	// The tasks that can be executed in parallel, in the order that they're
+	// executed.
+	Levels [][]*taskNode
+}
+
+type taskNode struct {
+	Name     string
+	Status   string
+	Duration string
+	RunAfter []string
+	Steps    []*stepNode
+}
+
+type stepNode struct {
+	Name   string
+	Status string
+	LogURL string
+}
+
+// groupRuns groups the PipelineRuns by repository and branch, the groups are
+// sorted by repository and branch, and the PipelineRuns in each group are
+// sorted most recent first.
+func groupRuns(prs []pipelinev1.PipelineRun) []*runGroup {
+	groups := map[string]*runGroup{}
+	for i := range prs {
+		s := summarise(&prs[i])
+		key := s.Repo + "\x00" + s.Branch
+		g, ok := groups[key]
+		if !ok {
+			g = &runGroup{Repo: s.Repo, Branch: s.Branch}
+			groups[key] = g
+		}
+		g.Runs = append(g.Runs, s)
+	}
+	sorted := []*runGroup{}
+	for _, g := range groups {
+		sort.SliceStable(g.Runs, func(i, j int) bool {
+			return g.Runs[i].Created.After(g.Runs[j].Created)
+		})
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Repo != sorted[j].Repo {
+			return sorted[i].Repo < sorted[j].Repo
+		}
+		return sorted[i].Branch < sorted[j].Branch
+	})
+	return sorted
+}
+
+func summarise(pr *pipelinev1.PipelineRun) *runSummary {
+	s := &runSummary{
+		Namespace:   pr.ObjectMeta.Namespace,
+		Name:        pr.ObjectMeta.Name,
+		Repo:        unknownRepo,
+		RepoURL:     pr.ObjectMeta.Annotations[sourceURLAnnotation],
+		Branch:      pr.ObjectMeta.Annotations[sourceBranchAnnotation],
+		SHA:         pr.ObjectMeta.Annotations[sourceRefAnnotation],
+		PullRequest: pr.ObjectMeta.Annotations[pullRequestAnnotation],
+		HookID:      pr.ObjectMeta.Annotations[dedupe.HookIDAnnotation],
+		Status:      conditionStatus(pr.Status.GetCondition(apis.ConditionSucceeded)),
+		Created:     pr.ObjectMeta.CreationTimestamp.Time,
+		Duration:    duration(pr.Status.StartTime, pr.Status.CompletionTime),
+	}
+	if repo := repoFromURL(s.RepoURL); repo != "" {
+		s.Repo = repo
+	}
+	if c := pr.Status.GetCondition(apis.ConditionSucceeded); c != nil {
+		s.Message = c.Message
+	}
+	return s
+}
+
+// describe returns the PipelineRun with the graph of its tasks, and the
+// state of their steps, with links to the logs for each step.
+func describe(pr *pipelinev1.PipelineRun, basePath string) *runDetail {
+	taskRuns := map[string]*pipelinev1.PipelineRunTaskRunStatus{}
+	for _, tr := range pr.Status.TaskRuns {
+		taskRuns[tr.PipelineTaskName] = tr
+	}
+	tasks := pipelineTasks(pr)
+	nodes := map[string]*taskNode{}
+	for _, t := range tasks {
+		n := &taskNode{Name: t.Name, Status: statusPending, RunAfter: t.RunAfter, Duration: "-"}
+		if tr, ok := taskRuns[t.Name]; ok && tr.Status != nil {
+			n.Status = conditionStatus(tr.Status.GetCondition(apis.ConditionSucceeded))
+			n.Duration = duration(tr.Status.StartTime, tr.Status.CompletionTime)
+			for _, step := range tr.Status.Steps {
+				n.Steps = append(n.Steps, &stepNode{
+					Name:   step.Name,
+					Status: stepStatus(step.ContainerState),
+					LogURL: logURL(basePath, pr, t.Name, step.Name),
+				})
+			}
+		}
+		nodes[t.Name] = n
+	}
+	return &runDetail{runSummary: summarise(pr), Levels: levels(tasks, nodes)}
+}
+
+// pipelineTasks returns the tasks from the resolved PipelineSpec, or the
+// tasks that have been executed if it's not available.
+func pipelineTasks(pr *pipelinev1.PipelineRun) []pipelinev1.PipelineTask {
+	spec := pr.Status.PipelineSpec
+	if spec == nil {
+		spec = pr.Spec.PipelineSpec
+	}
+	if spec != nil {
+		return append(spec.Tasks, spec.Finally...)
+	}
+	tasks := []pipelinev1.PipelineTask{}
+	for _, tr := range pr.Status.TaskRuns {
+		tasks = append(tasks, pipelinev1.PipelineTask{Name: tr.PipelineTaskName})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+// levels orders the tasks by the number of tasks that must run before them,
+// tasks at the same level can run in parallel.
+func levels(tasks []pipelinev1.PipelineTask, nodes map[string]*taskNode) [][]*taskNode {
+	runAfter := map[string][]string{}
+	for _, t := range tasks {
+		runAfter[t.Name] = t.RunAfter
+	}
+	depths := map[string]int{}
+	var depth func(name string, seen map[string]bool) int
+	depth = func(name string, seen map[string]bool) int {
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		// Invalid pipelines can have cycles.
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		d := 0
+		for _, prev := range runAfter[name] {
+			if _, ok := runAfter[prev]; !ok {
+				continue
+			}
+			if pd := depth(prev, seen) + 1; pd > d {
+				d = pd
+			}
+		}
+		depths[name] = d
+		return d
+	}
+	result := [][]*taskNode{}
+	for _, t := range tasks {
+		d := depth(t.Name, map[string]bool{})
+		for len(result) <= d {
+			result = append(result, []*taskNode{})
+		}
+		result[d] = append(result[d], nodes[t.Name])
+	}
+	return result
+}
+
+func conditionStatus(c *apis.Condition) string {
+	if c == nil {
+		return statusPending
+	}
+	switch c.Status {
+	case corev1.ConditionTrue:
+		return statusSucceeded
+	case corev1.ConditionFalse:
+		return statusFailed
+	}
+	return statusRunning
+}
+
+func stepStatus(s corev1.ContainerState) string {
+	switch {
+	case s.Terminated != nil && s.Terminated.ExitCode == 0:
+		return statusSucceeded
+	case s.Terminated != nil:
+		return statusFailed
+	case s.Running != nil:
+		return statusRunning
+	}
+	return statusPending
+}
+
+// duration returns the time between the start and end, or "-" if either is
+// unknown.
+func duration(start, end *metav1.Time) string {
+	if start == nil || end == nil {
+		return "-"
+	}
+	return end.Sub(start.Time).Round(time.Second).String()
+}
+
+func logURL(basePath string, pr *pipelinev1.PipelineRun, task, step string) string {
+	return fmt.Sprintf("%s/pipelineruns/%s/%s/logs/%s/%s", basePath, pr.ObjectMeta.Namespace, pr.ObjectMeta.Name,
+		url.PathEscape(task), url.PathEscape(step))
+}
+
+// repoFromURL returns the org/repo from a clone URL, or an empty string if
+// it can't be parsed.
+func repoFromURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Join(parts, "/"), ".git")
+}
@@ -9,6 +9,10 @@ import (
 
 // Creator is an interface that defines the behaviour for creating new
 // PersistentVolumeClaims with a a requisite size.
+//
+// If the name is empty, a name is generated, otherwise, if a claim with the
+// name already exists, it's returned rather than creating another, so that
+// retried work creates one claim.
 type Creator interface {
-	Create(ctx context.Context, namespace string, size resource.Quantity) (*corev1.PersistentVolumeClaim, error)
+	Create(ctx context.Context, namespace, name string, size resource.Quantity) (*corev1.PersistentVolumeClaim, error)
 }
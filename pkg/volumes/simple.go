@@ -4,6 +4,7 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -37,11 +38,11 @@ type SimpleVolumeCreator struct {
 }
 
 // Create impements the Creator interface.
-func (s SimpleVolumeCreator) Create(ctx context.Context, namespace string, size resource.Quantity) (*corev1.PersistentVolumeClaim, error) {
+func (s SimpleVolumeCreator) Create(ctx context.Context, namespace, name string, size resource.Quantity) (*corev1.PersistentVolumeClaim, error) {
 	vc := &corev1.PersistentVolumeClaim{
 		TypeMeta: volumeTypeMeta,
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: namePrefix,
+			Name: name,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			Resources: corev1.ResourceRequirements{
@@ -55,9 +56,15 @@ func (s SimpleVolumeCreator) Create(ctx context.Context, namespace string, size
 			},
 		},
 	}
+	if name == "" {
+		vc.ObjectMeta.GenerateName = namePrefix
+	}
 	volume, err := s.coreClient.CoreV1().
 		PersistentVolumeClaims(namespace).
 		Create(ctx, vc, metav1.CreateOptions{})
+	if name != "" && errors.IsAlreadyExists(err) {
+		return s.coreClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
 	if err != nil {
 		return nil, err
 	}
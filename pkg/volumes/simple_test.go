@@ -18,7 +18,7 @@ func TestSimpleVolume(t *testing.T) {
 	fakeClient := fake.NewSimpleClientset()
 	c := New(fakeClient)
 	size := resource.MustParse("1Gi")
-	v, err := c.Create(ctx, "testing", size)
+	v, err := c.Create(ctx, "testing", "", size)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -54,3 +54,28 @@ func TestSimpleVolume(t *testing.T) {
 		t.Fatalf("saved volume was different: %s\n", diff)
 	}
 }
+
+func TestSimpleVolumeWithName(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fake.NewSimpleClientset()
+	c := New(fakeClient)
+	size := resource.MustParse("1Gi")
+
+	for i := 0; i < 2; i++ {
+		v, err := c.Create(ctx, "testing", "my-volume", size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.ObjectMeta.Name != "my-volume" {
+			t.Fatalf("got volume %q, want my-volume", v.ObjectMeta.Name)
+		}
+	}
+
+	claims, err := fakeClient.CoreV1().PersistentVolumeClaims("testing").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(claims.Items); l != 1 {
+		t.Fatalf("got %d volume claims, want 1", l)
+	}
+}
@@ -0,0 +1,102 @@
+package watcher
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
+
+// This is used to find the existing summary comment on a pull request, so that
+// it can be updated rather than creating a new comment for every run.
+const summaryMarker = "<!-- tekton-ci:pipelinerun-summary -->"
+
+// pipelineRunSummary generates a Markdown table with the outcome of each of the
+// tasks in a PipelineRun.
+//
+// If the dashboardURL is provided, a link to the logs for each task is
+// included.
+func pipelineRunSummary(pr *pipelinev1.PipelineRun, dashboardURL string) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, summaryMarker)
+	fmt.Fprintf(&b, "**Tekton CI** PipelineRun `%s` %s", pr.ObjectMeta.Name, runState(pr))
+	if commit := findCommit(pr); commit != "" {
+		fmt.Fprintf(&b, " for commit %s", commit)
+	}
+	fmt.Fprint(&b, "\n\n")
+	if dashboardURL != "" {
+		fmt.Fprintln(&b, "| Task | Status | Duration | Logs |")
+		fmt.Fprintln(&b, "|------|--------|----------|------|")
+	} else {
+		fmt.Fprintln(&b, "| Task | Status | Duration |")
+		fmt.Fprintln(&b, "|------|--------|----------|")
+	}
+	for _, tr := range sortedTaskRuns(pr) {
+		fmt.Fprintf(&b, "| %s | %s | %s |", tr.PipelineTaskName, taskRunStatus(tr.Status), taskRunDuration(tr.Status))
+		if dashboardURL != "" {
+			fmt.Fprintf(&b, " [logs](%s) |", taskLogsURL(dashboardURL, pr, tr.PipelineTaskName))
+		}
+		fmt.Fprintln(&b)
+	}
+	return b.String()
+}
+
+// Tasks are sorted by the time that they started, and then by name.
+func sortedTaskRuns(pr *pipelinev1.PipelineRun) []*pipelinev1.PipelineRunTaskRunStatus {
+	taskRuns := []*pipelinev1.PipelineRunTaskRunStatus{}
+	for _, v := range pr.Status.TaskRuns {
+		if v.Status != nil {
+			taskRuns = append(taskRuns, v)
+		}
+	}
+	sort.SliceStable(taskRuns, func(i, j int) bool {
+		si, sj := startTime(taskRuns[i].Status), startTime(taskRuns[j].Status)
+		if !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return taskRuns[i].PipelineTaskName < taskRuns[j].PipelineTaskName
+	})
+	return taskRuns
+}
+
+func startTime(s *pipelinev1.TaskRunStatus) time.Time {
+	if s.StartTime == nil {
+		return time.Time{}
+	}
+	return s.StartTime.Time
+}
+
+func taskRunStatus(s *pipelinev1.TaskRunStatus) string {
+	c := s.GetCondition(apis.ConditionSucceeded)
+	if c == nil {
+		return "Pending"
+	}
+	switch c.Status {
+	case corev1.ConditionTrue:
+		return "Succeeded"
+	case corev1.ConditionFalse:
+		if c.Reason != "" {
+			return c.Reason
+		}
+		return "Failed"
+	}
+	return "Running"
+}
+
+func taskRunDuration(s *pipelinev1.TaskRunStatus) string {
+	if s.StartTime == nil || s.CompletionTime == nil {
+		return "-"
+	}
+	return s.CompletionTime.Sub(s.StartTime.Time).Round(time.Second).String()
+}
+
+// This uses the Tekton Dashboard URL format.
+func taskLogsURL(dashboardURL string, pr *pipelinev1.PipelineRun, taskName string) string {
+	return fmt.Sprintf("%s/#/namespaces/%s/pipelineruns/%s?pipelineTask=%s",
+		strings.TrimSuffix(dashboardURL, "/"), pr.ObjectMeta.Namespace, pr.ObjectMeta.Name, url.QueryEscape(taskName))
+}
@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+
+	"github.com/gitops-tools/tekton-ci/pkg/resources"
+)
+
+func TestPipelineRunSummary(t *testing.T) {
+	start := time.Date(2020, time.November, 10, 12, 0, 0, 0, time.UTC)
+	pr := makePipelineRun(
+		statusCondition(apis.ConditionSucceeded, corev1.ConditionFalse),
+		taskRuns(
+			taskRun("compile-stage-build", start.Add(time.Minute), 0, corev1.ConditionFalse, "Failed"),
+			taskRun("git-clone", start, time.Second*10, corev1.ConditionTrue, "Succeeded"),
+			taskRun("format-stage-test", start.Add(time.Second*10), time.Second*45, corev1.ConditionTrue, "Succeeded"),
+		))
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+	pr.ObjectMeta.Namespace = testNS
+
+	want := `<!-- tekton-ci:pipelinerun-summary -->
+**Tekton CI** PipelineRun ` + "`my-pipeline-run-abcde`" + ` Failed
+
+| Task | Status | Duration | Logs |
+|------|--------|----------|------|
+| git-clone | Succeeded | 10s | [logs](https://dashboard.example.com/#/namespaces/testing/pipelineruns/my-pipeline-run-abcde?pipelineTask=git-clone) |
+| format-stage-test | Succeeded | 45s | [logs](https://dashboard.example.com/#/namespaces/testing/pipelineruns/my-pipeline-run-abcde?pipelineTask=format-stage-test) |
+| compile-stage-build | Failed | - | [logs](https://dashboard.example.com/#/namespaces/testing/pipelineruns/my-pipeline-run-abcde?pipelineTask=compile-stage-build) |
+`
+	if diff := cmp.Diff(want, pipelineRunSummary(pr, "https://dashboard.example.com/")); diff != "" {
+		t.Fatalf("pipelineRunSummary() failed:\n%s", diff)
+	}
+}
+
+func TestPipelineRunSummaryWithNoDashboard(t *testing.T) {
+	start := time.Date(2020, time.November, 10, 12, 0, 0, 0, time.UTC)
+	pr := makePipelineRun(
+		statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue),
+		taskRuns(taskRun("git-clone", start, time.Second*10, corev1.ConditionTrue, "Succeeded")))
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+
+	want := `<!-- tekton-ci:pipelinerun-summary -->
+**Tekton CI** PipelineRun ` + "`my-pipeline-run-abcde`" + ` Successful
+
+| Task | Status | Duration |
+|------|--------|----------|
+| git-clone | Succeeded | 10s |
+`
+	if diff := cmp.Diff(want, pipelineRunSummary(pr, "")); diff != "" {
+		t.Fatalf("pipelineRunSummary() failed:\n%s", diff)
+	}
+}
+
+// A duration of 0 indicates that the TaskRun has not completed.
+func taskRun(name string, start time.Time, d time.Duration, s corev1.ConditionStatus, reason string) *pipelinev1.PipelineRunTaskRunStatus {
+	status := &pipelinev1.TaskRunStatus{
+		Status: duckv1beta1.Status{
+			Conditions: duckv1beta1.Conditions{
+				{Type: apis.ConditionSucceeded, Status: s, Reason: reason},
+			},
+		},
+		TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+			StartTime: &metav1.Time{Time: start},
+		},
+	}
+	if d != 0 {
+		status.CompletionTime = &metav1.Time{Time: start.Add(d)}
+	}
+	return &pipelinev1.PipelineRunTaskRunStatus{PipelineTaskName: name, Status: status}
+}
+
+func taskRuns(trs ...*pipelinev1.PipelineRunTaskRunStatus) resources.PipelineRunOpt {
+	return func(pr *pipelinev1.PipelineRun) {
+		pr.Status.TaskRuns = map[string]*pipelinev1.PipelineRunTaskRunStatus{}
+		for _, tr := range trs {
+			pr.Status.TaskRuns[pr.ObjectMeta.GenerateName+tr.PipelineTaskName] = tr
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dedupe"
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+)
+
+const (
+	sourceRefAnnotation    = "tekton.dev/ci-source-ref"
+	sourceBranchAnnotation = "tekton.dev/ci-source-branch"
+)
+
+// saveRun records the result of a completed PipelineRun in the run history,
+// if there is one.
+func (w *Watcher) saveRun(ctx context.Context, pr *pipelinev1.PipelineRun) {
+	if w.config.Runs == nil {
+		return
+	}
+	if err := w.config.Runs.Save(ctx, runFromPipelineRun(pr)); err != nil {
+		w.log.Errorw("failed to save the run", "name", pr.ObjectMeta.Name, "error", err)
+	}
+}
+
+// runFromPipelineRun extracts the result of a completed PipelineRun.
+//
+// The SHA is taken from the source annotation, falling back to the commit
+// recorded by a git resource.
+func runFromPipelineRun(pr *pipelinev1.PipelineRun) *runs.Run {
+	r := &runs.Run{
+		Name:        pr.ObjectMeta.Name,
+		Namespace:   pr.ObjectMeta.Namespace,
+		RepoURL:     findRepoURL(pr),
+		Branch:      pr.ObjectMeta.Annotations[sourceBranchAnnotation],
+		SHA:         pr.ObjectMeta.Annotations[sourceRefAnnotation],
+		HookID:      pr.ObjectMeta.Annotations[dedupe.HookIDAnnotation],
+		PullRequest: findPullRequest(pr),
+		Status:      runState(pr).String(),
+		Duration:    runDuration(pr),
+		Tasks:       []runs.TaskResult{},
+	}
+	if repo, err := parseRepoFromURL(r.RepoURL); err == nil {
+		r.Repo = repo
+	}
+	if r.SHA == "" {
+		r.SHA = findCommit(pr)
+	}
+	if c := pr.Status.GetCondition(apis.ConditionSucceeded); c != nil {
+		r.Reason = c.Reason
+		r.Message = c.Message
+	}
+	r.Started, r.Completed = timeOrZero(pr.Status.StartTime), timeOrZero(pr.Status.CompletionTime)
+	for _, tr := range sortedTaskRuns(pr) {
+		r.Tasks = append(r.Tasks, taskRunResult(tr))
+	}
+	return r
+}
+
+// The tests are parsed from the JUnit reports recorded by DSL jobs, reports
+// that can't be parsed are ignored.
+func taskRunResult(tr *pipelinev1.PipelineRunTaskRunStatus) runs.TaskResult {
+	t := runs.TaskResult{
+		Name:      tr.PipelineTaskName,
+		Status:    Pending.String(),
+		Started:   timeOrZero(tr.Status.StartTime),
+		Completed: timeOrZero(tr.Status.CompletionTime),
+	}
+	if c := tr.Status.GetCondition(apis.ConditionSucceeded); c != nil {
+		switch c.Status {
+		case corev1.ConditionTrue:
+			t.Status = Successful.String()
+		case corev1.ConditionFalse:
+			t.Status = Failed.String()
+			t.Reason = c.Reason
+		}
+	}
+	if !t.Started.IsZero() && !t.Completed.IsZero() {
+		t.Duration = t.Completed.Sub(t.Started)
+	}
+	for _, res := range tr.Status.TaskRunResults {
+		if res.Name != dsl.JUnitReportResult {
+			continue
+		}
+		if tests, err := runs.DecodeJUnitReport(res.Value); err == nil {
+			t.Tests = tests
+		}
+	}
+	return t
+}
+
+func timeOrZero(t *metav1.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
@@ -0,0 +1,160 @@
+package watcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+)
+
+func TestRunFromPipelineRun(t *testing.T) {
+	start := time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+	pr := makePipelineRun(
+		dsl.AnnotateSource("test-id", &dsl.Source{RepoURL: testSourceURL, Ref: testSHA, Branch: "main"}),
+		dsl.AnnotatePullRequest(5),
+		taskRuns(
+			taskRun("git-clone", start, time.Second*10, corev1.ConditionTrue, "Succeeded"),
+			taskRun("test", start.Add(time.Second*10), time.Minute, corev1.ConditionFalse, "Failed")))
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+	pr.ObjectMeta.Namespace = testNS
+	pr.Status.Conditions = append(pr.Status.Conditions, apis.Condition{
+		Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse, Reason: "Failed", Message: "Tasks Completed: 2 (Failed: 1)"})
+	pr.Status.StartTime = &metav1.Time{Time: start}
+	pr.Status.CompletionTime = &metav1.Time{Time: start.Add(time.Second * 70)}
+
+	want := &runs.Run{
+		Name:        "my-pipeline-run-abcde",
+		Namespace:   testNS,
+		Repo:        "bigkevmcd/tekton-ci",
+		RepoURL:     testSourceURL,
+		Branch:      "main",
+		SHA:         testSHA,
+		HookID:      "test-id",
+		PullRequest: 5,
+		Status:      "Failed",
+		Reason:      "Failed",
+		Message:     "Tasks Completed: 2 (Failed: 1)",
+		Started:     start,
+		Completed:   start.Add(time.Second * 70),
+		Duration:    time.Second * 70,
+		Tasks: []runs.TaskResult{
+			{Name: "git-clone", Status: "Successful", Started: start, Completed: start.Add(time.Second * 10), Duration: time.Second * 10},
+			{Name: "test", Status: "Failed", Reason: "Failed", Started: start.Add(time.Second * 10), Completed: start.Add(time.Second * 70), Duration: time.Minute},
+		},
+	}
+	if diff := cmp.Diff(want, runFromPipelineRun(pr)); diff != "" {
+		t.Fatalf("runFromPipelineRun() failed:\n%s", diff)
+	}
+}
+
+func TestRunFromPipelineRunWithCommitResult(t *testing.T) {
+	r := runFromPipelineRun(makePipelineRun(taskResult()))
+
+	if r.SHA != testSHA {
+		t.Fatalf("got SHA %q, want %q", r.SHA, testSHA)
+	}
+}
+
+func TestRunFromPipelineRunWithJUnitReport(t *testing.T) {
+	start := time.Date(2020, time.November, 1, 10, 0, 0, 0, time.UTC)
+	tr := taskRun("test", start, time.Minute, corev1.ConditionFalse, "Failed")
+	tr.Status.TaskRunResults = []pipelinev1.TaskRunResult{
+		{Name: "junit-report", Value: encodeReport(t, `<testsuite><testcase classname="pkg" name="TestOne"/><testcase classname="pkg" name="TestTwo"><failure/></testcase></testsuite>`)},
+	}
+	r := runFromPipelineRun(makePipelineRun(taskRuns(tr)))
+
+	want := []runs.TestResult{
+		{Name: "pkg.TestOne", Status: runs.TestPassed},
+		{Name: "pkg.TestTwo", Status: runs.TestFailed},
+	}
+	if diff := cmp.Diff(want, r.Tasks[0].Tests); diff != "" {
+		t.Fatalf("got different tests:\n%s", diff)
+	}
+}
+
+func TestRecordPipelineRunSavesCompletedRuns(t *testing.T) {
+	store := makeRunStore(t)
+	w := New(nil, fakeclientset.NewSimpleClientset(), testNS, &Config{Runs: store}, metrics.NewMock(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+	running := makePipelineRun(
+		dsl.AnnotateSource("test-id", &dsl.Source{RepoURL: testSourceURL, Ref: testSHA}),
+		statusCondition(apis.ConditionSucceeded, corev1.ConditionUnknown))
+	running.ObjectMeta.Name = "my-pipeline-run-abcde"
+	completed := running.DeepCopy()
+	completed.Status.Conditions = nil
+	statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue)(completed)
+
+	for _, pr := range []*pipelineRunEvent{{watch.Added, running}, {watch.Modified, completed}, {watch.Modified, completed}} {
+		if w.recordPipelineRun(pr.t, pr.pr) {
+			w.saveRun(context.TODO(), pr.pr)
+		}
+	}
+
+	_, total, err := store.List(context.TODO(), runs.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("got %d runs, want 1", total)
+	}
+	r, err := store.Get(context.TODO(), "", "my-pipeline-run-abcde")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != "Successful" || r.Repo != "bigkevmcd/tekton-ci" {
+		t.Fatalf("got run with status %q for repo %q", r.Status, r.Repo)
+	}
+}
+
+type pipelineRunEvent struct {
+	t  watch.EventType
+	pr *pipelinev1.PipelineRun
+}
+
+func encodeReport(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func makeRunStore(t *testing.T) *runs.BoltStore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tekton-ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := runs.NewBoltStore(filepath.Join(dir, "runs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+	return s
+}
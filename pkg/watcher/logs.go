@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+)
+
+// archiveQueueSize is the number of completed PipelineRuns that can be
+// waiting for their logs to be archived before the watch waits.
+const archiveQueueSize = 100
+
+// archivePipelineRuns archives the logs of the PipelineRuns from the queue,
+// until the stop channel is closed.
+//
+// Streaming the logs can be slow, so this is done outside the watch.
+func (w *Watcher) archivePipelineRuns(ctx context.Context, queue <-chan *pipelinev1.PipelineRun, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case pr := <-queue:
+			w.archiveLogs(ctx, pr)
+		}
+	}
+}
+
+// archiveLogs saves the logs for the steps of a completed PipelineRun in the
+// log archive, if there is one, and records their location in an annotation.
+func (w *Watcher) archiveLogs(ctx context.Context, pr *pipelinev1.PipelineRun) {
+	if w.config.LogArchive == nil || logs.Archived(pr) {
+		return
+	}
+	location, err := w.config.LogArchive.Save(ctx, logs.NewWriter(w.tektonClient, w.config.LogStreamer), pr)
+	if err != nil {
+		w.log.Errorw("failed to archive the logs", "name", pr.ObjectMeta.Name, "error", err)
+		return
+	}
+	if err := w.annotate(ctx, pr, logs.ArchiveAnnotation, location); err != nil {
+		w.log.Errorw("failed to record the location of the archived logs", "name", pr.ObjectMeta.Name, "error", err)
+	}
+}
+
+// annotate sets an annotation on the PipelineRun with a merge patch, so that
+// it doesn't conflict with other changes to the PipelineRun.
+func (w *Watcher) annotate(ctx context.Context, pr *pipelinev1.PipelineRun, key, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tektonClient.TektonV1beta1().PipelineRuns(pr.ObjectMeta.Namespace).Patch(ctx, pr.ObjectMeta.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,99 @@
+package watcher
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"gocloud.dev/blob/memblob"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+)
+
+func TestArchiveLogs(t *testing.T) {
+	tr := taskRun("test-stage-test", time.Now(), time.Minute, corev1.ConditionTrue, "Succeeded")
+	tr.Status.PodName = "test-pod"
+	tr.Status.Steps = []pipelinev1.StepState{{Name: "unnamed-0", ContainerName: "step-unnamed-0"}}
+	pr := makePipelineRun(taskRuns(tr), statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue))
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+	pr.ObjectMeta.Namespace = testNS
+	pr.Spec.PipelineSpec.Tasks = []pipelinev1.PipelineTask{{Name: "test-stage-test"}}
+	client := fakeclientset.NewSimpleClientset(pr)
+	streamer := logs.NewMock()
+	streamer.AddLogs(testNS, "test-pod", "step-unnamed-0", "PASS\n")
+	archive := logs.NewArchive(memblob.OpenBucket(nil), "gs://my-bucket")
+	w := New(nil, client, testNS, &Config{LogArchive: archive, LogStreamer: streamer}, metrics.NewMock(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+
+	w.archiveLogs(context.TODO(), pr)
+
+	want := "gs://my-bucket/logs/testing/my-pipeline-run-abcde.log"
+	saved, err := client.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), pr.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := saved.ObjectMeta.Annotations[logs.ArchiveAnnotation]; l != want {
+		t.Fatalf("got saved location %q, want %q", l, want)
+	}
+	rc, err := archive.Open(context.TODO(), testNS, pr.ObjectMeta.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "[test] PASS\n" {
+		t.Fatalf("got archived logs %q", s)
+	}
+}
+
+func TestArchiveLogsDoesNotConflictWithUpdates(t *testing.T) {
+	pr := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue))
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+	pr.ObjectMeta.Namespace = testNS
+	pr.ObjectMeta.ResourceVersion = "1"
+	client := fakeclientset.NewSimpleClientset(pr)
+	// The PipelineRun is changed by the controller after the event.
+	changed := pr.DeepCopy()
+	changed.ObjectMeta.ResourceVersion = "2"
+	changed.ObjectMeta.Annotations["testing"] = "changed"
+	if _, err := client.TektonV1beta1().PipelineRuns(testNS).Update(context.TODO(), changed, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	archive := logs.NewArchive(memblob.OpenBucket(nil), "gs://my-bucket")
+	w := New(nil, client, testNS, &Config{LogArchive: archive, LogStreamer: logs.NewMock()}, metrics.NewMock(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+
+	w.archiveLogs(context.TODO(), pr)
+
+	saved, err := client.TektonV1beta1().PipelineRuns(testNS).Get(context.TODO(), pr.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := saved.ObjectMeta.Annotations[logs.ArchiveAnnotation]; l != "gs://my-bucket/logs/testing/my-pipeline-run-abcde.log" {
+		t.Fatalf("got saved location %q", l)
+	}
+	if v := saved.ObjectMeta.Annotations["testing"]; v != "changed" {
+		t.Fatalf("the change to the PipelineRun was lost, got %q", v)
+	}
+}
+
+func TestArchiveLogsWithNoArchive(t *testing.T) {
+	pr := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue))
+	w := New(nil, fakeclientset.NewSimpleClientset(), testNS, &Config{}, metrics.NewMock(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)).Sugar())
+
+	w.archiveLogs(context.TODO(), pr)
+
+	if logs.Archived(pr) {
+		t.Fatal("PipelineRun was annotated")
+	}
+}
@@ -5,37 +5,110 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jenkins-x/go-scm/scm"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	pipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labelsv1 "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"knative.dev/pkg/apis"
 
+	"github.com/gitops-tools/tekton-ci/pkg/git"
 	"github.com/gitops-tools/tekton-ci/pkg/logger"
+	"github.com/gitops-tools/tekton-ci/pkg/logs"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
+	"github.com/gitops-tools/tekton-ci/pkg/runs"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
+	"github.com/gitops-tools/tekton-ci/pkg/ui"
 )
 
 const (
 	tektonCILabel               = "tekton-ci"
 	notificationStateAnnotation = "tekton.dev/ci-notification-state"
+	pullRequestAnnotation       = "tekton.dev/ci-pull-request"
 )
 
+// Config provides options for the notifications sent by the Watcher.
+type Config struct {
+	CommitStatuses      bool          // Send commit-statuses as the state of PipelineRuns change.
+	PullRequestComments bool          // Report a summary of completed PipelineRuns as a pull request comment.
+	DashboardURL        string        // Used to generate links to the logs for Tasks.
+	UIURL               string        // If set, commit-statuses link to the PipelineRun in the UI served from this URL.
+	Host                string        // If set, only PipelineRuns for repositories on this host are reported.
+	Runs                runs.Store    // If set, the results of completed PipelineRuns are recorded.
+	LogArchive          *logs.Archive // If set, the logs of completed PipelineRuns are archived.
+	LogStreamer         logs.Streamer // Used to get the logs to archive.
+}
+
+// Watcher tracks PipelineRuns with the correct label, and reports their state
+// to the upstream Git hosting service.
+//
+// The outcome and duration of PipelineRuns, and the number that are running,
+// are recorded in the metrics, the results of completed PipelineRuns are
+// recorded in the run history, and their logs are archived.
+type Watcher struct {
+	scmClient    git.SCM
+	tektonClient pipelineclientset.Interface
+	namespace    string
+	config       *Config
+	m            metrics.Interface
+	log          logger.Logger
+
+	mu   sync.Mutex
+	runs map[string]*runProgress
+}
+
+// runProgress is the progress of a PipelineRun that has been seen, and the
+// span for it, which is started when the PipelineRun starts, and ended when
+// it completes.
+type runProgress struct {
+	done  bool
+	ctx   context.Context
+	span  trace.Span
+	tasks map[string]bool // The TaskRuns that have been traced.
+}
+
+// New creates and returns a new Watcher.
+func New(scmClient git.SCM, tektonClient pipelineclientset.Interface, ns string, cfg *Config, m metrics.Interface, l logger.Logger) *Watcher {
+	return &Watcher{
+		scmClient:    scmClient,
+		tektonClient: tektonClient,
+		namespace:    ns,
+		config:       cfg,
+		m:            m,
+		log:          l,
+		runs:         map[string]*runProgress{},
+	}
+}
+
 // WatchPipelineRuns tracks PipelineRuns with the correct label, and reports
-// their state as a commit-status to the upstream Git hosting service.
-func WatchPipelineRuns(stop <-chan struct{}, scmClient *scm.Client, tektonClient pipelineclientset.Interface, ns string, l logger.Logger) {
-	l.Infow("starting to watch for PipelineRuns", "ns", ns)
-	api := tektonClient.TektonV1beta1().PipelineRuns(ns)
+// their state to the upstream Git hosting service.
+func (w *Watcher) WatchPipelineRuns(stop <-chan struct{}) {
+	w.log.Infow("starting to watch for PipelineRuns", "ns", w.namespace)
+	api := w.tektonClient.TektonV1beta1().PipelineRuns(w.namespace)
 	listOptions := metav1.ListOptions{
 		LabelSelector: labelsv1.Set(map[string]string{"app.kubernetes.io/part-of": "Tekton-CI"}).AsSelector().String(),
 	}
 	ctx := context.Background()
 	watcher, err := api.Watch(ctx, listOptions)
 	if err != nil {
-		l.Errorf("failed to watch PipelineRuns: %s", err)
+		w.log.Errorf("failed to watch PipelineRuns: %s", err)
 		return
 	}
 	ch := watcher.ResultChan()
+	var archiveQueue chan *pipelinev1.PipelineRun
+	if w.config.LogArchive != nil {
+		archiveQueue = make(chan *pipelinev1.PipelineRun, archiveQueueSize)
+		go w.archivePipelineRuns(ctx, archiveQueue, stop)
+	}
 
 	for {
 		select {
@@ -43,30 +116,182 @@ func WatchPipelineRuns(stop <-chan struct{}, scmClient *scm.Client, tektonClient
 			return
 		case v := <-ch:
 			pr := v.Object.(*pipelinev1.PipelineRun)
-			err := handlePipelineRun(ctx, scmClient, tektonClient, pr, l)
+			if w.reportsFor(pr) && w.recordPipelineRun(v.Type, pr) {
+				w.saveRun(ctx, pr)
+				if archiveQueue != nil {
+					select {
+					case archiveQueue <- pr.DeepCopy():
+					case <-stop:
+						return
+					}
+				}
+			}
+			if v.Type == watch.Deleted {
+				continue
+			}
+			err := w.handlePipelineRun(ctx, pr)
 			if err != nil {
-				l.Infow(fmt.Sprintf("error handling PipelineRun: %s", err), "name", pr.ObjectMeta.Name)
+				w.log.Infow(fmt.Sprintf("error handling PipelineRun: %s", err), "name", pr.ObjectMeta.Name)
 			}
 		}
 	}
 }
 
-func handlePipelineRun(ctx context.Context, scmClient *scm.Client, tektonClient pipelineclientset.Interface, pr *pipelinev1.PipelineRun, l logger.Logger) error {
+func (w *Watcher) handlePipelineRun(ctx context.Context, pr *pipelinev1.PipelineRun) error {
+	if !w.reportsFor(pr) || !(w.config.CommitStatuses || w.config.PullRequestComments) {
+		return nil
+	}
 	newState := runState(pr)
-	l.Infof("Received a PipelineRun %#v %s", pr.Status, newState)
+	w.log.Infof("Received a PipelineRun %#v %s", pr.Status, newState)
 	if newState.String() != notificationState(pr) {
-		err := sendNotification(scmClient, pr, l)
-		if err != nil {
-			return fmt.Errorf("failed to send notification %w", err)
+		if w.config.CommitStatuses {
+			err := w.sendNotification(ctx, pr)
+			if err != nil {
+				return fmt.Errorf("failed to send notification %w", err)
+			}
+		}
+		if w.config.PullRequestComments && newState != Pending {
+			err := w.sendPullRequestComment(ctx, pr)
+			if err != nil {
+				return fmt.Errorf("failed to comment on pull request %w", err)
+			}
 		}
 	}
-	return updatePRState(ctx, newState, pr, tektonClient)
+	return w.updatePRState(ctx, newState, pr)
 }
 
-func updatePRState(ctx context.Context, newState State, pr *pipelinev1.PipelineRun, tektonClient pipelineclientset.Interface) error {
+func (w *Watcher) updatePRState(ctx context.Context, newState State, pr *pipelinev1.PipelineRun) error {
 	setNotificationState(pr, newState)
-	_, err := tektonClient.TektonV1beta1().PipelineRuns(pr.ObjectMeta.Namespace).Update(ctx, pr, metav1.UpdateOptions{})
-	return err
+	return w.annotate(ctx, pr, notificationStateAnnotation, newState.String())
+}
+
+// recordPipelineRun records the metrics for an event for the PipelineRun, and
+// returns true the first time that the PipelineRun is seen to be complete.
+//
+// The outcome, duration and spans are only recorded for PipelineRuns that are
+// seen to complete, not those that were already complete when the watch
+// started.
+func (w *Watcher) recordPipelineRun(t watch.EventType, pr *pipelinev1.PipelineRun) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := pr.ObjectMeta.Namespace + "/" + pr.ObjectMeta.Name
+	completed := false
+	if t == watch.Deleted {
+		if p, ok := w.runs[key]; ok && p.span != nil {
+			p.span.SetStatus(codes.Error, "PipelineRun deleted")
+			p.span.End()
+		}
+		delete(w.runs, key)
+	} else {
+		state := runState(pr)
+		done := state != Pending
+		p, seen := w.runs[key]
+		if !seen {
+			p = &runProgress{tasks: map[string]bool{}}
+			w.runs[key] = p
+		}
+		completed = done && !p.done
+		// PipelineRuns that are listed when the watch starts may have been
+		// traced already, only the transitions that are seen are traced.
+		observed := seen || t == watch.Modified
+		if completed && !observed {
+			p.done = true
+		} else if !p.done {
+			tracePipelineRun(p, pr, state, observed)
+			p.done = done
+		}
+		if completed && observed {
+			w.m.ObservePipelineRun(state.String(), runDuration(pr))
+		}
+	}
+	running := 0
+	for _, p := range w.runs {
+		if !p.done {
+			running++
+		}
+	}
+	w.m.SetRunningPipelineRuns(w.config.Host, running)
+	return completed
+}
+
+// runDuration returns the time between the PipelineRun starting and
+// completing, or zero if either is unknown.
+func runDuration(pr *pipelinev1.PipelineRun) time.Duration {
+	if pr.Status.StartTime == nil || pr.Status.CompletionTime == nil {
+		return 0
+	}
+	return pr.Status.CompletionTime.Sub(pr.Status.StartTime.Time)
+}
+
+// tracePipelineRun records spans for the transitions of the PipelineRun since
+// it was last seen, in the trace of the hook that created it.
+//
+// When the PipelineRun starts, a span is recorded for the time it was
+// pending, and a span is started for the run, each TaskRun is recorded in a
+// span of the run when it completes, and the span for the run is ended when
+// the PipelineRun completes.
+//
+// If the transitions were not observed, i.e. the PipelineRun was listed when
+// the watch started, the pending span and the completed TaskRuns are not
+// recorded, as they may have been before.
+func tracePipelineRun(p *runProgress, pr *pipelinev1.PipelineRun, state State, observed bool) {
+	if pr.Status.StartTime == nil {
+		return
+	}
+	if p.span == nil {
+		parent := tracing.Extract(context.Background(), pr.ObjectMeta.Annotations)
+		if observed {
+			_, pending := tracing.Start(parent, "pipelinerun_pending",
+				trace.WithTimestamp(pr.ObjectMeta.CreationTimestamp.Time),
+				trace.WithAttributes(label.String("pipelinerun", pr.ObjectMeta.Name)))
+			pending.End(trace.WithTimestamp(pr.Status.StartTime.Time))
+		}
+		p.ctx, p.span = tracing.Start(parent, "pipelinerun",
+			trace.WithTimestamp(pr.Status.StartTime.Time),
+			trace.WithAttributes(label.String("pipelinerun", pr.ObjectMeta.Name)))
+	}
+	for _, tr := range pr.Status.TaskRuns {
+		if tr.Status == nil || tr.Status.StartTime == nil || tr.Status.CompletionTime == nil || p.tasks[tr.PipelineTaskName] {
+			continue
+		}
+		p.tasks[tr.PipelineTaskName] = true
+		if !observed {
+			continue
+		}
+		_, taskSpan := tracing.Start(p.ctx, "taskrun",
+			trace.WithTimestamp(tr.Status.StartTime.Time),
+			trace.WithAttributes(label.String("task", tr.PipelineTaskName)))
+		if tr.Status.GetCondition(apis.ConditionSucceeded).IsFalse() {
+			taskSpan.SetStatus(codes.Error, "TaskRun failed")
+		}
+		taskSpan.End(trace.WithTimestamp(tr.Status.CompletionTime.Time))
+	}
+	if state == Pending {
+		return
+	}
+	p.span.SetAttributes(label.String("outcome", state.String()))
+	if state == Failed {
+		p.span.SetStatus(codes.Error, "PipelineRun failed")
+	}
+	end := time.Now()
+	if pr.Status.CompletionTime != nil {
+		end = pr.Status.CompletionTime.Time
+	}
+	p.span.End(trace.WithTimestamp(end))
+	p.span = nil
+}
+
+// reportsFor returns true if the PipelineRun is for a repository on the host
+// that the Watcher reports to.
+func (w *Watcher) reportsFor(pr *pipelinev1.PipelineRun) bool {
+	if w.config.Host == "" {
+		return true
+	}
+	u, err := url.Parse(findRepoURL(pr))
+	if err != nil {
+		return false
+	}
+	return u.Host == w.config.Host
 }
 
 func notificationState(pr *pipelinev1.PipelineRun) string {
@@ -77,27 +302,39 @@ func setNotificationState(pr *pipelinev1.PipelineRun, s State) {
 	pr.ObjectMeta.Annotations[notificationStateAnnotation] = s.String()
 }
 
-func sendNotification(c *scm.Client, pr *pipelinev1.PipelineRun, l logger.Logger) error {
+func (w *Watcher) sendNotification(ctx context.Context, pr *pipelinev1.PipelineRun) error {
 	repo, err := parseRepoFromURL(findRepoURL(pr))
 	if err != nil {
 		return err
 	}
-	status := commitStatusInput(pr)
+	status := commitStatusInput(pr, w.config.UIURL)
 	commit := findCommit(pr)
 	if commit == "" {
 		return errors.New("could not find a commit-id in the PipelineRun")
 	}
 
-	l.Infof("sendNotification", "repo", repo, "status", status, "commit", commit)
-	s, _, err := c.Repositories.CreateStatus(context.Background(), repo, commit, status)
+	w.log.Infow("sendNotification", "repo", repo, "status", status, "commit", commit)
+	err = w.scmClient.CreateStatus(ctx, repo, commit, status)
 	if err != nil {
 		return fmt.Errorf("failed to create status: %w", err)
 	}
-
-	l.Infof("sendNotification status created: %#v\n", s)
 	return nil
 }
 
+// PipelineRuns that weren't triggered by a pull request are ignored.
+func (w *Watcher) sendPullRequestComment(ctx context.Context, pr *pipelinev1.PipelineRun) error {
+	number := findPullRequest(pr)
+	if number == 0 {
+		return nil
+	}
+	repo, err := parseRepoFromURL(findRepoURL(pr))
+	if err != nil {
+		return err
+	}
+	w.log.Infow("sendPullRequestComment", "repo", repo, "number", number)
+	return w.scmClient.CreateOrUpdateComment(ctx, repo, number, summaryMarker, pipelineRunSummary(pr, w.config.DashboardURL))
+}
+
 func findCommit(pr *pipelinev1.PipelineRun) string {
 	for _, tr := range pr.Status.TaskRuns {
 		for _, v := range tr.Status.ResourcesResult {
@@ -113,12 +350,25 @@ func findRepoURL(pr *pipelinev1.PipelineRun) string {
 	return pr.ObjectMeta.Annotations["tekton.dev/ci-source-url"]
 }
 
-func commitStatusInput(pr *pipelinev1.PipelineRun) *scm.StatusInput {
-	return &scm.StatusInput{
+// Returns 0 if the PipelineRun has no valid pull request annotation.
+func findPullRequest(pr *pipelinev1.PipelineRun) int {
+	n, err := strconv.Atoi(pr.ObjectMeta.Annotations[pullRequestAnnotation])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func commitStatusInput(pr *pipelinev1.PipelineRun, uiURL string) *scm.StatusInput {
+	s := &scm.StatusInput{
 		State: convertState(runState(pr)),
 		Label: tektonCILabel,
 		Desc:  "Tekton CI Status",
 	}
+	if uiURL != "" {
+		s.Target = ui.PipelineRunURL(uiURL, pr.ObjectMeta.Namespace, pr.ObjectMeta.Name)
+	}
+	return s
 }
 
 func parseRepoFromURL(s string) (string, error) {
@@ -3,25 +3,35 @@ package watcher
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/driver/fake"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	fakeclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	exporttrace "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"knative.dev/pkg/apis"
 
 	"github.com/gitops-tools/tekton-ci/pkg/dsl"
+	"github.com/gitops-tools/tekton-ci/pkg/git"
+	"github.com/gitops-tools/tekton-ci/pkg/metrics"
 	"github.com/gitops-tools/tekton-ci/pkg/resources"
+	"github.com/gitops-tools/tekton-ci/pkg/tracing"
 )
 
 const (
 	testSHA       = "9bb041d2f04027d96db99979c58531c3f6e39312"
 	testSourceURL = "https://github.com/bigkevmcd/tekton-ci.git"
+	testNS        = "testing"
 )
 
 func TestHandlePipelineRun(t *testing.T) {
@@ -34,7 +44,9 @@ func TestHandlePipelineRun(t *testing.T) {
 		taskResult())
 	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
 
-	err := handlePipelineRun(ctx, fakeSCM, fakeTektonClient, pr, logger.Sugar())
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{CommitStatuses: true}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -58,6 +70,37 @@ func TestHandlePipelineRun(t *testing.T) {
 	}
 }
 
+func TestHandlePipelineRunForAnotherHost(t *testing.T) {
+	ctx := context.TODO()
+	fakeSCM, data := fake.NewDefault()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	pr := makePipelineRun(
+		dsl.AnnotateSource("test-id",
+			&dsl.Source{RepoURL: testSourceURL, Ref: "master"}),
+		taskResult())
+	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
+
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{CommitStatuses: true, Host: "gitlab.com"}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(data.Statuses[testSHA]); l != 0 {
+		t.Fatalf("incorrect number of statuses notifified, got %d, want 0", l)
+	}
+	loaded, err := fakeTektonClient.TektonV1beta1().
+		PipelineRuns(pr.ObjectMeta.Namespace).
+		Get(ctx, pr.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := notificationState(loaded); s != "" {
+		t.Fatalf("post-handling last state got %s, want no state", s)
+	}
+}
+
 func TestHandlePipelineRunWithRepeatedState(t *testing.T) {
 	ctx := context.TODO()
 	fakeSCM, data := fake.NewDefault()
@@ -69,7 +112,9 @@ func TestHandlePipelineRunWithRepeatedState(t *testing.T) {
 	pr.ObjectMeta.Annotations[notificationStateAnnotation] = "Pending"
 	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
 
-	err := handlePipelineRun(ctx, fakeSCM, fakeTektonClient, pr, logger.Sugar())
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{CommitStatuses: true}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,7 +147,9 @@ func TestHandlePipelineRunWithNewState(t *testing.T) {
 	pr.ObjectMeta.Annotations[notificationStateAnnotation] = "Pending"
 	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
 
-	err := handlePipelineRun(ctx, fakeSCM, fakeTektonClient, pr, logger.Sugar())
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{CommitStatuses: true}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -122,6 +169,185 @@ func TestHandlePipelineRunWithNewState(t *testing.T) {
 	}
 }
 
+func TestHandlePipelineRunWithPullRequestComment(t *testing.T) {
+	ctx := context.TODO()
+	fakeSCM, data := fake.NewDefault()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	pr := makePipelineRun(
+		dsl.AnnotateSource("test-id",
+			&dsl.Source{RepoURL: testSourceURL, Ref: "master"}),
+		dsl.AnnotatePullRequest(2),
+		taskResult(),
+		statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue),
+	)
+	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{PullRequestComments: true}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(data.Statuses[testSHA]); l != 0 {
+		t.Fatalf("incorrect number of statuses notifified, got %d, want 0", l)
+	}
+	comments := data.PullRequestComments[2]
+	if l := len(comments); l != 1 {
+		t.Fatalf("incorrect number of comments, got %d, want 1", l)
+	}
+	if diff := cmp.Diff(pipelineRunSummary(pr, ""), comments[0].Body); diff != "" {
+		t.Fatalf("comment body incorrect:\n%s", diff)
+	}
+}
+
+func TestHandlePipelineRunWithPendingPullRequest(t *testing.T) {
+	ctx := context.TODO()
+	fakeSCM, data := fake.NewDefault()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	pr := makePipelineRun(
+		dsl.AnnotateSource("test-id",
+			&dsl.Source{RepoURL: testSourceURL, Ref: "master"}),
+		dsl.AnnotatePullRequest(2),
+		taskResult(),
+	)
+	fakeTektonClient := fakeclientset.NewSimpleClientset(pr)
+	w := New(git.New(fakeSCM, nil, metrics.NewMock()), fakeTektonClient, testNS, &Config{PullRequestComments: true}, metrics.NewMock(), logger.Sugar())
+
+	err := w.handlePipelineRun(ctx, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(data.PullRequestComments[2]); l != 0 {
+		t.Fatalf("incorrect number of comments, got %d, want 0", l)
+	}
+}
+
+func TestRecordPipelineRun(t *testing.T) {
+	m := metrics.NewMock()
+	w := New(nil, fakeclientset.NewSimpleClientset(), testNS, &Config{}, m, zaptest.NewLogger(t).Sugar())
+	running := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionUnknown))
+	running.ObjectMeta.Name = "running-run"
+	completed := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue))
+	completed.ObjectMeta.Name = "running-run"
+	start := metav1.NewTime(time.Now())
+	end := metav1.NewTime(start.Add(time.Minute))
+	completed.Status.StartTime = &start
+	completed.Status.CompletionTime = &end
+	alreadyCompleted := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionFalse))
+	alreadyCompleted.ObjectMeta.Name = "completed-run"
+
+	w.recordPipelineRun(watch.Added, running)
+	w.recordPipelineRun(watch.Added, alreadyCompleted)
+	if n := m.RunningPipelineRuns(""); n != 1 {
+		t.Fatalf("got %d running PipelineRuns, want 1", n)
+	}
+
+	w.recordPipelineRun(watch.Modified, completed)
+	w.recordPipelineRun(watch.Modified, completed)
+	w.recordPipelineRun(watch.Modified, alreadyCompleted)
+	if n := m.RunningPipelineRuns(""); n != 0 {
+		t.Fatalf("got %d running PipelineRuns, want 0", n)
+	}
+	if n := m.PipelineRuns("Successful"); n != 1 {
+		t.Fatalf("got %d successful PipelineRuns, want 1", n)
+	}
+	if n := m.PipelineRuns("Failed"); n != 0 {
+		t.Fatalf("got %d failed PipelineRuns, want 0", n)
+	}
+
+	w.recordPipelineRun(watch.Deleted, completed)
+	if l := len(w.runs); l != 1 {
+		t.Fatalf("got %d tracked PipelineRuns after deletion, want 1", l)
+	}
+}
+
+func TestRecordPipelineRunRecordsSpans(t *testing.T) {
+	tp, exporter := tracing.NewInMemory()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	ctx, hookSpan := tracing.Start(context.Background(), "webhook")
+	hookSpan.End()
+	start := time.Now()
+	pending := makePipelineRun(statusCondition(apis.ConditionSucceeded, corev1.ConditionUnknown))
+	pending.ObjectMeta.CreationTimestamp = metav1.Time{Time: start.Add(-time.Minute)}
+	tracing.Inject(ctx, pending.ObjectMeta.Annotations)
+	running := pending.DeepCopy()
+	running.Status.StartTime = &metav1.Time{Time: start}
+	taskCompleted := running.DeepCopy()
+	taskRuns(taskRun("first-task", start, time.Minute, corev1.ConditionFalse, "Failed"))(taskCompleted)
+	completed := taskCompleted.DeepCopy()
+	completed.Status.Conditions = nil
+	statusCondition(apis.ConditionSucceeded, corev1.ConditionFalse)(completed)
+	completed.Status.CompletionTime = &metav1.Time{Time: start.Add(time.Minute * 2)}
+	w := New(nil, fakeclientset.NewSimpleClientset(), testNS, &Config{}, metrics.NewMock(), zaptest.NewLogger(t).Sugar())
+
+	w.recordPipelineRun(watch.Added, pending)
+	w.recordPipelineRun(watch.Modified, running)
+	assertSpanNames(t, exporter.GetSpans(), "webhook", "pipelinerun_pending")
+	w.recordPipelineRun(watch.Modified, taskCompleted)
+	assertSpanNames(t, exporter.GetSpans(), "webhook", "pipelinerun_pending", "taskrun")
+	w.recordPipelineRun(watch.Modified, completed)
+	w.recordPipelineRun(watch.Modified, completed)
+
+	spans := exporter.GetSpans()
+	assertSpanNames(t, spans, "webhook", "pipelinerun_pending", "taskrun", "pipelinerun")
+	pendingSpan, taskSpan, runSpan := spans[1], spans[2], spans[3]
+	if pendingSpan.ParentSpanID != hookSpan.SpanContext().SpanID || pendingSpan.EndTime.Sub(pendingSpan.StartTime) != time.Minute {
+		t.Fatalf("got pending span with parent %s from %s to %s", pendingSpan.ParentSpanID, pendingSpan.StartTime, pendingSpan.EndTime)
+	}
+	if runSpan.ParentSpanID != hookSpan.SpanContext().SpanID {
+		t.Fatalf("got pipelinerun span with parent %s, want %s", runSpan.ParentSpanID, hookSpan.SpanContext().SpanID)
+	}
+	if runSpan.StatusCode != codes.Error || runSpan.EndTime.Sub(runSpan.StartTime) != time.Minute*2 {
+		t.Fatalf("got pipelinerun span with status %v from %s to %s", runSpan.StatusCode, runSpan.StartTime, runSpan.EndTime)
+	}
+	if taskSpan.ParentSpanID != runSpan.SpanContext.SpanID {
+		t.Fatalf("got taskrun span with parent %s, want %s", taskSpan.ParentSpanID, runSpan.SpanContext.SpanID)
+	}
+}
+
+func TestRecordPipelineRunDoesNotRetraceListedRuns(t *testing.T) {
+	tp, exporter := tracing.NewInMemory()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	start := time.Now()
+	running := makePipelineRun(
+		statusCondition(apis.ConditionSucceeded, corev1.ConditionUnknown),
+		taskRuns(taskRun("first-task", start, time.Minute, corev1.ConditionTrue, "Succeeded")))
+	running.Status.StartTime = &metav1.Time{Time: start}
+	completed := running.DeepCopy()
+	completed.Status.Conditions = nil
+	statusCondition(apis.ConditionSucceeded, corev1.ConditionTrue)(completed)
+	completed.Status.CompletionTime = &metav1.Time{Time: start.Add(time.Minute * 2)}
+	w := New(nil, fakeclientset.NewSimpleClientset(), testNS, &Config{}, metrics.NewMock(), zaptest.NewLogger(t).Sugar())
+
+	w.recordPipelineRun(watch.Added, running)
+	w.recordPipelineRun(watch.Modified, completed)
+
+	assertSpanNames(t, exporter.GetSpans(), "pipelinerun")
+}
+
+func assertSpanNames(t *testing.T, spans []*exporttrace.SpanData, want ...string) {
+	t.Helper()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("spans incorrect:\n%s", diff)
+	}
+}
+
+func TestFindPullRequest(t *testing.T) {
+	if n := findPullRequest(makePipelineRun(dsl.AnnotatePullRequest(5))); n != 5 {
+		t.Fatalf("findPullRequest() got %d, want 5", n)
+	}
+	if n := findPullRequest(makePipelineRun()); n != 0 {
+		t.Fatalf("findPullRequest() got %d, want 0", n)
+	}
+}
+
 func TestFindCommit(t *testing.T) {
 	pr := makePipelineRun(taskResult())
 
@@ -168,13 +394,25 @@ func TestCommitStatusInput(t *testing.T) {
 	}
 	pr := makePipelineRun()
 
-	cs := commitStatusInput(pr)
+	cs := commitStatusInput(pr, "")
 
 	if diff := cmp.Diff(want, cs); diff != "" {
 		t.Fatalf("commitStatusInput failed:\n%s", diff)
 	}
 }
 
+func TestCommitStatusInputWithUIURL(t *testing.T) {
+	pr := makePipelineRun()
+	pr.ObjectMeta.Name = "my-pipeline-run-abcde"
+	pr.ObjectMeta.Namespace = testNS
+
+	cs := commitStatusInput(pr, "https://ci.example.com")
+
+	if cs.Target != "https://ci.example.com/ui/pipelineruns/testing/my-pipeline-run-abcde" {
+		t.Fatalf("got target %q", cs.Target)
+	}
+}
+
 func TestParseRepoFromURL(t *testing.T) {
 	r, err := parseRepoFromURL(testSourceURL)
 	if err != nil {